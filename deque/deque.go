@@ -0,0 +1,666 @@
+// Package deque implements a persistent double-ended queue.
+//
+// A deque is a vector holding most of its elements and a short buffer
+// of the elements pushed onto its front. The front is pushed to and
+// popped from the buffer much as the back is pushed to and popped
+// from the tail of the vector. A full buffer is concatenated onto the
+// front of the vector as a leaf and an empty one is refilled by
+// splitting a leaf off of it, so the ends are changed in O(1)
+// amortized time and elements are retrieved by index in O(log n) time.
+package deque // import "jsouthworth.net/go/immutable/deque"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/vector"
+	"jsouthworth.net/go/seq"
+)
+
+var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
+var errReduceSig = errors.New("Reduce requires a function: func(init iT, v vT) oT")
+var errOutOfBounds = errors.New("out of bounds")
+var errTafterP = errors.New("transient used after persistent call")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty deque")
+
+// chunk is the most elements held in the front buffer, the number of
+// elements in a leaf of the vector.
+const chunk = 32
+
+// Deque is a persistent double-ended queue.
+type Deque struct {
+	// front holds the elements before those of rest in reverse
+	// order, so that its last element is the first of the deque.
+	front []interface{}
+	rest  *vector.Vector
+}
+
+var empty = Deque{
+	rest: vector.Empty(),
+}
+
+// Empty returns the empty deque.
+func Empty() *Deque {
+	return &empty
+}
+
+// New returns a deque holding elems, the first of them at the front.
+func New(elems ...interface{}) *Deque {
+	return From(vector.New(elems...))
+}
+
+// From will convert many go types to a deque.
+//
+// *Deque:
+//    Used directly as it is already immutable.
+// *TDeque:
+//    AsPersistent is called on the value and the result used for the deque.
+// Other:
+//    The value is converted to a vector with vector.From, which
+//    accepts vectors, slices, seq.Seqable and seq.Sequence, and
+//    the vector is used for the deque, its first element at the
+//    front.
+func From(value interface{}) *Deque {
+	switch v := value.(type) {
+	case *Deque:
+		return v
+	case *TDeque:
+		return v.AsPersistent()
+	default:
+		vec := vector.From(value)
+		if vec.Length() == 0 {
+			return Empty()
+		}
+		return &Deque{
+			rest: vec,
+		}
+	}
+}
+
+// PushFront returns a deque with the element added to the front.
+func (d *Deque) PushFront(elem interface{}) *Deque {
+	front, rest := d.front, d.rest
+	if len(front) == chunk {
+		rest = vector.New(reversed(front)...).Concat(rest)
+		front = nil
+	}
+	out := make([]interface{}, len(front)+1)
+	copy(out, front)
+	out[len(front)] = elem
+	return &Deque{
+		front: out,
+		rest:  rest,
+	}
+}
+
+// PushBack returns a deque with the element added to the back.
+func (d *Deque) PushBack(elem interface{}) *Deque {
+	return &Deque{
+		front: d.front,
+		rest:  d.rest.Append(elem),
+	}
+}
+
+// Conj returns a deque with the element added to the back.
+// Conj implements a generic mechanism for building collections.
+func (d *Deque) Conj(elem interface{}) interface{} {
+	return d.PushBack(elem)
+}
+
+// PopFront returns a deque without the element at the front.
+func (d *Deque) PopFront() *Deque {
+	if d.Length() <= 1 {
+		return Empty()
+	}
+	front, rest := d.front, d.rest
+	if len(front) == 0 {
+		front, rest = splitFront(rest)
+	}
+	// The buffer is copied rather than resliced so that it doesn't
+	// keep the popped element reachable.
+	out := make([]interface{}, len(front)-1)
+	copy(out, front)
+	return &Deque{
+		front: out,
+		rest:  rest,
+	}
+}
+
+// PopBack returns a deque without the element at the back.
+func (d *Deque) PopBack() *Deque {
+	switch {
+	case d.Length() <= 1:
+		return Empty()
+	case d.rest.Length() == 0:
+		out := make([]interface{}, len(d.front)-1)
+		copy(out, d.front[1:])
+		return &Deque{
+			front: out,
+			rest:  d.rest,
+		}
+	default:
+		return &Deque{
+			front: d.front,
+			rest:  d.rest.Pop(),
+		}
+	}
+}
+
+// PeekFront returns the element at the front of the deque or nil if
+// it is empty.
+func (d *Deque) PeekFront() interface{} {
+	switch {
+	case len(d.front) > 0:
+		return d.front[len(d.front)-1]
+	case d.rest.Length() > 0:
+		return d.rest.At(0)
+	default:
+		return nil
+	}
+}
+
+// PeekBack returns the element at the back of the deque or nil if it
+// is empty.
+func (d *Deque) PeekBack() interface{} {
+	switch {
+	case d.rest.Length() > 0:
+		return d.rest.At(d.rest.Length() - 1)
+	case len(d.front) > 0:
+		return d.front[0]
+	default:
+		return nil
+	}
+}
+
+// At returns the element i elements from the front of the deque. At
+// will panic if i is out of bounds.
+func (d *Deque) At(i int) interface{} {
+	return at(d.front, d.rest.Length(), d.rest.At, i)
+}
+
+// Find returns the element at index idx, an int, and whether there is
+// one.
+func (d *Deque) Find(idx interface{}) (interface{}, bool) {
+	i, ok := idx.(int)
+	if !ok || i < 0 || i >= d.Length() {
+		return nil, false
+	}
+	return d.At(i), true
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument. Apply allows deque to be called
+// as a function by the 'dyn' library.
+func (d *Deque) Apply(args ...interface{}) interface{} {
+	return d.At(args[0].(int))
+}
+
+// Length returns the number of elements in the deque.
+func (d *Deque) Length() int {
+	return len(d.front) + d.rest.Length()
+}
+
+// AsTransient will return a mutable copy on write version of the deque.
+func (d *Deque) AsTransient() *TDeque {
+	front := make([]interface{}, len(d.front), chunk)
+	copy(front, d.front)
+	return &TDeque{
+		front: front,
+		rest:  d.rest.AsTransient(),
+	}
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent deque. It does this by making a transient
+// deque and calling each action on it, then converting it back
+// to a persistent deque.
+func (d *Deque) Transform(actions ...func(*TDeque) *TDeque) *Deque {
+	out := d.AsTransient()
+	for _, action := range actions {
+		out = action(out)
+	}
+	return out.AsPersistent()
+}
+
+// Range calls the passed in function on each element of the deque,
+// front first. The function passed in may be of many types:
+//
+// func(value interface{}) bool:
+//    Takes a value of any type and returns if the loop should continue.
+//    Useful to avoid reflection where not needed and to support
+//    heterogenous deques.
+// func(value interface{})
+//    Takes a value of any type.
+//    Useful to avoid reflection where not needed and to support
+//    heterogenous deques.
+// func(value T) bool:
+//    Takes a value of the type of element stored in the deque and
+//    returns if the loop should continue. Useful for homogeneous deques.
+//    Is called with reflection and will panic if the type is incorrect.
+// func(value T)
+//    Takes a value of the type of element stored in the deque and
+//    returns if the loop should continue. Useful for homogeneous deques.
+//    Is called with reflection and will panic if the type is incorrect.
+// Range will panic if passed anything that doesn't match one of these signatures
+func (d *Deque) Range(do interface{}) {
+	// NOTE: Update other functions using the same pattern
+	//       when modifying the below.
+	//       This code is inlined to avoid heap allocation of
+	//       the closure.
+	var f func(value interface{}) bool
+	switch fn := do.(type) {
+	case func(value interface{}) bool:
+		f = fn
+	case func(value interface{}):
+		f = func(value interface{}) bool {
+			fn(value)
+			return true
+		}
+	default:
+		f = genRangeFunc(do)
+	}
+	rangeDeque(d.front, d.rest.Length(), d.rest.At, f)
+}
+
+// rangeDeque calls f with the elements of the front buffer front and
+// then of the vector of a deque, which has n elements retrieved by
+// at, until f returns false.
+func rangeDeque(front []interface{}, n int, at func(int) interface{}, f func(value interface{}) bool) {
+	cont := true
+	for i := len(front) - 1; i >= 0 && cont; i-- {
+		cont = f(front[i])
+	}
+	for i := 0; i < n && cont; i++ {
+		cont = f(at(i))
+	}
+}
+
+func genRangeFunc(do interface{}) func(value interface{}) bool {
+	rv := reflect.ValueOf(do)
+	if rv.Kind() != reflect.Func {
+		panic(errRangeSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 1 || rt.NumOut() > 1 {
+		panic(errRangeSig)
+	}
+	if rt.NumOut() == 1 &&
+		rt.Out(0).Kind() != reflect.Bool {
+		panic(errRangeSig)
+	}
+	return func(value interface{}) bool {
+		out := dyn.Apply(do, value)
+		if out != nil {
+			return out.(bool)
+		}
+		return true
+	}
+}
+
+// Reduce is a fast mechanism for reducing a Deque, front first.
+// Reduce can take the following types as the fn:
+//
+// func(init interface{}, value interface{}) interface{}
+// func(init iT, v vT) oT
+//
+// Reduce will panic if given any other function type.
+func (d *Deque) Reduce(fn interface{}, init interface{}) interface{} {
+	return reduceDeque(d.front, d.rest.Length(), d.rest.At, fn, init)
+}
+
+func reduceDeque(front []interface{}, n int, at func(int) interface{}, fn interface{}, init interface{}) interface{} {
+	var rFn func(r, v interface{}) interface{}
+	switch f := fn.(type) {
+	case func(res, val interface{}) interface{}:
+		rFn = f
+	default:
+		rFn = genReduceFunc(fn)
+	}
+	res := init
+	rangeDeque(front, n, at, func(value interface{}) bool {
+		res = rFn(res, value)
+		return true
+	})
+	return res
+}
+
+func genReduceFunc(fn interface{}) func(r, v interface{}) interface{} {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		panic(errReduceSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 2 {
+		panic(errReduceSig)
+	}
+	if rt.NumOut() != 1 {
+		panic(errReduceSig)
+	}
+	return func(r, v interface{}) interface{} {
+		return dyn.Apply(fn, r, v)
+	}
+}
+
+// Seq returns a representation of the deque as a sequence
+// corresponding to the elements of the deque, front first.
+func (d *Deque) Seq() seq.Sequence {
+	if d.Length() == 0 {
+		return nil
+	}
+	return &dequeSeq{
+		deque: d,
+	}
+}
+
+// String returns a representation of the deque as a string.
+func (d *Deque) String() string {
+	b := new(strings.Builder)
+	fmt.Fprint(b, "[ ")
+	d.Range(func(item interface{}) {
+		fmt.Fprintf(b, "%v ", item)
+	})
+	fmt.Fprint(b, "]")
+	return b.String()
+}
+
+// MarshalJSON implements json.Marshaler encoding the deque as a JSON
+// array with the front of the deque first.
+func (d *Deque) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, d.Length())
+	d.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array,
+// front of the deque first, into the deque. The deque returned by
+// Empty is shared and may not be decoded into.
+func (d *Deque) UnmarshalJSON(data []byte) error {
+	if d == &empty {
+		return errUnmarshalEmpty
+	}
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*d = *New(elems...)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format with the front of the deque first. Elements are encoded with
+// gob unless they implement encoding.BinaryMarshaler, so their
+// concrete types must be registered with gob.Register.
+func (d *Deque) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.Deque, d.Length(),
+		func(fn func(interface{}) bool) {
+			d.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. The deque returned by Empty is
+// shared and may not be decoded into.
+func (d *Deque) UnmarshalBinary(data []byte) error {
+	if d == &empty {
+		return errUnmarshalEmpty
+	}
+	out := Empty().AsTransient()
+	err := binenc.UnmarshalSeq(data, binenc.Deque, func(elem interface{}) {
+		out.PushBack(elem)
+	})
+	if err != nil {
+		return err
+	}
+	*d = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (d *Deque) GobEncode() ([]byte, error) {
+	return d.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (d *Deque) GobDecode(data []byte) error {
+	return d.UnmarshalBinary(data)
+}
+
+// Equal returns whether the other value passed in is a deque and the
+// values of that deque are equal to its values.
+func (d *Deque) Equal(other interface{}) bool {
+	od, isDeque := other.(*Deque)
+	if !isDeque || d.Length() != od.Length() {
+		return false
+	}
+	for a, b := d.Seq(), od.Seq(); a != nil; a, b = a.Next(), b.Next() {
+		if !dyn.Equal(a.First(), b.First()) {
+			return false
+		}
+	}
+	return true
+}
+
+type dequeSeq struct {
+	deque *Deque
+}
+
+func (s *dequeSeq) First() interface{} {
+	return s.deque.PeekFront()
+}
+
+func (s *dequeSeq) Next() seq.Sequence {
+	return s.deque.PopFront().Seq()
+}
+
+func (s *dequeSeq) String() string {
+	return seq.ConvertToString(s)
+}
+
+// TDeque is a transient double-ended queue. Pushing and popping
+// change the transient in place rather than returning new deques.
+// The changes become immutable when AsPersistent is called.
+type TDeque struct {
+	front []interface{}
+	rest  *vector.TVector
+	done  bool
+}
+
+// PushFront adds the element to the front of the deque. d is returned.
+func (d *TDeque) PushFront(elem interface{}) *TDeque {
+	d.ensureEditable()
+	if len(d.front) == chunk {
+		rest := vector.New(reversed(d.front)...).
+			Concat(d.rest.AsPersistent())
+		d.front, d.rest = d.front[:0], rest.AsTransient()
+	}
+	d.front = append(d.front, elem)
+	return d
+}
+
+// PushBack adds the element to the back of the deque. d is returned.
+func (d *TDeque) PushBack(elem interface{}) *TDeque {
+	d.ensureEditable()
+	d.rest.Append(elem)
+	return d
+}
+
+// Conj adds the element to the back of the deque. Conj implements a
+// generic mechanism for building collections.
+func (d *TDeque) Conj(elem interface{}) interface{} {
+	return d.PushBack(elem)
+}
+
+// PopFront removes the element at the front of the deque. d is
+// returned.
+func (d *TDeque) PopFront() *TDeque {
+	d.ensureEditable()
+	if d.Length() == 0 {
+		return d
+	}
+	if len(d.front) == 0 {
+		front, rest := splitFront(d.rest.AsPersistent())
+		d.front = append(d.front, front...)
+		d.rest = rest.AsTransient()
+	}
+	d.front[len(d.front)-1] = nil
+	d.front = d.front[:len(d.front)-1]
+	return d
+}
+
+// PopBack removes the element at the back of the deque. d is returned.
+func (d *TDeque) PopBack() *TDeque {
+	d.ensureEditable()
+	switch {
+	case d.Length() == 0:
+	case d.rest.Length() == 0:
+		n := copy(d.front, d.front[1:])
+		d.front[n] = nil
+		d.front = d.front[:n]
+	default:
+		d.rest.Pop()
+	}
+	return d
+}
+
+// PeekFront returns the element at the front of the deque or nil if
+// it is empty.
+func (d *TDeque) PeekFront() interface{} {
+	d.ensureEditable()
+	switch {
+	case len(d.front) > 0:
+		return d.front[len(d.front)-1]
+	case d.rest.Length() > 0:
+		return d.rest.At(0)
+	default:
+		return nil
+	}
+}
+
+// PeekBack returns the element at the back of the deque or nil if it
+// is empty.
+func (d *TDeque) PeekBack() interface{} {
+	d.ensureEditable()
+	switch {
+	case d.rest.Length() > 0:
+		return d.rest.At(d.rest.Length() - 1)
+	case len(d.front) > 0:
+		return d.front[0]
+	default:
+		return nil
+	}
+}
+
+// At returns the element i elements from the front of the deque. At
+// will panic if i is out of bounds.
+func (d *TDeque) At(i int) interface{} {
+	d.ensureEditable()
+	return at(d.front, d.rest.Length(), d.rest.At, i)
+}
+
+// Length returns the number of elements in the deque.
+func (d *TDeque) Length() int {
+	return len(d.front) + d.rest.Length()
+}
+
+// AsPersistent returns an immutable version of the deque. Any
+// transient operations performed after this will cause a panic.
+func (d *TDeque) AsPersistent() *Deque {
+	d.ensureEditable()
+	d.done = true
+	rest := d.rest.AsPersistent()
+	if d.Length() == 0 {
+		return Empty()
+	}
+	return &Deque{
+		front: d.front,
+		rest:  rest,
+	}
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (d *TDeque) MakePersistent() interface{} {
+	return d.AsPersistent()
+}
+
+// Range calls the passed in function on each element of the deque,
+// front first. It accepts the same functions as Deque.Range.
+func (d *TDeque) Range(do interface{}) {
+	// NOTE: Update other functions using the same pattern
+	//       when modifying the below.
+	//       This code is inlined to avoid heap allocation of
+	//       the closure.
+	d.ensureEditable()
+	var f func(value interface{}) bool
+	switch fn := do.(type) {
+	case func(value interface{}) bool:
+		f = fn
+	case func(value interface{}):
+		f = func(value interface{}) bool {
+			fn(value)
+			return true
+		}
+	default:
+		f = genRangeFunc(do)
+	}
+	rangeDeque(d.front, d.rest.Length(), d.rest.At, f)
+}
+
+// Reduce is a fast mechanism for reducing a TDeque. It accepts the
+// same functions as Deque.Reduce.
+func (d *TDeque) Reduce(fn interface{}, init interface{}) interface{} {
+	d.ensureEditable()
+	return reduceDeque(d.front, d.rest.Length(), d.rest.At, fn, init)
+}
+
+// String returns a representation of the deque as a string.
+func (d *TDeque) String() string {
+	b := new(strings.Builder)
+	fmt.Fprint(b, "[ ")
+	d.Range(func(item interface{}) {
+		fmt.Fprintf(b, "%v ", item)
+	})
+	fmt.Fprint(b, "]")
+	return b.String()
+}
+
+func (d *TDeque) ensureEditable() {
+	if d.done {
+		panic(errTafterP)
+	}
+}
+
+// at returns element i of a deque with the front buffer front and a
+// vector of n elements retrieved by vat.
+func at(front []interface{}, n int, vat func(int) interface{}, i int) interface{} {
+	switch {
+	case i < 0 || i >= len(front)+n:
+		panic(errOutOfBounds)
+	case i < len(front):
+		return front[len(front)-1-i]
+	default:
+		return vat(i - len(front))
+	}
+}
+
+// splitFront splits the first leaf's worth of elements off of the
+// non-empty vector v, returning them as a front buffer and the rest
+// of v.
+func splitFront(v *vector.Vector) ([]interface{}, *vector.Vector) {
+	first, rest := v.SplitAt(min(chunk, v.Length()))
+	return reversed(first.AsNative()), rest
+}
+
+func reversed(elems []interface{}) []interface{} {
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		out[len(elems)-1-i] = elem
+	}
+	return out
+}
@@ -0,0 +1,397 @@
+package deque
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/vector"
+	"jsouthworth.net/go/seq"
+)
+
+// apply performs op, numbered by i, on the persistent deque d, the
+// transient deque t and the slice model.
+func apply(op, i int, d *Deque, t *TDeque, model []interface{}) (*Deque, []interface{}) {
+	switch op % 5 {
+	case 0:
+		d = d.PushFront(i)
+		t.PushFront(i)
+		model = append([]interface{}{i}, model...)
+	case 1:
+		d = d.PushBack(i)
+		t.PushBack(i)
+		model = append(model, i)
+	case 2:
+		d = d.PopFront()
+		t.PopFront()
+		if len(model) > 0 {
+			model = model[1:]
+		}
+	case 3:
+		d = d.PopBack()
+		t.PopBack()
+		if len(model) > 0 {
+			model = model[:len(model)-1]
+		}
+	default:
+		// Runs of pushes to one end cross the front buffer's limit.
+		for j := 0; j < 40; j++ {
+			if op%2 == 0 {
+				d = d.PushFront(j)
+				t.PushFront(j)
+				model = append([]interface{}{j}, model...)
+			} else {
+				d = d.PushBack(j)
+				t.PushBack(j)
+				model = append(model, j)
+			}
+		}
+	}
+	return d, model
+}
+
+func matches(d interface {
+	Length() int
+	At(int) interface{}
+	PeekFront() interface{}
+	PeekBack() interface{}
+	Range(interface{})
+}, model []interface{}) bool {
+	if d.Length() != len(model) {
+		return false
+	}
+	for i, elem := range model {
+		if d.At(i) != elem {
+			return false
+		}
+	}
+	var got []interface{}
+	d.Range(func(elem interface{}) {
+		got = append(got, elem)
+	})
+	if len(got) != len(model) {
+		return false
+	}
+	for i := range got {
+		if got[i] != model[i] {
+			return false
+		}
+	}
+	if len(model) == 0 {
+		return d.PeekFront() == nil && d.PeekBack() == nil
+	}
+	return d.PeekFront() == model[0] &&
+		d.PeekBack() == model[len(model)-1]
+}
+
+func TestDequeModel(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("persistent and transient match a slice",
+		prop.ForAll(
+			func(ops []int) bool {
+				d := Empty()
+				tr := Empty().AsTransient()
+				var model []interface{}
+				for i, op := range ops {
+					prev, prevModel := d, append([]interface{}(nil), model...)
+					d, model = apply(op, i, d, tr, model)
+					if !matches(d, model) || !matches(tr, model) {
+						return false
+					}
+					// The previous version is unchanged.
+					if !matches(prev, prevModel) {
+						return false
+					}
+				}
+				return tr.AsPersistent().Equal(d)
+			},
+			gen.SliceOf(gen.IntRange(0, 100)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestPopReleasesElements(t *testing.T) {
+	d := Empty().PushFront(1).PushFront(2).PushFront(3)
+	// The buffer of a popped deque doesn't share the array holding
+	// the popped element.
+	if f := d.PopFront().front; len(f) != 2 || cap(f) != len(f) {
+		t.Fatalf("PopFront kept a buffer of capacity %d", cap(f))
+	}
+	if f := d.PopBack().front; len(f) != 2 || &f[0] == &d.front[1] {
+		t.Fatal("PopBack shared the buffer")
+	}
+	split := New(1, 2, 3, 4, 5).PopFront()
+	if f := split.front; len(f) != 4 || cap(f) != len(f) {
+		t.Fatalf("PopFront kept a buffer of capacity %d", cap(f))
+	}
+}
+
+func TestDequeFrom(t *testing.T) {
+	t.Run("*Deque", func(t *testing.T) {
+		d := New(1, 2, 3)
+		if From(d) != d {
+			t.Fatal("from didn't return the same deque")
+		}
+	})
+	t.Run("*TDeque", func(t *testing.T) {
+		d := From(New(1, 2, 3).AsTransient().PushFront(0))
+		if !d.Equal(New(0, 1, 2, 3)) {
+			t.Fatal("didn't get expected deque", d)
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		if From(nil) != Empty() {
+			t.Fatal("didn't get expected deque")
+		}
+	})
+	t.Run("[]int", func(t *testing.T) {
+		d := From([]int{1, 2, 3})
+		if d.PeekFront() != 1 || d.PeekBack() != 3 {
+			t.Fatal("from didn't create the right deque", d)
+		}
+	})
+	t.Run("Seqable", func(t *testing.T) {
+		d := From(vector.New(1, 2, 3))
+		if !d.Equal(New(1, 2, 3)) {
+			t.Fatal("from didn't create the right deque", d)
+		}
+	})
+}
+
+func TestDequeAt(t *testing.T) {
+	d := New(2, 3).PushFront(1).PushFront(0)
+	for i := 0; i < 4; i++ {
+		if d.At(i) != i {
+			t.Fatal("didn't get expected element", i, d.At(i))
+		}
+		if v, ok := d.Find(i); !ok || v != i {
+			t.Fatal("didn't find expected element", i, v)
+		}
+		if dyn.Apply(d, i) != i {
+			t.Fatal("apply didn't return expected element", i)
+		}
+	}
+	if _, ok := d.Find(4); ok {
+		t.Fatal("found an element out of bounds")
+	}
+	defer func() {
+		if r := recover(); r != errOutOfBounds {
+			t.Fatal("expected panic", r)
+		}
+	}()
+	d.At(4)
+}
+
+func TestDequeSeq(t *testing.T) {
+	d := New(1, 2, 3).PushFront(0)
+	i := 0
+	for s := seq.Seq(d); s != nil; s = s.Next() {
+		if s.First() != i {
+			t.Fatal("didn't get expected element", i, s.First())
+		}
+		i++
+	}
+	if i != 4 {
+		t.Fatal("sequence had the wrong length", i)
+	}
+	if Empty().Seq() != nil {
+		t.Fatal("the empty deque should have no sequence")
+	}
+}
+
+func TestDequeEqual(t *testing.T) {
+	d := New(1, 2, 3)
+	d2 := New(2, 3).PushFront(1)
+	if !dyn.Equal(d, d2) {
+		t.Fatal("the deques should have been equal")
+	}
+	if dyn.Equal(d, New(3, 2, 1)) {
+		t.Fatal("the deques should not have been equal")
+	}
+	if d.Equal(vector.New(1, 2, 3)) {
+		t.Fatal("a deque should not equal a vector")
+	}
+}
+
+func TestRange(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Range func(interface{}) bool",
+		prop.ForAll(
+			func(a int) bool {
+				expected := a
+				l := Empty().PushBack(a).PushFront(a)
+				var got int
+				l.Range(func(i interface{}) bool {
+					got += i.(int)
+					return false
+				})
+				return got == expected
+			},
+			gen.Int(),
+		))
+	properties.Property("Range func(T)",
+		prop.ForAll(
+			func(a int) bool {
+				expected := a + a
+				l := Empty().PushBack(a).PushFront(a)
+				var got int
+				l.Range(func(i int) {
+					got += i
+				})
+				return got == expected
+			},
+			gen.Int(),
+		))
+	properties.Property("Range func(T) bool",
+		prop.ForAll(
+			func(a int) bool {
+				expected := a
+				l := Empty().PushBack(a).PushFront(a).AsTransient()
+				var got int
+				l.Range(func(i int) bool {
+					got += i
+					return false
+				})
+				return got == expected
+			},
+			gen.Int(),
+		))
+	properties.Property("Range bad func panics",
+		prop.ForAll(
+			func(a int) (ok bool) {
+				defer func() {
+					r := recover()
+					ok = r == errRangeSig
+				}()
+				Empty().PushBack(a).Range(func(a, b int) {})
+				return false
+			},
+			gen.Int(),
+		))
+	properties.TestingRun(t)
+}
+
+func TestDequeReduce(t *testing.T) {
+	d := New(2, 3, 4, 5).PushFront(1)
+	out := d.Reduce(func(res, val int) int {
+		return res*10 + val
+	}, 0)
+	if out != 12345 {
+		t.Fatal("didn't get expected value", out)
+	}
+	out = d.AsTransient().Reduce(func(res, val interface{}) interface{} {
+		return res.(int)*10 + val.(int)
+	}, 0)
+	if out != 12345 {
+		t.Fatal("didn't get expected value", out)
+	}
+}
+
+func TestTDeque(t *testing.T) {
+	t.Run("original unchanged", func(t *testing.T) {
+		d := New(1, 2, 3)
+		td := d.AsTransient().PopFront().PushFront(0).PopBack().PushBack(4)
+		if !d.Equal(New(1, 2, 3)) {
+			t.Fatal("transient changed the original deque", d)
+		}
+		if td.String() != "[ 0 2 4 ]" {
+			t.Fatal("didn't get expected deque", td)
+		}
+	})
+	t.Run("Transform", func(t *testing.T) {
+		d := Empty().Transform(func(td *TDeque) *TDeque {
+			for i := 0; i < 100; i++ {
+				td.PushFront(i)
+			}
+			return td.PopBack()
+		})
+		if d.Length() != 99 || d.PeekFront() != 99 || d.PeekBack() != 1 {
+			t.Fatal("didn't get expected deque", d)
+		}
+	})
+	t.Run("after persistent", func(t *testing.T) {
+		td := Empty().AsTransient()
+		td.AsPersistent()
+		defer func() {
+			if r := recover(); r != errTafterP {
+				t.Fatal("expected panic", r)
+			}
+		}()
+		td.PushFront(1)
+	})
+}
+
+func TestJSON(t *testing.T) {
+	d := New(2.0, 3.0).PushFront(1.0).PopFront()
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[2,3]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Deque
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(d) {
+		t.Fatalf("expected %v, got %v", d, &got)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Deque
+	}
+	in := snapshot{Value: New("two", nil, 4.5).PushFront(1)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Deque).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	if err := Empty().UnmarshalBinary(data); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func ExampleDeque_PushFront() {
+	d := New(2, 3).PushFront(1).PushBack(4)
+	fmt.Println(d)
+	// Output: [ 1 2 3 4 ]
+}
+
+func ExampleDeque_PopBack() {
+	d := New(1, 2, 3).PopBack().PopFront()
+	fmt.Println(d)
+	// Output: [ 2 ]
+}
+
+func ExampleDeque_At() {
+	d := New(1, 2, 3).PushFront(0)
+	fmt.Println(d.At(0), d.At(3))
+	// Output: 0 3
+}
@@ -2,289 +2,383 @@ package hashmap
 
 import (
 	"math/bits"
+	"sync/atomic"
 
-	"jsouthworth.net/go/dyn"
-	"jsouthworth.net/go/hash"
 	"jsouthworth.net/go/seq"
 )
 
-const bitmapCap = width / 2
-
-func emptySeededBitmapNode(seed uintptr) *bitmapIndexedNode {
-	return &bitmapIndexedNode{
+func emptySeededBitmapNode[K comparable, V any](h *hasher[K, V]) *bitmapIndexedNode[K, V] {
+	return &bitmapIndexedNode[K, V]{
 		edit: zero,
-		seed: seed,
+		h:    h,
 	}
 }
 
-type bitmapIndexedNode struct {
-	bitmap uint32
-	seed   uintptr
-	array  entries
-	edit   *uint32
-}
-
-func (n *bitmapIndexedNode) assoc(
-	edit *uint32,
-	shift uint,
-	hash uintptr,
-	k, v interface{},
-) (node, bool) {
-	if n.entryExists(hash, shift) {
-		return n.assocExisting(edit, shift, hash, k, v)
-	}
-	return n.assocNew(edit, shift, hash, k, v), true
+// bitmapIndexedNode is a node of the trie in the CHAMP layout. Each of
+// the width positions of a node holds nothing, an entry or a sub-node.
+// dataMap marks the positions holding an entry and nodeMap those
+// holding a sub-node. The entries and the sub-nodes are each kept
+// contiguously in the order of their positions.
+//
+// The trie is kept in a canonical form. A sub-node never holds just a
+// single entry, the entry is stored in its parent instead, and a
+// collision node is stored at the shallowest position no other key
+// shares. Tries built with the same hash from the same entries have
+// the same shape whatever the order of the changes that built them.
+type bitmapIndexedNode[K comparable, V any] struct {
+	dataMap uint32
+	nodeMap uint32
+	h       *hasher[K, V]
+	entries []entryOf[K, V]
+	nodes   []node[K, V]
+	edit    *uint32
 }
 
-func (n *bitmapIndexedNode) assocNew(
+func (n *bitmapIndexedNode[K, V]) assoc(
 	edit *uint32,
 	shift uint,
 	hash uintptr,
-	k, v interface{},
-) node {
-	switch {
-	case n.isFull():
-		idx := mask(hash, shift)
-		child, _ := emptySeededBitmapNode(n.seed).
-			assoc(edit, shift+shiftBits, hash, k, v)
-		return n.unpack(edit, shift, idx, child)
-	default:
-		return n.addNewEntry(edit, hash, shift, k, v)
-	}
-}
-
-func (n *bitmapIndexedNode) assocExisting(
-	edit *uint32,
-	shift uint,
-	hashval uintptr,
-	k, v interface{},
-) (node, bool) {
-	bit := bitpos(hashval, shift)
-	idx := n.index(bit)
-	e := n.array[idx]
+	k K, v V,
+) (node[K, V], bool) {
+	bit := bitpos(hash, shift)
 	switch {
-	case !e.isLeaf():
-		// Non-leaf node
+	case n.dataMap&bit != 0:
+		idx := index(n.dataMap, bit)
+		e := n.entries[idx]
+		if e.hash == hash && n.h.keyEqual(k, e.k) {
+			// A key replacement
+			if n.h.valueEqual(v, e.v) {
+				return n, false
+			}
+			editable := n.ensureEditable(edit, true, false)
+			editable.entries[idx].v = v
+			return editable, false
+		}
+		// Push both entries into a new sub-node
+		child := mergeEntries(edit, n.h, shift+shiftBits,
+			e, entryOf[K, V]{k: k, v: v, hash: hash})
+		editable := n.ensureEditable(edit, true, false)
+		editable.entries = removeAt(editable.entries, idx)
+		editable.dataMap &^= bit
+		editable.nodes = insertAt(editable.nodes,
+			index(editable.nodeMap, bit), child)
+		editable.nodeMap |= bit
+		// Only a root can be left holding just a collision node.
+		return editable.compact(), true
+	case n.nodeMap&bit != 0:
 		// Walk down the tree
-		new, added := e.v.(node).
-			assoc(edit, shift+shiftBits, hashval, k, v)
-		if new == e.v {
+		idx := index(n.nodeMap, bit)
+		child := n.nodes[idx]
+		new, added := child.assoc(edit, shift+shiftBits, hash, k, v)
+		if new == child {
 			return n, added
 		}
-		editable := n.ensureEditable(edit)
-		editable.array[idx].v = new
+		editable := n.ensureEditable(edit, false, true)
+		editable.nodes[idx] = new
 		return editable, added
-	case e.matches(k):
-		// A key replacement
-		if equalValues(v, e.v) {
-			return n, false
-		}
-		editable := n.ensureEditable(edit)
-		editable.array[idx].v = v
-		return editable, false
 	default:
-		h1 := hash.Any(e.k, n.seed)
-		if h1 == hashval {
-			// A hash collision
-			new := &hashCollisionNode{
-				edit:  edit,
-				seed:  n.seed,
-				hash:  h1,
-				array: []entry{e, {k: k, v: v}},
-			}
-			editable := n.ensureEditable(edit)
-			editable.array.assoc(idx, entry{k: nil, v: new})
-			return editable, true
-		}
-
-		// Push into new bitmap
-		new, _ := emptySeededBitmapNode(n.seed).
-			assoc(edit, shift+shiftBits, h1, e.k, e.v)
-		new, _ = new.
-			assoc(edit, shift+shiftBits, hashval, k, v)
-		editable := n.ensureEditable(edit)
-		editable.array.assoc(idx, entry{k: nil, v: new})
-		return editable, true
+		return n.addNewEntry(edit, bit, entryOf[K, V]{k: k, v: v, hash: hash}), true
 	}
 }
 
-func (n *bitmapIndexedNode) addNewEntry(
+func (n *bitmapIndexedNode[K, V]) addNewEntry(
 	edit *uint32,
-	hash uintptr,
-	shift uint,
-	k, v interface{},
-) *bitmapIndexedNode {
-	bit := bitpos(hash, shift)
-	idx := n.index(bit)
+	bit uint32,
+	e entryOf[K, V],
+) *bitmapIndexedNode[K, V] {
 	// Using ensureEditable here leads to two copies of
-	// the array. To avoid that, inline the logic
-	var editable *bitmapIndexedNode
+	// the entries. To avoid that, inline the logic
+	var editable *bitmapIndexedNode[K, V]
 	if isEditable(n.edit, edit) {
 		editable = n
 	} else {
-		editable = &bitmapIndexedNode{
-			bitmap: n.bitmap,
-			seed:   n.seed,
-			edit:   edit,
-			array:  n.array.copyWithCap(len(n.array) + 1),
+		editable = &bitmapIndexedNode[K, V]{
+			dataMap: n.dataMap,
+			nodeMap: n.nodeMap,
+			h:       n.h,
+			entries: copyWithCap(n.entries, len(n.entries)+1),
+			nodes:   n.nodes[:len(n.nodes):len(n.nodes)],
+			edit:    edit,
+		}
+		if !frozen(edit) {
+			editable.nodes = copySlice(n.nodes)
 		}
 	}
-	editable.array = editable.array.insert(idx, entry{k: k, v: v})
-	editable.bitmap |= bit
+	editable.entries = insertAt(editable.entries, index(n.dataMap, bit), e)
+	editable.dataMap |= bit
 	return editable
 }
 
-func (n *bitmapIndexedNode) unpack(
+// mergeEntries returns a node for the position at shift holding the
+// entries a and b.
+func mergeEntries[K comparable, V any](
 	edit *uint32,
+	h *hasher[K, V],
 	shift uint,
-	idx uint,
-	child node,
-) *arrayNode {
-	var nodes array
-	nodes[idx] = child
-	var j uint
-	for i := uint(0); i < width; i++ {
-		if ((n.bitmap >> i) & 1) == 0 {
-			continue
+	a, b entryOf[K, V],
+) node[K, V] {
+	if a.hash == b.hash {
+		return &hashCollisionNode[K, V]{
+			edit:  edit,
+			h:     h,
+			hash:  a.hash,
+			array: []entryOf[K, V]{a, b},
 		}
-		entry := n.array[j]
-		if entry.isLeaf() {
-			node, _ := emptySeededBitmapNode(n.seed).
-				assoc(edit,
-					shift+shiftBits,
-					hash.Any(entry.k, n.seed),
-					entry.k,
-					entry.v)
-			nodes[i] = node
-		} else {
-			nodes[i] = entry.v.(node)
+	}
+	bitA, bitB := bitpos(a.hash, shift), bitpos(b.hash, shift)
+	if bitA == bitB {
+		return &bitmapIndexedNode[K, V]{
+			nodeMap: bitA,
+			h:       h,
+			nodes: []node[K, V]{
+				mergeEntries(edit, h, shift+shiftBits, a, b),
+			},
+			edit: edit,
 		}
-		j++
 	}
-	return &arrayNode{
-		seed:  n.seed,
-		edit:  edit,
-		count: len(n.array) + 1,
-		array: nodes,
+	if bitB < bitA {
+		a, b = b, a
+	}
+	return &bitmapIndexedNode[K, V]{
+		dataMap: bitA | bitB,
+		h:       h,
+		entries: []entryOf[K, V]{a, b},
+		edit:    edit,
 	}
 }
 
-func (n *bitmapIndexedNode) without(
+func (n *bitmapIndexedNode[K, V]) without(
 	edit *uint32,
 	shift uint,
 	hash uintptr,
-	k interface{},
-) (node, bool) {
+	k K,
+) (node[K, V], bool) {
 	bit := bitpos(hash, shift)
-	if !n.bitEntryExists(bit) {
-		return n, false
-	}
-	idx := n.index(bit)
-	ent := n.array[idx]
 	switch {
-	case !ent.isLeaf():
-		child, removed := ent.v.(node).
-			without(edit, shift+shiftBits, hash, k)
-		switch {
-		case child == ent.v:
-			return n, removed
-		case child != nil:
-			editable := n.ensureEditable(edit)
-			editable.array.assoc(idx, entry{k: nil, v: child})
-			return editable, removed
-		case n.bitmap == bit:
-			return nil, removed
-		default:
-			editable := n.ensureEditable(edit)
-			editable.array.remove(idx)
-			editable.bitmap = editable.bitmap &^ bit
-			return editable, removed
+	case n.dataMap&bit != 0:
+		idx := index(n.dataMap, bit)
+		if e := n.entries[idx]; e.hash != hash || !n.h.keyEqual(k, e.k) {
+			return n, false
 		}
-	case dyn.Equal(k, ent.k):
-		if n.bitmap == bit {
+		if len(n.entries) == 1 && len(n.nodes) == 0 {
 			return nil, true
 		}
-		editable := n.ensureEditable(edit)
-		editable.array.remove(idx)
-		editable.bitmap = editable.bitmap &^ bit
-		return editable, true
+		editable := n.ensureEditable(edit, true, false)
+		editable.entries = removeAt(editable.entries, idx)
+		editable.dataMap &^= bit
+		return editable.compact(), true
+	case n.nodeMap&bit != 0:
+		idx := index(n.nodeMap, bit)
+		child := n.nodes[idx]
+		new, removed := child.without(edit, shift+shiftBits, hash, k)
+		if !removed {
+			return n, false
+		}
+		// A transient child may have been changed in place, so it
+		// still needs checking when new is child.
+		return n.replaceNode(edit, bit, idx, new), true
 	default:
 		return n, false
 	}
 }
 
-func (n *bitmapIndexedNode) find(
+// replaceNode replaces the sub-node at bit, found at idx in nodes,
+// with child, the result of removing an entry from it. A child that
+// is left with a single entry is replaced by the entry.
+func (n *bitmapIndexedNode[K, V]) replaceNode(
+	edit *uint32,
+	bit uint32,
+	idx int,
+	child node[K, V],
+) node[K, V] {
+	e, single := singleEntry(child)
+	switch {
+	case child == nil && len(n.nodes) == 1 && len(n.entries) == 0:
+		return nil
+	case child == nil:
+		editable := n.ensureEditable(edit, false, true)
+		editable.nodes = removeAt(editable.nodes, idx)
+		editable.nodeMap &^= bit
+		return editable.compact()
+	case single:
+		editable := n.ensureEditable(edit, false, true)
+		editable.nodes = removeAt(editable.nodes, idx)
+		editable.nodeMap &^= bit
+		editable.entries = insertAt(editable.entries,
+			index(editable.dataMap, bit), e)
+		editable.dataMap |= bit
+		return editable
+	default:
+		editable := n.ensureEditable(edit, false, true)
+		editable.nodes[idx] = child
+		return editable.compact()
+	}
+}
+
+// compact returns the collision node that is the only content of n in
+// place of n, so the collision node moves up to the shallowest
+// position no other key shares. Otherwise n is returned.
+func (n *bitmapIndexedNode[K, V]) compact() node[K, V] {
+	if len(n.entries) == 0 && len(n.nodes) == 1 {
+		if c, ok := resolve(n.nodes[0]).(*hashCollisionNode[K, V]); ok {
+			return c
+		}
+	}
+	return n
+}
+
+// singleEntry returns the entry of a node holding just one entry.
+func singleEntry[K comparable, V any](n node[K, V]) (entryOf[K, V], bool) {
+	switch n := n.(type) {
+	case *bitmapIndexedNode[K, V]:
+		if len(n.entries) == 1 && len(n.nodes) == 0 {
+			return n.entries[0], true
+		}
+	case *hashCollisionNode[K, V]:
+		if len(n.array) == 1 {
+			return n.array[0], true
+		}
+	}
+	var none entryOf[K, V]
+	return none, false
+}
+
+func (n *bitmapIndexedNode[K, V]) find(
 	shift uint,
 	hash uintptr,
-	k interface{},
-) (interface{}, bool) {
+	k K,
+) (V, bool) {
 	bit := bitpos(hash, shift)
-	if (n.bitmap & bit) == 0 {
-		return nil, false
-	}
-	idx := n.index(bit)
-	ent := n.array[idx]
-	if !ent.isLeaf() {
-		return ent.v.(node).find(shift+shiftBits, hash, k)
-	}
-	if dyn.Equal(ent.k, k) {
-		return ent.v, true
+	switch {
+	case n.dataMap&bit != 0:
+		// The hashes tell most keys apart before they are compared.
+		ent := n.entries[index(n.dataMap, bit)]
+		if ent.hash == hash && n.h.keyEqual(k, ent.k) {
+			return ent.v, true
+		}
+	case n.nodeMap&bit != 0:
+		return n.nodes[index(n.nodeMap, bit)].find(shift+shiftBits, hash, k)
 	}
-	return nil, false
+	var none V
+	return none, false
 }
 
-func (n *bitmapIndexedNode) seq() seq.Sequence {
-	out := entrySeqNew(n.array, 0, nil)
+func (n *bitmapIndexedNode[K, V]) seq() seq.Sequence {
+	out := nodeSeqNew(n.entries, n.nodes, nil)
 	if out == nil {
 		return nil
 	}
 	return out
 }
 
-func (n *bitmapIndexedNode) index(bit uint32) int {
-	return bits.OnesCount32(n.bitmap & (bit - 1))
-}
-
-func (n *bitmapIndexedNode) isFull() bool {
-	return len(n.array) >= bitmapCap
+// index returns the position in the entries or nodes of a node of the
+// content marked by bit in bitmap.
+func index(bitmap, bit uint32) int {
+	return bits.OnesCount32(bitmap & (bit - 1))
 }
 
-func (n *bitmapIndexedNode) entryExists(hash uintptr, shift uint) bool {
-	bit := bitpos(hash, shift)
-	return n.bitEntryExists(bit)
+// ensureEditable returns a node like n that edit may change in place.
+// The entries are copied when entries is set and the sub-nodes when
+// nodes is set. A node made by a persistent change is frozen from the
+// start, so it shares the other slices with n; they are capped so
+// inserting into them makes a copy.
+func (n *bitmapIndexedNode[K, V]) ensureEditable(
+	edit *uint32,
+	entries, nodes bool,
+) *bitmapIndexedNode[K, V] {
+	if isEditable(n.edit, edit) {
+		return n
+	}
+	out := &bitmapIndexedNode[K, V]{
+		dataMap: n.dataMap,
+		nodeMap: n.nodeMap,
+		h:       n.h,
+		entries: n.entries[:len(n.entries):len(n.entries)],
+		nodes:   n.nodes[:len(n.nodes):len(n.nodes)],
+		edit:    edit,
+	}
+	if entries || !frozen(edit) {
+		out.entries = copySlice(n.entries)
+	}
+	if nodes || !frozen(edit) {
+		out.nodes = copySlice(n.nodes)
+	}
+	return out
 }
 
-func (n *bitmapIndexedNode) bitEntryExists(bit uint32) bool {
-	return n.bitmap&bit != 0
+// frozen reports whether nodes made for edit can never be changed in
+// place.
+func frozen(edit *uint32) bool {
+	return atomic.LoadUint32(edit) == 0
 }
 
-func (n *bitmapIndexedNode) ensureEditable(edit *uint32) *bitmapIndexedNode {
-	if isEditable(n.edit, edit) {
-		return n
+func (n *bitmapIndexedNode[K, V]) rnge(fn func(entryOf[K, V]) bool) bool {
+	for _, entry := range n.entries {
+		if !fn(entry) {
+			return false
+		}
 	}
-	return &bitmapIndexedNode{
-		bitmap: n.bitmap,
-		seed:   n.seed,
-		array:  n.array.copy(),
-		edit:   edit,
+	for _, node := range n.nodes {
+		if !node.rnge(fn) {
+			return false
+		}
 	}
+	return true
 }
 
-func (n *bitmapIndexedNode) rnge(fn func(Entry) bool) bool {
-	for _, entry := range n.array {
-		if entry.isLeaf() {
-			if !fn(entry) {
-				return false
-			}
-			continue
+// nodeSeq is a sequence of the entries of a node followed by those of
+// its sub-nodes.
+type nodeSeq[K comparable, V any] struct {
+	entries []entryOf[K, V]
+	nodes   []node[K, V]
+	s       seq.Sequence
+}
+
+func nodeSeqNew[K comparable, V any](
+	entries []entryOf[K, V],
+	nodes []node[K, V],
+	s seq.Sequence,
+) *nodeSeq[K, V] {
+	if len(entries) > 0 || s != nil {
+		return &nodeSeq[K, V]{
+			entries: entries,
+			nodes:   nodes,
+			s:       s,
 		}
-		n, ok := entry.v.(node)
-		if !ok || n == nil {
+	}
+	for i, node := range nodes {
+		s := node.seq()
+		if s == nil {
 			continue
 		}
-		if !n.rnge(fn) {
-			return false
+		return &nodeSeq[K, V]{
+			nodes: nodes[i+1:],
+			s:     s,
 		}
 	}
-	return true
+	return nil
+}
+
+func (s *nodeSeq[K, V]) First() interface{} {
+	if len(s.entries) > 0 {
+		return s.entries[0].withoutHash()
+	}
+	return s.s.First()
+}
+
+func (s *nodeSeq[K, V]) Next() seq.Sequence {
+	var out *nodeSeq[K, V]
+	if len(s.entries) > 0 {
+		out = nodeSeqNew(s.entries[1:], s.nodes, nil)
+	} else {
+		out = nodeSeqNew(nil, s.nodes, s.s.Next())
+	}
+	if out == nil {
+		return nil
+	}
+	return out
+}
+
+func (s *nodeSeq[K, V]) String() string {
+	return seq.ConvertToString(s)
 }
@@ -0,0 +1,196 @@
+package hashmap
+
+import (
+	"math/bits"
+	"sort"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/hash"
+)
+
+// crowdedHash gives the same hash to a few keys and a common prefix
+// to many more so the tries have collision nodes and deep paths.
+func crowdedHash(k interface{}, seed uintptr) uintptr {
+	return uintptr(k.(int) % 50)
+}
+
+// isCanonical checks that no sub-node of the trie n could be replaced
+// by a single entry or by its only collision node.
+func isCanonical(n node[interface{}, interface{}], root bool) bool {
+	switch n := n.(type) {
+	case *bitmapIndexedNode[interface{}, interface{}]:
+		if n.dataMap&n.nodeMap != 0 ||
+			bits.OnesCount32(n.dataMap) != len(n.entries) ||
+			bits.OnesCount32(n.nodeMap) != len(n.nodes) {
+			return false
+		}
+		if _, single := singleEntry[interface{}, interface{}](n); !root &&
+			(single || n.compact() != n) {
+			return false
+		}
+		for _, child := range n.nodes {
+			if !isCanonical(child, false) {
+				return false
+			}
+		}
+		return true
+	case *hashCollisionNode[interface{}, interface{}]:
+		return root || len(n.array) > 1
+	case *flatNode[interface{}, interface{}]:
+		return root
+	default:
+		return false
+	}
+}
+
+// fromModel builds a map holding the entries of model by inserting
+// them into empty in order of their keys.
+func fromModel(empty *Map, model map[interface{}]interface{}) *Map {
+	keys := make([]int, 0, len(model))
+	for k := range model {
+		keys = append(keys, k.(int))
+	}
+	sort.Ints(keys)
+	out := empty
+	for _, k := range keys {
+		out = out.Assoc(k, model[k])
+	}
+	return out
+}
+
+// sameTrie reports whether a and b have identical shapes.
+func sameTrie(a, b *Map) bool {
+	if isFlat(a.root) || isFlat(b.root) {
+		// A map of more than flatMin entries may be flat or not
+		// depending on whether it has shrunk.
+		return isFlat(a.root) == isFlat(b.root) ||
+			a.Length() == b.Length() && a.Length() > flatMin
+	}
+	return equalNodes(a.h, a.root, b.root)
+}
+
+func TestCanonicalForm(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("the trie's shape only depends on its entries",
+		prop.ForAll(
+			func(ops []int) bool {
+				empty := Empty(Hasher(crowdedHash), Seed(1))
+				m, tm := empty, empty.AsTransient()
+				model := make(map[interface{}]interface{})
+				for i, op := range ops {
+					if op < 0 {
+						m = m.Delete(-op)
+						tm.Delete(-op)
+						delete(model, -op)
+					} else {
+						m = m.Assoc(op, i%3)
+						tm.Assoc(op, i%3)
+						model[op] = i % 3
+					}
+				}
+				want := fromModel(empty, model)
+				got := tm.AsPersistent()
+				return isCanonical(m.root, true) && isCanonical(got.root, true) &&
+					sameTrie(m, want) && sameTrie(got, want) &&
+					m.Equal(want) && want.Equal(got) &&
+					matchesModel(m, model)
+			},
+			gen.SliceOf(gen.IntRange(-200, 200)),
+		))
+	properties.Property("Equal notices a changed value",
+		prop.ForAll(
+			func(keys []int, k int) bool {
+				m := Empty(Hasher(crowdedHash), Seed(1))
+				for _, key := range keys {
+					m = m.Assoc(key, key)
+				}
+				m = m.Assoc(k, k)
+				return !m.Equal(m.Assoc(k, -1)) &&
+					!m.Assoc(k, -1).Equal(m) &&
+					m.Equal(m.Delete(k).Assoc(k, k))
+			},
+			gen.SliceOf(gen.IntRange(0, 200)),
+			gen.IntRange(0, 200),
+		))
+	properties.Property("set operations build canonical tries",
+		prop.ForAll(
+			func(as, bs []int) bool {
+				empty := Empty(Hasher(crowdedHash), Seed(1))
+				a, b := empty, empty
+				union := make(map[interface{}]interface{})
+				inA := make(map[int]bool)
+				for _, k := range as {
+					a = a.Assoc(k, k)
+					union[k] = k
+					inA[k] = true
+				}
+				for _, k := range bs {
+					b = b.Assoc(k, k)
+					union[k] = k
+				}
+				intersection := make(map[interface{}]interface{})
+				difference := make(map[interface{}]interface{})
+				for k := range union {
+					switch {
+					case inA[k.(int)] && b.Contains(k):
+						intersection[k] = k
+					case inA[k.(int)]:
+						difference[k] = k
+					}
+				}
+				for _, got := range []struct {
+					m     *Map
+					model map[interface{}]interface{}
+				}{
+					{a.Union(b), union},
+					{a.Intersection(b), intersection},
+					{a.Difference(b), difference},
+				} {
+					want := fromModel(empty, got.model)
+					if !isCanonical(got.m.root, true) || !sameTrie(got.m, want) ||
+						!got.m.Equal(want) || !matchesModel(got.m, got.model) {
+						return false
+					}
+				}
+				return true
+			},
+			gen.SliceOf(gen.IntRange(0, 200)),
+			gen.SliceOf(gen.IntRange(0, 200)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestHashCaching(t *testing.T) {
+	var hashed int
+	empty := Empty(Hasher(func(k interface{}, seed uintptr) uintptr {
+		hashed++
+		return hash.Any(k, seed)
+	}))
+	a, b := empty.AsTransient(), empty.AsTransient()
+	for i := 0; i < 1000; i++ {
+		a.Assoc(i, i)
+		b.Assoc(i+500, i)
+	}
+	if hashed != 2000 {
+		t.Fatal("keys were hashed more than once on insert", hashed)
+	}
+	hashed = 0
+	other := b.AsPersistent()
+	union := a.AsPersistent().Union(other)
+	diff := union.Difference(other)
+	if hashed != 0 || union.Length() != 1500 || diff.Length() != 500 {
+		t.Fatal("set operations rehashed keys", hashed)
+	}
+	for i := 0; i < 1000; i++ {
+		if !diff.Contains(i) == (i < 500) {
+			t.Fatal("didn't get expected difference", i)
+		}
+	}
+	if e := diff.Seq().First().(Entry); e != EntryNew(e.Key(), e.Value()) {
+		t.Fatal("the entries of a sequence didn't match EntryNew", e)
+	}
+}
@@ -0,0 +1,148 @@
+package hashmap
+
+// DiffOf returns the entries that differ between two versions of a
+// map. added holds the entries whose keys are only in new, removed
+// holds the entries whose keys are only in old and changed holds the
+// new values of keys in both maps whose values differ.
+//
+// Maps derived from the same original map are compared node by node
+// skipping the subtrees they share, so the cost is proportional to
+// the number of changes rather than the size of the maps. Unrelated
+// maps are compared entry by entry.
+func DiffOf[K comparable, V any](old, new *MapOf[K, V]) (added, removed, changed *MapOf[K, V]) {
+	d := differ[K, V]{
+		h:       new.h,
+		added:   emptyWithHasher(new.h).AsTransient(),
+		removed: emptyWithHasher(old.h).AsTransient(),
+		changed: emptyWithHasher(new.h).AsTransient(),
+	}
+	if old.sameShape(new) {
+		d.diffNodes(old.root, new.root, 0)
+	} else {
+		d.diffByEntry(old, new)
+	}
+	return d.added.AsPersistent(), d.removed.AsPersistent(),
+		d.changed.AsPersistent()
+}
+
+// differ collects the differences between two tries.
+type differ[K comparable, V any] struct {
+	h       *hasher[K, V]
+	added   *TMapOf[K, V]
+	removed *TMapOf[K, V]
+	changed *TMapOf[K, V]
+}
+
+func (d *differ[K, V]) diffByEntry(old, new *MapOf[K, V]) {
+	old.Range(func(key K, value V) bool {
+		v, ok := new.Find(key)
+		switch {
+		case !ok:
+			d.removed.Assoc(key, value)
+		case !d.h.valueEqual(v, value):
+			d.changed.Assoc(key, v)
+		}
+		return true
+	})
+	new.Range(func(key K, value V) bool {
+		if !old.Contains(key) {
+			d.added.Assoc(key, value)
+		}
+		return true
+	})
+}
+
+func (d *differ[K, V]) diffNodes(a, b node[K, V], shift uint) {
+	if sameNode(a, b) {
+		return
+	}
+	a, b = resolve(a), resolve(b)
+	if ca, ok := a.(*hashCollisionNode[K, V]); ok {
+		if cb, ok := b.(*hashCollisionNode[K, V]); ok && ca.hash == cb.hash {
+			d.diffEntries(ca.array, cb.array)
+			return
+		}
+	}
+	var as, bs [width]cell[K, V]
+	cellsOf(&as, a, shift, originA)
+	cellsOf(&bs, b, shift, originB)
+	for i := 0; i < width; i++ {
+		d.diffCells(as[i], bs[i], shift)
+	}
+}
+
+func (d *differ[K, V]) diffCells(a, b cell[K, V], shift uint) {
+	switch {
+	case !a.full && !b.full:
+	case !b.full:
+		d.rangeCell(a, d.removed)
+	case !a.full:
+		d.rangeCell(b, d.added)
+	case a.isLeaf() && b.isLeaf():
+		d.diffEntries([]entryOf[K, V]{a.entryOf}, []entryOf[K, V]{b.entryOf})
+	case a.isLeaf():
+		d.diffEntries([]entryOf[K, V]{a.entryOf}, entriesOf(b.n))
+	case b.isLeaf():
+		d.diffEntries(entriesOf(a.n), []entryOf[K, V]{b.entryOf})
+	default:
+		d.diffNodes(a.n, b.n, shift+shiftBits)
+	}
+}
+
+// diffEntries compares two small groups of entries that share a
+// position in the trie.
+func (d *differ[K, V]) diffEntries(old, new []entryOf[K, V]) {
+	for _, e := range old {
+		if v, found := d.findEntry(new, e); !found {
+			d.removed.Assoc(e.k, e.v)
+		} else if !d.h.valueEqual(e.v, v) {
+			d.changed.Assoc(e.k, v)
+		}
+	}
+	for _, e := range new {
+		if _, found := d.findEntry(old, e); !found {
+			d.added.Assoc(e.k, e.v)
+		}
+	}
+}
+
+func (d *differ[K, V]) rangeCell(c cell[K, V], out *TMapOf[K, V]) {
+	if c.isLeaf() {
+		out.Assoc(c.k, c.v)
+		return
+	}
+	c.n.rnge(func(e entryOf[K, V]) bool {
+		out.Assoc(e.k, e.v)
+		return true
+	})
+}
+
+func entriesOf[K comparable, V any](n node[K, V]) []entryOf[K, V] {
+	var out []entryOf[K, V]
+	n.rnge(func(e entryOf[K, V]) bool {
+		out = append(out, e)
+		return true
+	})
+	return out
+}
+
+func (d *differ[K, V]) findEntry(entries []entryOf[K, V], target entryOf[K, V]) (V, bool) {
+	for _, e := range entries {
+		if e.hash == target.hash && d.h.keyEqual(target.k, e.k) {
+			return e.v, true
+		}
+	}
+	var none V
+	return none, false
+}
+
+// Diff returns the entries that differ between two versions of a map.
+// added holds the entries whose keys are only in new, removed holds
+// the entries whose keys are only in old and changed holds the new
+// values of keys in both maps whose values differ. Maps derived from
+// the same original map are compared node by node skipping the
+// subtrees they share.
+func Diff(old, new *Map) (added, removed, changed *Map) {
+	a, r, c := DiffOf(old.typed(), new.typed())
+	return (*Map)(a), (*Map)(r), (*Map)(c)
+}
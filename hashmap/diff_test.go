@@ -0,0 +1,85 @@
+package hashmap
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/prop"
+)
+
+func TestDiff(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MaxSize = 500
+	properties := gopter.NewProperties(parameters)
+	for _, shared := range []bool{true, false} {
+		name := "unrelated "
+		if shared {
+			name = "shared "
+		}
+		properties.Property(name+"Diff", prop.ForAll(
+			func(c setopsCase) bool {
+				added := make(map[interface{}]interface{})
+				removed := make(map[interface{}]interface{})
+				changed := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					if nv, ok := c.nativeB[k]; !ok {
+						removed[k] = v
+					} else if nv != v {
+						changed[k] = nv
+					}
+				}
+				for k, v := range c.nativeB {
+					if _, ok := c.nativeA[k]; !ok {
+						added[k] = v
+					}
+				}
+				a, r, ch := Diff(c.a, c.b)
+				return matchesNative(a, added) &&
+					matchesNative(r, removed) &&
+					matchesNative(ch, changed)
+			},
+			genSetopsCase(shared),
+		))
+	}
+	properties.TestingRun(t)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	base := Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		base.Assoc(i, i)
+	}
+	old := base.AsPersistent()
+	new := old.Assoc(-1, -1).Assoc(5, 50).Delete(7)
+	added, removed, changed := Diff(old, new)
+	if !added.Equal(New(-1, -1)) {
+		t.Fatalf("unexpected added entries %v", added)
+	}
+	if !removed.Equal(New(7, 7)) {
+		t.Fatalf("unexpected removed entries %v", removed)
+	}
+	if !changed.Equal(New(5, 50)) {
+		t.Fatalf("unexpected changed entries %v", changed)
+	}
+	added, removed, changed = Diff(old, old)
+	if added.Length()+removed.Length()+changed.Length() != 0 {
+		t.Fatal("expected no differences between a map and itself")
+	}
+}
+
+func BenchmarkDiffSnapshots(b *testing.B) {
+	base := Empty().AsTransient()
+	for i := 0; i < 1000000; i++ {
+		base.Assoc(i, i)
+	}
+	old := base.AsPersistent()
+	new := old
+	for i := 0; i < 100; i++ {
+		new = new.Assoc(i*7919, -i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Diff(old, new)
+	}
+}
@@ -7,4 +7,20 @@
 // the default go equality operator for keys and values in this map library
 // implement the Equal(other interface{}) bool function for the type.
 // Otherwise '==' will be used with all its restrictions.
+//
+// Like Clojure's array maps, maps of up to eight entries keep them
+// in a flat slice and find keys by comparing them without hashing.
+// A map becomes a HAMT when it grows past that size and flattens
+// again when it shrinks to half of it.
+//
+// The nodes of the HAMT use the CHAMP layout from Steindorfer and
+// Vinju's "Optimizing Hash-Array Mapped Tries for Fast and Lean
+// Immutable JVM Collections". Each node keeps its entries and its sub-nodes in two separate arrays
+// and the trie is kept in a canonical form when entries are removed,
+// so two maps holding the same entries have the same shape. That
+// lets Equal compare maps sharing a hash node by node.
+//
+// MapOf provides a typed variant of Map whose keys and values are
+// stored without boxing. Map is a MapOf[interface{}, interface{}]
+// and may be used when heterogeneous keys or values are required.
 package hashmap
@@ -0,0 +1,75 @@
+package hashmap
+
+import (
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/internal/jsonmap"
+)
+
+// MarshalJSON implements json.Marshaler. A map whose keys are all
+// strings, or implement encoding.TextMarshaler, is encoded as a JSON
+// object with its members sorted by key. Any other map is encoded as
+// an array of [key, value] pairs.
+func (m *MapOf[K, V]) MarshalJSON() ([]byte, error) {
+	return jsonmap.Marshal(m.Range, true)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either of the
+// forms produced by MarshalJSON and builds the map with a transient.
+// Object member names are converted to K directly for string keys,
+// with UnmarshalText for encoding.TextUnmarshaler keys and are
+// otherwise decoded as JSON, which allows numeric keys. The options
+// m was created with are kept.
+func (m *MapOf[K, V]) UnmarshalJSON(data []byte) error {
+	out := m.cleared().AsTransient()
+	err := jsonmap.Unmarshal(data, func(k K, v V) {
+		out.Assoc(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	*m = *out.AsPersistent()
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Keys and values whose types implement
+// encoding.BinaryMarshaler encode themselves, others are encoded with
+// gob so the concrete types held in interface{} keys or values must
+// be registered with gob.Register.
+func (m *MapOf[K, V]) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalMap(binenc.HashMap, m.count, m.Range)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. The map is built with a
+// transient and keeps the options m was created with.
+func (m *MapOf[K, V]) UnmarshalBinary(data []byte) error {
+	out := m.cleared().AsTransient()
+	err := binenc.UnmarshalMap(data, binenc.HashMap, func(k K, v V) {
+		out.Assoc(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	*m = *out.AsPersistent()
+	return nil
+}
+
+// cleared returns an empty map with the options of m. The zero
+// MapOf gets a random seed.
+func (m *MapOf[K, V]) cleared() *MapOf[K, V] {
+	if m.h == nil {
+		return EmptyOf[K, V]()
+	}
+	return emptyWithHasher(m.h)
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (m *MapOf[K, V]) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (m *MapOf[K, V]) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
@@ -0,0 +1,208 @@
+package hashmap
+
+import (
+	"sync/atomic"
+
+	"jsouthworth.net/go/seq"
+)
+
+// flatMax is the most entries a map keeps in a flatNode.
+const flatMax = 8
+
+// flatMin is the number of entries a trie must shrink to before it is
+// flattened. It is below flatMax so that a map whose size goes back
+// and forth across flatMax isn't rebuilt on every change.
+const flatMin = flatMax / 2
+
+// flatNode is the root of a map holding at most flatMax entries. The
+// entries are kept in a slice and found by comparing keys, so small
+// maps never hash their keys. A flatNode is only ever a root; it is
+// promoted to a trie when it grows past flatMax entries and maps are
+// demoted back to one when they shrink to flatMin entries.
+type flatNode[K comparable, V any] struct {
+	h     *hasher[K, V]
+	edit  *uint32
+	array []entryOf[K, V]
+}
+
+func emptyFlatNode[K comparable, V any](h *hasher[K, V]) *flatNode[K, V] {
+	return &flatNode[K, V]{
+		h:    h,
+		edit: zero,
+	}
+}
+
+func (n *flatNode[K, V]) assoc(
+	edit *uint32,
+	shift uint,
+	hash uintptr,
+	k K, v V,
+) (node[K, V], bool) {
+	idx, ok := n.findIndex(k)
+	switch {
+	case ok:
+		if n.h.valueEqual(n.array[idx].v, v) {
+			return n, false
+		}
+		editable := n.ensureEditable(edit)
+		editable.array[idx].v = v
+		return editable, false
+	case len(n.array) < flatMax:
+		editable := n.ensureEditable(edit)
+		editable.array = appendExact(editable.array, entryOf[K, V]{k: k, v: v})
+		return editable, true
+	default:
+		return n.promote(edit, k, v), true
+	}
+}
+
+// promote returns a trie holding the entries of n and the new entry
+// k, v.
+func (n *flatNode[K, V]) promote(edit *uint32, k K, v V) node[K, V] {
+	if atomic.LoadUint32(edit) == 0 {
+		// Build the trie in place and then freeze it.
+		edit = atomicOne()
+		defer atomic.StoreUint32(edit, 0)
+	}
+	var out node[K, V] = emptySeededBitmapNode(n.h)
+	for _, e := range n.array {
+		out, _ = out.assoc(edit, 0, n.h.hash(e.k), e.k, e.v)
+	}
+	out, _ = out.assoc(edit, 0, n.h.hash(k), k, v)
+	return out
+}
+
+func (n *flatNode[K, V]) without(
+	edit *uint32,
+	shift uint,
+	hash uintptr,
+	k K,
+) (node[K, V], bool) {
+	idx, ok := n.findIndex(k)
+	if !ok {
+		return n, false
+	}
+	editable := n.ensureEditable(edit)
+	editable.array = removeAt(editable.array, idx)
+	return editable, true
+}
+
+func (n *flatNode[K, V]) find(
+	shift uint,
+	hash uintptr,
+	k K,
+) (V, bool) {
+	if idx, ok := n.findIndex(k); ok {
+		return n.array[idx].v, true
+	}
+	var none V
+	return none, false
+}
+
+func (n *flatNode[K, V]) findIndex(k K) (int, bool) {
+	for i, e := range n.array {
+		if n.h.keyEqual(k, e.k) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (n *flatNode[K, V]) ensureEditable(edit *uint32) *flatNode[K, V] {
+	if isEditable(n.edit, edit) {
+		return n
+	}
+	return &flatNode[K, V]{
+		h:     n.h,
+		edit:  edit,
+		array: copySlice(n.array),
+	}
+}
+
+func (n *flatNode[K, V]) seq() seq.Sequence {
+	out := entrySeqNew(n.array, 0)
+	if out == nil {
+		return nil
+	}
+	return out
+}
+
+func (n *flatNode[K, V]) rnge(fn func(entryOf[K, V]) bool) bool {
+	for _, entry := range n.array {
+		if !fn(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// flatten returns a flatNode holding the entries of the trie n,
+// which may be nil.
+func flatten[K comparable, V any](
+	edit *uint32,
+	h *hasher[K, V],
+	n node[K, V],
+) *flatNode[K, V] {
+	out := &flatNode[K, V]{
+		h:    h,
+		edit: edit,
+	}
+	if n != nil {
+		n.rnge(func(e entryOf[K, V]) bool {
+			out.array = append(out.array, e)
+			return true
+		})
+	}
+	return out
+}
+
+func isFlat[K comparable, V any](n node[K, V]) bool {
+	_, ok := n.(*flatNode[K, V])
+	return ok
+}
+
+// findRoot looks k up in the root of a map, hashing it only when the
+// root is a trie.
+func findRoot[K comparable, V any](h *hasher[K, V], root node[K, V], k K) (V, bool) {
+	if n, ok := root.(*flatNode[K, V]); ok {
+		return n.find(0, 0, k)
+	}
+	return root.find(0, h.hash(k), k)
+}
+
+// assocRoot associates k with v in the root of a map, hashing k only
+// when the root is a trie.
+func assocRoot[K comparable, V any](
+	edit *uint32,
+	h *hasher[K, V],
+	root node[K, V],
+	k K, v V,
+) (node[K, V], bool) {
+	if n, ok := root.(*flatNode[K, V]); ok {
+		return n.assoc(edit, 0, 0, k, v)
+	}
+	return root.assoc(edit, 0, h.hash(k), k, v)
+}
+
+// withoutRoot removes k from the root of a map holding count
+// entries. A trie left with flatMin or fewer entries is flattened.
+func withoutRoot[K comparable, V any](
+	edit *uint32,
+	h *hasher[K, V],
+	root node[K, V],
+	k K,
+	count int,
+) (node[K, V], bool) {
+	if n, ok := root.(*flatNode[K, V]); ok {
+		return n.without(edit, 0, 0, k)
+	}
+	out, removed := root.without(edit, 0, h.hash(k), k)
+	switch {
+	case !removed:
+		return root, false
+	case count-1 <= flatMin:
+		return flatten(edit, h, out), true
+	default:
+		return out, true
+	}
+}
@@ -0,0 +1,118 @@
+package hashmap
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/hash"
+	"jsouthworth.net/go/seq"
+)
+
+// matchesModel checks that m holds exactly the entries of model
+// through each of the ways of reading a map.
+func matchesModel(m *Map, model map[interface{}]interface{}) bool {
+	if m.Length() != len(model) {
+		return false
+	}
+	for k, v := range model {
+		if m.At(k) != v {
+			return false
+		}
+	}
+	n := 0
+	for iter := m.Iterator(); iter.HasNext(); n++ {
+		k, v := iter.Next()
+		if model[k] != v {
+			return false
+		}
+	}
+	for s := seq.Seq(m); s != nil; s = s.Next() {
+		n--
+	}
+	return n == 0
+}
+
+// flatShape reports whether a root is flat or a trie as a map holding
+// count entries may be.
+func flatShape(root node[interface{}, interface{}], count int) bool {
+	if isFlat(root) {
+		return count <= flatMax
+	}
+	return count > flatMin
+}
+
+func TestFlatNode(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("small maps are flat and match a native map",
+		prop.ForAll(
+			func(ops []int) bool {
+				m := Empty()
+				tm := Empty().AsTransient()
+				model := make(map[interface{}]interface{})
+				for i, op := range ops {
+					k := op % 12
+					if op < 0 {
+						k = -op % 12
+						m = m.Delete(k)
+						tm.Delete(k)
+						delete(model, k)
+					} else {
+						m = m.Assoc(k, i)
+						tm.Assoc(k, i)
+						model[k] = i
+					}
+					if !flatShape(m.root, m.Length()) ||
+						!flatShape(tm.root, tm.Length()) {
+						return false
+					}
+					if !matchesModel(m, model) {
+						return false
+					}
+				}
+				return matchesModel(tm.AsPersistent(), model)
+			},
+			gen.SliceOf(gen.IntRange(-20, 20)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestFlatNodeHashing(t *testing.T) {
+	var hashed int
+	m := Empty(Hasher(func(k interface{}, seed uintptr) uintptr {
+		hashed++
+		return hash.Any(k, seed)
+	}))
+	for i := 0; i < flatMax; i++ {
+		m = m.Assoc(i, i)
+	}
+	if m.At(0) != 0 || !m.Contains(flatMax-1) || hashed != 0 {
+		t.Fatal("a small map hashed its keys", hashed)
+	}
+	m = m.Assoc(flatMax, flatMax)
+	if isFlat(m.root) || hashed != flatMax+1 {
+		t.Fatal("the map wasn't promoted to a trie", hashed)
+	}
+	hashed = 0
+	for i := 0; i < 10; i++ {
+		m = m.Delete(flatMax).Assoc(flatMax, flatMax)
+	}
+	if isFlat(m.root) || hashed != 20 {
+		t.Fatal("the map was rebuilt crossing flatMax", hashed)
+	}
+	for i := 0; i < flatMax-flatMin; i++ {
+		m = m.Delete(i)
+	}
+	if isFlat(m.root) {
+		t.Fatal("the map was demoted early", m)
+	}
+	m = m.Delete(flatMax - flatMin)
+	if !isFlat(m.root) || m.Length() != flatMin || m.Contains(0) {
+		t.Fatal("the map wasn't demoted", m)
+	}
+	if m.Union(New(0, 0)).Length() != flatMin+1 {
+		t.Fatal("didn't get expected union")
+	}
+}
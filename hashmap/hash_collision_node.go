@@ -1,92 +1,184 @@
 package hashmap
 
 import (
+	"sort"
+
 	"jsouthworth.net/go/dyn"
 	"jsouthworth.net/go/seq"
 )
 
-type hashCollisionNode struct {
-	hash  uintptr
-	seed  uintptr
-	edit  *uint32
-	array entries
+// collisionScanMax is the most entries a collision node scans to find
+// a key. Past it the entries are kept sorted with dyn.Compare and
+// searched, which bounds the cost of lookups when many keys share a
+// hash, as they may when the keys come from an adversary.
+const collisionScanMax = 8
+
+// hashCollisionNode holds the entries whose keys share a hash. The
+// entries are sorted by their keys when sorted is set.
+type hashCollisionNode[K comparable, V any] struct {
+	hash   uintptr
+	h      *hasher[K, V]
+	edit   *uint32
+	array  []entryOf[K, V]
+	sorted bool
 }
 
-func (n *hashCollisionNode) assoc(
+func (n *hashCollisionNode[K, V]) assoc(
 	edit *uint32,
 	shift uint,
 	hash uintptr,
-	k, v interface{},
-) (node, bool) {
+	k K, v V,
+) (node[K, V], bool) {
 	if hash == n.hash {
 		idx, ok := n.findIndex(k)
 		if ok {
-			if equalValues(n.array[idx].v, v) {
+			if n.h.valueEqual(n.array[idx].v, v) {
 				return n, false
 			}
 			return n.editAndSet(edit, idx, v), false
 		}
-		return n.editAndAppend(edit, entry{k: k, v: v}), true
+		return n.editAndAppend(edit, entryOf[K, V]{k: k, v: v, hash: hash}), true
 	}
-	out := &bitmapIndexedNode{
-		edit:   edit,
-		bitmap: bitpos(n.hash, shift),
-		array:  []entry{entry{k: nil, v: n}},
+	out := &bitmapIndexedNode[K, V]{
+		edit:    edit,
+		h:       n.h,
+		nodeMap: bitpos(n.hash, shift),
+		nodes:   []node[K, V]{n},
 	}
 	return out.assoc(edit, shift, hash, k, v)
 }
 
-func (n *hashCollisionNode) findIndex(k interface{}) (int, bool) {
+func (n *hashCollisionNode[K, V]) findIndex(k K) (int, bool) {
+	if n.sorted {
+		if idx, found, ok := n.search(k); ok {
+			return idx, found
+		}
+	}
 	for i, e := range n.array {
-		if dyn.Equal(k, e.k) {
+		if n.h.keyEqual(k, e.k) {
 			return i, true
 		}
 	}
 	return -1, false
 }
 
-func (n *hashCollisionNode) ensureEditable(edit *uint32) *hashCollisionNode {
+func (n *hashCollisionNode[K, V]) ensureEditable(edit *uint32) *hashCollisionNode[K, V] {
 	if isEditable(n.edit, edit) {
 		return n
 	}
-	return &hashCollisionNode{
-		hash:  n.hash,
-		seed:  n.seed,
-		edit:  edit,
-		array: n.array.copy(),
+	return &hashCollisionNode[K, V]{
+		hash:   n.hash,
+		h:      n.h,
+		edit:   edit,
+		array:  copySlice(n.array),
+		sorted: n.sorted,
 	}
 }
 
-func (n *hashCollisionNode) editAndSet(
+func (n *hashCollisionNode[K, V]) editAndSet(
 	edit *uint32,
 	idx int,
-	val interface{},
-) *hashCollisionNode {
+	val V,
+) *hashCollisionNode[K, V] {
 	editable := n.ensureEditable(edit)
 	editable.array[idx].v = val
 	return editable
 }
 
-func (n *hashCollisionNode) editAndAppend(edit *uint32, e entry) *hashCollisionNode {
-	if isEditable(n.edit, edit) {
-		n.array = n.array.append(e)
-		return n
+func (n *hashCollisionNode[K, V]) editAndAppend(
+	edit *uint32,
+	e entryOf[K, V],
+) *hashCollisionNode[K, V] {
+	editable := n
+	if !isEditable(n.edit, edit) {
+		editable = &hashCollisionNode[K, V]{
+			hash:   n.hash,
+			h:      n.h,
+			edit:   edit,
+			array:  copyWithCap(n.array, len(n.array)+1),
+			sorted: n.sorted,
+		}
+	}
+	if !editable.sorted {
+		editable.array = appendExact(editable.array, e)
+		editable.sortIfLarge()
+		return editable
+	}
+	idx, _, ok := editable.search(e.k)
+	if !ok {
+		// e can't be ordered with the other keys.
+		editable.array = appendExact(editable.array, e)
+		editable.sorted = false
+		return editable
+	}
+	editable.array = insertAt(editable.array, idx, e)
+	return editable
+}
+
+// sortIfLarge sorts the entries of n once it holds more than
+// collisionScanMax of them. They are left as they are when the map
+// has its own key equality, which the order may not agree with, or
+// when the keys can't be ordered.
+func (n *hashCollisionNode[K, V]) sortIfLarge() {
+	if n.sorted || len(n.array) <= collisionScanMax || n.h.keyEqFn != nil {
+		return
+	}
+	for _, e := range n.array {
+		if !orderable(e.k) {
+			return
+		}
 	}
+	defer func() {
+		// dyn.Compare panics on keys it can't order; the
+		// entries are still all there, just not sorted.
+		if recover() != nil {
+			n.sorted = false
+		}
+	}()
+	sort.SliceStable(n.array, func(i, j int) bool {
+		return dyn.Compare(n.array[i].k, n.array[j].k) < 0
+	})
+	n.sorted = true
+}
 
-	return &hashCollisionNode{
-		hash:  n.hash,
-		seed:  n.seed,
-		edit:  edit,
-		array: n.array.copyWithCap(len(n.array) + 1).append(e),
+// search finds k in the sorted entries of n. It returns the index of
+// the entry holding k or, when found is false, the index k would be
+// inserted at. ok is false when k can't be ordered with the keys of n.
+func (n *hashCollisionNode[K, V]) search(k K) (idx int, found, ok bool) {
+	if !orderable(k) {
+		return 0, false, false
 	}
+	defer func() {
+		if recover() != nil {
+			idx, found, ok = 0, false, false
+		}
+	}()
+	idx = sort.Search(len(n.array), func(i int) bool {
+		return dyn.Compare(n.array[i].k, k) >= 0
+	})
+	// Keys ordered the same are not necessarily equal.
+	for i := idx; i < len(n.array) && dyn.Compare(n.array[i].k, k) == 0; i++ {
+		if n.h.keyEqual(k, n.array[i].k) {
+			return i, true, true
+		}
+	}
+	return idx, false, true
+}
+
+// orderable reports whether k may be kept in a sorted collision node.
+// Keys with their own equality need their own order to go with it.
+func orderable[K comparable](k K) bool {
+	_, equaler := interface{}(k).(dyn.Equaler)
+	_, comparer := interface{}(k).(dyn.Comparer)
+	return !equaler || comparer
 }
 
-func (n *hashCollisionNode) without(
+func (n *hashCollisionNode[K, V]) without(
 	edit *uint32,
 	shift uint,
 	hash uintptr,
-	k interface{},
-) (node, bool) {
+	k K,
+) (node[K, V], bool) {
 	idx, ok := n.findIndex(k)
 	if !ok {
 		return n, false
@@ -95,46 +187,34 @@ func (n *hashCollisionNode) without(
 		return nil, true
 	}
 	editable := n.ensureEditable(edit)
-	editable.array = editable.array.remove(idx)
+	editable.array = removeAt(editable.array, idx)
 	return editable, true
 }
 
-func (n *hashCollisionNode) find(
+func (n *hashCollisionNode[K, V]) find(
 	shift uint,
 	hash uintptr,
-	k interface{},
-) (interface{}, bool) {
+	k K,
+) (V, bool) {
 	idx, ok := n.findIndex(k)
 	if !ok {
-		return nil, false
-	}
-	if dyn.Equal(k, n.array[idx].k) {
-		return n.array[idx].v, true
+		var none V
+		return none, false
 	}
-	return nil, false
+	return n.array[idx].v, true
 }
 
-func (n *hashCollisionNode) seq() seq.Sequence {
-	out := entrySeqNew(n.array, 0, nil)
+func (n *hashCollisionNode[K, V]) seq() seq.Sequence {
+	out := entrySeqNew(n.array, 0)
 	if out == nil {
 		return nil
 	}
 	return out
 }
 
-func (n *hashCollisionNode) rnge(fn func(Entry) bool) bool {
+func (n *hashCollisionNode[K, V]) rnge(fn func(entryOf[K, V]) bool) bool {
 	for _, entry := range n.array {
-		if entry.isLeaf() {
-			if !fn(entry) {
-				return false
-			}
-			continue
-		}
-		n, ok := entry.v.(node)
-		if !ok || n == nil {
-			continue
-		}
-		if !n.rnge(fn) {
+		if !fn(entry) {
 			return false
 		}
 	}
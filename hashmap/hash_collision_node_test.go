@@ -194,3 +194,130 @@ func TestHashCollisionNode(t *testing.T) {
 	))
 	properties.TestingRun(t)
 }
+
+// orderedCollider keys all share a hash and are ordered by their
+// value.
+type orderedCollider int
+
+func (c orderedCollider) Hash() uintptr {
+	return 10
+}
+
+func (c orderedCollider) Compare(other interface{}) int {
+	return int(c) - int(other.(orderedCollider))
+}
+
+// collisionNodeOf returns the collision node holding the keys of m,
+// which all share a hash.
+func collisionNodeOf(m *Map) *hashCollisionNode[interface{}, interface{}] {
+	n := m.root
+	for {
+		switch node := n.(type) {
+		case *bitmapIndexedNode[interface{}, interface{}]:
+			n = node.nodes[0]
+		case *hashCollisionNode[interface{}, interface{}]:
+			return node
+		default:
+			return nil
+		}
+	}
+}
+
+func TestSortedCollisionNode(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("large collision nodes are sorted and match a native map",
+		prop.ForAll(
+			func(ops []int) bool {
+				m := Empty()
+				tm := Empty().AsTransient()
+				model := make(map[interface{}]interface{})
+				for i, op := range ops {
+					k := orderedCollider(op)
+					if op < 0 {
+						k = -k
+						m = m.Delete(k)
+						tm.Delete(k)
+						delete(model, k)
+					} else {
+						m = m.Assoc(k, i)
+						tm.Assoc(k, i)
+						model[k] = i
+					}
+				}
+				got := tm.AsPersistent()
+				want := Empty()
+				for k, v := range model {
+					want = want.Assoc(k, v)
+				}
+				if !sameTrie(m, want) || !sameTrie(got, want) {
+					return false
+				}
+				for _, m := range []*Map{m, got} {
+					n := collisionNodeOf(m)
+					if m.Length() > flatMax && n == nil {
+						return false
+					}
+					if n != nil && len(n.array) > collisionScanMax && !n.sorted {
+						return false
+					}
+					for i := 1; n != nil && n.sorted && i < len(n.array); i++ {
+						if n.array[i-1].k.(orderedCollider) >= n.array[i].k.(orderedCollider) {
+							return false
+						}
+					}
+					if !matchesModel(m, model) {
+						return false
+					}
+				}
+				return m.Equal(got)
+			},
+			gen.SliceOf(gen.IntRange(-40, 40)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestUnsortableCollisionNode(t *testing.T) {
+	m := Empty()
+	for i := 0; i < 2*collisionScanMax; i++ {
+		m = m.Assoc(orderedCollider(i), i)
+	}
+	if !collisionNodeOf(m).sorted {
+		t.Fatal("the collision node wasn't sorted")
+	}
+	// A key that can't be compared with the others turns the node
+	// back to a scanned one.
+	odd := hashCollider("odd")
+	m = m.Assoc(odd, "odd")
+	if m.At(odd) != "odd" || m.At(orderedCollider(3)) != 3 {
+		t.Fatal("didn't get expected values", m)
+	}
+	if !m.Delete(odd).Contains(orderedCollider(5)) {
+		t.Fatal("lost an entry", m)
+	}
+	folded := Empty(KeyEqual(func(a, b interface{}) bool {
+		return a.(orderedCollider)%100 == b.(orderedCollider)%100
+	}))
+	for i := 0; i < 2*collisionScanMax; i++ {
+		folded = folded.Assoc(orderedCollider(i), i)
+	}
+	if collisionNodeOf(folded).sorted {
+		t.Fatal("a map with its own key equality was sorted")
+	}
+	if folded.At(orderedCollider(103)) != 3 {
+		t.Fatal("didn't get expected value", folded)
+	}
+}
+
+func BenchmarkCollisionFind(b *testing.B) {
+	m := Empty().AsTransient()
+	for i := 0; i < 1000; i++ {
+		m.Assoc(orderedCollider(i), i)
+	}
+	p := m.AsPersistent()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Find(orderedCollider(i % 1000))
+	}
+}
@@ -11,109 +11,79 @@ const (
 // are not safe for concurrent access so they may not be shared
 // between goroutines.
 func (m *Map) Iterator() Iterator {
-	i := makeIterator(m.root)
-	i.HasNext() // Make sure the initial iterator value is valid
-	return i
+	return m.typed().Iterator()
 }
 
-// Iterator is a mutable iterator for a map. It has a fixed size
-// stack, the size of which is computed from the maximum number of
-// nested nodes possible based on the branching factor and the size of
-// the hash type.
-type Iterator struct {
+// Iterator is a mutable iterator for a map.
+type Iterator = IteratorOf[interface{}, interface{}]
+
+// IteratorOf is a mutable iterator for a typed map. It has a fixed
+// size stack, the size of which is computed from the maximum number
+// of nested nodes possible based on the branching factor and the size
+// of the hash type.
+type IteratorOf[K comparable, V any] struct {
 	depth uintptr
 	stack [maxDepth + 1]struct {
-		n   node
+		n   node[K, V]
 		cur int
 	}
 }
 
-func makeIterator(n node) Iterator {
-	var i Iterator
+func makeIterator[K comparable, V any](n node[K, V]) IteratorOf[K, V] {
+	var i IteratorOf[K, V]
 	i.stack[0].n = n
 	return i
 }
 
 // HasNext is true when there are more elements to be iterated over.
-func (i *Iterator) HasNext() bool {
+func (i *IteratorOf[K, V]) HasNext() bool {
 	state := i.stack[i.depth]
 	switch n := state.n.(type) {
-	case *arrayNode:
-		for j := state.cur; j < width; j++ {
-			node := n.array[j]
-			if node != nil {
-				i.stack[i.depth].cur = j + 1
-				i.pushNode(node)
-				return i.HasNext()
-			}
+	case *bitmapIndexedNode[K, V]:
+		// The entries of a node are visited before its sub-nodes.
+		if state.cur < len(n.entries) {
+			return true
 		}
-		if i.depth == 0 {
-			return false
-		}
-		i.popNode()
-		return i.HasNext()
-	case *bitmapIndexedNode:
-		for j := state.cur; j < len(n.array); j++ {
-			entry := n.array[j]
-			if entry.isLeaf() {
-				i.stack[i.depth].cur = j
-				return true
-			} else {
-				n, ok := entry.v.(node)
-				if !ok || n == nil {
-					continue
-				} else {
-					i.stack[i.depth].cur = j + 1
-					i.pushNode(n)
-					return i.HasNext()
-				}
-			}
+		if j := state.cur - len(n.entries); j < len(n.nodes) {
+			i.stack[i.depth].cur++
+			i.pushNode(n.nodes[j])
+			return i.HasNext()
 		}
 		if i.depth == 0 {
 			return false
 		}
 		i.popNode()
 		return i.HasNext()
-	case *hashCollisionNode:
-		for j := state.cur; j < len(n.array); j++ {
-			entry := n.array[j]
-			if entry.isLeaf() {
-				i.stack[i.depth].cur = j
-				return true
-			} else {
-				n, ok := entry.v.(node)
-				if !ok || n == nil {
-					continue
-				} else {
-					i.stack[i.depth].cur = j + 1
-					i.pushNode(n)
-					return i.HasNext()
-				}
-			}
+	case *hashCollisionNode[K, V]:
+		if state.cur < len(n.array) {
+			return true
 		}
 		if i.depth == 0 {
 			return false
 		}
 		i.popNode()
 		return i.HasNext()
+	case *flatNode[K, V]:
+		// A flatNode is only ever the root.
+		return state.cur < len(n.array)
 	default:
 		return false
 	}
 }
 
 // Next provides the next key value pair and increments the cursor.
-func (i *Iterator) Next() (k, v interface{}) {
+func (i *IteratorOf[K, V]) Next() (k K, v V) {
 	state := i.stack[i.depth]
 	switch n := state.n.(type) {
-	case *arrayNode:
-		// HasNext should always step away from arrayNodes
-		// panic if we find one in Next
-		panic("arrayNode!")
-	case *bitmapIndexedNode:
+	case *bitmapIndexedNode[K, V]:
+		entry := n.entries[state.cur]
+		i.stack[i.depth].cur++
+		return entry.k, entry.v
+	case *hashCollisionNode[K, V]:
 		entry := n.array[state.cur]
 		i.stack[i.depth].cur++
 		return entry.k, entry.v
-	case *hashCollisionNode:
+	case *flatNode[K, V]:
 		entry := n.array[state.cur]
 		i.stack[i.depth].cur++
 		return entry.k, entry.v
@@ -122,15 +92,15 @@ func (i *Iterator) Next() (k, v interface{}) {
 	}
 }
 
-func (i *Iterator) pushNode(n node) {
+func (i *IteratorOf[K, V]) pushNode(n node[K, V]) {
 	i.depth = i.depth + 1
 	state := i.stack[i.depth]
-	state.n = n
+	state.n = resolve(n)
 	state.cur = 0
 	i.stack[i.depth] = state
 }
 
-func (i *Iterator) popNode() {
+func (i *IteratorOf[K, V]) popNode() {
 	state := i.stack[i.depth]
 	state.n = nil
 	state.cur = 0
@@ -0,0 +1,108 @@
+package hashmap
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// The benchmarks below measure the costs that depend on the layout of
+// the trie's nodes, for maps of a few sizes.
+
+var layoutSizes = []int{1000, 100000}
+
+func layoutMap(size int) *MapOf[int, int] {
+	m := EmptyOf[int, int]().AsTransient()
+	for i := 0; i < size; i++ {
+		m.Assoc(i, i)
+	}
+	return m.AsPersistent()
+}
+
+func benchmarkLayout(b *testing.B, fn func(b *testing.B, m *MapOf[int, int])) {
+	for _, size := range layoutSizes {
+		m := layoutMap(size)
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			fn(b, m)
+		})
+	}
+}
+
+func BenchmarkLayoutIterator(b *testing.B) {
+	benchmarkLayout(b, func(b *testing.B, m *MapOf[int, int]) {
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			iter := m.Iterator()
+			for iter.HasNext() {
+				_, v := iter.Next()
+				sum += v
+			}
+		}
+	})
+}
+
+func BenchmarkLayoutRange(b *testing.B) {
+	benchmarkLayout(b, func(b *testing.B, m *MapOf[int, int]) {
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			m.Range(func(_, v int) bool {
+				sum += v
+				return true
+			})
+		}
+	})
+}
+
+func BenchmarkLayoutFind(b *testing.B) {
+	benchmarkLayout(b, func(b *testing.B, m *MapOf[int, int]) {
+		for i := 0; i < b.N; i++ {
+			m.Find(i % m.Length())
+		}
+	})
+}
+
+func BenchmarkLayoutEqual(b *testing.B) {
+	benchmarkLayout(b, func(b *testing.B, m *MapOf[int, int]) {
+		// other holds the same entries as m but none of its nodes
+		// are shared with it.
+		t := emptyWithHasher(m.h).AsTransient()
+		for i := m.Length() - 1; i >= 0; i-- {
+			t.Assoc(i, i)
+		}
+		other := t.AsPersistent()
+		for i := 0; i < b.N; i++ {
+			if !m.Equal(other) {
+				b.Fatal("the maps should have been equal")
+			}
+		}
+	})
+}
+
+func BenchmarkLayoutAssocDelete(b *testing.B) {
+	benchmarkLayout(b, func(b *testing.B, m *MapOf[int, int]) {
+		for i := 0; i < b.N; i++ {
+			k := i % m.Length()
+			m.Delete(k).Assoc(k, -k)
+		}
+	})
+}
+
+func BenchmarkLayoutMemory(b *testing.B) {
+	for _, size := range layoutSizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			var before, after runtime.MemStats
+			var m *MapOf[int, int]
+			for i := 0; i < b.N; i++ {
+				m = nil
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				m = layoutMap(size)
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+			}
+			used := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+			b.ReportMetric(float64(used)/float64(m.Length()), "B/entry")
+		})
+	}
+}
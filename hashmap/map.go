@@ -5,11 +5,10 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
-	"strings"
 	"sync/atomic"
 
 	"jsouthworth.net/go/dyn"
-	"jsouthworth.net/go/hash"
+	"jsouthworth.net/go/immutable/persist"
 	"jsouthworth.net/go/seq"
 )
 
@@ -34,27 +33,94 @@ type Entry interface {
 
 // EntryNew constructs a map entry that may be used with Conj.
 func EntryNew(key, value interface{}) Entry {
-	return entry{key, value}
+	return entry{k: key, v: value}
 }
 
 // Map is a persistent immutable map. Operations on
 // map returns a new map that shares much of the
-// structure with the original map.
-type Map struct {
-	hashSeed uintptr
-	count    int
-	root     node
-}
-
-// Empty returns a new empty persistent map with a random hashSeed.
-func Empty() *Map {
-	seed := uintptr(rand.Uint64())
-	return &Map{
-		hashSeed: seed,
-		root:     emptySeededBitmapNode(seed),
+// structure with the original map. Map is the heterogeneous
+// form of MapOf; keys and values may be of any type.
+type Map MapOf[interface{}, interface{}]
+
+type mapOptions struct {
+	hasher hasher[interface{}, interface{}]
+	seeded bool
+}
+
+// Option is a type that allows changes to pluggable parts of the
+// Map implementation.
+type Option func(*mapOptions)
+
+// Hasher is an option to the Empty function that will allow
+// one to specify a different hash function instead of the
+// default which is from the hash library. The function is
+// passed the map's seed along with the key. Keys that are
+// equal under KeyEqual must hash to the same value.
+func Hasher(fn func(k interface{}, seed uintptr) uintptr) Option {
+	id := new(optionID)
+	return func(o *mapOptions) {
+		o.hasher.hashFn = fn
+		o.hasher.ids.hashFn = id
+	}
+}
+
+// KeyEqual is an option to the Empty function that will allow
+// one to specify a different equality operator instead
+// of the default which is from the dyn library. This is used
+// for keys.
+func KeyEqual(eq func(k1, k2 interface{}) bool) Option {
+	id := new(optionID)
+	return func(o *mapOptions) {
+		o.hasher.keyEqFn = eq
+		o.hasher.ids.keyEqFn = id
+	}
+}
+
+// ValueEqual is an option to the Empty function that will allow
+// one to specify a different equality operator instead
+// of the default which is from the dyn library. This is used
+// for values.
+func ValueEqual(eq func(v1, v2 interface{}) bool) Option {
+	id := new(optionID)
+	return func(o *mapOptions) {
+		o.hasher.valueEqFn = eq
+		o.hasher.ids.valueEqFn = id
 	}
 }
 
+// Seed is an option to the Empty function that will allow one
+// to specify the hash seed instead of a random one. Maps with
+// the same seed store their keys in the same order.
+func Seed(seed uintptr) Option {
+	return func(o *mapOptions) {
+		o.hasher.seed = seed
+		o.seeded = true
+	}
+}
+
+// Empty returns a new empty persistent map with a random hashSeed,
+// one may supply options for the map by using one of the option
+// generating functions and providing that to Empty. The options
+// are kept by every map derived from the returned one.
+func Empty(options ...Option) *Map {
+	if len(options) == 0 {
+		return (*Map)(EmptyOf[interface{}, interface{}]())
+	}
+	opts := applyOptions(options)
+	if !opts.seeded {
+		opts.hasher.seed = uintptr(rand.Uint64())
+	}
+	return (*Map)(emptyWithHasher(&opts.hasher))
+}
+
+func applyOptions(options []Option) *mapOptions {
+	var opts mapOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return &opts
+}
+
 // New converts a list of elements to a persistent map
 // by associating them pairwise. New will panic if the
 // number of elements is not even.
@@ -137,17 +203,13 @@ func mapFromReflection(value interface{}) *Map {
 // At returns the value associated with the key.
 // If one is not found, nil is returned.
 func (m *Map) At(key interface{}) interface{} {
-	v, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
-	if !ok {
-		return nil
-	}
-	return v
+	return m.typed().At(key)
 }
 
 // EntryAt returns the entry (key, value pair) of the key.
 // If one is not found, nil is returned.
 func (m *Map) EntryAt(key interface{}) Entry {
-	v, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
+	v, ok := findRoot(m.h, m.root, key)
 	if !ok {
 		return nil
 	}
@@ -159,24 +221,7 @@ func (m *Map) EntryAt(key interface{}) Entry {
 // are different from one already in the map, if the entry
 // is already in the map the original map is returned.
 func (m *Map) Assoc(key, value interface{}) *Map {
-	root, added := m.root.assoc(zero, 0,
-		hash.Any(key, m.hashSeed), key, value)
-	switch {
-	case root == m.root:
-		return m
-	case added:
-		return &Map{
-			hashSeed: m.hashSeed,
-			count:    m.count + 1,
-			root:     root,
-		}
-	default: //replaced key
-		return &Map{
-			hashSeed: m.hashSeed,
-			count:    m.count,
-			root:     root,
-		}
-	}
+	return (*Map)(m.typed().Assoc(key, value))
 }
 
 // Conj takes a value that must be an Entry. Conj implements
@@ -188,24 +233,13 @@ func (m *Map) Conj(value interface{}) interface{} {
 
 // AsNative returns the map converted to a go native map type.
 func (m *Map) AsNative() map[interface{}]interface{} {
-	out := make(map[interface{}]interface{})
-	iter := m.Iterator()
-	for iter.HasNext() {
-		key, val := iter.Next()
-		out[key] = val
-	}
-	return out
+	return m.typed().AsNative()
 }
 
 // AsTransient will return a transient map that shares
 // structure with the persistent map.
 func (m *Map) AsTransient() *TMap {
-	return &TMap{
-		hashSeed: m.hashSeed,
-		count:    m.count,
-		root:     m.root,
-		edit:     atomicOne(),
-	}
+	return (*TMap)(m.typed().AsTransient())
 }
 
 // MakeTransient is a generic version of AsTransient.
@@ -215,37 +249,19 @@ func (m *Map) MakeTransient() interface{} {
 
 // Contains will test if the key exists in the map.
 func (m *Map) Contains(key interface{}) bool {
-	_, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
-	return ok
+	return m.typed().Contains(key)
 }
 
 // Find will return the value for a key if it exists in the map and
 // whether the key exists in the map. For non-nil values, exists will
 // always be true.
 func (m *Map) Find(key interface{}) (value interface{}, exists bool) {
-	return m.root.find(0, hash.Any(key, m.hashSeed), key)
+	return m.typed().Find(key)
 }
 
 // Delete removes a key and associated value from the map.
 func (m *Map) Delete(key interface{}) *Map {
-	root, removed := m.root.without(zero, 0,
-		hash.Any(key, m.hashSeed), key)
-	switch {
-	case root == nil:
-		return &Map{
-			hashSeed: m.hashSeed,
-			count:    m.count - 1,
-			root:     emptySeededBitmapNode(m.hashSeed),
-		}
-	case removed:
-		return &Map{
-			hashSeed: m.hashSeed,
-			count:    m.count - 1,
-			root:     root,
-		}
-	default:
-		return m
-	}
+	return (*Map)(m.typed().Delete(key))
 }
 
 // Equal tests if two maps are Equal by comparing the entries of each.
@@ -256,19 +272,122 @@ func (m *Map) Equal(o interface{}) bool {
 	if !ok {
 		return ok
 	}
-	if m.Length() != other.Length() {
-		return false
-	}
-	foundAll := true
-	iter := m.Iterator()
-	for iter.HasNext() {
-		key, value := iter.Next()
-		if !equalValues(other.At(key), value) {
-			foundAll = false
-			break
-		}
+	return m.typed().Equal(other.typed())
+}
+
+// Union returns a map containing the entries of both maps. When a
+// key is in both maps the value from m is kept.
+func (m *Map) Union(other *Map) *Map {
+	return (*Map)(m.typed().Union(other.typed()))
+}
+
+// Intersection returns a map containing the entries of m whose keys
+// are also in other.
+func (m *Map) Intersection(other *Map) *Map {
+	return (*Map)(m.typed().Intersection(other.typed()))
+}
+
+// Difference returns a map containing the entries of m whose keys are
+// not in other.
+func (m *Map) Difference(other *Map) *Map {
+	return (*Map)(m.typed().Difference(other.typed()))
+}
+
+// SymmetricDifference returns a map containing the entries whose keys
+// are in exactly one of the maps.
+func (m *Map) SymmetricDifference(other *Map) *Map {
+	return (*Map)(m.typed().SymmetricDifference(other.typed()))
+}
+
+// IsSubset returns true if every key of m is also a key of other.
+func (m *Map) IsSubset(other *Map) bool {
+	return m.typed().IsSubset(other.typed())
+}
+
+// IsSuperset returns true if every key of other is also a key of m.
+func (m *Map) IsSuperset(other *Map) bool {
+	return m.typed().IsSuperset(other.typed())
+}
+
+// Disjoint returns true if the maps have no keys in common.
+func (m *Map) Disjoint(other *Map) bool {
+	return m.typed().Disjoint(other.typed())
+}
+
+// Merge returns a map containing the entries of both maps. When a key
+// is in both maps with different values, resolve is called with the
+// key, the value from m and the value from other, and its result is
+// stored. Keys whose values are equal keep that value without calling
+// resolve. If resolve is nil the value from other is kept.
+func (m *Map) Merge(other *Map, resolve func(k, a, b interface{}) interface{}) *Map {
+	return (*Map)(m.typed().Merge(other.typed(), resolve))
+}
+
+// MergeWith merges each of others into m in turn, as if by Merge.
+func (m *Map) MergeWith(resolve func(k, a, b interface{}) interface{}, others ...*Map) *Map {
+	typed := make([]*MapOf[interface{}, interface{}], len(others))
+	for i, other := range others {
+		typed[i] = other.typed()
 	}
-	return foundAll
+	return (*Map)(m.typed().MergeWith(resolve, typed...))
+}
+
+// MarshalJSON implements json.Marshaler. A map whose keys are all
+// strings, or implement encoding.TextMarshaler, is encoded as a JSON
+// object with its members sorted by key. Any other map is encoded as
+// an array of [key, value] pairs.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return m.typed().MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either of the
+// forms produced by MarshalJSON. Keys decoded from an object are
+// strings; keys decoded from pairs take the types encoding/json uses
+// for interface{} values and so must be hashable.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	return m.typed().UnmarshalJSON(data)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Keys and values are encoded with gob unless they implement
+// encoding.BinaryMarshaler, so their concrete types must be
+// registered with gob.Register.
+func (m *Map) MarshalBinary() ([]byte, error) {
+	return m.typed().MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary.
+func (m *Map) UnmarshalBinary(data []byte) error {
+	return m.typed().UnmarshalBinary(data)
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (m *Map) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (m *Map) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
+
+// Persist writes the map to w and returns the hash of its root. Nodes
+// shared with versions previously written by w are not written
+// again. Keys and values are encoded as by MarshalBinary.
+func (m *Map) Persist(w *persist.Writer) (persist.Hash, error) {
+	return m.typed().Persist(w)
+}
+
+// Load reads the map whose root hash was returned by Persist. Nodes
+// are read as they are first used and nodes already read by r are
+// shared with the maps it returned before that were loaded with
+// the same Option values. A map created with Hasher or equality
+// options must be loaded with the same options; the persisted seed is
+// always used.
+func Load(r *persist.Reader, h persist.Hash, options ...Option) (*Map, error) {
+	m, err := loadMap(r, h, applyOptions(options).hasher)
+	return (*Map)(m), err
 }
 
 // Length returns the number of entries in the map.
@@ -299,32 +418,37 @@ func (m *Map) Length() int {
 //    Is called with reflection and will panic if the kT and vT types are incorrect.
 // Range will panic if passed anything not matching these signatures.
 func (m *Map) Range(do interface{}) {
-	// NOTE: Update other functions using the same pattern
-	//       when modifying the below.
-	//       This code is inlined to avoid heap allocation of
-	//       the closure.
-	var f func(Entry) bool
+	m.root.rnge(genEntryRangeFunc(do))
+}
+
+// genEntryRangeFunc adapts the function types accepted by Range to
+// the function used to walk the nodes of the map.
+func genEntryRangeFunc(do interface{}) func(entry) bool {
 	switch fn := do.(type) {
 	case func(key, value interface{}) bool:
-		f = func(entry Entry) bool {
-			return fn(entry.Key(), entry.Value())
+		return func(e entry) bool {
+			return fn(e.k, e.v)
 		}
 	case func(key, value interface{}):
-		f = func(entry Entry) bool {
-			fn(entry.Key(), entry.Value())
+		return func(e entry) bool {
+			fn(e.k, e.v)
 			return true
 		}
 	case func(e Entry) bool:
-		f = fn
+		return func(e entry) bool {
+			return fn(e)
+		}
 	case func(e Entry):
-		f = func(entry Entry) bool {
-			fn(entry)
+		return func(e entry) bool {
+			fn(e)
 			return true
 		}
 	default:
-		f = genRangeFunc(do)
+		f := genRangeFunc(do)
+		return func(e entry) bool {
+			return f(e)
+		}
 	}
-	m.root.rnge(f)
 }
 
 func genRangeFunc(do interface{}) func(Entry) bool {
@@ -358,30 +482,30 @@ func genRangeFunc(do interface{}) func(Entry) bool {
 // func(init iT, k kT, v vT) oT
 // Reduce will panic if given any other function type.
 func (m *Map) Reduce(fn interface{}, init interface{}) interface{} {
-	// NOTE: Update other functions using the same pattern
-	//       when modifying the below.
-	//       This code is inlined to avoid heap allocation of
-	//       the closure.
-	var rFn func(interface{}, Entry) interface{}
+	rFn := genEntryReduceFunc(fn)
+	res := init
+	m.root.rnge(func(e entry) bool {
+		res = rFn(res, e)
+		return true
+	})
+	return res
+}
+
+func genEntryReduceFunc(fn interface{}) func(interface{}, Entry) interface{} {
 	switch v := fn.(type) {
 	case func(interface{}, Entry) interface{}:
-		rFn = v
+		return v
 	case func(interface{}, interface{}) interface{}:
-		rFn = func(init interface{}, entry Entry) interface{} {
+		return func(init interface{}, entry Entry) interface{} {
 			return v(init, entry)
 		}
 	case func(interface{}, interface{}, interface{}) interface{}:
-		rFn = func(init interface{}, entry Entry) interface{} {
+		return func(init interface{}, entry Entry) interface{} {
 			return v(init, entry.Key(), entry.Value())
 		}
 	default:
-		rFn = genReduceFunc(fn)
+		return genReduceFunc(fn)
 	}
-	res := init
-	m.Range(func(e Entry) {
-		res = rFn(res, e)
-	})
-	return res
 }
 
 func genReduceFunc(fn interface{}) func(interface{}, Entry) interface{} {
@@ -415,13 +539,7 @@ func (m *Map) Seq() seq.Sequence {
 
 // String returns a string representation of the map.
 func (m *Map) String() string {
-	var b strings.Builder
-	fmt.Fprint(&b, "{ ")
-	m.Range(func(entry Entry) {
-		fmt.Fprintf(&b, "%s ", entry)
-	})
-	fmt.Fprint(&b, "}")
-	return b.String()
+	return m.typed().String()
 }
 
 // Apply takes an arbitrary number of arguments and returns the
@@ -444,6 +562,10 @@ func (m *Map) Transform(actions ...func(*TMap) *TMap) *Map {
 	return out.AsPersistent()
 }
 
+func (m *Map) typed() *MapOf[interface{}, interface{}] {
+	return (*MapOf[interface{}, interface{}])(m)
+}
+
 // TMap is a transient version of a map. Changes made to a transient
 // map will not effect the original persistent structure. Changes to a
 // transient map occur as mutations. These mutations are then made
@@ -451,28 +573,18 @@ func (m *Map) Transform(actions ...func(*TMap) *TMap) *Map {
 // structure. These are useful when appling multiple transforms to a
 // persistent map where the intermediate results will not be seen or
 // stored anywhere.
-type TMap struct {
-	edit     *uint32
-	hashSeed uintptr
-	count    int
-	root     node
-}
+type TMap TMapOf[interface{}, interface{}]
 
 // At returns the value associated with the key.
 // If one is not found, nil is returned.
 func (m *TMap) At(key interface{}) interface{} {
-	m.ensureEditable()
-	v, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
-	if !ok {
-		return nil
-	}
-	return v
+	return m.typed().At(key)
 }
 
 // EntryAt returns the entry (key, value pair) of the key.
 // If one is not found, nil is returned.
 func (m *TMap) EntryAt(key interface{}) Entry {
-	v, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
+	v, ok := findRoot(m.h, m.root, key)
 	if !ok {
 		return nil
 	}
@@ -482,13 +594,7 @@ func (m *TMap) EntryAt(key interface{}) Entry {
 // Assoc associates a value with a key in the map.
 // The transient map is modified and then returned.
 func (m *TMap) Assoc(key, value interface{}) *TMap {
-	m.ensureEditable()
-	root, added := m.root.assoc(m.edit, 0,
-		hash.Any(key, m.hashSeed), key, value)
-	if added {
-		m.count++
-	}
-	m.root = root
+	m.typed().Assoc(key, value)
 	return m
 }
 
@@ -502,13 +608,7 @@ func (m *TMap) Conj(value interface{}) interface{} {
 // AsPersistent will transform this transient map into a persistent map.
 // Once this occurs any additional actions on the transient map will fail.
 func (m *TMap) AsPersistent() *Map {
-	m.ensureEditable()
-	atomic.StoreUint32(m.edit, 0)
-	return &Map{
-		hashSeed: m.hashSeed,
-		count:    m.count,
-		root:     m.root,
-	}
+	return (*Map)(m.typed().AsPersistent())
 }
 
 // MakePersistent is a generic version of AsPersistent.
@@ -518,30 +618,19 @@ func (m *TMap) MakePersistent() interface{} {
 
 // Contains will test if the key exists in the map.
 func (m *TMap) Contains(key interface{}) bool {
-	m.ensureEditable()
-	_, ok := m.root.find(0, hash.Any(key, m.hashSeed), key)
-	return ok
+	return m.typed().Contains(key)
 }
 
 // Find will return the value for a key if it exists in the map and
 // whether the key exists in the map. For non-nil values, exists will
 // always be true.
 func (m *TMap) Find(key interface{}) (value interface{}, exists bool) {
-	return m.root.find(0, hash.Any(key, m.hashSeed), key)
+	return m.typed().Find(key)
 }
 
 // Delete removes a key and associated value from the map.
 func (m *TMap) Delete(key interface{}) *TMap {
-	m.ensureEditable()
-	root, removed := m.root.without(m.edit, 0,
-		hash.Any(key, m.hashSeed), key)
-	if root == nil {
-		root = emptySeededBitmapNode(m.hashSeed)
-	}
-	if removed {
-		m.count--
-	}
-	m.root = root
+	m.typed().Delete(key)
 	return m
 }
 
@@ -553,18 +642,7 @@ func (m *TMap) Equal(o interface{}) bool {
 	if !ok {
 		return ok
 	}
-	if m.Length() != other.Length() {
-		return false
-	}
-	foundAll := true
-	m.Range(func(key, value interface{}) bool {
-		if !equalValues(other.At(key), value) {
-			foundAll = false
-			return false
-		}
-		return true
-	})
-	return foundAll
+	return m.typed().Equal(other.typed())
 }
 
 // Length returns the number of entries in the map.
@@ -580,12 +658,6 @@ func (m *TMap) Apply(args ...interface{}) interface{} {
 	return m.At(key)
 }
 
-func (m *TMap) ensureEditable() {
-	if atomic.LoadUint32(m.edit) == 0 {
-		panic(errTafterP)
-	}
-}
-
 // Range will loop over the entries in the Map and call 'do' on each entry.
 // The 'do' function may be of many types:
 //
@@ -609,33 +681,7 @@ func (m *TMap) ensureEditable() {
 //    Is called with reflection and will panic if the kT and vT types are incorrect.
 // Range will panic if passed anything not matching these signatures.
 func (m *TMap) Range(do interface{}) {
-	// NOTE: Update other functions using the same pattern
-	//       when modifying the below.
-	//       This code is inlined to avoid heap allocation of
-	//       the closure.
-	var f func(Entry) bool
-	switch fn := do.(type) {
-	case func(key, value interface{}) bool:
-		f = func(entry Entry) bool {
-			return fn(entry.Key(), entry.Value())
-		}
-	case func(key, value interface{}):
-		f = func(entry Entry) bool {
-			fn(entry.Key(), entry.Value())
-			return true
-		}
-	case func(e Entry) bool:
-		f = fn
-	case func(e Entry):
-		f = func(entry Entry) bool {
-			fn(entry)
-			return true
-		}
-	default:
-		f = genRangeFunc(do)
-	}
-
-	m.root.rnge(f)
+	m.root.rnge(genEntryRangeFunc(do))
 }
 
 // Reduce is a fast mechanism for reducing a Map. Reduce can take
@@ -647,200 +693,154 @@ func (m *TMap) Range(do interface{}) {
 // func(init iT, k kT, v vT) oT
 // Reduce will panic if given any other function type.
 func (m *TMap) Reduce(fn interface{}, init interface{}) interface{} {
-	// NOTE: Update other functions using the same pattern
-	//       when modifying the below.
-	//       This code is inlined to avoid heap allocation of
-	//       the closure.
-	var rFn func(interface{}, Entry) interface{}
-	switch v := fn.(type) {
-	case func(interface{}, Entry) interface{}:
-		rFn = v
-	case func(interface{}, interface{}) interface{}:
-		rFn = func(init interface{}, entry Entry) interface{} {
-			return v(init, entry)
-		}
-	case func(interface{}, interface{}, interface{}) interface{}:
-		rFn = func(init interface{}, entry Entry) interface{} {
-			return v(init, entry.Key(), entry.Value())
-		}
-	default:
-		rFn = genReduceFunc(fn)
-	}
+	rFn := genEntryReduceFunc(fn)
 	res := init
-	m.Range(func(e Entry) {
+	m.root.rnge(func(e entry) bool {
 		res = rFn(res, e)
+		return true
 	})
 	return res
 }
 
 // String returns a string representation of the map.
 func (m *TMap) String() string {
-	var b strings.Builder
-	fmt.Fprint(&b, "{ ")
-	m.Range(func(entry Entry) {
-		fmt.Fprintf(&b, "%s ", entry)
-	})
-	fmt.Fprint(&b, "}")
-	return b.String()
+	return m.typed().String()
+}
+
+func (m *TMap) typed() *TMapOf[interface{}, interface{}] {
+	return (*TMapOf[interface{}, interface{}])(m)
 }
 
-type node interface {
+type node[K comparable, V any] interface {
 	assoc(edit *uint32, shift uint, hash uintptr,
-		k, v interface{}) (node, bool)
+		k K, v V) (node[K, V], bool)
 	without(edit *uint32, shift uint, hash uintptr,
-		k interface{}) (node, bool)
-	find(shift uint, hash uintptr, k interface{}) (interface{}, bool)
+		k K) (node[K, V], bool)
+	find(shift uint, hash uintptr, k K) (V, bool)
 	seq() seq.Sequence
-	rnge(func(Entry) bool) bool
+	rnge(func(entryOf[K, V]) bool) bool
 }
 
-type entry struct {
-	k, v interface{}
+type entry = entryOf[interface{}, interface{}]
+
+type entryOf[K comparable, V any] struct {
+	k K
+	v V
+	// hash is the hash of k, computed when the entry is stored in
+	// the trie so it never has to be hashed again. The entries of a
+	// flatNode aren't hashed and leave it unset.
+	hash uintptr
 }
 
-func (e entry) Key() interface{} {
+func (e entryOf[K, V]) Key() K {
 	return e.k
 }
 
-func (e entry) Value() interface{} {
+func (e entryOf[K, V]) Value() V {
 	return e.v
 }
 
-func (e entry) String() string {
-	return fmt.Sprintf("[%v %v]", e.k, e.v)
+// withoutHash returns the entry as it is handed out of the map, so it
+// compares equal to one built by EntryNew.
+func (e entryOf[K, V]) withoutHash() entryOf[K, V] {
+	return entryOf[K, V]{k: e.k, v: e.v}
 }
 
-func (e entry) isLeaf() bool {
-	return e.k != nil
+func (e entryOf[K, V]) String() string {
+	return fmt.Sprintf("[%v %v]", e.k, e.v)
 }
 
-func (e entry) matches(k interface{}) bool {
-	return dyn.EqualNonComparable(k, e.k)
+// slot is the content of a position in a node. It either holds an
+// entry or a sub-node.
+type slot[K comparable, V any] struct {
+	entryOf[K, V]
+	n node[K, V]
 }
 
-type entries []entry
+func (s slot[K, V]) isLeaf() bool {
+	return s.n == nil
+}
 
-func (e entries) insert(idx int, ent entry) entries {
+func insertAt[E any](e []E, idx int, ent E) []E {
 	if cap(e) >= len(e)+1 {
 		// This accounts for the transient case where
 		// we might pop elements but the whole backing
 		// array still exists and may be larger than
 		// the current slice.
-		out := append(e, entry{})
+		var zero E
+		out := append(e, zero)
 		copy(out[idx+1:], e[idx:])
 		out[idx] = ent
 		return out
 	}
-	out := make([]entry, len(e)+1)
+	out := make([]E, len(e)+1)
 	copy(out, e[:idx])
 	out[idx] = ent
 	copy(out[idx+1:], e[idx:])
 	return out
 }
 
-func (e entries) assoc(idx int, ent entry) entries {
-	e[idx] = ent
-	return e
-}
-
-func (e entries) append(ent entry) entries {
+func appendExact[E any](e []E, ent E) []E {
 	if cap(e) >= len(e)+1 {
 		return append(e, ent)
 	}
 	// We don't want Go's append semantics we just want to
 	// increase by one entry at a time so we do it our selves
-	out := make([]entry, len(e)+1)
+	out := make([]E, len(e)+1)
 	copy(out, e)
 	out[len(e)] = ent
 	return out
 }
 
-func (e entries) copy() entries {
-	out := make([]entry, len(e))
+func copySlice[E any](e []E) []E {
+	out := make([]E, len(e))
 	copy(out, e)
 	return out
 }
 
-func (e entries) copyWithCap(cap int) entries {
-	out := make([]entry, len(e), cap)
+func copyWithCap[E any](e []E, cap int) []E {
+	out := make([]E, len(e), cap)
 	copy(out, e)
 	return out
 }
 
-func (e entries) remove(idx int) entries {
+func removeAt[E any](e []E, idx int) []E {
+	var zero E
 	out := e
 	copy(out[idx:], out[idx+1:])
-	out[len(out)-1] = entry{}
+	out[len(out)-1] = zero
 	out = out[:len(out)-1]
 	return out
 }
 
-type entrySeq struct {
-	es    entries
+type entrySeq[K comparable, V any] struct {
+	es    []entryOf[K, V]
 	index int
-	s     seq.Sequence
 }
 
-func entrySeqNew(es entries, index int, s seq.Sequence) *entrySeq {
-	if s != nil {
-		return &entrySeq{
-			es:    es,
-			index: index,
-			s:     s,
-		}
+func entrySeqNew[K comparable, V any](es []entryOf[K, V], index int) *entrySeq[K, V] {
+	if index >= len(es) {
+		return nil
 	}
-	for i := index; i < len(es); i++ {
-		entry := es[i]
-		if entry.isLeaf() {
-			return &entrySeq{
-				es:    es,
-				index: i,
-				s:     nil,
-			}
-		}
-		if entry.v == nil {
-			continue
-		}
-		n := entry.v.(node)
-		if n == nil {
-			continue
-		}
-		nodeSeq := n.seq()
-		if nodeSeq == nil {
-			continue
-		}
-		return &entrySeq{
-			es:    es,
-			index: i + 1,
-			s:     nodeSeq,
-		}
+	return &entrySeq[K, V]{
+		es:    es,
+		index: index,
 	}
-	return nil
 }
 
-func (e *entrySeq) First() interface{} {
-	if e.s != nil {
-		return e.s.First()
-	}
-	return e.es[e.index]
+func (e *entrySeq[K, V]) First() interface{} {
+	return e.es[e.index].withoutHash()
 }
 
-func (e *entrySeq) Next() seq.Sequence {
-	if e.s != nil {
-		out := entrySeqNew(e.es, e.index, e.s.Next())
-		if out == nil {
-			return nil
-		}
-		return out
-	}
-	out := entrySeqNew(e.es, e.index+1, nil)
+func (e *entrySeq[K, V]) Next() seq.Sequence {
+	out := entrySeqNew(e.es, e.index+1)
 	if out == nil {
 		return nil
 	}
 	return out
 }
 
-func (e *entrySeq) String() string {
+func (e *entrySeq[K, V]) String() string {
 	return seq.ConvertToString(e)
 }
 
@@ -1,9 +1,14 @@
 package hashmap
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/hash"
 	"jsouthworth.net/go/seq"
 )
 
@@ -54,10 +60,86 @@ func BenchmarkNativeMapInterfaceAssoc(b *testing.B) {
 }
 
 func TestEmptyGeneratesSeededEmpty(t *testing.T) {
-	assert(t, Empty().hashSeed != Empty().hashSeed,
+	assert(t, Empty().h.seed != Empty().h.seed,
 		"Empty generated the same seed")
 }
 
+// foldCase makes string keys case insensitive.
+var foldCase = []Option{
+	Hasher(func(k interface{}, seed uintptr) uintptr {
+		return hash.Any(strings.ToLower(k.(string)), seed)
+	}),
+	KeyEqual(func(k1, k2 interface{}) bool {
+		return strings.EqualFold(k1.(string), k2.(string))
+	}),
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("case insensitive keys", func(t *testing.T) {
+		m := Empty(foldCase...).Assoc("Key", 1).Assoc("KEY", 2)
+		if m.Length() != 1 || m.At("key") != 2 {
+			t.Fatal("didn't get expected map", m)
+		}
+		m = m.Delete("kEy").Assoc("A", 1)
+		if !m.Contains("a") {
+			t.Fatal("deleting to empty lost the options", m)
+		}
+		m = m.Transform(func(tm *TMap) *TMap {
+			return tm.Delete("a").Assoc("B", 1).Assoc("b", 2)
+		})
+		if m.Length() != 1 || m.At("B") != 2 {
+			t.Fatal("transient lost the options", m)
+		}
+	})
+	t.Run("value equality", func(t *testing.T) {
+		m := Empty(ValueEqual(func(v1, v2 interface{}) bool {
+			return math.Abs(v1.(float64)-v2.(float64)) < 1e-9
+		})).Assoc("a", 1.0)
+		if m.Assoc("a", 1.0+1e-12) != m {
+			t.Fatal("a nearly equal value replaced the original")
+		}
+		if !m.Equal(m.Delete("a").Assoc("a", 1.0-1e-12)) {
+			t.Fatal("the maps should have been equal")
+		}
+	})
+	t.Run("seed", func(t *testing.T) {
+		a, b := Empty(Seed(42)), Empty(Seed(42))
+		if a.h.seed != 42 || b.h.seed != 42 {
+			t.Fatal("the seed wasn't used")
+		}
+		for i := 0; i < 100; i++ {
+			a = a.Assoc(i, i)
+			b = b.Assoc(99-i, 99-i)
+		}
+		if a.String() != b.String() {
+			t.Fatal("maps with the same seed had different orders")
+		}
+	})
+	t.Run("set operations", func(t *testing.T) {
+		a := Empty(foldCase...).Assoc("a", 1).Assoc("b", 2)
+		b := Empty(foldCase...).Assoc("A", 3).Assoc("C", 4)
+		if u := a.Union(b); u.Length() != 3 || !u.Contains("c") {
+			t.Fatal("didn't get expected union", u)
+		}
+		if i := a.Intersection(b); i.Length() != 1 || !i.Contains("A") {
+			t.Fatal("didn't get expected intersection", i)
+		}
+		added, removed, _ := Diff(a, b)
+		if added.Length() != 1 || removed.Length() != 1 {
+			t.Fatal("didn't get expected diff", added, removed)
+		}
+	})
+	t.Run("decoding", func(t *testing.T) {
+		m := Empty(foldCase...)
+		if err := json.Unmarshal([]byte(`{"A":1,"a":2}`), m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Length() != 1 || !m.Contains("a") {
+			t.Fatal("decoding lost the options", m)
+		}
+	})
+}
+
 func TestNew(t *testing.T) {
 	parameters := gopter.DefaultTestParameters()
 	properties := gopter.NewProperties(parameters)
@@ -1759,3 +1841,90 @@ func TestReduce(t *testing.T) {
 			}
 		})
 }
+
+func TestJSON(t *testing.T) {
+	m := New("b", 2.0, "a", 1.0)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":1,"b":2}` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Map
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(m) {
+		t.Fatalf("expected %v, got %v", m, &got)
+	}
+
+	mixed := New(1.0, "one", "two", 2.0)
+	data, err = json.Marshal(mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs [][2]interface{}
+	if err := json.Unmarshal(data, &pairs); err != nil || len(pairs) != 2 {
+		t.Fatalf("expected pairs, got %s", data)
+	}
+	got = Map{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(mixed) {
+		t.Fatalf("expected %v, got %v", mixed, &got)
+	}
+
+	var typed *MapOf[int, string]
+	if err := json.Unmarshal([]byte(`{"1":"one","2":"two"}`), &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.Length() != 2 || typed.At(1) != "one" || typed.At(2) != "two" {
+		t.Fatalf("unexpected typed map %v", typed)
+	}
+	data, err = json.Marshal(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[[1,"one"],[2,"two"]]` && string(data) != `[[2,"two"],[1,"one"]]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	if err := json.Unmarshal([]byte(`[[1]]`), &typed); err == nil {
+		t.Fatal("expected an error for a malformed pair")
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Map
+	}
+	in := snapshot{Value: New("one", 1, 2, "two", 3.5, nil)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Map).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	typed, err := NewOf(map[string]int{"a": 1, "b": 2}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got MapOf[string, int]
+	if err := got.UnmarshalBinary(typed); err != nil ||
+		got.Length() != 2 || got.At("a") != 1 || got.At("b") != 2 {
+		t.Fatalf("unexpected typed map %v, %v", &got, err)
+	}
+}
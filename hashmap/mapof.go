@@ -0,0 +1,503 @@
+package hashmap
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/hash"
+	"jsouthworth.net/go/seq"
+)
+
+// EntryOf is a typed map entry. Each entry consists of a key and value.
+type EntryOf[K comparable, V any] interface {
+	Key() K
+	Value() V
+}
+
+// EntryOfNew constructs a typed map entry that may be used with Conj.
+func EntryOfNew[K comparable, V any](key K, value V) EntryOf[K, V] {
+	return entryOf[K, V]{k: key, v: value}
+}
+
+// MapOf is a persistent immutable map with keys of type K and values
+// of type V. Operations on the map return a new map that shares much
+// of the structure with the original map. MapOf uses the same HAMT
+// as Map but keys and values are stored without boxing and the
+// functions passed to Range are called directly.
+type MapOf[K comparable, V any] struct {
+	h     *hasher[K, V]
+	count int
+	root  node[K, V]
+}
+
+// hasher holds the seed, hash function and equality functions of a
+// map. It is shared by every version of the map and all of their
+// nodes. A nil function selects the default from the hash and dyn
+// libraries.
+type hasher[K comparable, V any] struct {
+	seed      uintptr
+	hashFn    func(k K, seed uintptr) uintptr
+	keyEqFn   func(k1, k2 K) bool
+	valueEqFn func(v1, v2 V) bool
+	ids       hasherIDs
+}
+
+// hasherIDs identify the options the functions of a hasher were given
+// by. Functions can't be compared, so a persist.Reader only shares the
+// nodes it has decoded between maps loaded with the same options.
+type hasherIDs struct {
+	hashFn, keyEqFn, valueEqFn *optionID
+}
+
+type optionID struct {
+	_ byte // a zero sized optionID wouldn't have a unique address
+}
+
+func (h *hasher[K, V]) hash(k K) uintptr {
+	if h.hashFn == nil {
+		return hash.Any(k, h.seed)
+	}
+	return h.hashFn(k, h.seed)
+}
+
+func (h *hasher[K, V]) keyEqual(k1, k2 K) bool {
+	if h.keyEqFn == nil {
+		return dyn.EqualNonComparable(k1, k2)
+	}
+	return h.keyEqFn(k1, k2)
+}
+
+func (h *hasher[K, V]) valueEqual(v1, v2 V) bool {
+	if h.valueEqFn == nil {
+		return equalValues(v1, v2)
+	}
+	return h.valueEqFn(v1, v2)
+}
+
+// sameHash reports whether keys hash to the same values under h and
+// other, in which case tries built with them have the same shape.
+// Functions can't be compared so a Hasher option is only known to
+// match itself.
+func (h *hasher[K, V]) sameHash(other *hasher[K, V]) bool {
+	if h == other {
+		return true
+	}
+	return h.hashFn == nil && other.hashFn == nil && h.seed == other.seed
+}
+
+// EmptyOf returns a new empty persistent typed map with a random
+// hashSeed.
+func EmptyOf[K comparable, V any]() *MapOf[K, V] {
+	return emptyWithHasher(&hasher[K, V]{seed: uintptr(rand.Uint64())})
+}
+
+func emptyWithHasher[K comparable, V any](h *hasher[K, V]) *MapOf[K, V] {
+	return &MapOf[K, V]{
+		h:    h,
+		root: emptyFlatNode(h),
+	}
+}
+
+// NewOf converts a go native map to a persistent typed map.
+func NewOf[K comparable, V any](entries map[K]V) *MapOf[K, V] {
+	out := EmptyOf[K, V]().AsTransient()
+	for key, val := range entries {
+		out = out.Assoc(key, val)
+	}
+	return out.AsPersistent()
+}
+
+// At returns the value associated with the key.
+// If one is not found, the zero value of V is returned.
+func (m *MapOf[K, V]) At(key K) V {
+	v, _ := findRoot(m.h, m.root, key)
+	return v
+}
+
+// EntryAt returns the entry (key, value pair) of the key.
+// If one is not found, nil is returned.
+func (m *MapOf[K, V]) EntryAt(key K) EntryOf[K, V] {
+	v, ok := findRoot(m.h, m.root, key)
+	if !ok {
+		return nil
+	}
+	return entryOf[K, V]{k: key, v: v}
+}
+
+// Assoc associates a value with a key in the map.
+// A new persistent map is returned if the key and value
+// are different from one already in the map, if the entry
+// is already in the map the original map is returned.
+func (m *MapOf[K, V]) Assoc(key K, value V) *MapOf[K, V] {
+	root, added := assocRoot(zero, m.h, m.root, key, value)
+	switch {
+	case root == m.root:
+		return m
+	case added:
+		return &MapOf[K, V]{
+			h:     m.h,
+			count: m.count + 1,
+			root:  root,
+		}
+	default: //replaced key
+		return &MapOf[K, V]{
+			h:     m.h,
+			count: m.count,
+			root:  root,
+		}
+	}
+}
+
+// Conj takes a value that must be an EntryOf[K, V]. Conj implements
+// a generic mechanism for building collections.
+func (m *MapOf[K, V]) Conj(value interface{}) interface{} {
+	entry := value.(EntryOf[K, V])
+	return m.Assoc(entry.Key(), entry.Value())
+}
+
+// AsNative returns the map converted to a go native map type.
+func (m *MapOf[K, V]) AsNative() map[K]V {
+	out := make(map[K]V, m.count)
+	iter := m.Iterator()
+	for iter.HasNext() {
+		key, val := iter.Next()
+		out[key] = val
+	}
+	return out
+}
+
+// AsTransient will return a transient map that shares
+// structure with the persistent map.
+func (m *MapOf[K, V]) AsTransient() *TMapOf[K, V] {
+	return &TMapOf[K, V]{
+		h:     m.h,
+		count: m.count,
+		root:  m.root,
+		edit:  atomicOne(),
+	}
+}
+
+// MakeTransient is a generic version of AsTransient.
+func (m *MapOf[K, V]) MakeTransient() interface{} {
+	return m.AsTransient()
+}
+
+// Contains will test if the key exists in the map.
+func (m *MapOf[K, V]) Contains(key K) bool {
+	_, ok := findRoot(m.h, m.root, key)
+	return ok
+}
+
+// Find will return the value for a key if it exists in the map and
+// whether the key exists in the map.
+func (m *MapOf[K, V]) Find(key K) (value V, exists bool) {
+	return findRoot(m.h, m.root, key)
+}
+
+// Delete removes a key and associated value from the map.
+func (m *MapOf[K, V]) Delete(key K) *MapOf[K, V] {
+	root, removed := withoutRoot(zero, m.h, m.root, key, m.count)
+	if !removed {
+		return m
+	}
+	return &MapOf[K, V]{
+		h:     m.h,
+		count: m.count - 1,
+		root:  root,
+	}
+}
+
+// Equal tests if two maps are Equal by comparing the entries of each.
+// Equal implements the Equaler which allows for deep
+// comparisons when there are maps of maps
+func (m *MapOf[K, V]) Equal(o interface{}) bool {
+	other, ok := o.(*MapOf[K, V])
+	if !ok {
+		return ok
+	}
+	if m.Length() != other.Length() {
+		return false
+	}
+	if m.sameShape(other) {
+		return equalNodes(m.h, m.root, other.root)
+	}
+	iter := m.Iterator()
+	for iter.HasNext() {
+		key, value := iter.Next()
+		v, ok := other.Find(key)
+		if !ok || !m.h.valueEqual(v, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalNodes reports whether the tries a and b, built with the same
+// hash, hold the same entries. Both tries are canonical so they have
+// the same shape exactly when they hold the same keys, and shared
+// sub-tries are skipped without being walked.
+func equalNodes[K comparable, V any](h *hasher[K, V], a, b node[K, V]) bool {
+	if sameNode(a, b) {
+		return true
+	}
+	switch a := resolve(a).(type) {
+	case *bitmapIndexedNode[K, V]:
+		b, ok := resolve(b).(*bitmapIndexedNode[K, V])
+		if !ok || a.dataMap != b.dataMap || a.nodeMap != b.nodeMap {
+			return false
+		}
+		for i, e := range a.entries {
+			if e.hash != b.entries[i].hash ||
+				!h.keyEqual(e.k, b.entries[i].k) ||
+				!h.valueEqual(b.entries[i].v, e.v) {
+				return false
+			}
+		}
+		for i, n := range a.nodes {
+			if !equalNodes(h, n, b.nodes[i]) {
+				return false
+			}
+		}
+		return true
+	case *hashCollisionNode[K, V]:
+		b, ok := resolve(b).(*hashCollisionNode[K, V])
+		if !ok || a.hash != b.hash || len(a.array) != len(b.array) {
+			return false
+		}
+		for _, e := range a.array {
+			idx, found := b.findIndex(e.k)
+			if !found || !h.valueEqual(b.array[idx].v, e.v) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// Length returns the number of entries in the map.
+func (m *MapOf[K, V]) Length() int {
+	return m.count
+}
+
+// Range calls do on each entry of the map until do returns false.
+func (m *MapOf[K, V]) Range(do func(key K, value V) bool) {
+	m.root.rnge(func(e entryOf[K, V]) bool {
+		return do(e.k, e.v)
+	})
+}
+
+// Reduce is a fast mechanism for reducing a typed map. fn is called
+// with the accumulated result and each entry of the map in turn.
+func Reduce[K comparable, V any, R any](
+	m *MapOf[K, V],
+	fn func(res R, key K, value V) R,
+	init R,
+) R {
+	res := init
+	m.Range(func(key K, value V) bool {
+		res = fn(res, key, value)
+		return true
+	})
+	return res
+}
+
+// Iterator provides a mutable iterator over the map. This allows
+// efficient, heap allocation-less access to the contents. Iterators
+// are not safe for concurrent access so they may not be shared
+// between goroutines.
+func (m *MapOf[K, V]) Iterator() IteratorOf[K, V] {
+	i := makeIterator(m.root)
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+// Seq returns a seralized sequence of EntryOf[K, V]
+// corresponding to the maps entries.
+func (m *MapOf[K, V]) Seq() seq.Sequence {
+	return m.root.seq()
+}
+
+// String returns a string representation of the map.
+func (m *MapOf[K, V]) String() string {
+	return mapString(m.root)
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows map to be called
+// as a function by the 'dyn' library.
+func (m *MapOf[K, V]) Apply(args ...interface{}) interface{} {
+	key, _ := args[0].(K)
+	return m.At(key)
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent map. It does this by making a transient
+// map and calling each action on it, then converting it back
+// to a persistent map.
+func (m *MapOf[K, V]) Transform(actions ...func(*TMapOf[K, V]) *TMapOf[K, V]) *MapOf[K, V] {
+	out := m.AsTransient()
+	for _, action := range actions {
+		out = action(out)
+	}
+	return out.AsPersistent()
+}
+
+// TMapOf is a transient version of a typed map. Changes made to a
+// transient map will not effect the original persistent
+// structure. Changes to a transient map occur as mutations. These
+// mutations are then made persistent when the transient is
+// transformed into a persistent structure.
+type TMapOf[K comparable, V any] struct {
+	edit  *uint32
+	h     *hasher[K, V]
+	count int
+	root  node[K, V]
+}
+
+// At returns the value associated with the key.
+// If one is not found, the zero value of V is returned.
+func (m *TMapOf[K, V]) At(key K) V {
+	m.ensureEditable()
+	v, _ := findRoot(m.h, m.root, key)
+	return v
+}
+
+// EntryAt returns the entry (key, value pair) of the key.
+// If one is not found, nil is returned.
+func (m *TMapOf[K, V]) EntryAt(key K) EntryOf[K, V] {
+	v, ok := findRoot(m.h, m.root, key)
+	if !ok {
+		return nil
+	}
+	return entryOf[K, V]{k: key, v: v}
+}
+
+// Assoc associates a value with a key in the map.
+// The transient map is modified and then returned.
+func (m *TMapOf[K, V]) Assoc(key K, value V) *TMapOf[K, V] {
+	m.ensureEditable()
+	root, added := assocRoot(m.edit, m.h, m.root, key, value)
+	if added {
+		m.count++
+	}
+	m.root = root
+	return m
+}
+
+// Conj takes a value that must be an EntryOf[K, V]. Conj implements
+// a generic mechanism for building collections.
+func (m *TMapOf[K, V]) Conj(value interface{}) interface{} {
+	entry := value.(EntryOf[K, V])
+	return m.Assoc(entry.Key(), entry.Value())
+}
+
+// AsPersistent will transform this transient map into a persistent map.
+// Once this occurs any additional actions on the transient map will fail.
+func (m *TMapOf[K, V]) AsPersistent() *MapOf[K, V] {
+	m.ensureEditable()
+	atomic.StoreUint32(m.edit, 0)
+	return &MapOf[K, V]{
+		h:     m.h,
+		count: m.count,
+		root:  m.root,
+	}
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (m *TMapOf[K, V]) MakePersistent() interface{} {
+	return m.AsPersistent()
+}
+
+// Contains will test if the key exists in the map.
+func (m *TMapOf[K, V]) Contains(key K) bool {
+	m.ensureEditable()
+	_, ok := findRoot(m.h, m.root, key)
+	return ok
+}
+
+// Find will return the value for a key if it exists in the map and
+// whether the key exists in the map.
+func (m *TMapOf[K, V]) Find(key K) (value V, exists bool) {
+	return findRoot(m.h, m.root, key)
+}
+
+// Delete removes a key and associated value from the map.
+func (m *TMapOf[K, V]) Delete(key K) *TMapOf[K, V] {
+	m.ensureEditable()
+	root, removed := withoutRoot(m.edit, m.h, m.root, key, m.count)
+	if removed {
+		m.count--
+	}
+	m.root = root
+	return m
+}
+
+// Equal tests if two maps are Equal by comparing the entries of each.
+// Equal implements the Equaler which allows for deep
+// comparisons when there are maps of maps
+func (m *TMapOf[K, V]) Equal(o interface{}) bool {
+	other, ok := o.(*TMapOf[K, V])
+	if !ok {
+		return ok
+	}
+	if m.Length() != other.Length() {
+		return false
+	}
+	foundAll := true
+	m.Range(func(key K, value V) bool {
+		v, ok := other.Find(key)
+		if !ok || !m.h.valueEqual(v, value) {
+			foundAll = false
+			return false
+		}
+		return true
+	})
+	return foundAll
+}
+
+// Length returns the number of entries in the map.
+func (m *TMapOf[K, V]) Length() int {
+	return m.count
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows map to be called
+// as a function by the 'dyn' library.
+func (m *TMapOf[K, V]) Apply(args ...interface{}) interface{} {
+	key, _ := args[0].(K)
+	return m.At(key)
+}
+
+// Range calls do on each entry of the map until do returns false.
+func (m *TMapOf[K, V]) Range(do func(key K, value V) bool) {
+	m.root.rnge(func(e entryOf[K, V]) bool {
+		return do(e.k, e.v)
+	})
+}
+
+// String returns a string representation of the map.
+func (m *TMapOf[K, V]) String() string {
+	return mapString(m.root)
+}
+
+func (m *TMapOf[K, V]) ensureEditable() {
+	if atomic.LoadUint32(m.edit) == 0 {
+		panic(errTafterP)
+	}
+}
+
+func mapString[K comparable, V any](root node[K, V]) string {
+	var b strings.Builder
+	fmt.Fprint(&b, "{ ")
+	root.rnge(func(entry entryOf[K, V]) bool {
+		fmt.Fprintf(&b, "%s ", entry)
+		return true
+	})
+	fmt.Fprint(&b, "}")
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package hashmap
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+func BenchmarkMapOfAssoc(b *testing.B) {
+	b.ReportAllocs()
+	m := EmptyOf[int, int]()
+	for i := 0; i < b.N; i++ {
+		m = m.Assoc(i, i)
+	}
+}
+
+func BenchmarkTMapOfAssoc(b *testing.B) {
+	b.ReportAllocs()
+	m := EmptyOf[int, int]().AsTransient()
+	for i := 0; i < b.N; i++ {
+		m.Assoc(i, i)
+	}
+	m.AsPersistent()
+}
+
+func TestMapOf(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("NewOf(m).AsNative() == m", prop.ForAll(
+		func(native map[string]int) bool {
+			m := NewOf(native)
+			if m.Length() != len(native) {
+				return false
+			}
+			out := m.AsNative()
+			for k, v := range native {
+				if out[k] != v {
+					return false
+				}
+			}
+			return true
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+	))
+	properties.Property("Assoc then At returns value", prop.ForAll(
+		func(native map[string]int, k string, v int) bool {
+			m := NewOf(native).Assoc(k, v)
+			got, ok := m.Find(k)
+			return ok && got == v && m.At(k) == v && m.Contains(k)
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+		gen.AlphaString(),
+		gen.Int(),
+	))
+	properties.Property("Assoc does not modify original", prop.ForAll(
+		func(native map[string]int, k string, v int) bool {
+			m := NewOf(native)
+			_ = m.Assoc(k, v)
+			old, ok := native[k]
+			got, found := m.Find(k)
+			return ok == found && old == got
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+		gen.AlphaString(),
+		gen.Int(),
+	))
+	properties.Property("Delete removes key", prop.ForAll(
+		func(native map[string]int) bool {
+			m := NewOf(native)
+			for k := range native {
+				m = m.Delete(k)
+				if m.Contains(k) {
+					return false
+				}
+			}
+			return m.Length() == 0
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+	))
+	properties.Property("Range visits every entry", prop.ForAll(
+		func(native map[string]int) bool {
+			seen := make(map[string]int)
+			NewOf(native).Range(func(k string, v int) bool {
+				seen[k] = v
+				return true
+			})
+			if len(seen) != len(native) {
+				return false
+			}
+			for k, v := range native {
+				if seen[k] != v {
+					return false
+				}
+			}
+			return true
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+	))
+	properties.Property("Iterator visits every entry", prop.ForAll(
+		func(native map[int]int) bool {
+			seen := make(map[int]int)
+			iter := NewOf(native).Iterator()
+			for iter.HasNext() {
+				k, v := iter.Next()
+				seen[k] = v
+			}
+			if len(seen) != len(native) {
+				return false
+			}
+			for k, v := range native {
+				if seen[k] != v {
+					return false
+				}
+			}
+			return true
+		},
+		gen.MapOf(gen.Int(), gen.Int()),
+	))
+	properties.Property("Reduce sums values", prop.ForAll(
+		func(native map[int]int) bool {
+			exp := 0
+			for _, v := range native {
+				exp += v
+			}
+			got := Reduce(NewOf(native),
+				func(res int, _ int, v int) int {
+					return res + v
+				}, 0)
+			return got == exp
+		},
+		gen.MapOf(gen.Int(), gen.IntRange(-1000, 1000)),
+	))
+	properties.Property("transient and persistent agree", prop.ForAll(
+		func(native map[string]int) bool {
+			p := EmptyOf[string, int]()
+			tr := EmptyOf[string, int]().AsTransient()
+			for k, v := range native {
+				p = p.Assoc(k, v)
+				tr = tr.Assoc(k, v)
+			}
+			return p.Equal(tr.AsPersistent())
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+	))
+	properties.TestingRun(t)
+}
+
+func TestTMapOfAfterPersistent(t *testing.T) {
+	defer func() {
+		r := recover()
+		assert(t, r == errTafterP, "expected transient after persistent panic")
+	}()
+	m := EmptyOf[string, int]().AsTransient()
+	m.AsPersistent()
+	m.Assoc("a", 1)
+}
+
+func TestMapOfUntypedShareStructure(t *testing.T) {
+	m := Empty().Assoc("a", 1).Assoc("b", 2)
+	typed := m.typed()
+	assert(t, typed.Length() == 2, "typed view has wrong length")
+	assert(t, typed.At("b") == 2, "typed view lost entry")
+	assert(t, m.String() == typed.String(), "string forms differ")
+}
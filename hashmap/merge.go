@@ -0,0 +1,30 @@
+package hashmap
+
+// Merge returns a map containing the entries of both maps. When a key
+// is in both maps with different values, resolve is called with the
+// key, the value from m and the value from other, and its result is
+// stored. Keys whose values are equal keep that value without calling
+// resolve. If resolve is nil the value from other is kept.
+//
+// Maps derived from the same original map are merged node by node,
+// skipping the subtrees they still share. Unrelated maps are merged
+// by folding the smaller map into the larger one.
+func (m *MapOf[K, V]) Merge(other *MapOf[K, V], resolve func(k K, a, b V) V) *MapOf[K, V] {
+	if resolve == nil {
+		resolve = keepRight[K, V]
+	}
+	return m.combineResolving(opUnion, other, resolve)
+}
+
+// MergeWith merges each of others into m in turn, as if by Merge.
+func (m *MapOf[K, V]) MergeWith(resolve func(k K, a, b V) V, others ...*MapOf[K, V]) *MapOf[K, V] {
+	out := m
+	for _, other := range others {
+		out = out.Merge(other, resolve)
+	}
+	return out
+}
+
+func keepRight[K comparable, V any](_ K, _, b V) V {
+	return b
+}
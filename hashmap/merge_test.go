@@ -0,0 +1,145 @@
+package hashmap
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/prop"
+)
+
+func sumValues(k, a, b interface{}) interface{} {
+	return a.(int)*10000 + b.(int)
+}
+
+func TestMerge(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MaxSize = 500
+	properties := gopter.NewProperties(parameters)
+	for _, shared := range []bool{true, false} {
+		name := "unrelated "
+		if shared {
+			name = "shared "
+		}
+		properties.Property(name+"Merge", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					exp[k] = v
+				}
+				for k, v := range c.nativeB {
+					if a, ok := exp[k]; ok && a != v {
+						v = sumValues(k, a, v)
+					}
+					exp[k] = v
+				}
+				return matchesNative(c.a.Merge(c.b, sumValues), exp)
+			},
+			genSetopsCase(shared),
+		))
+		properties.Property(name+"Merge keeps other by default", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					exp[k] = v
+				}
+				for k, v := range c.nativeB {
+					exp[k] = v
+				}
+				return matchesNative(c.a.Merge(c.b, nil), exp)
+			},
+			genSetopsCase(shared),
+		))
+	}
+	properties.TestingRun(t)
+}
+
+func TestMergeWith(t *testing.T) {
+	base := New(1, 1, 2, 2, 3, 3)
+	layers := []*Map{
+		base.Assoc(2, 20),
+		base.Assoc(3, 30).Assoc(4, 40),
+		Empty().Assoc(1, 100),
+	}
+	got := base.MergeWith(func(k, a, b interface{}) interface{} {
+		return a.(int) + b.(int)
+	}, layers...)
+	exp := New(1, 101, 2, 24, 3, 33, 4, 40)
+	if !got.Equal(exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if base.MergeWith(nil) != base {
+		t.Fatal("expected merging nothing to return the map")
+	}
+}
+
+func TestMergeReusesStructure(t *testing.T) {
+	base := Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		base.Assoc(i, i)
+	}
+	a := base.AsPersistent()
+	b := a.Assoc(10000, 10000)
+	calls := 0
+	resolve := func(k, a, b interface{}) interface{} {
+		calls++
+		return b
+	}
+	if got := a.Merge(b, resolve); got != b {
+		t.Fatal("expected merge into a superset to return the superset")
+	}
+	if got := b.Merge(a, resolve); got != b {
+		t.Fatal("expected merge of a subset to return the map")
+	}
+	if calls != 0 {
+		t.Fatalf("resolve called %d times for equal values", calls)
+	}
+	c := a.Assoc(5, -5)
+	got := a.Merge(c, resolve)
+	if calls != 1 || got.At(5) != -5 || got.Length() != a.Length() {
+		t.Fatalf("unexpected merge result, %d calls, %v at 5",
+			calls, got.At(5))
+	}
+}
+
+func TestMergeSkipsSharedSubtrees(t *testing.T) {
+	base := Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		base.Assoc(i, i)
+	}
+	orig := base.AsPersistent()
+	a, b, hidden := hideShared(orig.Assoc(1, -1).Assoc(-1, -1),
+		orig.Assoc(1, -2).Assoc(-2, -2))
+	if hidden < width-4 {
+		t.Fatal("expected most sub-nodes to be shared", hidden)
+	}
+	calls := 0
+	got := a.MergeWith(func(k, a, b interface{}) interface{} {
+		calls++
+		return a.(int) + b.(int)
+	}, b)
+	if calls != 1 || got.Length() != 10002 || got.At(1) != -3 {
+		t.Fatalf("unexpected merge result, %d calls, %d entries",
+			calls, got.Length())
+	}
+}
+
+func BenchmarkMergeShared(b *testing.B) {
+	base := Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		base.Assoc(i, i)
+	}
+	m1 := base.AsPersistent()
+	m2 := m1
+	for i := 0; i < 100; i++ {
+		m1 = m1.Assoc(i*7, -i)
+		m2 = m2.Assoc(-i, i)
+	}
+	resolve := func(k, a, b interface{}) interface{} {
+		return b
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m1.Merge(m2, resolve)
+	}
+}
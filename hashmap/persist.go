@@ -0,0 +1,400 @@
+package hashmap
+
+import (
+	"errors"
+	"math/bits"
+
+	"jsouthworth.net/go/immutable/internal/atomic"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/persist"
+	"jsouthworth.net/go/seq"
+)
+
+var errCorruptNode = errors.New("corrupt hashmap node")
+
+// Persist writes the map to w and returns the hash of its root. Each
+// node is written once, so the nodes this map shares with versions
+// previously written by w are not written again. Keys and values are
+// encoded as by MarshalBinary.
+func (m *MapOf[K, V]) Persist(w *persist.Writer) (persist.Hash, error) {
+	root, err := persistNode(w, m.root)
+	if err != nil {
+		return persist.Hash{}, err
+	}
+	return w.Write(m, func() ([]byte, error) {
+		e := binenc.NewEncoder(binenc.HashMapRoot, m.count)
+		e.WriteUvarint(uint64(m.h.seed))
+		e.WriteBytes(root[:])
+		return e.Bytes(), nil
+	})
+}
+
+// LoadOf reads the map whose root hash was returned by Persist. Only
+// the root is read immediately; the other nodes are read through r
+// when they are first used and nodes already read by r are shared
+// with the maps it returned before. Operations on the map panic with
+// a *persist.ReadError if a node can not be read.
+func LoadOf[K comparable, V any](r *persist.Reader, h persist.Hash) (*MapOf[K, V], error) {
+	return loadMap(r, h, hasher[K, V]{})
+}
+
+// loadMap reads the map whose root hash is h. The map hashes and
+// compares its keys with the functions of hs and the seed it was
+// persisted with.
+func loadMap[K comparable, V any](r *persist.Reader, h persist.Hash, hs hasher[K, V]) (*MapOf[K, V], error) {
+	return persist.ReadIn(r, hs.ids, h, func(data []byte) (*MapOf[K, V], error) {
+		d, count, err := binenc.NewDecoder(data, binenc.HashMapRoot)
+		if err != nil {
+			return nil, err
+		}
+		seed, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		root, err := readHash(d)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.Done(); err != nil {
+			return nil, err
+		}
+		hs.seed = uintptr(seed)
+		n, err := loadNode(r, root, &hs)
+		if err != nil {
+			return nil, err
+		}
+		return &MapOf[K, V]{
+			h:     &hs,
+			count: count,
+			root:  n,
+		}, nil
+	})
+}
+
+func persistNode[K comparable, V any](w *persist.Writer, n node[K, V]) (persist.Hash, error) {
+	if n, ok := n.(*lazyNode[K, V]); ok {
+		// A node that hasn't been read needn't be if it is
+		// written back to the store it came from.
+		return w.WriteFrom(n, n.r.Store(), n.hash, func() ([]byte, error) {
+			return encodeNode(w, n.load())
+		})
+	}
+	return w.Write(n, func() ([]byte, error) {
+		return encodeNode(w, n)
+	})
+}
+
+func encodeNode[K comparable, V any](w *persist.Writer, n node[K, V]) ([]byte, error) {
+	switch n := n.(type) {
+	case *bitmapIndexedNode[K, V]:
+		return encodeBitmapNode(w, n)
+	case *hashCollisionNode[K, V]:
+		return encodeCollisionNode(n)
+	case *flatNode[K, V]:
+		return encodeFlatNode(n)
+	default:
+		return nil, errCorruptNode
+	}
+}
+
+func encodeBitmapNode[K comparable, V any](w *persist.Writer, n *bitmapIndexedNode[K, V]) ([]byte, error) {
+	children := make([]persist.Hash, len(n.nodes))
+	for i, child := range n.nodes {
+		h, err := persistNode(w, child)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = h
+	}
+	// The entries and sub-nodes are written in the order of their
+	// positions, each preceded by a flag telling them apart.
+	e := binenc.NewEncoder(binenc.HashMapChampNode, len(n.entries)+len(n.nodes))
+	e.WriteUvarint(uint64(n.h.seed))
+	e.WriteUvarint(uint64(n.dataMap | n.nodeMap))
+	d, c := 0, 0
+	for i := uint(0); i < width; i++ {
+		bit := uint32(1) << i
+		switch {
+		case n.dataMap&bit != 0:
+			e.WriteUvarint(0)
+			if err := encodeEntry(e, n.entries[d]); err != nil {
+				return nil, err
+			}
+			d++
+		case n.nodeMap&bit != 0:
+			e.WriteUvarint(1)
+			e.WriteBytes(children[c][:])
+			c++
+		}
+	}
+	return e.Bytes(), nil
+}
+
+func encodeCollisionNode[K comparable, V any](n *hashCollisionNode[K, V]) ([]byte, error) {
+	e := binenc.NewEncoder(binenc.HashMapCollisionNode, len(n.array))
+	e.WriteUvarint(uint64(n.h.seed))
+	e.WriteUvarint(uint64(n.hash))
+	for _, ent := range n.array {
+		if err := encodeEntry(e, ent); err != nil {
+			return nil, err
+		}
+	}
+	return e.Bytes(), nil
+}
+
+func encodeFlatNode[K comparable, V any](n *flatNode[K, V]) ([]byte, error) {
+	e := binenc.NewEncoder(binenc.HashMapFlatNode, len(n.array))
+	e.WriteUvarint(uint64(n.h.seed))
+	for _, ent := range n.array {
+		if err := encodeEntry(e, ent); err != nil {
+			return nil, err
+		}
+	}
+	return e.Bytes(), nil
+}
+
+func encodeEntry[K comparable, V any](e *binenc.Encoder, ent entryOf[K, V]) error {
+	if err := binenc.Encode(e, ent.k); err != nil {
+		return err
+	}
+	return binenc.Encode(e, ent.v)
+}
+
+// loadNode reads the node whose hash is h giving it hs. A node
+// persisted with a different seed than hs is corrupt.
+func loadNode[K comparable, V any](r *persist.Reader, h persist.Hash, hs *hasher[K, V]) (node[K, V], error) {
+	return persist.ReadIn(r, hs.ids, h, func(data []byte) (node[K, V], error) {
+		kind, err := binenc.KindOf(data)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case binenc.HashMapChampNode:
+			return decodeChampNode(r, data, hs)
+		case binenc.HashMapCollisionNode:
+			return decodeCollisionNode(data, hs)
+		case binenc.HashMapFlatNode:
+			return decodeFlatNode(data, hs)
+		default:
+			return nil, errCorruptNode
+		}
+	})
+}
+
+// decodeChampNode decodes a node of the trie. Its sub-nodes are only
+// read when they are first used.
+func decodeChampNode[K comparable, V any](r *persist.Reader, data []byte, hs *hasher[K, V]) (node[K, V], error) {
+	d, count, err := binenc.NewDecoder(data, binenc.HashMapChampNode)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	bitmap, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if uintptr(seed) != hs.seed ||
+		bitmap > 1<<width-1 || bits.OnesCount64(bitmap) != count {
+		return nil, errCorruptNode
+	}
+	n := emptySeededBitmapNode(hs)
+	for i := uint(0); i < width; i++ {
+		bit := uint32(1) << i
+		if uint32(bitmap)&bit == 0 {
+			continue
+		}
+		isNode, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		switch isNode {
+		case 0:
+			var e entryOf[K, V]
+			if e, err = decodeEntry[K, V](d); err == nil {
+				// Hashes aren't part of the encoding.
+				e.hash = hs.hash(e.k)
+				n.dataMap |= bit
+				n.entries = append(n.entries, e)
+			}
+		case 1:
+			var h persist.Hash
+			if h, err = readHash(d); err == nil {
+				n.nodeMap |= bit
+				n.nodes = append(n.nodes, &lazyNode[K, V]{r: r, hash: h, h: hs})
+			}
+		default:
+			err = errCorruptNode
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, d.Done()
+}
+
+// lazyNode stands in for a sub-node of a loaded trie that has not been
+// read. It reads the node through the Reader the first time it is
+// needed and keeps it. A change that leaves the node as it was leaves
+// the lazyNode in its place, so versions of a map still share the
+// sub-tries they haven't changed.
+type lazyNode[K comparable, V any] struct {
+	r      *persist.Reader
+	hash   persist.Hash
+	h      *hasher[K, V]
+	loaded atomic.Value[node[K, V]]
+}
+
+func (n *lazyNode[K, V]) load() node[K, V] {
+	if loaded, ok := n.loaded.Load(); ok {
+		return loaded
+	}
+	loaded, err := loadNode(n.r, n.hash, n.h)
+	if err == nil && isFlat(loaded) {
+		err = errCorruptNode
+	}
+	if err != nil {
+		panic(&persist.ReadError{Hash: n.hash, Err: err})
+	}
+	return n.loaded.Store(loaded)
+}
+
+func (n *lazyNode[K, V]) assoc(
+	edit *uint32,
+	shift uint,
+	hash uintptr,
+	k K, v V,
+) (node[K, V], bool) {
+	loaded := n.load()
+	out, added := loaded.assoc(edit, shift, hash, k, v)
+	if out == loaded {
+		return n, added
+	}
+	return out, added
+}
+
+func (n *lazyNode[K, V]) without(
+	edit *uint32,
+	shift uint,
+	hash uintptr,
+	k K,
+) (node[K, V], bool) {
+	loaded := n.load()
+	out, removed := loaded.without(edit, shift, hash, k)
+	if out == loaded {
+		return n, removed
+	}
+	return out, removed
+}
+
+func (n *lazyNode[K, V]) find(shift uint, hash uintptr, k K) (V, bool) {
+	return n.load().find(shift, hash, k)
+}
+
+func (n *lazyNode[K, V]) seq() seq.Sequence {
+	return n.load().seq()
+}
+
+func (n *lazyNode[K, V]) rnge(fn func(entryOf[K, V]) bool) bool {
+	return n.load().rnge(fn)
+}
+
+// resolve returns the node a lazyNode stands in for, or n itself.
+func resolve[K comparable, V any](n node[K, V]) node[K, V] {
+	if l, ok := n.(*lazyNode[K, V]); ok {
+		return l.load()
+	}
+	return n
+}
+
+// sameNode reports whether a and b are the same node, in memory or as
+// the same node of a store that hasn't been read yet.
+func sameNode[K comparable, V any](a, b node[K, V]) bool {
+	if a == b {
+		return true
+	}
+	la, ok := a.(*lazyNode[K, V])
+	if !ok {
+		return false
+	}
+	lb, ok := b.(*lazyNode[K, V])
+	return ok && la.r == lb.r && la.hash == lb.hash &&
+		la.h.seed == lb.h.seed && la.h.ids == lb.h.ids
+}
+
+func decodeCollisionNode[K comparable, V any](data []byte, hs *hasher[K, V]) (node[K, V], error) {
+	d, count, err := binenc.NewDecoder(data, binenc.HashMapCollisionNode)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// Every entry takes at least four bytes.
+	if uintptr(seed) != hs.seed || count > len(data)/4 {
+		return nil, errCorruptNode
+	}
+	n := &hashCollisionNode[K, V]{
+		hash:  uintptr(hash),
+		h:     hs,
+		edit:  zero,
+		array: make([]entryOf[K, V], count),
+	}
+	for i := range n.array {
+		if n.array[i], err = decodeEntry[K, V](d); err != nil {
+			return nil, err
+		}
+		n.array[i].hash = n.hash
+	}
+	n.sortIfLarge()
+	return n, d.Done()
+}
+
+func decodeFlatNode[K comparable, V any](data []byte, hs *hasher[K, V]) (node[K, V], error) {
+	d, count, err := binenc.NewDecoder(data, binenc.HashMapFlatNode)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if uintptr(seed) != hs.seed || count > flatMax {
+		return nil, errCorruptNode
+	}
+	n := &flatNode[K, V]{
+		h:     hs,
+		edit:  zero,
+		array: make([]entryOf[K, V], count),
+	}
+	for i := range n.array {
+		if n.array[i], err = decodeEntry[K, V](d); err != nil {
+			return nil, err
+		}
+	}
+	return n, d.Done()
+}
+
+func decodeEntry[K comparable, V any](d *binenc.Decoder) (entryOf[K, V], error) {
+	var ent entryOf[K, V]
+	var err error
+	if ent.k, err = binenc.Decode[K](d); err != nil {
+		return ent, err
+	}
+	ent.v, err = binenc.Decode[V](d)
+	return ent, err
+}
+
+func readHash(d *binenc.Decoder) (persist.Hash, error) {
+	var h persist.Hash
+	b, err := d.ReadBytes(len(h))
+	copy(h[:], b)
+	return h, err
+}
@@ -0,0 +1,247 @@
+package hashmap
+
+import (
+	"encoding/gob"
+	"errors"
+	"strconv"
+	"testing"
+
+	"jsouthworth.net/go/immutable/persist"
+)
+
+func init() {
+	gob.Register(fewHashes(0))
+}
+
+func TestPersistHistory(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	base := Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		base.Assoc(setopsKey(i), i)
+	}
+	m := base.AsPersistent()
+	versions := []*Map{m}
+	hashes := make([]persist.Hash, 0, 1001)
+	h, err := m.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes = append(hashes, h)
+	full := store.Size()
+	for i := 0; i < 1000; i++ {
+		switch i % 3 {
+		case 0:
+			m = m.Assoc(setopsKey(10000+i), i)
+		case 1:
+			m = m.Delete(setopsKey(i * 7))
+		default:
+			m = m.Assoc(setopsKey(i), -i)
+		}
+		h, err := m.Persist(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, m)
+		hashes = append(hashes, h)
+	}
+	// Each version only adds the nodes on the path to its change,
+	// a small fraction of the whole.
+	if perVersion := (store.Size() - full) / 1000; perVersion > full/100 {
+		t.Fatalf("each version added %d bytes to a %d byte map",
+			perVersion, full)
+	}
+
+	r := persist.NewReader(store)
+	for i, h := range hashes {
+		got, err := Load(r, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(versions[i]) {
+			t.Fatalf("version %d did not round trip", i)
+		}
+	}
+	// The loaded maps are ordinary maps.
+	got, err := Load(r, hashes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got.Assoc(-1, -1).Delete(setopsKey(3)).Assoc(setopsKey(4), 0)
+	exp := versions[0].Assoc(-1, -1).Delete(setopsKey(3)).Assoc(setopsKey(4), 0)
+	if !got.Equal(exp) || !matchesNative(got, toNative(exp)) {
+		t.Fatal("loaded map did not behave like the original")
+	}
+}
+
+func toNative(m *Map) map[interface{}]interface{} {
+	out := make(map[interface{}]interface{})
+	m.Range(func(k, v interface{}) {
+		out[k] = v
+	})
+	return out
+}
+
+func TestPersistTyped(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	m := NewOf(map[string]int{"a": 1, "b": 2})
+	h, err := m.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := persist.NewReader(store)
+	got, err := LoadOf[string, int](r, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(m) {
+		t.Fatalf("got %v, expected %v", got, m)
+	}
+	if _, err := LoadOf[string, int](r, persist.Hash{}); err != persist.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	empty, err := EmptyOf[string, int]().Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadOf[string, int](r, empty); err != nil || got.Length() != 0 {
+		t.Fatalf("got %v, %v for the empty map", got, err)
+	}
+}
+
+func TestPersistOptions(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	m := Empty(append(foldCase, Seed(7))...)
+	for i := 0; i < 1000; i++ {
+		m = m.Assoc(strconv.Itoa(i)+"Key", i)
+	}
+	h, err := m.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := persist.NewReader(store)
+	hashOnly, err := Load(r, h, foldCase[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(r, h, foldCase...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.h.seed != 7 || got.Length() != 1000 || got.At("10KEY") != 10 {
+		t.Fatal("loaded map did not keep the options", got.h.seed)
+	}
+	if hashOnly.Contains("10KEY") || hashOnly.At("10Key") != 10 {
+		t.Fatal("loads with different equality options shared nodes")
+	}
+	again, err := Load(r, h, foldCase...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != got {
+		t.Fatal("loading with the same options didn't share the nodes")
+	}
+}
+
+// countingStore counts the reads made from a store.
+type countingStore struct {
+	persist.Store
+	gets int
+}
+
+func (s *countingStore) Get(h persist.Hash) ([]byte, error) {
+	s.gets++
+	return s.Store.Get(h)
+}
+
+func TestLoadLazily(t *testing.T) {
+	store := &countingStore{Store: persist.NewMemStore()}
+	w := persist.NewWriter(store)
+	base := EmptyOf[int, int]().AsTransient()
+	for i := 0; i < 100000; i++ {
+		base.Assoc(i, i)
+	}
+	m := base.AsPersistent()
+	h, err := m.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := m.Assoc(7, -7).Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.gets = 0
+	r := persist.NewReader(store)
+	a, err := LoadOf[int, int](r, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.gets != 2 || a.Length() != 100000 {
+		t.Fatalf("loading read %d nodes", store.gets)
+	}
+	if v, ok := a.Find(7); !ok || v != 7 {
+		t.Fatalf("Find(7) = %v, %v", v, ok)
+	}
+	if store.gets > 8 {
+		t.Fatalf("a lookup read %d nodes", store.gets-2)
+	}
+
+	// Versions loaded by the same reader are compared without reading
+	// the sub-tries they share.
+	b, err := LoadOf[int, int](r, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := store.gets
+	if a.Equal(b) {
+		t.Fatal("versions with different values are equal")
+	}
+	if u := a.Union(b); u.Length() != 100000 {
+		t.Fatalf("union has length %d", u.Length())
+	}
+	if reads := store.gets - before; reads > 16 {
+		t.Fatalf("comparing versions read %d nodes", reads)
+	}
+
+	// Writing an edit back to the store only writes the changed path.
+	before = store.gets
+	if _, err := b.Assoc(8, -8).Persist(w); err != nil {
+		t.Fatal(err)
+	}
+	if reads := store.gets - before; reads > 8 {
+		t.Fatalf("persisting an edit read %d nodes", reads)
+	}
+	iter, n := b.Iterator(), 0
+	for iter.HasNext() {
+		iter.Next()
+		n++
+	}
+	if n != 100000 {
+		t.Fatalf("iterated %d entries", n)
+	}
+
+	// A node missing from the store panics with a ReadError.
+	partial := persist.NewMemStore()
+	root, _ := store.Get(h)
+	partial.Put(h, root)
+	var first persist.Hash
+	copy(first[:], root[len(root)-len(first):])
+	data, _ := store.Get(first)
+	partial.Put(first, data)
+	broken, err := LoadOf[int, int](persist.NewReader(partial), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = func() (err error) {
+		defer persist.Recover(&err)
+		broken.Find(7)
+		return nil
+	}()
+	var re *persist.ReadError
+	if !errors.As(err, &re) || !errors.Is(err, persist.ErrNotFound) {
+		t.Fatalf("expected a ReadError, got %v", err)
+	}
+}
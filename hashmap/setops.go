@@ -0,0 +1,580 @@
+package hashmap
+
+type setOp uint8
+
+const (
+	opUnion setOp = iota
+	opIntersection
+	opDifference
+	opSymmetricDifference
+	opCount
+)
+
+// Union returns a map containing the entries of both maps. When a
+// key is in both maps the value from m is kept.
+func (m *MapOf[K, V]) Union(other *MapOf[K, V]) *MapOf[K, V] {
+	return m.combine(opUnion, other)
+}
+
+// Intersection returns a map containing the entries of m whose keys
+// are also in other.
+func (m *MapOf[K, V]) Intersection(other *MapOf[K, V]) *MapOf[K, V] {
+	return m.combine(opIntersection, other)
+}
+
+// Difference returns a map containing the entries of m whose keys are
+// not in other.
+func (m *MapOf[K, V]) Difference(other *MapOf[K, V]) *MapOf[K, V] {
+	return m.combine(opDifference, other)
+}
+
+// SymmetricDifference returns a map containing the entries whose keys
+// are in exactly one of the maps.
+func (m *MapOf[K, V]) SymmetricDifference(other *MapOf[K, V]) *MapOf[K, V] {
+	return m.combine(opSymmetricDifference, other)
+}
+
+// IsSubset returns true if every key of m is also a key of other.
+func (m *MapOf[K, V]) IsSubset(other *MapOf[K, V]) bool {
+	return m.count <= other.count && m.common(other) == m.count
+}
+
+// IsSuperset returns true if every key of other is also a key of m.
+func (m *MapOf[K, V]) IsSuperset(other *MapOf[K, V]) bool {
+	return other.IsSubset(m)
+}
+
+// Disjoint returns true if the maps have no keys in common.
+func (m *MapOf[K, V]) Disjoint(other *MapOf[K, V]) bool {
+	return m.common(other) == 0
+}
+
+// combine applies op to the two maps. Maps that hash keys alike,
+// which is the case for maps derived from the same original map,
+// are walked node by node so that shared subtrees and subtrees
+// present in only one map are reused without rehashing their
+// keys. Otherwise, or when either map is small enough to be flat,
+// the smaller map is folded into the result one entry at a time.
+func (m *MapOf[K, V]) combine(op setOp, other *MapOf[K, V]) *MapOf[K, V] {
+	return m.combineResolving(op, other, nil)
+}
+
+// combineResolving is combine where resolve, if not nil, picks the
+// value of a key found in both maps with different values.
+func (m *MapOf[K, V]) combineResolving(
+	op setOp,
+	other *MapOf[K, V],
+	resolve func(k K, a, b V) V,
+) *MapOf[K, V] {
+	if !m.sameShape(other) {
+		return m.combineByEntry(op, other, resolve)
+	}
+	c := combiner[K, V]{op: op, h: m.h, resolve: resolve}
+	root := c.combine(m.root, other.root, 0)
+	var count int
+	switch op {
+	case opUnion:
+		count = m.count + c.onlyB
+	case opIntersection:
+		count = m.count - c.onlyA
+	case opDifference:
+		count = c.onlyA
+	case opSymmetricDifference:
+		count = c.onlyA + c.onlyB
+	}
+	switch root {
+	case m.root:
+		return m
+	case other.root:
+		return other
+	}
+	if count <= flatMax {
+		root = flatten(zero, m.h, root)
+	}
+	return &MapOf[K, V]{
+		h:     m.h,
+		count: count,
+		root:  root,
+	}
+}
+
+func (m *MapOf[K, V]) combineByEntry(
+	op setOp,
+	other *MapOf[K, V],
+	resolve func(k K, a, b V) V,
+) *MapOf[K, V] {
+	c := combiner[K, V]{h: m.h, resolve: resolve}
+	var out *TMapOf[K, V]
+	switch op {
+	case opUnion:
+		// Fold the smaller map into the larger one, keeping the
+		// values of m unless they are resolved otherwise.
+		if m.count < other.count {
+			out = other.AsTransient()
+			m.Range(func(key K, value V) bool {
+				if v, ok := other.Find(key); ok {
+					value = c.pick(key, value, v)
+				}
+				out.Assoc(key, value)
+				return true
+			})
+			break
+		}
+		out = m.AsTransient()
+		other.Range(func(key K, value V) bool {
+			if v, ok := m.Find(key); ok {
+				value = c.pick(key, v, value)
+			}
+			out.Assoc(key, value)
+			return true
+		})
+	case opIntersection:
+		out = emptyWithHasher(m.h).AsTransient()
+		m.Range(func(key K, value V) bool {
+			if other.Contains(key) {
+				out.Assoc(key, value)
+			}
+			return true
+		})
+	case opDifference:
+		out = m.AsTransient()
+		other.Range(func(key K, _ V) bool {
+			out.Delete(key)
+			return true
+		})
+	case opSymmetricDifference:
+		out = m.AsTransient()
+		other.Range(func(key K, value V) bool {
+			if m.Contains(key) {
+				out.Delete(key)
+			} else {
+				out.Assoc(key, value)
+			}
+			return true
+		})
+	}
+	// Return an input map unchanged by the operation rather than
+	// an equal copy of it.
+	switch {
+	case out.root == m.root:
+		return m
+	case out.root == other.root:
+		return other
+	case op == opIntersection && out.count == m.count:
+		return m
+	}
+	return out.AsPersistent()
+}
+
+// common returns the number of keys present in both maps.
+func (m *MapOf[K, V]) common(other *MapOf[K, V]) int {
+	if m.sameShape(other) {
+		c := combiner[K, V]{op: opCount, h: m.h}
+		c.combine(m.root, other.root, 0)
+		return m.count - c.onlyA
+	}
+	small, large := m, other
+	if small.count > large.count {
+		small, large = large, small
+	}
+	common := 0
+	small.Range(func(key K, _ V) bool {
+		if large.Contains(key) {
+			common++
+		}
+		return true
+	})
+	return common
+}
+
+// sameShape reports whether both maps are tries built with the same
+// hash and so may be combined node by node.
+func (m *MapOf[K, V]) sameShape(other *MapOf[K, V]) bool {
+	return m.h.sameHash(other.h) && !isFlat(m.root) && !isFlat(other.root)
+}
+
+// combiner merges two tries built with the same hash. It counts the
+// keys found in only one of the tries so the size of the result can
+// be computed without walking it. Those keys all lie outside the
+// subtrees the tries share, so the shared subtrees are never visited.
+type combiner[K comparable, V any] struct {
+	op      setOp
+	h       *hasher[K, V]
+	onlyA   int
+	onlyB   int
+	resolve func(k K, a, b V) V
+}
+
+// pick returns the value a union keeps for k when it is a in the
+// left hand map and b in the right hand one.
+func (c *combiner[K, V]) pick(k K, a, b V) V {
+	if c.resolve == nil || c.h.valueEqual(a, b) {
+		return a
+	}
+	return c.resolve(k, a, b)
+}
+
+type cellOrigin uint8
+
+const (
+	originNone cellOrigin = iota
+	originA
+	originB
+	// originBoth marks an entry found in both inputs with equal
+	// values.
+	originBoth
+	originNew
+)
+
+// cell is the content of one of the width positions of a node at a
+// given shift; either nothing, a single entry or a sub-node.
+type cell[K comparable, V any] struct {
+	slot[K, V]
+	full   bool
+	origin cellOrigin
+}
+
+func entryCell[K comparable, V any](e entryOf[K, V], origin cellOrigin) cell[K, V] {
+	return cell[K, V]{slot: slot[K, V]{entryOf: e}, full: true, origin: origin}
+}
+
+func nodeCell[K comparable, V any](n node[K, V], origin cellOrigin) cell[K, V] {
+	if n == nil {
+		return cell[K, V]{}
+	}
+	// Pull single entries of new nodes up so the result stays
+	// compact. Nodes taken from either input are kept as is so the
+	// structure is shared.
+	if e, ok := singleEntry(n); ok && origin == originNew {
+		return entryCell(e, origin)
+	}
+	return cell[K, V]{slot: slot[K, V]{n: n}, full: true, origin: origin}
+}
+
+// cellsOf fills out with the cells of n at shift. out is passed in
+// rather than returned so it may stay on the stack of the caller.
+func cellsOf[K comparable, V any](
+	out *[width]cell[K, V],
+	n node[K, V],
+	shift uint,
+	origin cellOrigin,
+) {
+	switch n := n.(type) {
+	case *bitmapIndexedNode[K, V]:
+		d, c := 0, 0
+		for i := uint(0); i < width; i++ {
+			bit := uint32(1) << i
+			switch {
+			case n.dataMap&bit != 0:
+				out[i] = entryCell(n.entries[d], origin)
+				d++
+			case n.nodeMap&bit != 0:
+				out[i] = cell[K, V]{slot: slot[K, V]{n: n.nodes[c]}, full: true, origin: origin}
+				c++
+			}
+		}
+	case *hashCollisionNode[K, V]:
+		// All of the entries share a hash so at this level they
+		// occupy a single position.
+		out[mask(n.hash, shift)] = cell[K, V]{slot: slot[K, V]{n: n}, full: true, origin: origin}
+	}
+}
+
+func (c *combiner[K, V]) combine(a, b node[K, V], shift uint) node[K, V] {
+	if sameNode(a, b) {
+		switch c.op {
+		case opUnion, opIntersection:
+			return a
+		default:
+			return nil
+		}
+	}
+	ra, rb := resolve(a), resolve(b)
+	if ca, ok := ra.(*hashCollisionNode[K, V]); ok {
+		if cb, ok := rb.(*hashCollisionNode[K, V]); ok && ca.hash == cb.hash {
+			return c.combineCollisions(ca, cb, shift)
+		}
+	}
+	var as, bs [width]cell[K, V]
+	cellsOf(&as, ra, shift, originA)
+	cellsOf(&bs, rb, shift, originB)
+	var out [width]cell[K, V]
+	sameA, sameB := true, true
+	for i := 0; i < width; i++ {
+		out[i] = c.combineCells(as[i], bs[i], shift)
+		sameA = sameA && sameCell(out[i], as[i])
+		sameB = sameB && sameCell(out[i], bs[i])
+	}
+	switch {
+	case c.op == opCount:
+		return nil
+	case sameA:
+		return a
+	case sameB:
+		return b
+	}
+	return c.build(&out, shift)
+}
+
+func sameCell[K comparable, V any](out, in cell[K, V]) bool {
+	if !out.full || !in.full {
+		return out.full == in.full
+	}
+	if out.n != nil {
+		return out.n == in.n
+	}
+	return out.origin == in.origin || out.origin == originBoth
+}
+
+func (c *combiner[K, V]) combineCells(a, b cell[K, V], shift uint) cell[K, V] {
+	switch {
+	case !a.full && !b.full:
+		return cell[K, V]{}
+	case !b.full:
+		c.onlyA += cellSize(a)
+		if c.op == opIntersection {
+			return cell[K, V]{}
+		}
+		return a
+	case !a.full:
+		c.onlyB += cellSize(b)
+		if c.op == opUnion || c.op == opSymmetricDifference {
+			return b
+		}
+		return cell[K, V]{}
+	case a.isLeaf() && b.isLeaf():
+		return c.combineEntries(a, b, shift)
+	case a.isLeaf():
+		return c.combineEntryNode(a.entryOf, b.n, true, shift)
+	case b.isLeaf():
+		return c.combineEntryNode(b.entryOf, a.n, false, shift)
+	default:
+		n := c.combine(a.n, b.n, shift+shiftBits)
+		return nodeCell(n, nodeOrigin(n, a, b))
+	}
+}
+
+// nodeOrigin reports which input cell, if any, holds n.
+func nodeOrigin[K comparable, V any](n node[K, V], a, b cell[K, V]) cellOrigin {
+	switch {
+	case n == a.n:
+		return originA
+	case n == b.n:
+		return originB
+	default:
+		return originNew
+	}
+}
+
+func (c *combiner[K, V]) combineEntries(a, b cell[K, V], shift uint) cell[K, V] {
+	if c.h.keyEqual(b.k, a.k) {
+		switch {
+		case c.op != opUnion && c.op != opIntersection:
+			return cell[K, V]{}
+		case c.h.valueEqual(a.v, b.v):
+			return entryCell(a.entryOf, originBoth)
+		case c.op == opIntersection:
+			return a
+		}
+		switch v := c.pick(a.k, a.v, b.v); {
+		case c.h.valueEqual(v, a.v):
+			return a
+		case c.h.valueEqual(v, b.v):
+			return b
+		default:
+			return entryCell(entryOf[K, V]{k: a.k, v: v, hash: a.hash}, originNew)
+		}
+	}
+	c.onlyA++
+	c.onlyB++
+	switch c.op {
+	case opUnion, opSymmetricDifference:
+		n := mergeEntries(zero, c.h, shift+shiftBits, a.entryOf, b.entryOf)
+		return nodeCell(n, originNew)
+	case opDifference:
+		return a
+	default:
+		return cell[K, V]{}
+	}
+}
+
+// combineEntryNode combines a single entry with a sub-node. fromA is
+// true when the entry belongs to the left hand map.
+func (c *combiner[K, V]) combineEntryNode(
+	e entryOf[K, V],
+	n node[K, V],
+	fromA bool,
+	shift uint,
+) cell[K, V] {
+	h := e.hash
+	v, found := n.find(shift+shiftBits, h, e.k)
+	onlyE, onlyN := 1, nodeSize(n)
+	if found {
+		onlyE, onlyN = 0, onlyN-1
+	}
+	nOrigin := originA
+	if fromA {
+		nOrigin = originB
+		c.onlyA += onlyE
+		c.onlyB += onlyN
+	} else {
+		c.onlyA += onlyN
+		c.onlyB += onlyE
+	}
+	switch c.op {
+	case opUnion:
+		value := e.v
+		switch {
+		case found && fromA:
+			value = c.pick(e.k, e.v, v)
+		case found:
+			value = c.pick(e.k, v, e.v)
+		}
+		edited, _ := n.assoc(zero, shift+shiftBits, h, e.k, value)
+		return editedCell(n, edited, nOrigin)
+	case opIntersection:
+		if !found {
+			return cell[K, V]{}
+		}
+		if fromA {
+			return entryCell(e, originA)
+		}
+		return entryCell(entryOf[K, V]{k: e.k, v: v, hash: e.hash}, originNew)
+	case opDifference:
+		switch {
+		case fromA && found:
+			return cell[K, V]{}
+		case fromA:
+			return entryCell(e, originA)
+		case found:
+			edited, _ := n.without(zero, shift+shiftBits, h, e.k)
+			return editedCell(n, edited, nOrigin)
+		default:
+			return nodeCell(n, nOrigin)
+		}
+	case opSymmetricDifference:
+		var edited node[K, V]
+		if found {
+			edited, _ = n.without(zero, shift+shiftBits, h, e.k)
+		} else {
+			edited, _ = n.assoc(zero, shift+shiftBits, h, e.k, e.v)
+		}
+		return editedCell(n, edited, nOrigin)
+	default:
+		return cell[K, V]{}
+	}
+}
+
+// editedCell returns a cell for the result of editing n, keeping the
+// origin of n when the edit left it unchanged.
+func editedCell[K comparable, V any](n, edited node[K, V], origin cellOrigin) cell[K, V] {
+	if edited == n {
+		return nodeCell(n, origin)
+	}
+	return nodeCell(edited, originNew)
+}
+
+func (c *combiner[K, V]) combineCollisions(
+	a, b *hashCollisionNode[K, V],
+	shift uint,
+) node[K, V] {
+	var out []entryOf[K, V]
+	changed := false
+	c.onlyB += len(b.array)
+	for _, e := range a.array {
+		idx, found := b.findIndex(e.k)
+		if found {
+			c.onlyB--
+		} else {
+			c.onlyA++
+		}
+		switch {
+		case c.op == opUnion && found:
+			v := c.pick(e.k, e.v, b.array[idx].v)
+			changed = changed || !c.h.valueEqual(v, e.v)
+			out = append(out, entryOf[K, V]{k: e.k, v: v, hash: e.hash})
+		case c.op == opUnion, c.op == opIntersection && found:
+			out = append(out, e)
+		case (c.op == opDifference || c.op == opSymmetricDifference) && !found:
+			out = append(out, e)
+		}
+	}
+	if c.op == opUnion || c.op == opSymmetricDifference {
+		for _, e := range b.array {
+			if _, found := a.findIndex(e.k); !found {
+				out = append(out, e)
+			}
+		}
+	}
+	switch {
+	case c.op == opCount || len(out) == 0:
+		return nil
+	case len(out) == len(a.array) && !changed &&
+		c.op != opSymmetricDifference:
+		return a
+	}
+	n := &hashCollisionNode[K, V]{
+		hash:  a.hash,
+		h:     c.h,
+		edit:  zero,
+		array: out,
+	}
+	n.sortIfLarge()
+	return n
+}
+
+func (c *combiner[K, V]) build(cells *[width]cell[K, V], shift uint) node[K, V] {
+	entries, nodes := 0, 0
+	for i := range cells {
+		switch {
+		case !cells[i].full:
+		case cells[i].isLeaf():
+			entries++
+		default:
+			nodes++
+		}
+	}
+	if entries == 0 && nodes == 0 {
+		return nil
+	}
+	out := &bitmapIndexedNode[K, V]{
+		h:    c.h,
+		edit: zero,
+	}
+	if entries > 0 {
+		out.entries = make([]entryOf[K, V], 0, entries)
+	}
+	if nodes > 0 {
+		out.nodes = make([]node[K, V], 0, nodes)
+	}
+	for i := range cells {
+		bit := uint32(1) << uint32(i)
+		switch {
+		case !cells[i].full:
+		case cells[i].isLeaf():
+			out.dataMap |= bit
+			out.entries = append(out.entries, cells[i].entryOf)
+		default:
+			out.nodeMap |= bit
+			out.nodes = append(out.nodes, cells[i].n)
+		}
+	}
+	return out.compact()
+}
+
+// cellSize returns the number of entries held by a full cell.
+func cellSize[K comparable, V any](c cell[K, V]) int {
+	if c.isLeaf() {
+		return 1
+	}
+	return nodeSize(c.n)
+}
+
+func nodeSize[K comparable, V any](n node[K, V]) int {
+	size := 0
+	n.rnge(func(entryOf[K, V]) bool {
+		size++
+		return true
+	})
+	return size
+}
@@ -0,0 +1,314 @@
+package hashmap
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+// fewHashes only has a handful of distinct hashes so sets of them
+// are mostly made of collision nodes.
+type fewHashes int
+
+func (f fewHashes) Hash() uintptr {
+	return uintptr(f % 4)
+}
+
+func setopsKey(k int) interface{} {
+	if k%3 == 0 {
+		return fewHashes(k)
+	}
+	return k
+}
+
+type setopsCase struct {
+	a, b    *Map
+	nativeA map[interface{}]interface{}
+	nativeB map[interface{}]interface{}
+}
+
+func makeSetopsCase(base, addA, delA, addB, delB []int, shared bool) setopsCase {
+	nativeA := make(map[interface{}]interface{})
+	nativeB := make(map[interface{}]interface{})
+	origin := Empty().AsTransient()
+	for _, k := range base {
+		origin.Assoc(setopsKey(k), k)
+		nativeA[setopsKey(k)] = k
+		nativeB[setopsKey(k)] = k
+	}
+	a := origin.AsPersistent()
+	b := a
+	if !shared {
+		b = Empty()
+		for k, v := range nativeB {
+			b = b.Assoc(k, v)
+		}
+	}
+	for _, k := range addA {
+		a = a.Assoc(setopsKey(k), k)
+		nativeA[setopsKey(k)] = k
+	}
+	for _, k := range delA {
+		a = a.Delete(setopsKey(k))
+		delete(nativeA, setopsKey(k))
+	}
+	for _, k := range addB {
+		b = b.Assoc(setopsKey(k), -k)
+		nativeB[setopsKey(k)] = -k
+	}
+	for _, k := range delB {
+		b = b.Delete(setopsKey(k))
+		delete(nativeB, setopsKey(k))
+	}
+	return setopsCase{a: a, b: b, nativeA: nativeA, nativeB: nativeB}
+}
+
+func matchesNative(m *Map, native map[interface{}]interface{}) bool {
+	if m.Length() != len(native) {
+		return false
+	}
+	for k, v := range native {
+		got, ok := m.Find(k)
+		if !ok || got != v {
+			return false
+		}
+	}
+	count := 0
+	m.Range(func(k, v interface{}) bool {
+		count++
+		return true
+	})
+	if count != len(native) {
+		return false
+	}
+	// The result must remain a valid trie.
+	t := m.AsTransient()
+	for k := range native {
+		t.Delete(k)
+	}
+	return t.Length() == 0 && t.AsPersistent().Length() == 0
+}
+
+func genSetopsCase(shared bool) gopter.Gen {
+	keys := gen.SliceOf(gen.IntRange(0, 2000))
+	return gopter.CombineGens(keys, keys, keys, keys, keys).
+		Map(func(vals []interface{}) setopsCase {
+			return makeSetopsCase(vals[0].([]int), vals[1].([]int),
+				vals[2].([]int), vals[3].([]int), vals[4].([]int), shared)
+		})
+}
+
+func TestSetOperations(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MaxSize = 500
+	properties := gopter.NewProperties(parameters)
+	for _, shared := range []bool{true, false} {
+		name := "unrelated "
+		if shared {
+			name = "shared "
+		}
+		properties.Property(name+"Union", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeB {
+					exp[k] = v
+				}
+				for k, v := range c.nativeA {
+					exp[k] = v
+				}
+				return matchesNative(c.a.Union(c.b), exp)
+			},
+			genSetopsCase(shared),
+		))
+		properties.Property(name+"Intersection", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					if _, ok := c.nativeB[k]; ok {
+						exp[k] = v
+					}
+				}
+				return matchesNative(c.a.Intersection(c.b), exp)
+			},
+			genSetopsCase(shared),
+		))
+		properties.Property(name+"Difference", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					if _, ok := c.nativeB[k]; !ok {
+						exp[k] = v
+					}
+				}
+				return matchesNative(c.a.Difference(c.b), exp)
+			},
+			genSetopsCase(shared),
+		))
+		properties.Property(name+"SymmetricDifference", prop.ForAll(
+			func(c setopsCase) bool {
+				exp := make(map[interface{}]interface{})
+				for k, v := range c.nativeA {
+					if _, ok := c.nativeB[k]; !ok {
+						exp[k] = v
+					}
+				}
+				for k, v := range c.nativeB {
+					if _, ok := c.nativeA[k]; !ok {
+						exp[k] = v
+					}
+				}
+				return matchesNative(c.a.SymmetricDifference(c.b), exp)
+			},
+			genSetopsCase(shared),
+		))
+		properties.Property(name+"predicates", prop.ForAll(
+			func(c setopsCase) bool {
+				subset, disjoint := true, true
+				for k := range c.nativeA {
+					if _, ok := c.nativeB[k]; ok {
+						disjoint = false
+					} else {
+						subset = false
+					}
+				}
+				superset := true
+				for k := range c.nativeB {
+					if _, ok := c.nativeA[k]; !ok {
+						superset = false
+					}
+				}
+				return c.a.IsSubset(c.b) == subset &&
+					c.a.IsSuperset(c.b) == superset &&
+					c.a.Disjoint(c.b) == disjoint &&
+					c.a.IsSubset(c.a) && !c.a.Union(c.b).Disjoint(c.a) ==
+					(len(c.nativeA) != 0)
+			},
+			genSetopsCase(shared),
+		))
+	}
+	properties.TestingRun(t)
+}
+
+func TestSetOperationsReuseStructure(t *testing.T) {
+	base := Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		base.Assoc(i, i)
+	}
+	a := base.AsPersistent()
+	b := a.Assoc(10000, 10000)
+	if got := a.Union(a); got != a {
+		t.Fatal("expected union with itself to return the map")
+	}
+	if got := b.Union(a); got != b {
+		t.Fatal("expected union with a subset to return the map")
+	}
+	if got := a.Union(b); got != b {
+		t.Fatal("expected union with a superset to return the superset")
+	}
+	if got := a.Intersection(b); got != a {
+		t.Fatal("expected intersection with a superset to return the map")
+	}
+	diff := b.Difference(a)
+	if diff.Length() != 1 || diff.At(10000) != 10000 {
+		t.Fatalf("unexpected difference %v", diff)
+	}
+	if got := a.SymmetricDifference(a); got.Length() != 0 {
+		t.Fatalf("expected empty symmetric difference, got %v", got)
+	}
+	if !a.IsSubset(b) || a.IsSuperset(b) || a.Disjoint(b) {
+		t.Fatal("unexpected predicate result")
+	}
+}
+
+// untouchable stands in for a subtree two maps share. Its node is
+// nil, so visiting it in any way panics.
+type untouchable struct {
+	node[interface{}, interface{}]
+}
+
+// hideShared returns copies of a and b whose root sub-nodes shared by
+// both maps are replaced by the same untouchable node, along with the
+// number of sub-nodes replaced.
+func hideShared(a, b *Map) (*Map, *Map, int) {
+	ra := *a.root.(*bitmapIndexedNode[interface{}, interface{}])
+	rb := *b.root.(*bitmapIndexedNode[interface{}, interface{}])
+	ra.nodes, rb.nodes = copySlice(ra.nodes), copySlice(rb.nodes)
+	hidden := 0
+	for bit := uint32(1); bit != 0; bit <<= 1 {
+		if ra.nodeMap&bit == 0 || rb.nodeMap&bit == 0 {
+			continue
+		}
+		i, j := index(ra.nodeMap, bit), index(rb.nodeMap, bit)
+		if ra.nodes[i] == rb.nodes[j] {
+			n := &untouchable{}
+			ra.nodes[i], rb.nodes[j] = n, n
+			hidden++
+		}
+	}
+	return &Map{h: a.h, count: a.count, root: &ra},
+		&Map{h: b.h, count: b.count, root: &rb}, hidden
+}
+
+func TestSetOperationsSkipSharedSubtrees(t *testing.T) {
+	base := Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		base.Assoc(i, i)
+	}
+	orig := base.AsPersistent()
+	a, b, hidden := hideShared(orig.Assoc(-1, -1).Delete(0),
+		orig.Assoc(-2, -2).Assoc(1, -1))
+	if hidden < width-4 {
+		t.Fatal("expected most sub-nodes to be shared", hidden)
+	}
+	for _, got := range []struct {
+		m    *Map
+		want int
+	}{
+		{a.Union(b), 10002},
+		{a.Intersection(b), 9999},
+		{a.Difference(b), 1},
+		{b.Difference(a), 2},
+		{a.SymmetricDifference(b), 3},
+	} {
+		if got.m.Length() != got.want {
+			t.Fatalf("expected %d entries, got %d", got.want, got.m.Length())
+		}
+	}
+	if a.IsSubset(b) || !a.Delete(-1).IsSubset(b) || a.Disjoint(b) {
+		t.Fatal("unexpected predicate result")
+	}
+}
+
+func BenchmarkUnionShared(b *testing.B) {
+	base := Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		base.Assoc(i, i)
+	}
+	m1 := base.AsPersistent()
+	m2 := m1
+	for i := 0; i < 100; i++ {
+		m1 = m1.Assoc(-i, i)
+		m2 = m2.Delete(i * 7)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m1.Union(m2)
+	}
+}
+
+func BenchmarkUnionUnrelated(b *testing.B) {
+	t1, t2 := Empty().AsTransient(), Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		t1.Assoc(i, i)
+		t2.Assoc(i, i)
+	}
+	m1, m2 := t1.AsPersistent(), t2.AsPersistent()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m1.Union(m2)
+	}
+}
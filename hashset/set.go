@@ -4,9 +4,16 @@
 // the default go equality operator for values in this  library
 // implement the Equal(other interface{}) bool function for the type.
 // Otherwise '==' will be used with all its restrictions.
+//
+// The set algebra operations, Union, Intersection, Difference and
+// friends, walk both sets node by node when the sets were derived
+// from a common set so that shared parts of the sets are reused
+// rather than rehashed. Unrelated sets are combined one element at a
+// time.
 package hashset // import "jsouthworth.net/go/immutable/hashset"
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -14,6 +21,7 @@ import (
 
 	"jsouthworth.net/go/dyn"
 	"jsouthworth.net/go/immutable/hashmap"
+	"jsouthworth.net/go/immutable/internal/binenc"
 	"jsouthworth.net/go/seq"
 )
 
@@ -25,10 +33,41 @@ type Set struct {
 	backingMap *hashmap.Map
 }
 
-// Empty returns the empty set.
-func Empty() *Set {
+// Option is a type that allows changes to pluggable parts of the
+// Set implementation. The options are those of the backing map.
+type Option = hashmap.Option
+
+// Hasher is an option to the Empty function that will allow
+// one to specify a different hash function instead of the
+// default which is from the hash library. The function is
+// passed the set's seed along with the element. Elements that
+// are equal under Equal must hash to the same value.
+func Hasher(fn func(elem interface{}, seed uintptr) uintptr) Option {
+	return hashmap.Hasher(fn)
+}
+
+// Equal is an option to the Empty function that will allow
+// one to specify a different equality operator instead
+// of the default which is from the dyn library. This is used
+// for elements.
+func Equal(eq func(e1, e2 interface{}) bool) Option {
+	return hashmap.KeyEqual(eq)
+}
+
+// Seed is an option to the Empty function that will allow one
+// to specify the hash seed instead of a random one. Sets with
+// the same seed store their elements in the same order.
+func Seed(seed uintptr) Option {
+	return hashmap.Seed(seed)
+}
+
+// Empty returns the empty set, one may supply options for the set
+// by using one of the option generating functions and providing
+// that to Empty. The options are kept by every set derived from
+// the returned one.
+func Empty(options ...Option) *Set {
 	return &Set{
-		backingMap: hashmap.Empty(),
+		backingMap: hashmap.Empty(options...),
 	}
 }
 
@@ -314,6 +353,63 @@ func (s *Set) String() string {
 	return b.String()
 }
 
+// MarshalJSON implements json.Marshaler encoding the set as a JSON
+// array.
+func (s *Set) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, s.Length())
+	s.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array
+// into the set. The elements take the types encoding/json uses for
+// interface{} values and so must be hashable.
+func (s *Set) UnmarshalJSON(data []byte) error {
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*s = *New(elems...)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Elements are encoded with gob unless they implement
+// encoding.BinaryMarshaler, so their concrete types must be
+// registered with gob.Register.
+func (s *Set) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.HashSet, s.Length(),
+		func(fn func(interface{}) bool) {
+			s.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary.
+func (s *Set) UnmarshalBinary(data []byte) error {
+	out := Empty().AsTransient()
+	err := binenc.UnmarshalSeq(data, binenc.HashSet, func(elem interface{}) {
+		out.Add(elem)
+	})
+	if err != nil {
+		return err
+	}
+	*s = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (s *Set) GobEncode() ([]byte, error) {
+	return s.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (s *Set) GobDecode(data []byte) error {
+	return s.UnmarshalBinary(data)
+}
+
 // Apply takes an arbitrary number of arguments and returns the
 // value At the first argument.  Apply allows map to be called
 // as a function by the 'dyn' library.
@@ -343,6 +439,58 @@ func (s *Set) Equal(o interface{}) bool {
 	return s.backingMap.Equal(other.backingMap)
 }
 
+// Union returns a set containing the elements of both sets.
+func (s *Set) Union(other *Set) *Set {
+	return s.combined(other, s.backingMap.Union(other.backingMap))
+}
+
+// Intersection returns a set containing the elements that are in
+// both sets.
+func (s *Set) Intersection(other *Set) *Set {
+	return s.combined(other, s.backingMap.Intersection(other.backingMap))
+}
+
+// Difference returns a set containing the elements of s that are not
+// in other.
+func (s *Set) Difference(other *Set) *Set {
+	return s.combined(other, s.backingMap.Difference(other.backingMap))
+}
+
+// SymmetricDifference returns a set containing the elements that are
+// in exactly one of the sets.
+func (s *Set) SymmetricDifference(other *Set) *Set {
+	return s.combined(other, s.backingMap.SymmetricDifference(other.backingMap))
+}
+
+// IsSubset returns true if every element of s is in other.
+func (s *Set) IsSubset(other *Set) bool {
+	return s.backingMap.IsSubset(other.backingMap)
+}
+
+// IsSuperset returns true if every element of other is in s.
+func (s *Set) IsSuperset(other *Set) bool {
+	return s.backingMap.IsSuperset(other.backingMap)
+}
+
+// Disjoint returns true if the sets have no elements in common.
+func (s *Set) Disjoint(other *Set) bool {
+	return s.backingMap.Disjoint(other.backingMap)
+}
+
+// combined wraps the result of a set operation on the backing maps,
+// returning either input set when its map was reused unchanged.
+func (s *Set) combined(other *Set, m *hashmap.Map) *Set {
+	switch m {
+	case s.backingMap:
+		return s
+	case other.backingMap:
+		return other
+	}
+	return &Set{
+		backingMap: m,
+	}
+}
+
 // TSet is a transient copy on write version of Set. Changes made to a
 // transient set will not effect the original persistent
 // structure. Changes to a transient set occur as mutations. These
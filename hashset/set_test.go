@@ -1,13 +1,18 @@
 package hashset
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/hash"
 	"jsouthworth.net/go/immutable/vector"
 	"jsouthworth.net/go/seq"
 )
@@ -671,6 +676,32 @@ func TestSeqEmpty(t *testing.T) {
 	}
 }
 
+func TestOptions(t *testing.T) {
+	empty := Empty(
+		Hasher(func(elem interface{}, seed uintptr) uintptr {
+			return hash.Any(strings.ToLower(elem.(string)), seed)
+		}),
+		Equal(func(e1, e2 interface{}) bool {
+			return strings.EqualFold(e1.(string), e2.(string))
+		}),
+		Seed(1),
+	)
+	s := empty.Add("a").Add("A").Add("b")
+	if s.Length() != 2 || !s.Contains("B") {
+		t.Fatal("didn't get expected set", s)
+	}
+	s = s.Delete("A").Delete("B").Add("C")
+	if !s.Contains("c") {
+		t.Fatal("deleting to empty lost the options", s)
+	}
+	s = s.Transform(func(ts *TSet) *TSet {
+		return ts.Add("c").Add("D")
+	})
+	if s.Length() != 2 || !s.Contains("d") {
+		t.Fatal("transient lost the options", s)
+	}
+}
+
 func TestTransform(t *testing.T) {
 	set := New(1, 2, 3, 4, 5)
 	set = set.Transform(
@@ -765,3 +796,122 @@ func TestReduce(t *testing.T) {
 		}
 	})
 }
+
+func TestSetAlgebra(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	build := func(base, add, del []int) (*Set, *Set) {
+		b := New()
+		for _, i := range base {
+			b = b.Add(i)
+		}
+		s := b
+		for _, i := range add {
+			s = s.Add(i)
+		}
+		for _, i := range del {
+			s = s.Delete(i)
+		}
+		return b, s
+	}
+	properties.Property("algebra agrees with membership",
+		prop.ForAll(
+			func(base, add, del, other []int) bool {
+				b, s := build(base, add, del)
+				o := New()
+				for _, i := range other {
+					o = o.Add(i)
+				}
+				ok := true
+				for _, x := range []*Set{b, o} {
+					union := s.Union(x)
+					inter := s.Intersection(x)
+					diff := s.Difference(x)
+					sym := s.SymmetricDifference(x)
+					for _, elems := range [][]int{base, add, del, other} {
+						for _, e := range elems {
+							in1, in2 := s.Contains(e), x.Contains(e)
+							ok = ok &&
+								union.Contains(e) == (in1 || in2) &&
+								inter.Contains(e) == (in1 && in2) &&
+								diff.Contains(e) == (in1 && !in2) &&
+								sym.Contains(e) == (in1 != in2)
+						}
+					}
+					ok = ok && union.Length() ==
+						inter.Length()+sym.Length() &&
+						diff.Length() == s.Length()-inter.Length() &&
+						inter.IsSubset(s) && inter.IsSubset(x) &&
+						union.IsSuperset(s) && union.IsSuperset(x) &&
+						diff.Disjoint(x) &&
+						s.Disjoint(x) == (inter.Length() == 0)
+				}
+				return ok
+			},
+			gen.SliceOf(gen.IntRange(0, 500)),
+			gen.SliceOf(gen.IntRange(0, 500)),
+			gen.SliceOf(gen.IntRange(0, 500)),
+			gen.SliceOf(gen.IntRange(0, 500)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestSetAlgebraSharesStructure(t *testing.T) {
+	s := New(1, 2, 3)
+	if s.Union(s) != s || s.Intersection(s) != s {
+		t.Fatal("expected operations with itself to return the set")
+	}
+	bigger := s.Add(4)
+	if s.Union(bigger) != bigger || bigger.Union(s) != bigger {
+		t.Fatal("expected union with a subset to reuse the superset")
+	}
+	if !s.IsSubset(bigger) || !bigger.IsSuperset(s) || s.Disjoint(bigger) {
+		t.Fatal("unexpected predicate results")
+	}
+	if !bigger.Difference(s).Equal(New(4)) {
+		t.Fatal("unexpected difference")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	s := New(1.0, "two", true)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Set
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(s) {
+		t.Fatalf("expected %v, got %v from %s", s, &got, data)
+	}
+	if data, _ := json.Marshal(New(1)); string(data) != "[1]" {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Set
+	}
+	in := snapshot{Value: New(1, "two", 4.5)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Set).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+}
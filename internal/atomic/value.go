@@ -0,0 +1,26 @@
+package atomic
+
+import "sync/atomic"
+
+// Value holds a T that is set at most once and may be read while it
+// is being set.
+type Value[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// Load returns the value and whether it has been set.
+func (v *Value[T]) Load() (T, bool) {
+	p := v.p.Load()
+	if p == nil {
+		var none T
+		return none, false
+	}
+	return *p, true
+}
+
+// Store sets the value unless it has already been set and returns the
+// value held.
+func (v *Value[T]) Store(val T) T {
+	v.p.CompareAndSwap(nil, &val)
+	return *v.p.Load()
+}
@@ -0,0 +1,378 @@
+// Package binenc implements the binary format shared by the
+// collections' MarshalBinary and UnmarshalBinary methods.
+//
+// An encoding starts with a format version, a byte identifying the
+// kind of collection and the number of elements as a uvarint. Each
+// element, or each key and value of a map, follows as a tag byte and
+// a uvarint length prefixed payload. Elements whose static type
+// implements encoding.BinaryMarshaler and whose pointer implements
+// encoding.BinaryUnmarshaler encode themselves. Other elements are
+// written with a single gob stream shared by the whole collection,
+// so the concrete types of interface{} payloads must be registered
+// with gob.Register.
+package binenc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"math"
+	"reflect"
+)
+
+// Version is the current version of the format.
+const Version = 1
+
+// Kind identifies the collection an encoding was produced by.
+type Kind byte
+
+// The kinds of collection.
+const (
+	Vector Kind = iota + 1
+	List
+	Stack
+	Queue
+	HashSet
+	TreeSet
+	HashMap
+	TreeMap
+	Deque
+	PQueue
+)
+
+// The kinds of the nodes and roots written to a node store.
+const (
+	VectorRoot Kind = iota + 64
+	VectorNode
+	HashMapRoot
+	HashMapChampNode
+	HashMapCollisionNode
+	TreeRoot
+	TreeLeaf
+	TreeInternal
+	VectorRelaxedNode
+	HashMapFlatNode
+)
+
+const (
+	tagNil byte = iota
+	tagBinary
+	tagGob
+)
+
+var (
+	errVersion = errors.New("unsupported binary encoding version")
+	errKind    = errors.New("binary encoding is of a different collection")
+	errCorrupt = errors.New("corrupt binary encoding")
+)
+
+// MarshalSeq encodes the count elements visited by rng.
+func MarshalSeq[T any](kind Kind, count int, rng func(func(T) bool)) ([]byte, error) {
+	e := NewEncoder(kind, count)
+	var err error
+	rng(func(elem T) bool {
+		err = Encode(e, elem)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalSeq decodes an encoding produced by MarshalSeq calling add
+// with each element in order.
+func UnmarshalSeq[T any](data []byte, kind Kind, add func(T)) error {
+	d, count, err := newBoundedDecoder(data, kind)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		elem, err := Decode[T](d)
+		if err != nil {
+			return err
+		}
+		add(elem)
+	}
+	return d.Done()
+}
+
+// MarshalMap encodes the count entries visited by rng.
+func MarshalMap[K, V any](kind Kind, count int, rng func(func(K, V) bool)) ([]byte, error) {
+	e := NewEncoder(kind, count)
+	var err error
+	rng(func(k K, v V) bool {
+		if err = Encode(e, k); err == nil {
+			err = Encode(e, v)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalMap decodes an encoding produced by MarshalMap calling
+// assoc with each entry in order.
+func UnmarshalMap[K, V any](data []byte, kind Kind, assoc func(K, V)) error {
+	d, count, err := newBoundedDecoder(data, kind)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		k, err := Decode[K](d)
+		if err != nil {
+			return err
+		}
+		v, err := Decode[V](d)
+		if err != nil {
+			return err
+		}
+		assoc(k, v)
+	}
+	return d.Done()
+}
+
+// Encoder writes an encoding. Elements are written with Encode and
+// the structure around them with WriteUvarint and WriteBytes.
+type Encoder struct {
+	buf     bytes.Buffer
+	gobBuf  bytes.Buffer
+	gob     *gob.Encoder
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// NewEncoder returns an Encoder that has written the header for
+// count items of kind.
+func NewEncoder(kind Kind, count int) *Encoder {
+	e := &Encoder{}
+	e.gob = gob.NewEncoder(&e.gobBuf)
+	e.buf.WriteByte(Version)
+	e.buf.WriteByte(byte(kind))
+	e.WriteUvarint(uint64(count))
+	return e
+}
+
+// Bytes returns the encoding written so far.
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// WriteUvarint writes x as a uvarint.
+func (e *Encoder) WriteUvarint(x uint64) {
+	n := binary.PutUvarint(e.scratch[:], x)
+	e.buf.Write(e.scratch[:n])
+}
+
+// WriteBytes writes b without a length prefix.
+func (e *Encoder) WriteBytes(b []byte) {
+	e.buf.Write(b)
+}
+
+func (e *Encoder) write(tag byte, payload []byte) {
+	e.buf.WriteByte(tag)
+	e.WriteUvarint(uint64(len(payload)))
+	e.buf.Write(payload)
+}
+
+// Encode writes v as a tagged, length prefixed element.
+func Encode[T any](e *Encoder, v T) error {
+	switch {
+	case isNil(v):
+		e.write(tagNil, nil)
+	case selfEncoding[T]():
+		m, ok := interface{}(v).(encoding.BinaryMarshaler)
+		if !ok {
+			m = interface{}(&v).(encoding.BinaryMarshaler)
+		}
+		payload, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.write(tagBinary, payload)
+	default:
+		e.gobBuf.Reset()
+		if err := e.gob.Encode(&v); err != nil {
+			return err
+		}
+		e.write(tagGob, e.gobBuf.Bytes())
+	}
+	return nil
+}
+
+// selfEncoding reports whether values of T encode themselves. The
+// static type is used so that decoding knows what to construct.
+func selfEncoding[T any]() bool {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Interface {
+		return false
+	}
+	ptr := reflect.PointerTo(typ)
+	marshaler := reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	unmarshaler := reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	return ptr.Implements(marshaler) && ptr.Implements(unmarshaler)
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface,
+		reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+// Decoder reads an encoding written by an Encoder.
+type Decoder struct {
+	data    []byte
+	payload payloadReader
+	gob     *gob.Decoder
+}
+
+// payloadReader serves the gob decoder one element's payload at a
+// time. It implements io.ByteReader so gob does not buffer past the
+// current payload.
+type payloadReader struct {
+	r bytes.Reader
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+func (p *payloadReader) ReadByte() (byte, error) {
+	return p.r.ReadByte()
+}
+
+// KindOf returns the kind recorded in the header of data.
+func KindOf(data []byte) (Kind, error) {
+	if len(data) < 2 {
+		return 0, errCorrupt
+	}
+	if data[0] != Version {
+		return 0, errVersion
+	}
+	return Kind(data[1]), nil
+}
+
+// NewDecoder reads the header of data, which must be of kind, and
+// returns a Decoder for the rest along with the recorded count. The
+// meaning of the count is up to the caller, which must check it
+// before allocating for it.
+func NewDecoder(data []byte, kind Kind) (*Decoder, int, error) {
+	k, err := KindOf(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if k != kind {
+		return nil, 0, errKind
+	}
+	d := &Decoder{data: data[2:]}
+	count, err := d.ReadUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	if count > math.MaxInt32 {
+		return nil, 0, errCorrupt
+	}
+	d.gob = gob.NewDecoder(&d.payload)
+	return d, int(count), nil
+}
+
+// newBoundedDecoder is NewDecoder for encodings holding count
+// elements. Every element takes at least two bytes which bounds the
+// count of a well formed encoding.
+func newBoundedDecoder(data []byte, kind Kind) (*Decoder, int, error) {
+	d, count, err := NewDecoder(data, kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	if count > len(d.data)/2 {
+		return nil, 0, errCorrupt
+	}
+	return d, count, nil
+}
+
+// ReadUvarint reads a uvarint written by WriteUvarint.
+func (d *Decoder) ReadUvarint() (uint64, error) {
+	x, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		return 0, errCorrupt
+	}
+	d.data = d.data[n:]
+	return x, nil
+}
+
+// ReadBytes reads n bytes written by WriteBytes.
+func (d *Decoder) ReadBytes(n int) ([]byte, error) {
+	if n > len(d.data) {
+		return nil, errCorrupt
+	}
+	out := d.data[:n]
+	d.data = d.data[n:]
+	return out, nil
+}
+
+func (d *Decoder) next() (byte, []byte, error) {
+	if len(d.data) == 0 {
+		return 0, nil, errCorrupt
+	}
+	tag := d.data[0]
+	d.data = d.data[1:]
+	length, err := d.ReadUvarint()
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > uint64(len(d.data)) {
+		return 0, nil, errCorrupt
+	}
+	payload := d.data[:length]
+	d.data = d.data[length:]
+	return tag, payload, nil
+}
+
+// Done returns an error if any of the encoding was not read.
+func (d *Decoder) Done() error {
+	if len(d.data) != 0 {
+		return errCorrupt
+	}
+	return nil
+}
+
+// Decode reads an element written by Encode.
+func Decode[T any](d *Decoder) (T, error) {
+	var v T
+	tag, payload, err := d.next()
+	if err != nil {
+		return v, err
+	}
+	switch tag {
+	case tagNil:
+		return v, nil
+	case tagBinary:
+		u, ok := interface{}(&v).(encoding.BinaryUnmarshaler)
+		if !ok {
+			return v, errCorrupt
+		}
+		return v, u.UnmarshalBinary(payload)
+	case tagGob:
+		d.payload.r.Reset(payload)
+		if err := d.gob.Decode(&v); err != nil {
+			return v, err
+		}
+		if d.payload.r.Len() != 0 {
+			return v, errCorrupt
+		}
+		return v, nil
+	default:
+		return v, errCorrupt
+	}
+}
@@ -0,0 +1,134 @@
+package binenc
+
+import (
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// point encodes itself as two bytes.
+type point struct {
+	x, y byte
+}
+
+func (p point) MarshalBinary() ([]byte, error) {
+	return []byte{p.x, p.y}, nil
+}
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("bad point")
+	}
+	p.x, p.y = data[0], data[1]
+	return nil
+}
+
+type payload struct {
+	Name string
+}
+
+func init() {
+	gob.Register(payload{})
+}
+
+func roundTripSeq[T any](t *testing.T, elems []T) []T {
+	t.Helper()
+	data, err := MarshalSeq(Vector, len(elems), func(fn func(T) bool) {
+		for _, elem := range elems {
+			if !fn(elem) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []T
+	if err := UnmarshalSeq(data, Vector, func(elem T) {
+		out = append(out, elem)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	ints := []int{1, 2, 3, -4}
+	if got := roundTripSeq(t, ints); !reflect.DeepEqual(got, ints) {
+		t.Fatalf("expected %v, got %v", ints, got)
+	}
+	points := []point{{1, 2}, {3, 4}}
+	if got := roundTripSeq(t, points); !reflect.DeepEqual(got, points) {
+		t.Fatalf("expected %v, got %v", points, got)
+	}
+	mixed := []interface{}{1, "two", nil, payload{"three"}, 4.5}
+	if got := roundTripSeq(t, mixed); !reflect.DeepEqual(got, mixed) {
+		t.Fatalf("expected %v, got %v", mixed, got)
+	}
+	ptrs := []*payload{{"one"}, nil}
+	if got := roundTripSeq(t, ptrs); len(got) != 2 ||
+		got[0].Name != "one" || got[1] != nil {
+		t.Fatalf("unexpected pointers %v", got)
+	}
+}
+
+func TestSelfEncoding(t *testing.T) {
+	data, err := MarshalSeq(Vector, 1, func(fn func(point) bool) {
+		fn(point{7, 9})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{Version, byte(Vector), 1, tagBinary, 2, 7, 9}
+	if !reflect.DeepEqual(data, exp) {
+		t.Fatalf("expected %v, got %v", exp, data)
+	}
+}
+
+func TestMap(t *testing.T) {
+	keys := []string{"a", "b"}
+	data, err := MarshalMap(HashMap, 2, func(fn func(string, interface{}) bool) {
+		for i, k := range keys {
+			fn(k, i)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]interface{})
+	if err := UnmarshalMap(data, HashMap, func(k string, v interface{}) {
+		got[k] = v
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]interface{}{"a": 0, "b": 1}) {
+		t.Fatalf("unexpected map %v", got)
+	}
+	if err := UnmarshalMap(data, TreeMap, func(string, interface{}) {}); err != errKind {
+		t.Fatalf("expected kind error, got %v", err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	data, err := MarshalSeq(List, 2, func(fn func(int) bool) {
+		fn(1)
+		fn(2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noop := func(int) {}
+	version := append([]byte{Version + 1}, data[1:]...)
+	if err := UnmarshalSeq(version, List, noop); err != errVersion {
+		t.Fatalf("expected version error, got %v", err)
+	}
+	for i := 0; i < len(data); i++ {
+		if err := UnmarshalSeq(data[:i], List, noop); err == nil {
+			t.Fatalf("expected error decoding %d of %d bytes", i, len(data))
+		}
+	}
+	if err := UnmarshalSeq(append(data, 0), List, noop); err != errCorrupt {
+		t.Fatalf("expected trailing bytes to be an error, got %v", err)
+	}
+}
@@ -17,35 +17,67 @@ func (e Error) Error() string {
 
 const ErrTafterP = Error("transient used after persistent call")
 
-type BTree struct {
-	root    node
+const ErrOutOfBounds = Error("index out of bounds")
+
+// BTree is a persistent B+Tree of boxed keys.
+type BTree = TreeOf[interface{}]
+
+// TBTree is a transient B+Tree of boxed keys.
+type TBTree = TTreeOf[interface{}]
+
+// Iterator is an iterator over a BTree.
+type Iterator = IteratorOf[interface{}]
+
+// TreeOf is a persistent B+Tree of keys of type K. The keys are
+// stored directly in the leaves and ordered by the tree's compare
+// function.
+type TreeOf[K any] struct {
+	root    node[K]
 	count   int
 	version int
 	edit    *atomic.Bool
 
-	cmp compareFunc
-	eq  eqFunc
+	cmp   compareFunc[K]
+	eq    eqFunc[K]
+	order *order
 }
 
+// order identifies the compare function of a tree. Functions can't be
+// compared, so each Compare option makes its own order and trees are
+// known to share an ordering only when they were built from the same
+// option.
+type order struct {
+	_ byte // a zero sized order wouldn't have a unique address
+}
+
+var defaultOrder = new(order)
+
 var emptyEdit = atomic.NewBool(false)
 
 var empty = &BTree{
-	root: newLeaf(0, emptyEdit),
-	edit: emptyEdit,
-	cmp:  dyn.Compare,
-	eq:   dyn.Equal,
+	root:  newLeaf[interface{}](0, emptyEdit),
+	edit:  emptyEdit,
+	cmp:   dyn.Compare,
+	eq:    dyn.Equal,
+	order: defaultOrder,
 }
 
 type btreeOptions struct {
-	cmp compareFunc
-	eq  eqFunc
+	cmp   compareFunc[interface{}]
+	eq    eqFunc[interface{}]
+	order *order
 }
 
 type Option func(*btreeOptions)
 
+// Compare is an option ordering the keys of a tree with cmp. Trees
+// built from the same Compare option share their ordering, see
+// SameOrder.
 func Compare(cmp func(k1, k2 interface{}) int) Option {
+	ord := new(order)
 	return func(opts *btreeOptions) {
 		opts.cmp = cmp
+		opts.order = ord
 	}
 }
 
@@ -61,139 +93,298 @@ func Empty(options ...Option) *BTree {
 	}
 
 	opts := btreeOptions{
-		cmp: dyn.Compare,
-		eq:  dyn.Equal,
+		cmp:   dyn.Compare,
+		eq:    dyn.Equal,
+		order: defaultOrder,
 	}
 	for _, option := range options {
 		option(&opts)
 	}
 
-	return &BTree{
-		root: newLeaf(0, emptyEdit),
-		edit: emptyEdit,
-		cmp:  opts.cmp,
-		eq:   opts.eq,
+	out := EmptyOf(opts.cmp, opts.eq)
+	out.order = opts.order
+	return out
+}
+
+// cleared returns an empty tree with the same ordering as t.
+func (t *TreeOf[K]) cleared() *TreeOf[K] {
+	out := EmptyOf(t.cmp, t.eq)
+	out.order = t.order
+	return out
+}
+
+// EmptyOf returns an empty tree ordered by cmp. eq is used to
+// determine if a key being added is identical to the one already
+// stored so that the tree may be returned unchanged.
+func EmptyOf[K any](cmp func(k1, k2 K) int, eq func(k1, k2 K) bool) *TreeOf[K] {
+	return &TreeOf[K]{
+		root:  newLeaf[K](0, emptyEdit),
+		edit:  emptyEdit,
+		cmp:   cmp,
+		eq:    eq,
+		order: new(order),
 	}
 }
 
-func (t *BTree) Contains(key interface{}) bool {
+func (t *TreeOf[K]) Contains(key K) bool {
 	_, found := t.root.find(key, t.cmp)
 	return found
 }
 
-func (t *BTree) At(key interface{}) interface{} {
+func (t *TreeOf[K]) At(key K) K {
 	out, _ := t.root.find(key, t.cmp)
 	return out
 }
 
-func (t *BTree) Find(key interface{}) (interface{}, bool) {
+func (t *TreeOf[K]) Find(key K) (K, bool) {
 	return t.root.find(key, t.cmp)
 }
 
-func (t *BTree) Add(key interface{}) *BTree {
+// First returns the smallest key in the tree.
+func (t *TreeOf[K]) First() (K, bool) {
+	return t.root.first()
+}
+
+// Last returns the largest key in the tree.
+func (t *TreeOf[K]) Last() (K, bool) {
+	return t.root.last()
+}
+
+// Floor returns the greatest key less than or equal to key.
+func (t *TreeOf[K]) Floor(key K) (K, bool) {
+	return t.root.floor(key, t.cmp, true)
+}
+
+// Ceiling returns the least key greater than or equal to key.
+func (t *TreeOf[K]) Ceiling(key K) (K, bool) {
+	return t.root.ceiling(key, t.cmp, true)
+}
+
+// Lower returns the greatest key strictly less than key.
+func (t *TreeOf[K]) Lower(key K) (K, bool) {
+	return t.root.floor(key, t.cmp, false)
+}
+
+// Higher returns the least key strictly greater than key.
+func (t *TreeOf[K]) Higher(key K) (K, bool) {
+	return t.root.ceiling(key, t.cmp, false)
+}
+
+// Nth returns the key at index i in ascending order.
+func (t *TreeOf[K]) Nth(i int) (K, bool) {
+	if i < 0 || i >= t.count {
+		var none K
+		return none, false
+	}
+	return t.root.nth(i), true
+}
+
+// Rank returns the number of keys strictly less than key. When key
+// is in the tree this is its index.
+func (t *TreeOf[K]) Rank(key K) int {
+	return t.root.rank(key, t.cmp)
+}
+
+// IteratorSlice returns an iterator over the keys with indexes in
+// [start, end) in ascending order. It panics with ErrOutOfBounds if
+// the indexes are not within the tree.
+func (t *TreeOf[K]) IteratorSlice(start, end int) IteratorOf[K] {
+	if start < 0 || end < start || end > t.count {
+		panic(ErrOutOfBounds)
+	}
+	i := makeIterator(t.cmp, t.root)
+	if start == end {
+		// Bound the iterator at the first key so nothing is
+		// produced; an empty tree is already exhausted.
+		if first, ok := t.root.first(); ok {
+			i.bound, i.bounded = first, true
+		}
+	} else {
+		i.findFirst(t.root.nth(start))
+		if end < t.count {
+			i.bound, i.bounded = t.root.nth(end), true
+		}
+	}
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+func (t *TreeOf[K]) Add(key K) *TreeOf[K] {
 	ret := t.root.add(key, t.cmp, t.eq, t.edit)
-	var newRoot node
+	var newRoot node[K]
 	switch ret.status {
 	case returnUnchanged:
 		return t
 	case returnOne:
 		newRoot = ret.nodes[0]
 	case returnReplaced:
-		return &BTree{
+		return &TreeOf[K]{
 			root:    ret.nodes[0],
 			count:   t.count,
 			version: t.version + 1,
 			edit:    t.edit,
 			cmp:     t.cmp,
+			order:   t.order,
 			eq:      t.eq,
 		}
 	default:
-		nr := newNode(2, t.edit)
+		nr := newNode[K](2, t.edit)
 		nr.keys[0] = ret.nodes[0].maxKey()
 		nr.keys[1] = ret.nodes[1].maxKey()
 		copy(nr.children, ret.nodes[:])
+		nr.recount()
 		newRoot = nr
 	}
-	return &BTree{
+	return &TreeOf[K]{
 		root:    newRoot,
 		count:   t.count + 1,
 		version: t.version + 1,
 		edit:    t.edit,
 		cmp:     t.cmp,
+		order:   t.order,
 		eq:      t.eq,
 	}
 }
 
-func (t *BTree) Delete(key interface{}) *BTree {
+func (t *TreeOf[K]) Delete(key K) *TreeOf[K] {
 	ret := t.root.remove(key, nil, nil, t.cmp, t.edit)
 	if ret.status == returnUnchanged {
 		return t
 	}
 	newRoot := ret.nodes[1] // center
-	if nr, ok := newRoot.(*internalNode); ok && nr.len == 1 {
-		newRoot = nr.children[0]
+	if nr, ok := newRoot.(*internalNode[K]); ok && nr.len == 1 {
+		newRoot = resolve(nr.children[0])
 	}
-	return &BTree{
+	return &TreeOf[K]{
 		root:    newRoot,
 		count:   t.count - 1,
 		version: t.version + 1,
 		edit:    t.edit,
 		cmp:     t.cmp,
+		order:   t.order,
 		eq:      t.eq,
 	}
 }
 
-func (t *BTree) Length() int {
+func (t *TreeOf[K]) Length() int {
 	return t.count
 }
 
-func (t *BTree) String() string {
+func (t *TreeOf[K]) String() string {
 	var b strings.Builder
 	t.root.string(&b, 1)
 	return b.String()
 }
 
-func (t *BTree) Iterator() Iterator {
+func (t *TreeOf[K]) Iterator() IteratorOf[K] {
 	i := makeIterator(t.cmp, t.root)
 	i.HasNext() // Make sure the initial iterator value is valid
 	return i
 }
 
-func (t *BTree) IteratorFrom(from interface{}) Iterator {
+// IteratorFrom returns an iterator over the keys greater than or
+// equal to from in ascending order.
+func (t *TreeOf[K]) IteratorFrom(from K) IteratorOf[K] {
+	i := makeIterator(t.cmp, t.root)
+	i.findFirst(from)
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+// IteratorRange returns an iterator over the keys in [from, to) in
+// ascending order.
+func (t *TreeOf[K]) IteratorRange(from, to K) IteratorOf[K] {
 	i := makeIterator(t.cmp, t.root)
 	i.findFirst(from)
+	i.bound, i.bounded = to, true
 	i.HasNext() // Make sure the initial iterator value is valid
 	return i
 }
 
-type Iterator struct {
-	cmp   compareFunc
-	depth int
-	stack [maxIterDepth]struct {
-		n   node
+// ReverseIterator returns an iterator over all keys in descending
+// order.
+func (t *TreeOf[K]) ReverseIterator() IteratorOf[K] {
+	i := makeReverseIterator(t.cmp, t.root)
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+// IteratorBefore returns an iterator over the keys strictly less
+// than before in descending order.
+func (t *TreeOf[K]) IteratorBefore(before K) IteratorOf[K] {
+	i := makeReverseIterator(t.cmp, t.root)
+	i.findLast(before)
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+// IteratorOf walks the leaves of a tree using a fixed size stack of
+// nodes. When reverse is set the stack is walked from the right and
+// cursors count down. When bounded is set iteration stops at bound;
+// bound is exclusive for forward iterators and inclusive for reverse
+// iterators.
+type IteratorOf[K any] struct {
+	cmp     compareFunc[K]
+	reverse bool
+	bounded bool
+	bound   K
+	depth   int
+	stack   [maxIterDepth]struct {
+		n   node[K]
 		cur int
 	}
 }
 
-func makeIterator(cmp compareFunc, n node) Iterator {
-	var i Iterator
+func makeIterator[K any](cmp compareFunc[K], n node[K]) IteratorOf[K] {
+	var i IteratorOf[K]
 	i.cmp = cmp
 	i.stack[0].n = n
 	return i
 }
 
-func (i *Iterator) Next() interface{} {
+func makeReverseIterator[K any](cmp compareFunc[K], n node[K]) IteratorOf[K] {
+	var i IteratorOf[K]
+	i.cmp = cmp
+	i.reverse = true
+	i.stack[0].n = n
+	i.stack[0].cur = n.leafPart().len - 1
+	return i
+}
+
+func (i *IteratorOf[K]) Next() K {
 	state := i.stack[i.depth]
-	n := state.n.(*leafNode)
+	n := state.n.(*leafNode[K])
 	out := n.keys[state.cur]
-	i.stack[i.depth].cur++
+	if i.reverse {
+		i.stack[i.depth].cur--
+	} else {
+		i.stack[i.depth].cur++
+	}
 	return out
 }
 
-func (i *Iterator) HasNext() bool {
+func (i *IteratorOf[K]) HasNext() bool {
+	var ok bool
+	if i.reverse {
+		ok = i.hasPrev()
+	} else {
+		ok = i.hasNext()
+	}
+	if !ok || !i.bounded {
+		return ok
+	}
+	state := i.stack[i.depth]
+	key := state.n.(*leafNode[K]).keys[state.cur]
+	if i.reverse {
+		return i.cmp(key, i.bound) >= 0
+	}
+	return i.cmp(key, i.bound) < 0
+}
+
+func (i *IteratorOf[K]) hasNext() bool {
 	state := i.stack[i.depth]
 	switch n := state.n.(type) {
-	case *leafNode:
+	case *leafNode[K]:
 		if state.cur < n.len {
 			return true
 		}
@@ -201,38 +392,71 @@ func (i *Iterator) HasNext() bool {
 			return false
 		}
 		i.popNode()
-		return i.HasNext()
-	case *internalNode:
+		return i.hasNext()
+	case *internalNode[K]:
 		if state.cur < n.len {
-			child := n.children[state.cur]
+			child := resolve(n.children[state.cur])
 			i.stack[i.depth].cur++
 			i.pushNode(child)
 			switch child.(type) {
-			case *leafNode:
+			case *leafNode[K]:
 				return true
-			case *internalNode:
-				return i.HasNext()
+			case *internalNode[K]:
+				return i.hasNext()
 			}
 		}
 		if i.depth == 0 {
 			return false
 		}
 		i.popNode()
-		return i.HasNext()
+		return i.hasNext()
+	default:
+		return false
+	}
+}
+
+func (i *IteratorOf[K]) hasPrev() bool {
+	state := i.stack[i.depth]
+	switch n := state.n.(type) {
+	case *leafNode[K]:
+		if state.cur >= 0 && state.cur < n.len {
+			return true
+		}
+		if i.depth == 0 {
+			return false
+		}
+		i.popNode()
+		return i.hasPrev()
+	case *internalNode[K]:
+		if state.cur >= 0 && state.cur < n.len {
+			child := n.children[state.cur]
+			i.stack[i.depth].cur--
+			i.pushNode(child)
+			return i.hasPrev()
+		}
+		if i.depth == 0 {
+			return false
+		}
+		i.popNode()
+		return i.hasPrev()
 	default:
 		return false
 	}
 }
 
-func (i *Iterator) pushNode(n node) {
+func (i *IteratorOf[K]) pushNode(n node[K]) {
+	n = resolve(n)
 	i.depth = i.depth + 1
 	state := i.stack[i.depth]
 	state.n = n
 	state.cur = 0
+	if i.reverse {
+		state.cur = n.leafPart().len - 1
+	}
 	i.stack[i.depth] = state
 }
 
-func (i *Iterator) popNode() {
+func (i *IteratorOf[K]) popNode() {
 	state := i.stack[i.depth]
 	state.n = nil
 	state.cur = 0
@@ -240,15 +464,15 @@ func (i *Iterator) popNode() {
 	i.depth = i.depth - 1
 }
 
-func (i *Iterator) findFirst(from interface{}) {
+func (i *IteratorOf[K]) findFirst(from K) {
 	for {
 		state := i.stack[i.depth]
 		switch n := state.n.(type) {
-		case *leafNode:
+		case *leafNode[K]:
 			first := n.searchFirst(from, i.cmp)
 			i.stack[i.depth].cur = first
 			return
-		case *internalNode:
+		case *internalNode[K]:
 			first := n.searchFirst(from, i.cmp)
 			if first >= len(n.children) {
 				i.stack[i.depth].cur = len(n.children)
@@ -261,49 +485,125 @@ func (i *Iterator) findFirst(from interface{}) {
 	}
 }
 
-type TBTree struct {
-	root    node
+// findLast positions a reverse iterator on the greatest key that is
+// strictly less than before.
+func (i *IteratorOf[K]) findLast(before K) {
+	for {
+		state := i.stack[i.depth]
+		switch n := state.n.(type) {
+		case *leafNode[K]:
+			i.stack[i.depth].cur = n.searchFirst(before, i.cmp) - 1
+			return
+		case *internalNode[K]:
+			// The first child whose max key is >= before may
+			// still hold smaller keys; if there is none every
+			// key is smaller and the walk starts at the last child.
+			idx := min(n.searchFirst(before, i.cmp), n.len-1)
+			i.stack[i.depth].cur = idx - 1
+			i.pushNode(n.children[idx])
+		}
+	}
+}
+
+// TTreeOf is the transient version of TreeOf.
+type TTreeOf[K any] struct {
+	root    node[K]
 	count   int
 	version int
 	edit    *atomic.Bool
 
-	cmp compareFunc
-	eq  eqFunc
+	cmp   compareFunc[K]
+	eq    eqFunc[K]
+	order *order
 
-	orig *BTree
+	orig *TreeOf[K]
 }
 
-func (t *BTree) AsTransient() *TBTree {
-	return &TBTree{
+func (t *TreeOf[K]) AsTransient() *TTreeOf[K] {
+	return &TTreeOf[K]{
 		root:    t.root,
 		count:   t.count,
 		version: t.version,
 		edit:    atomic.NewBool(true),
 		cmp:     t.cmp,
+		order:   t.order,
 		eq:      t.eq,
 
 		orig: t,
 	}
 }
 
-func (t *TBTree) Contains(key interface{}) bool {
+func (t *TTreeOf[K]) Contains(key K) bool {
 	t.ensureEditable()
 	_, found := t.root.find(key, t.cmp)
 	return found
 }
 
-func (t *TBTree) At(key interface{}) interface{} {
+func (t *TTreeOf[K]) At(key K) K {
 	t.ensureEditable()
 	out, _ := t.root.find(key, t.cmp)
 	return out
 }
 
-func (t *TBTree) Find(key interface{}) (interface{}, bool) {
+func (t *TTreeOf[K]) Find(key K) (K, bool) {
 	t.ensureEditable()
 	return t.root.find(key, t.cmp)
 }
 
-func (t *TBTree) Add(key interface{}) *TBTree {
+// First returns the smallest key in the tree.
+func (t *TTreeOf[K]) First() (K, bool) {
+	t.ensureEditable()
+	return t.root.first()
+}
+
+// Last returns the largest key in the tree.
+func (t *TTreeOf[K]) Last() (K, bool) {
+	t.ensureEditable()
+	return t.root.last()
+}
+
+// Floor returns the greatest key less than or equal to key.
+func (t *TTreeOf[K]) Floor(key K) (K, bool) {
+	t.ensureEditable()
+	return t.root.floor(key, t.cmp, true)
+}
+
+// Ceiling returns the least key greater than or equal to key.
+func (t *TTreeOf[K]) Ceiling(key K) (K, bool) {
+	t.ensureEditable()
+	return t.root.ceiling(key, t.cmp, true)
+}
+
+// Lower returns the greatest key strictly less than key.
+func (t *TTreeOf[K]) Lower(key K) (K, bool) {
+	t.ensureEditable()
+	return t.root.floor(key, t.cmp, false)
+}
+
+// Higher returns the least key strictly greater than key.
+func (t *TTreeOf[K]) Higher(key K) (K, bool) {
+	t.ensureEditable()
+	return t.root.ceiling(key, t.cmp, false)
+}
+
+// Nth returns the key at index i in ascending order.
+func (t *TTreeOf[K]) Nth(i int) (K, bool) {
+	t.ensureEditable()
+	if i < 0 || i >= t.count {
+		var none K
+		return none, false
+	}
+	return t.root.nth(i), true
+}
+
+// Rank returns the number of keys strictly less than key. When key
+// is in the tree this is its index.
+func (t *TTreeOf[K]) Rank(key K) int {
+	t.ensureEditable()
+	return t.root.rank(key, t.cmp)
+}
+
+func (t *TTreeOf[K]) Add(key K) *TTreeOf[K] {
 	t.ensureEditable()
 	ret := t.root.add(key, t.cmp, t.eq, t.edit)
 	switch ret.status {
@@ -317,10 +617,11 @@ func (t *TBTree) Add(key interface{}) *TBTree {
 	case returnOne:
 		t.root = ret.nodes[0]
 	default:
-		nr := newNode(2, t.edit)
+		nr := newNode[K](2, t.edit)
 		nr.keys[0] = ret.nodes[0].maxKey()
 		nr.keys[1] = ret.nodes[1].maxKey()
 		copy(nr.children, ret.nodes[:])
+		nr.recount()
 		t.root = nr
 	}
 	t.count++
@@ -328,7 +629,7 @@ func (t *TBTree) Add(key interface{}) *TBTree {
 	return t
 }
 
-func (t *TBTree) Delete(key interface{}) *TBTree {
+func (t *TTreeOf[K]) Delete(key K) *TTreeOf[K] {
 	t.ensureEditable()
 	ret := t.root.remove(key, nil, nil, t.cmp, t.edit)
 	switch ret.status {
@@ -337,8 +638,8 @@ func (t *TBTree) Delete(key interface{}) *TBTree {
 	case returnEarly:
 	default:
 		newRoot := ret.nodes[1] // center
-		if nr, ok := newRoot.(*internalNode); ok && nr.len == 1 {
-			newRoot = nr.children[0]
+		if nr, ok := newRoot.(*internalNode[K]); ok && nr.len == 1 {
+			newRoot = resolve(nr.children[0])
 		}
 		t.root = newRoot
 	}
@@ -347,48 +648,49 @@ func (t *TBTree) Delete(key interface{}) *TBTree {
 	return t
 }
 
-func (t *TBTree) Iterator() Iterator {
+func (t *TTreeOf[K]) Iterator() IteratorOf[K] {
 	t.ensureEditable()
 	i := makeIterator(t.cmp, t.root)
 	i.HasNext() // Make sure the initial iterator value is valid
 	return i
 }
 
-func (t *TBTree) Length() int {
+func (t *TTreeOf[K]) Length() int {
 	t.ensureEditable()
 	return t.count
 }
 
-func (t *TBTree) String() string {
+func (t *TTreeOf[K]) String() string {
 	var b strings.Builder
 	t.root.string(&b, 1)
 	return b.String()
 }
 
-func (t *TBTree) AsPersistent() *BTree {
+func (t *TTreeOf[K]) AsPersistent() *TreeOf[K] {
 	t.ensureEditable()
 	t.edit.Reset(false)
 	if t.root == t.orig.root {
 		return t.orig
 	}
-	return &BTree{
+	return &TreeOf[K]{
 		root:    t.root,
 		count:   t.count,
 		version: t.version,
 		edit:    t.edit,
 		cmp:     t.cmp,
+		order:   t.order,
 		eq:      t.eq,
 	}
 }
 
-func (t *TBTree) ensureEditable() {
+func (t *TTreeOf[K]) ensureEditable() {
 	if !t.edit.Deref() {
 		panic(ErrTafterP)
 	}
 }
 
-type compareFunc func(k1, k2 interface{}) int
-type eqFunc func(k1, k2 interface{}) bool
+type compareFunc[K any] func(k1, k2 K) int
+type eqFunc[K any] func(k1, k2 K) bool
 
 const (
 	maxLen    = 64
@@ -404,14 +706,21 @@ const (
 	maxIterDepth = (64 + 1) / 5
 )
 
-type node interface {
-	search(key interface{}, cmp compareFunc) int
-	searchFirst(key interface{}, cmp compareFunc) int
-	find(key interface{}, cmp compareFunc) (interface{}, bool)
-	add(key interface{}, cmp compareFunc, eq eqFunc, edit *atomic.Bool) nodeReturn
-	remove(key interface{}, left, right node, cmp compareFunc, edit *atomic.Bool) nodeReturn
-	leafPart() *leafNode
-	maxKey() interface{}
+type node[K any] interface {
+	search(key K, cmp compareFunc[K]) int
+	searchFirst(key K, cmp compareFunc[K]) int
+	find(key K, cmp compareFunc[K]) (K, bool)
+	first() (K, bool)
+	last() (K, bool)
+	ceiling(key K, cmp compareFunc[K], inclusive bool) (K, bool)
+	floor(key K, cmp compareFunc[K], inclusive bool) (K, bool)
+	count() int
+	nth(i int) K
+	rank(key K, cmp compareFunc[K]) int
+	add(key K, cmp compareFunc[K], eq eqFunc[K], edit *atomic.Bool) nodeReturn[K]
+	remove(key K, left, right node[K], cmp compareFunc[K], edit *atomic.Bool) nodeReturn[K]
+	leafPart() *leafNode[K]
+	maxKey() K
 	string(b *strings.Builder, lvl int)
 }
 
@@ -439,12 +748,12 @@ func (s returnStatus) String() string {
 	return returnStatusStrings[s]
 }
 
-type nodeReturn struct {
+type nodeReturn[K any] struct {
 	status returnStatus
-	nodes  [3]node
+	nodes  [3]node[K]
 }
 
-func (r nodeReturn) String() string {
+func (r nodeReturn[K]) String() string {
 	return fmt.Sprintf("{ %s %v %v %v }",
 		r.status, r.nodes[0], r.nodes[1], r.nodes[2])
 }
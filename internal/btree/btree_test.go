@@ -1,7 +1,10 @@
 package btree_test
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -11,7 +14,9 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
 	"jsouthworth.net/go/immutable/internal/btree"
+	"jsouthworth.net/go/immutable/persist"
 )
 
 func TestSet(t *testing.T) {
@@ -657,6 +662,89 @@ func TestIteratorFrom(t *testing.T) {
 	}
 }
 
+func TestReverseIterator(t *testing.T) {
+	tree := btree.Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		tree = tree.Add(i)
+	}
+	p := tree.AsPersistent()
+	iter := p.ReverseIterator()
+	expected := 99999
+	for iter.HasNext() {
+		got := iter.Next().(int)
+		if got != expected {
+			t.Fatalf("didn't get expected value from iteration: got %v expected %v", got, expected)
+		}
+		expected--
+	}
+	if expected != -1 {
+		t.Fatalf("reverse iteration stopped early at %v", expected)
+	}
+}
+
+func TestIteratorBefore(t *testing.T) {
+	tree := btree.Empty().AsTransient()
+	for i := 0; i < 100000; i += 2 {
+		tree = tree.Add(i)
+	}
+	p := tree.AsPersistent()
+	for _, before := range []int{-10, 0, 1, 2, 63, 64, 65, 4097, 99998, 99999, 100001} {
+		iter := p.IteratorBefore(before)
+		expected := before - 1
+		if expected >= 100000 {
+			expected = 99998
+		}
+		if expected%2 != 0 {
+			expected--
+		}
+		for iter.HasNext() {
+			got := iter.Next().(int)
+			if got != expected {
+				t.Fatalf("IteratorBefore(%v): got %v expected %v", before, got, expected)
+			}
+			expected -= 2
+		}
+		if expected >= 0 {
+			t.Fatalf("IteratorBefore(%v) stopped early at %v", before, expected)
+		}
+	}
+}
+
+func TestIteratorRange(t *testing.T) {
+	tree := btree.Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		tree = tree.Add(i)
+	}
+	p := tree.AsPersistent()
+	ranges := [][2]int{{-10, 10}, {0, 0}, {5, 3}, {63, 4097}, {99990, 100010}}
+	for _, r := range ranges {
+		var sum int
+		for i := max(r[0], 0); i < min(r[1], 100000); i++ {
+			sum += i
+		}
+		iter := p.IteratorRange(r[0], r[1])
+		var got int
+		for iter.HasNext() {
+			got += iter.Next().(int)
+		}
+		if sum != got {
+			t.Fatalf("IteratorRange(%v, %v): got %v expected %v", r[0], r[1], got, sum)
+		}
+	}
+}
+
+func TestReverseIteratorEmpty(t *testing.T) {
+	tree := btree.Empty()
+	iter := tree.ReverseIterator()
+	if iter.HasNext() {
+		t.Fatal("ReverseIterator over empty tree had next")
+	}
+	iter = tree.IteratorBefore(10)
+	if iter.HasNext() {
+		t.Fatal("IteratorBefore over empty tree had next")
+	}
+}
+
 func TestIteratorEmpty(t *testing.T) {
 	tree := btree.Empty()
 	iter := tree.Iterator()
@@ -790,3 +878,661 @@ func unmakeTree(m *btree.BTree) {
 }
 
 var genTree = gopter.DeriveGen(makeTree, unmakeTree)
+
+func TestNavigation(t *testing.T) {
+	tree := btree.Empty()
+	if _, ok := tree.First(); ok {
+		t.Fatal("First on empty tree found a key")
+	}
+	if _, ok := tree.Floor(10); ok {
+		t.Fatal("Floor on empty tree found a key")
+	}
+	tr := tree.AsTransient()
+	for i := 0; i < 10000; i += 2 {
+		tr = tr.Add(i)
+	}
+	p := tr.AsPersistent()
+	type query struct {
+		name string
+		fn   func(interface{}) (interface{}, bool)
+		key  int
+		want int
+		ok   bool
+	}
+	queries := []query{
+		{"Floor", p.Floor, 5, 4, true},
+		{"Floor", p.Floor, 6, 6, true},
+		{"Floor", p.Floor, -1, 0, false},
+		{"Floor", p.Floor, 20000, 9998, true},
+		{"Ceiling", p.Ceiling, 5, 6, true},
+		{"Ceiling", p.Ceiling, 6, 6, true},
+		{"Ceiling", p.Ceiling, 9999, 0, false},
+		{"Ceiling", p.Ceiling, -5, 0, true},
+		{"Lower", p.Lower, 6, 4, true},
+		{"Lower", p.Lower, 0, 0, false},
+		{"Lower", p.Lower, 128, 126, true},
+		{"Higher", p.Higher, 6, 8, true},
+		{"Higher", p.Higher, 9998, 0, false},
+		{"Higher", p.Higher, 127, 128, true},
+	}
+	for _, q := range queries {
+		got, ok := q.fn(q.key)
+		if ok != q.ok || (ok && got != q.want) {
+			t.Fatalf("%s(%d) = %v, %v expected %v, %v",
+				q.name, q.key, got, ok, q.want, q.ok)
+		}
+	}
+	if first, _ := p.First(); first != 0 {
+		t.Fatalf("First returned %v", first)
+	}
+	if last, _ := p.Last(); last != 9998 {
+		t.Fatalf("Last returned %v", last)
+	}
+}
+
+func TestOrderStatistics(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	check := func(name string, tree *btree.BTree, keys map[int]struct{}) {
+		sorted := make([]int, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Ints(sorted)
+		if tree.Length() != len(sorted) {
+			t.Fatalf("%s: length %d expected %d",
+				name, tree.Length(), len(sorted))
+		}
+		for i, k := range sorted {
+			if got, ok := tree.Nth(i); !ok || got != k {
+				t.Fatalf("%s: Nth(%d) = %v expected %v", name, i, got, k)
+			}
+			if got := tree.Rank(k); got != i {
+				t.Fatalf("%s: Rank(%d) = %d expected %d", name, k, got, i)
+			}
+		}
+		if _, ok := tree.Nth(len(sorted)); ok {
+			t.Fatalf("%s: Nth past the end found a key", name)
+		}
+		if got := tree.Rank(-1); got != 0 {
+			t.Fatalf("%s: Rank(-1) = %d", name, got)
+		}
+	}
+
+	keys := make(map[int]struct{})
+	tree := btree.Empty()
+	tr := tree.AsTransient()
+	for i := 0; i < 20000; i++ {
+		k := rng.Intn(100000)
+		tr.Add(k)
+		keys[k] = struct{}{}
+	}
+	tree = tr.AsPersistent()
+	check("transient add", tree, keys)
+
+	for i := 0; i < 2000; i++ {
+		k := rng.Intn(100000)
+		tree = tree.Add(k)
+		keys[k] = struct{}{}
+	}
+	check("persistent add", tree, keys)
+
+	tr = tree.AsTransient()
+	for k := range keys {
+		if rng.Intn(2) == 0 {
+			tr.Delete(k)
+			delete(keys, k)
+		}
+	}
+	tree = tr.AsPersistent()
+	check("transient delete", tree, keys)
+
+	for k := range keys {
+		if rng.Intn(3) == 0 {
+			tree = tree.Delete(k)
+			delete(keys, k)
+		}
+	}
+	check("persistent delete", tree, keys)
+}
+
+func TestIteratorSlice(t *testing.T) {
+	tr := btree.Empty().AsTransient()
+	for i := 0; i < 10000; i++ {
+		tr.Add(i * 3)
+	}
+	tree := tr.AsPersistent()
+	collect := func(iter btree.Iterator) []interface{} {
+		var out []interface{}
+		for iter.HasNext() {
+			out = append(out, iter.Next())
+		}
+		return out
+	}
+	ranges := [][2]int{{0, 0}, {0, 10}, {500, 1500}, {9990, 10000}, {10000, 10000}}
+	for _, r := range ranges {
+		got := collect(tree.IteratorSlice(r[0], r[1]))
+		if len(got) != r[1]-r[0] {
+			t.Fatalf("IteratorSlice(%d, %d) produced %d keys",
+				r[0], r[1], len(got))
+		}
+		for i, k := range got {
+			if k != (r[0]+i)*3 {
+				t.Fatalf("IteratorSlice(%d, %d) got %v at %d",
+					r[0], r[1], k, i)
+			}
+		}
+	}
+	if len(collect(btree.Empty().IteratorSlice(0, 0))) != 0 {
+		t.Fatal("expected empty slice of empty tree")
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != btree.ErrOutOfBounds {
+				t.Fatalf("expected out of bounds panic, got %v", r)
+			}
+		}()
+		tree.IteratorSlice(5, 10001)
+	}()
+}
+
+func TestFromSorted(t *testing.T) {
+	for _, n := range []int{0, 1, 31, 64, 65, 129, 4097, 20000} {
+		keys := make([]interface{}, n)
+		for i := range keys {
+			keys[i] = i * 2
+		}
+		tree := btree.Empty().FromSorted(keys)
+		if tree.Length() != n {
+			t.Fatalf("FromSorted(%d) has length %d", n, tree.Length())
+		}
+		for i := 0; i < n; i++ {
+			if got, ok := tree.Nth(i); !ok || got != i*2 {
+				t.Fatalf("FromSorted(%d) Nth(%d) = %v, %v", n, i, got, ok)
+			}
+			if got := tree.Rank(i*2 + 1); got != i+1 {
+				t.Fatalf("FromSorted(%d) Rank(%d) = %d", n, i*2+1, got)
+			}
+		}
+		tr := tree.AsTransient()
+		for i := 0; i < n; i++ {
+			tr.Add(i*2 + 1)
+		}
+		for i := 0; i < n; i += 2 {
+			tr.Delete(i * 2)
+		}
+		out := tr.AsPersistent()
+		if exp := n + n/2; out.Length() != exp {
+			t.Fatalf("FromSorted(%d) then edits has length %d expected %d",
+				n, out.Length(), exp)
+		}
+		iter := out.Iterator()
+		prev := -1
+		for iter.HasNext() {
+			k := iter.Next().(int)
+			if k <= prev {
+				t.Fatalf("FromSorted(%d) then edits is out of order", n)
+			}
+			prev = k
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	makeTree := func(n int) (*btree.BTree, map[int]bool) {
+		native := make(map[int]bool)
+		tr := btree.Empty().AsTransient()
+		for i := 0; i < n; i++ {
+			k := rng.Intn(4 * (n + 1))
+			tr.Add(k)
+			native[k] = true
+		}
+		return tr.AsPersistent(), native
+	}
+	check := func(name string, got *btree.BTree, exp map[int]bool) {
+		if got.Length() != len(exp) {
+			t.Fatalf("%s has length %d expected %d",
+				name, got.Length(), len(exp))
+		}
+		iter := got.Iterator()
+		prev := -1
+		for iter.HasNext() {
+			k := iter.Next().(int)
+			if !exp[k] || k <= prev {
+				t.Fatalf("%s produced unexpected key %d", name, k)
+			}
+			prev = k
+		}
+	}
+	sizes := []int{0, 1, 10, 100, 1000, 5000}
+	for _, na := range sizes {
+		for _, nb := range sizes {
+			a, nativeA := makeTree(na)
+			b, nativeB := makeTree(nb)
+			union := make(map[int]bool)
+			inter := make(map[int]bool)
+			diff := make(map[int]bool)
+			for k := range nativeA {
+				union[k] = true
+				if nativeB[k] {
+					inter[k] = true
+				} else {
+					diff[k] = true
+				}
+			}
+			for k := range nativeB {
+				union[k] = true
+			}
+			name := fmt.Sprintf("(%d, %d)", na, nb)
+			check("Union"+name, a.Union(b), union)
+			check("Intersection"+name, a.Intersection(b), inter)
+			check("Difference"+name, a.Difference(b), diff)
+		}
+	}
+	a, _ := makeTree(1000)
+	if a.Union(a) != a || a.Intersection(a) != a ||
+		a.Difference(btree.Empty()) != a {
+		t.Fatal("expected operations that keep every key to return the tree")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := btree.Empty().AsTransient()
+	for i := 0; i < 20000; i++ {
+		tr.Add(i * 2)
+	}
+	old := tr.AsPersistent()
+	for _, edits := range []int{0, 1, 10, 1000} {
+		native := make(map[int]bool)
+		for i := 0; i < 20000; i++ {
+			native[i*2] = true
+		}
+		new := old
+		for i := 0; i < edits; i++ {
+			k := rng.Intn(40000)
+			if native[k] {
+				new = new.Delete(k)
+				delete(native, k)
+			} else {
+				new = new.Add(k)
+				native[k] = true
+			}
+		}
+		calls, prev := 0, -1
+		new.Diff(old, func(a, b interface{}, inA, inB bool) bool {
+			calls++
+			var k int
+			switch {
+			case inA && inB:
+				if a != b {
+					t.Fatalf("matched different keys %v and %v", a, b)
+				}
+				k = a.(int)
+			case inA:
+				k = a.(int)
+				if !native[k] || k%2 == 0 {
+					t.Fatalf("%d reported as only in the new tree", k)
+				}
+			case inB:
+				k = b.(int)
+				if native[k] || k%2 != 0 {
+					t.Fatalf("%d reported as only in the old tree", k)
+				}
+			}
+			if k <= prev {
+				t.Fatalf("diff out of order at %d", k)
+			}
+			prev = k
+			return true
+		})
+		if calls > (edits+1)*2*64 {
+			t.Fatalf("diff with %d edits visited %d keys", edits, calls)
+		}
+	}
+	a := btree.Empty().Add(1).Add(2)
+	b := btree.Empty().Add(2).Add(3)
+	var got []string
+	a.Diff(b, func(x, y interface{}, inA, inB bool) bool {
+		got = append(got, fmt.Sprint(x, y, inA, inB))
+		return true
+	})
+	exp := []string{"1 <nil> true false", "2 2 true true", "<nil> 3 false true"}
+	if strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	r := persist.NewReader(store)
+	for _, n := range []int{0, 1, 64, 65, 4097, 20000} {
+		keys := make([]interface{}, n)
+		for i := range keys {
+			keys[i] = i * 2
+		}
+		tree := btree.Empty().FromSorted(keys)
+		h, err := tree.Persist(w, binenc.Encode[interface{}])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := btree.Empty().Load(r, h, binenc.Decode[interface{}])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Length() != n {
+			t.Fatalf("loaded %d keys expected %d", got.Length(), n)
+		}
+		for i := 0; i < n; i++ {
+			if k, ok := got.Nth(i); !ok || k != i*2 {
+				t.Fatalf("loaded Nth(%d) = %v, %v", i, k, ok)
+			}
+			if rank := got.Rank(i*2 + 1); rank != i+1 {
+				t.Fatalf("loaded Rank(%d) = %d", i*2+1, rank)
+			}
+		}
+		edited := got.Add(-1).Delete(0)
+		if n > 0 && (edited.Length() != n || !edited.Contains(-1) ||
+			edited.Contains(0)) {
+			t.Fatalf("edits to a loaded tree of %d keys failed", n)
+		}
+	}
+
+	// Successive versions only add the path to each change.
+	tree := btree.Empty()
+	tr := tree.AsTransient()
+	for i := 0; i < 20000; i++ {
+		tr.Add(i)
+	}
+	tree = tr.AsPersistent()
+	if _, err := tree.Persist(w, binenc.Encode[interface{}]); err != nil {
+		t.Fatal(err)
+	}
+	before := store.Size()
+	hashes := make([]persist.Hash, 0, 100)
+	versions := make([]*btree.BTree, 0, 100)
+	for i := 0; i < 100; i++ {
+		tree = tree.Add(20000 + i*3).Delete(i * 11)
+		h, err := tree.Persist(w, binenc.Encode[interface{}])
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, h)
+		versions = append(versions, tree)
+	}
+	if perVersion := (store.Size() - before) / 100; perVersion > before/50 {
+		t.Fatalf("each version added %d bytes to a %d byte tree",
+			perVersion, before)
+	}
+	for i, h := range hashes {
+		got, err := btree.Empty().Load(r, h, binenc.Decode[interface{}])
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, b := got.Iterator(), versions[i].Iterator()
+		for a.HasNext() && b.HasNext() {
+			if x, y := a.Next(), b.Next(); x != y {
+				t.Fatalf("version %d has %v where %v was written", i, x, y)
+			}
+		}
+		if a.HasNext() || b.HasNext() {
+			t.Fatalf("version %d has a different length", i)
+		}
+	}
+}
+
+func TestLoadLazily(t *testing.T) {
+	const n = 100000
+	store := &countingStore{Store: persist.NewMemStore()}
+	w := persist.NewWriter(store)
+	tr := btree.Empty().AsTransient()
+	for i := 0; i < n; i++ {
+		tr.Add(i * 2)
+	}
+	h, err := tr.AsPersistent().Persist(w, binenc.Encode[interface{}])
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	r := persist.NewReader(store)
+	tree, err := btree.Empty().Load(r, h, binenc.Decode[interface{}])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.gets != 2 || tree.Length() != n {
+		t.Fatalf("loading read %d nodes", store.gets)
+	}
+	if got := tree.Rank(n * 2); got != n {
+		t.Fatalf("Rank(%d) = %d", n*2, got)
+	}
+	if got, ok := tree.Find(n); !ok || got != n {
+		t.Fatalf("Find(%d) = %v, %v", n, got, ok)
+	}
+	if store.gets > 6 {
+		t.Fatalf("a lookup read %d nodes", store.gets-2)
+	}
+
+	// Writing an edit back to the store only writes the changed path.
+	before := store.gets
+	edited := tree.Add(-1)
+	if _, err := edited.Persist(w, binenc.Encode[interface{}]); err != nil {
+		t.Fatal(err)
+	}
+	if reads := store.gets - before; reads > 4 {
+		t.Fatalf("persisting an edit read %d nodes", reads)
+	}
+
+	// A node missing from the store panics with a ReadError.
+	partial := persist.NewMemStore()
+	for _, hash := range []persist.Hash{h, rootOf(t, store, h)} {
+		data, _ := store.Get(hash)
+		partial.Put(hash, data)
+	}
+	broken, err := btree.Empty().Load(persist.NewReader(partial), h,
+		binenc.Decode[interface{}])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = func() (err error) {
+		defer persist.Recover(&err)
+		broken.Find(n)
+		return nil
+	}()
+	var re *persist.ReadError
+	if !errors.As(err, &re) || !errors.Is(err, persist.ErrNotFound) {
+		t.Fatalf("expected a ReadError, got %v", err)
+	}
+}
+
+// rootOf returns the hash of the root node of the tree written as h.
+func rootOf(t *testing.T, store persist.Store, h persist.Hash) persist.Hash {
+	data, err := store.Get(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root persist.Hash
+	copy(root[:], data[len(data)-len(root):])
+	return root
+}
+
+// countingStore counts the reads made from a store.
+type countingStore struct {
+	persist.Store
+	gets int
+}
+
+func (s *countingStore) Get(h persist.Hash) ([]byte, error) {
+	s.gets++
+	return s.Store.Get(h)
+}
+
+func TestLoadPaged(t *testing.T) {
+	const n = 100000
+	store := &countingStore{Store: persist.NewMemStore()}
+	w := persist.NewWriter(store)
+	tr := btree.Empty().AsTransient()
+	for i := 0; i < n; i++ {
+		tr.Add(i * 2)
+	}
+	tree := tr.AsPersistent()
+	h, err := tree.Persist(w, binenc.Encode[interface{}])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pager := btree.NewPager(store, binenc.Decode[interface{}], 8)
+	store.gets = 0
+	paged, err := btree.Empty().LoadPaged(pager, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paged.Length() != n {
+		t.Fatalf("paged tree has length %d", paged.Length())
+	}
+	if pager.Cached() != 0 || store.gets != 2 {
+		t.Fatalf("expected only the root to be read, %d nodes were",
+			store.gets)
+	}
+	internal := store.gets
+
+	// Each lookup reads at most one leaf, besides the internal nodes
+	// that are read once.
+	for i := 0; i < 100; i++ {
+		k := (i * 7919) % n * 2
+		if got, ok := paged.Find(k); !ok || got != k {
+			t.Fatalf("Find(%d) = %v, %v", k, got, ok)
+		}
+		if paged.Contains(k + 1) {
+			t.Fatalf("found %d", k+1)
+		}
+		if got, ok := paged.Nth(k / 2); !ok || got != k {
+			t.Fatalf("Nth(%d) = %v, %v", k/2, got, ok)
+		}
+		if got := paged.Rank(k + 1); got != k/2+1 {
+			t.Fatalf("Rank(%d) = %d", k+1, got)
+		}
+	}
+	if reads := store.gets - internal; reads > 400 {
+		t.Fatalf("300 lookups read %d nodes", reads)
+	}
+	if pager.Cached() > 8 {
+		t.Fatalf("pager holds %d leaves", pager.Cached())
+	}
+
+	iter, prev := paged.Iterator(), -2
+	for iter.HasNext() {
+		k := iter.Next().(int)
+		if k != prev+2 {
+			t.Fatalf("iterated to %d after %d", k, prev)
+		}
+		prev = k
+	}
+	if prev != (n-1)*2 {
+		t.Fatalf("iteration stopped at %d", prev)
+	}
+	rev := paged.ReverseIterator()
+	if !rev.HasNext() {
+		t.Fatal("expected reverse iteration")
+	}
+	if k := rev.Next(); k != (n-1)*2 {
+		t.Fatalf("reverse iteration started at %v", k)
+	}
+
+	// Nodes that weren't changed aren't read to be written back.
+	before := store.gets
+	if _, err := paged.Add(-1).Persist(w, binenc.Encode[interface{}]); err != nil {
+		t.Fatal(err)
+	}
+	if reads := store.gets - before; reads > 1 {
+		t.Fatalf("persisting an edit read %d nodes", reads)
+	}
+
+	// Changes keep the leaves they make in memory and the result can
+	// be written back.
+	edited := paged.AsTransient()
+	for i := 0; i < n; i += 3 {
+		edited.Delete(i * 2)
+	}
+	for i := 0; i < 1000; i++ {
+		edited.Add(i*2 + 1)
+	}
+	out := edited.AsPersistent()
+	if exp := n - (n+2)/3 + 1000; out.Length() != exp {
+		t.Fatalf("edited tree has length %d expected %d", out.Length(), exp)
+	}
+	calls := 0
+	out.Diff(paged, func(a, b interface{}, inA, inB bool) bool {
+		if !inA || !inB {
+			calls++
+		}
+		return true
+	})
+	if exp := (n+2)/3 + 1000; calls != exp {
+		t.Fatalf("diff found %d differences expected %d", calls, exp)
+	}
+	h2, err := out.Persist(w, binenc.Encode[interface{}])
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := btree.Empty().LoadPaged(pager, h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := again.Iterator(), out.Iterator()
+	for a.HasNext() && b.HasNext() {
+		if x, y := a.Next(), b.Next(); x != y {
+			t.Fatalf("reloaded %v where %v was written", x, y)
+		}
+	}
+	if a.HasNext() || b.HasNext() {
+		t.Fatal("reloaded tree has a different length")
+	}
+
+	// Deleting down to a single leaf leaves an ordinary root.
+	small := again.AsTransient()
+	keys := again.Iterator()
+	for i := 0; i < again.Length()-10 && keys.HasNext(); i++ {
+		small.Delete(keys.Next())
+	}
+	rest := small.AsPersistent()
+	if count := len(collect(rest.Iterator())); count != 10 {
+		t.Fatalf("expected 10 keys to remain, iterated %d", count)
+	}
+
+	missing := btree.NewPager(persist.NewMemStore(), binenc.Decode[interface{}], 8)
+	if _, err := btree.Empty().LoadPaged(missing, h); err != persist.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// A leaf that can't be read panics with a ReadError.
+	partial := persist.NewMemStore()
+	for _, hash := range []persist.Hash{h, rootOf(t, store, h)} {
+		data, _ := store.Get(hash)
+		partial.Put(hash, data)
+	}
+	broken, err := btree.Empty().LoadPaged(
+		btree.NewPager(partial, binenc.Decode[interface{}], 8), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken.Length() != n {
+		t.Fatalf("paged tree has length %d", broken.Length())
+	}
+	err = func() (err error) {
+		defer persist.Recover(&err)
+		broken.Contains(n)
+		return nil
+	}()
+	var re *persist.ReadError
+	if !errors.As(err, &re) || !errors.Is(err, persist.ErrNotFound) {
+		t.Fatalf("expected a ReadError, got %v", err)
+	}
+}
+
+func collect(iter btree.Iterator) []interface{} {
+	var out []interface{}
+	for iter.HasNext() {
+		out = append(out, iter.Next())
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package btree
+
+// Diff walks t and o together in key order calling fn for each key
+// that is not in a subtree shared by both trees. a is the key from t
+// and inA is true when t holds it, likewise b and inB for o. Keys
+// found in both trees are passed together. Shared subtrees, which
+// are common between versions of a tree, are skipped without being
+// visited so the cost is proportional to the size of the changes.
+// The walk stops when fn returns false.
+func (t *TreeOf[K]) Diff(o *TreeOf[K], fn func(a, b K, inA, inB bool) bool) {
+	var none K
+	a, b := newDiffCursor(t.root), newDiffCursor(o.root)
+	for !a.done() && !b.done() {
+		ka, kb := a.key(), b.key()
+		c := t.cmp(ka, kb)
+		switch {
+		case c < 0 && a.child() != nil:
+			a.descend()
+		case c < 0:
+			if !fn(ka, none, true, false) {
+				return
+			}
+			a.advance()
+		case c > 0 && b.child() != nil:
+			b.descend()
+		case c > 0:
+			if !fn(none, kb, false, true) {
+				return
+			}
+			b.advance()
+		case a.child() != nil && sameNode(a.child(), b.child()):
+			a.advance()
+			b.advance()
+		case a.child() == nil && b.child() == nil:
+			if !fn(ka, kb, true, true) {
+				return
+			}
+			a.advance()
+			b.advance()
+		default:
+			ha, hb := a.height(), b.height()
+			if ha >= hb {
+				a.descend()
+			}
+			if hb >= ha {
+				b.descend()
+			}
+		}
+	}
+	a.drain(func(k K) bool { return fn(k, none, true, false) })
+	b.drain(func(k K) bool { return fn(none, k, false, true) })
+}
+
+// diffCursor is a position in a tree. The current element is either
+// a key of a leaf or a whole child of an internal node.
+type diffCursor[K any] struct {
+	levels int
+	stack  []diffFrame[K]
+}
+
+type diffFrame[K any] struct {
+	n   node[K]
+	cur int
+}
+
+func newDiffCursor[K any](root node[K]) *diffCursor[K] {
+	c := &diffCursor[K]{}
+	if root.leafPart().len == 0 {
+		return c
+	}
+	for n := root; ; c.levels++ {
+		in, ok := n.(*internalNode[K])
+		if !ok {
+			break
+		}
+		n = resolve(in.children[0])
+	}
+	c.stack = append(c.stack, diffFrame[K]{n: root})
+	return c
+}
+
+func (c *diffCursor[K]) done() bool {
+	return len(c.stack) == 0
+}
+
+// child returns the current child node or nil if the cursor is at a
+// key.
+func (c *diffCursor[K]) child() node[K] {
+	top := c.stack[len(c.stack)-1]
+	if n, ok := top.n.(*internalNode[K]); ok {
+		return n.children[top.cur]
+	}
+	return nil
+}
+
+// key returns the current key or the smallest key of the current
+// child.
+func (c *diffCursor[K]) key() K {
+	if child := c.child(); child != nil {
+		k, _ := child.first()
+		return k
+	}
+	top := c.stack[len(c.stack)-1]
+	return top.n.leafPart().keys[top.cur]
+}
+
+// height returns the number of levels below the current element.
+func (c *diffCursor[K]) height() int {
+	return c.levels - len(c.stack) + 1
+}
+
+func (c *diffCursor[K]) descend() {
+	c.stack = append(c.stack, diffFrame[K]{n: resolve(c.child())})
+}
+
+func (c *diffCursor[K]) advance() {
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		top.cur++
+		if top.cur < top.n.leafPart().len {
+			return
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
+
+func (c *diffCursor[K]) drain(fn func(K) bool) {
+	for !c.done() {
+		if c.child() != nil {
+			c.descend()
+			continue
+		}
+		if !fn(c.key()) {
+			return
+		}
+		c.advance()
+	}
+}
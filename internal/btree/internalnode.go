@@ -7,44 +7,119 @@ import (
 	"jsouthworth.net/go/immutable/internal/atomic"
 )
 
-type internalNode struct {
-	*leafNode
-
-	children []node
+type internalNode[K any] struct {
+	*leafNode[K]
+
+	children []node[K]
+	// size is the number of keys stored in the leaves below this
+	// node. It lets the tree answer order statistic queries without
+	// visiting every leaf.
+	size int
 }
 
-func newNode(len int, edit *atomic.Bool) *internalNode {
-	return &internalNode{
-		leafNode: &leafNode{
-			keys: make([]interface{}, len),
+func newNode[K any](len int, edit *atomic.Bool) *internalNode[K] {
+	return &internalNode[K]{
+		leafNode: &leafNode[K]{
+			keys: make([]K, len),
 			len:  len,
 			edit: edit,
 		},
-		children: make([]node, len),
+		children: make([]node[K], len),
+	}
+}
+
+func (n *internalNode[K]) count() int {
+	return n.size
+}
+
+// recount recomputes size from the children. It must be called
+// whenever the children of a node are replaced.
+func (n *internalNode[K]) recount() {
+	size := 0
+	for i := 0; i < n.len; i++ {
+		size += n.children[i].count()
+	}
+	n.size = size
+}
+
+func (n *internalNode[K]) nth(i int) K {
+	for c := 0; c < n.len; c++ {
+		size := n.children[c].count()
+		if i < size {
+			return n.children[c].nth(i)
+		}
+		i -= size
 	}
+	panic("unreachable")
 }
 
-func (n *internalNode) find(key interface{}, cmp compareFunc) (interface{}, bool) {
+func (n *internalNode[K]) rank(key K, cmp compareFunc[K]) int {
+	idx := n.searchFirst(key, cmp)
+	out := 0
+	for c := 0; c < idx; c++ {
+		out += n.children[c].count()
+	}
+	if idx < n.len {
+		out += n.children[idx].rank(key, cmp)
+	}
+	return out
+}
+
+func (n *internalNode[K]) find(key K, cmp compareFunc[K]) (K, bool) {
 	idx := n.search(key, cmp)
 	if idx >= 0 {
 		return n.keys[idx], true
 	}
 	idx = -idx - 1
 	if idx == n.len {
-		return nil, false
+		var none K
+		return none, false
 	}
 	return n.children[idx].find(key, cmp)
 }
 
-func (n *internalNode) add(
-	key interface{},
-	cmp compareFunc,
-	eq eqFunc,
+func (n *internalNode[K]) first() (K, bool) {
+	return n.children[0].first()
+}
+
+func (n *internalNode[K]) ceiling(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	// keys hold the max key of each child so the first child whose
+	// max satisfies the bound must contain the answer.
+	idx := n.searchCeiling(key, cmp, inclusive)
+	if idx >= n.len {
+		var none K
+		return none, false
+	}
+	return n.children[idx].ceiling(key, cmp, inclusive)
+}
+
+func (n *internalNode[K]) floor(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	// idx is the first child with a max key beyond the bound; if it
+	// holds nothing within the bound the answer is the max of the
+	// child before it.
+	idx := n.searchCeiling(key, cmp, !inclusive)
+	if idx >= n.len {
+		return n.maxKey(), true
+	}
+	if out, ok := n.children[idx].floor(key, cmp, inclusive); ok {
+		return out, ok
+	}
+	if idx == 0 {
+		var none K
+		return none, false
+	}
+	return n.keys[idx-1], true
+}
+
+func (n *internalNode[K]) add(
+	key K,
+	cmp compareFunc[K],
+	eq eqFunc[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	idx, _ := n.searchEq(key, cmp, eq)
 	if idx >= 0 {
-		return nodeReturn{status: returnUnchanged}
+		return nodeReturn[K]{status: returnUnchanged}
 	}
 	ins := -idx - 1
 	if ins == n.len {
@@ -55,6 +130,9 @@ func (n *internalNode) add(
 	case returnUnchanged:
 		return ret
 	case returnEarly:
+		// A descendant was modified in place so this node is
+		// editable as well.
+		n.size++
 		return ret
 	case returnOne, returnReplaced:
 		if n.isEditable() {
@@ -70,122 +148,130 @@ func (n *internalNode) add(
 	}
 }
 
-func (n *internalNode) modifyInPlace(
-	ins int, eq eqFunc, new node, status returnStatus,
-) nodeReturn {
+func (n *internalNode[K]) modifyInPlace(
+	ins int, eq eqFunc[K], new node[K], status returnStatus,
+) nodeReturn[K] {
 	n.keys[ins] = new.maxKey()
 	n.children[ins] = new
+	n.recount()
 	if ins == n.len-1 && eq(new.maxKey(), n.maxKey()) {
-		return nodeReturn{
+		return nodeReturn[K]{
 			status: status,
-			nodes:  [3]node{n},
+			nodes:  [3]node[K]{n},
 		}
 	}
 	if status == returnReplaced {
-		return nodeReturn{
+		return nodeReturn[K]{
 			status: status,
-			nodes:  [3]node{n},
+			nodes:  [3]node[K]{n},
 		}
 	}
-	return nodeReturn{status: returnEarly}
+	return nodeReturn[K]{status: returnEarly}
 }
 
-func (n *internalNode) copyAndModify(
+func (n *internalNode[K]) copyAndModify(
 	ins int,
-	eq eqFunc,
+	eq eqFunc[K],
 	edit *atomic.Bool,
-	newNode node,
+	newNode node[K],
 	status returnStatus,
-) nodeReturn {
-	var newKeys []interface{}
-	if eq(newNode.maxKey(), n.keys[ins]) {
+) nodeReturn[K] {
+	// An editable copy is changed in place later, so it may only
+	// share the arrays of n if it can never change them.
+	shared := !edit.Deref()
+
+	var newKeys []K
+	if shared && eq(newNode.maxKey(), n.keys[ins]) {
 		newKeys = n.keys
 	} else {
-		newKeys = make([]interface{}, n.len)
+		newKeys = make([]K, n.len)
 		copy(newKeys, n.keys)
 		newKeys[ins] = newNode.maxKey()
 	}
 
-	var newChildren []node
-	if newNode == n.children[ins] {
+	var newChildren []node[K]
+	if shared && newNode == n.children[ins] {
 		newChildren = n.children
 	} else {
-		newChildren = make([]node, n.len)
+		newChildren = make([]node[K], n.len)
 		copy(newChildren, n.children)
 		newChildren[ins] = newNode
 	}
-	return nodeReturn{
-		status: status,
-		nodes: [3]node{
-			&internalNode{
-				leafNode: &leafNode{
-					keys: newKeys,
-					len:  n.len,
-					edit: edit,
-				},
-				children: newChildren,
-			},
+	out := &internalNode[K]{
+		leafNode: &leafNode[K]{
+			keys: newKeys,
+			len:  n.len,
+			edit: edit,
 		},
+		children: newChildren,
+	}
+	out.recount()
+	return nodeReturn[K]{
+		status: status,
+		nodes:  [3]node[K]{out},
 	}
 }
 
-func (n *internalNode) copyAndAppend(
+func (n *internalNode[K]) copyAndAppend(
 	ins int,
-	n1, n2 node,
+	n1, n2 node[K],
 	edit *atomic.Bool,
-) nodeReturn {
-	newNode := newNode(n.len+1, edit)
-	kstitch := keyStitcher{newNode.keys, 0}
+) nodeReturn[K] {
+	newNode := newNode[K](n.len+1, edit)
+	kstitch := keyStitcher[K]{newNode.keys, 0}
 	kstitch.copyAll(n.keys, 0, ins)
 	kstitch.copyOne(n1.maxKey())
 	kstitch.copyOne(n2.maxKey())
 	kstitch.copyAll(n.keys, ins+1, n.len)
 
-	nstitch := nodeStitcher{newNode.children, 0}
+	nstitch := nodeStitcher[K]{newNode.children, 0}
 	nstitch.copyAll(n.children, 0, ins)
 	nstitch.copyOne(n1)
 	nstitch.copyOne(n2)
 	nstitch.copyAll(n.children, ins+1, n.len)
+	newNode.recount()
 
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnOne,
-		nodes:  [3]node{newNode},
+		nodes:  [3]node[K]{newNode},
 	}
 }
 
-func (n *internalNode) split(
+func (n *internalNode[K]) split(
 	ins int,
-	n1, n2 node,
+	n1, n2 node[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	half1 := (n.len + 1) >> 1
 	if ins+1 == half1 {
 		half1++
 	}
 	half2 := n.len + 1 - half1
 
-	node1 := newNode(half1, edit)
-	node2 := newNode(half2, edit)
+	node1 := newNode[K](half1, edit)
+	node2 := newNode[K](half2, edit)
 
 	// add to first half
 	if ins < half1 {
-		ks := keyStitcher{node1.keys, 0}
+		ks := keyStitcher[K]{node1.keys, 0}
 		ks.copyAll(n.keys, 0, ins)
 		ks.copyOne(n1.maxKey())
 		ks.copyOne(n2.maxKey())
 		ks.copyAll(n.keys, ins+1, half1-1)
 		copy(node2.keys, n.keys[half1-1:n.len])
 
-		ns := nodeStitcher{node1.children, 0}
+		ns := nodeStitcher[K]{node1.children, 0}
 		ns.copyAll(n.children, 0, ins)
 		ns.copyOne(n1)
 		ns.copyOne(n2)
 		ns.copyAll(n.children, ins+1, half1-1)
 		copy(node2.children, n.children[half1-1:n.len])
+		node1.recount()
+		node2.recount()
 
-		return nodeReturn{
+		return nodeReturn[K]{
 			status: returnTwo,
-			nodes: [3]node{
+			nodes: [3]node[K]{
 				node1,
 				node2,
 			},
@@ -194,64 +280,66 @@ func (n *internalNode) split(
 
 	// add to second half
 	copy(node1.keys, n.keys[0:half1])
-	ks := keyStitcher{node2.keys, 0}
+	ks := keyStitcher[K]{node2.keys, 0}
 	ks.copyAll(n.keys, half1, ins)
 	ks.copyOne(n1.maxKey())
 	ks.copyOne(n2.maxKey())
 	ks.copyAll(n.keys, ins+1, n.len)
 
 	copy(node1.children, n.children[0:half1])
-	ns := nodeStitcher{node2.children, 0}
+	ns := nodeStitcher[K]{node2.children, 0}
 	ns.copyAll(n.children, half1, ins)
 	ns.copyOne(n1)
 	ns.copyOne(n2)
 	ns.copyAll(n.children, ins+1, n.len)
+	node1.recount()
+	node2.recount()
 
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnTwo,
-		nodes: [3]node{
+		nodes: [3]node[K]{
 			node1,
 			node2,
 		},
 	}
 }
 
-func (n *internalNode) remove(
-	key interface{},
-	leftNode, rightNode node,
-	cmp compareFunc,
+func (n *internalNode[K]) remove(
+	key K,
+	leftNode, rightNode node[K],
+	cmp compareFunc[K],
 	edit *atomic.Bool,
-) nodeReturn {
-	var left, right *internalNode
+) nodeReturn[K] {
+	var left, right *internalNode[K]
 	if leftNode != nil {
-		left = leftNode.(*internalNode)
+		left = resolve(leftNode).(*internalNode[K])
 	}
 	if rightNode != nil {
-		right = rightNode.(*internalNode)
+		right = resolve(rightNode).(*internalNode[K])
 	}
 	return n.removeInternal(
 		key, left, right, cmp, edit)
 }
 
-func (n *internalNode) removeInternal(
-	key interface{},
-	left, right *internalNode,
-	cmp compareFunc,
+func (n *internalNode[K]) removeInternal(
+	key K,
+	left, right *internalNode[K],
+	cmp compareFunc[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	idx := n.search(key, cmp)
 	if idx < 0 {
 		idx = -idx - 1
 	}
 	if idx == n.len {
-		return nodeReturn{status: returnUnchanged}
+		return nodeReturn[K]{status: returnUnchanged}
 	}
 
-	var leftChild node
+	var leftChild node[K]
 	if idx > 0 {
 		leftChild = n.children[idx-1]
 	}
-	var rightChild node
+	var rightChild node[K]
 	if idx < n.len-1 {
 		rightChild = n.children[idx+1]
 	}
@@ -261,6 +349,7 @@ func (n *internalNode) removeInternal(
 	case returnUnchanged:
 		return ret
 	case returnEarly:
+		n.size--
 		return ret
 	}
 
@@ -302,21 +391,21 @@ func (n *internalNode) removeInternal(
 	}
 }
 
-func (n *internalNode) needsRebalance(
+func (n *internalNode[K]) needsRebalance(
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 ) bool {
 	return newLen < minLen && (left != nil || right != nil)
 }
 
-func (n *internalNode) removeInPlace(
+func (n *internalNode[K]) removeInPlace(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
-	ks := keyStitcher{n.keys, max(idx-1, 0)}
+	nodes [3]node[K],
+) nodeReturn[K] {
+	ks := keyStitcher[K]{n.keys, max(idx-1, 0)}
 	if nodes[0] != nil {
 		ks.copyOne(nodes[0].maxKey())
 	}
@@ -328,7 +417,7 @@ func (n *internalNode) removeInPlace(
 		ks.copyAll(n.keys, idx+2, n.len)
 	}
 
-	cs := nodeStitcher{n.children, max(idx-1, 0)}
+	cs := nodeStitcher[K]{n.children, max(idx-1, 0)}
 	if nodes[0] != nil {
 		cs.copyOne(nodes[0])
 	}
@@ -341,19 +430,20 @@ func (n *internalNode) removeInPlace(
 	}
 
 	n.len = newLen
-	return nodeReturn{status: returnEarly}
+	n.recount()
+	return nodeReturn[K]{status: returnEarly}
 }
 
-func (n *internalNode) copyAndRemoveIdx(
+func (n *internalNode[K]) copyAndRemoveIdx(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
-	newCenter := newNode(newLen, edit)
+	nodes [3]node[K],
+) nodeReturn[K] {
+	newCenter := newNode[K](newLen, edit)
 
-	ks := keyStitcher{newCenter.keys, 0}
+	ks := keyStitcher[K]{newCenter.keys, 0}
 	ks.copyAll(n.keys, 0, idx-1)
 	if nodes[0] != nil {
 		ks.copyOne(nodes[0].maxKey())
@@ -364,7 +454,7 @@ func (n *internalNode) copyAndRemoveIdx(
 	}
 	ks.copyAll(n.keys, idx+2, n.len)
 
-	cs := nodeStitcher{newCenter.children, 0}
+	cs := nodeStitcher[K]{newCenter.children, 0}
 	cs.copyAll(n.children, 0, idx-1)
 	if nodes[0] != nil {
 		cs.copyOne(nodes[0])
@@ -375,9 +465,11 @@ func (n *internalNode) copyAndRemoveIdx(
 	}
 	cs.copyAll(n.children, idx+2, n.len)
 
-	return nodeReturn{
+	newCenter.recount()
+
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes: [3]node{
+		nodes: [3]node[K]{
 			internalNodeToNode(left),
 			newCenter,
 			internalNodeToNode(right),
@@ -385,16 +477,16 @@ func (n *internalNode) copyAndRemoveIdx(
 	}
 }
 
-func (n *internalNode) joinLeft(
+func (n *internalNode[K]) joinLeft(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
-	join := newNode(left.len+newLen, edit)
+	nodes [3]node[K],
+) nodeReturn[K] {
+	join := newNode[K](left.len+newLen, edit)
 
-	ks := keyStitcher{join.keys, 0}
+	ks := keyStitcher[K]{join.keys, 0}
 	ks.copyAll(left.keys, 0, left.len)
 	ks.copyAll(n.keys, 0, idx-1)
 	if nodes[0] != nil {
@@ -406,7 +498,7 @@ func (n *internalNode) joinLeft(
 	}
 	ks.copyAll(n.keys, idx+2, n.len)
 
-	cs := nodeStitcher{join.children, 0}
+	cs := nodeStitcher[K]{join.children, 0}
 	cs.copyAll(left.children, 0, left.len)
 	cs.copyAll(n.children, 0, idx-1)
 	if nodes[0] != nil {
@@ -418,22 +510,24 @@ func (n *internalNode) joinLeft(
 	}
 	cs.copyAll(n.children, idx+2, n.len)
 
-	return nodeReturn{
+	join.recount()
+
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [3]node{nil, join, internalNodeToNode(right)},
+		nodes:  [3]node[K]{nil, join, internalNodeToNode(right)},
 	}
 }
 
-func (n *internalNode) joinRight(
+func (n *internalNode[K]) joinRight(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
-	join := newNode(newLen+right.len, edit)
+	nodes [3]node[K],
+) nodeReturn[K] {
+	join := newNode[K](newLen+right.len, edit)
 
-	ks := keyStitcher{join.keys, 0}
+	ks := keyStitcher[K]{join.keys, 0}
 	ks.copyAll(n.keys, 0, idx-1)
 	if nodes[0] != nil {
 		ks.copyOne(nodes[0].maxKey())
@@ -445,7 +539,7 @@ func (n *internalNode) joinRight(
 	ks.copyAll(n.keys, idx+2, n.len)
 	ks.copyAll(right.keys, 0, right.len)
 
-	cs := nodeStitcher{join.children, 0}
+	cs := nodeStitcher[K]{join.children, 0}
 	cs.copyAll(n.children, 0, idx-1)
 	if nodes[0] != nil {
 		cs.copyOne(nodes[0])
@@ -457,31 +551,33 @@ func (n *internalNode) joinRight(
 	cs.copyAll(n.children, idx+2, n.len)
 	cs.copyAll(right.children, 0, right.len)
 
-	return nodeReturn{
+	join.recount()
+
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [3]node{internalNodeToNode(left), join, nil},
+		nodes:  [3]node[K]{internalNodeToNode(left), join, nil},
 	}
 }
 
-func (n *internalNode) borrowLeft(
+func (n *internalNode[K]) borrowLeft(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
+	nodes [3]node[K],
+) nodeReturn[K] {
 	var (
 		totalLen     = left.len + newLen
 		newLeftLen   = totalLen >> 1
 		newCenterLen = totalLen - newLeftLen
 	)
 
-	newLeft := newNode(newLeftLen, edit)
-	newCenter := newNode(newCenterLen, edit)
+	newLeft := newNode[K](newLeftLen, edit)
+	newCenter := newNode[K](newCenterLen, edit)
 
 	copy(newLeft.keys, left.keys[0:newLeftLen])
 
-	ks := keyStitcher{newCenter.keys, 0}
+	ks := keyStitcher[K]{newCenter.keys, 0}
 	ks.copyAll(left.keys, newLeftLen, left.len)
 	ks.copyAll(n.keys, 0, idx-1)
 	if nodes[0] != nil {
@@ -495,7 +591,7 @@ func (n *internalNode) borrowLeft(
 
 	copy(newLeft.children, left.children[0:newLeftLen])
 
-	cs := nodeStitcher{newCenter.children, 0}
+	cs := nodeStitcher[K]{newCenter.children, 0}
 	cs.copyAll(left.children, newLeftLen, left.len)
 	cs.copyAll(n.children, 0, idx-1)
 	if nodes[0] != nil {
@@ -507,19 +603,22 @@ func (n *internalNode) borrowLeft(
 	}
 	cs.copyAll(n.children, idx+2, n.len)
 
-	return nodeReturn{
+	newLeft.recount()
+	newCenter.recount()
+
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [3]node{newLeft, newCenter, internalNodeToNode(right)},
+		nodes:  [3]node[K]{newLeft, newCenter, internalNodeToNode(right)},
 	}
 }
 
-func (n *internalNode) borrowRight(
+func (n *internalNode[K]) borrowRight(
 	idx int,
 	newLen int,
-	left, right *internalNode,
+	left, right *internalNode[K],
 	edit *atomic.Bool,
-	nodes [3]node,
-) nodeReturn {
+	nodes [3]node[K],
+) nodeReturn[K] {
 	var (
 		totalLen     = newLen + right.len
 		newCenterLen = totalLen >> 1
@@ -527,10 +626,10 @@ func (n *internalNode) borrowRight(
 		rightHead    = right.len - newRightLen
 	)
 
-	newCenter := newNode(newCenterLen, edit)
-	newRight := newNode(newRightLen, edit)
+	newCenter := newNode[K](newCenterLen, edit)
+	newRight := newNode[K](newRightLen, edit)
 
-	ks := keyStitcher{newCenter.keys, 0}
+	ks := keyStitcher[K]{newCenter.keys, 0}
 	ks.copyAll(n.keys, 0, idx-1)
 	if nodes[0] != nil {
 		ks.copyOne(nodes[0].maxKey())
@@ -544,7 +643,7 @@ func (n *internalNode) borrowRight(
 
 	copy(newRight.keys, right.keys[rightHead:right.len])
 
-	cs := nodeStitcher{newCenter.children, 0}
+	cs := nodeStitcher[K]{newCenter.children, 0}
 	cs.copyAll(n.children, 0, idx-1)
 	if nodes[0] != nil {
 		cs.copyOne(nodes[0])
@@ -558,19 +657,22 @@ func (n *internalNode) borrowRight(
 
 	copy(newRight.children, right.children[rightHead:right.len])
 
-	return nodeReturn{
+	newCenter.recount()
+	newRight.recount()
+
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [3]node{internalNodeToNode(left), newCenter, newRight},
+		nodes:  [3]node[K]{internalNodeToNode(left), newCenter, newRight},
 	}
 }
 
-func (n *internalNode) String() string {
+func (n *internalNode[K]) String() string {
 	var b strings.Builder
 	n.string(&b, 0)
 	return b.String()
 }
 
-func (n *internalNode) string(b *strings.Builder, lvl int) {
+func (n *internalNode[K]) string(b *strings.Builder, lvl int) {
 	for i := 0; i < n.len; i++ {
 		b.WriteString("\n")
 		for j := 0; j < lvl; j++ {
@@ -581,7 +683,7 @@ func (n *internalNode) string(b *strings.Builder, lvl int) {
 	}
 }
 
-func internalNodeToNode(n *internalNode) node {
+func internalNodeToNode[K any](n *internalNode[K]) node[K] {
 	if n != nil {
 		return n
 	}
@@ -8,38 +8,50 @@ import (
 	"jsouthworth.net/go/immutable/internal/atomic"
 )
 
-type leafNode struct {
-	keys []interface{}
+type leafNode[K any] struct {
+	keys []K
 	len  int
 	edit *atomic.Bool
 }
 
-func newLeaf(len int, edit *atomic.Bool) *leafNode {
-	out := leafNode{
+func newLeaf[K any](len int, edit *atomic.Bool) *leafNode[K] {
+	out := leafNode[K]{
 		len:  len,
 		edit: edit,
 	}
 	if edit.Deref() {
-		out.keys = make([]interface{}, min(maxLen, len+expandLen))
+		out.keys = make([]K, min(maxLen, len+expandLen))
 	} else {
-		out.keys = make([]interface{}, len)
+		out.keys = make([]K, len)
 	}
 	return &out
 }
 
-func (n *leafNode) isEditable() bool {
+func (n *leafNode[K]) isEditable() bool {
 	return n.edit.Deref()
 }
 
-func (n *leafNode) leafPart() *leafNode {
+func (n *leafNode[K]) leafPart() *leafNode[K] {
 	return n
 }
 
-func (n *leafNode) maxKey() interface{} {
+func (n *leafNode[K]) maxKey() K {
 	return n.keys[n.len-1]
 }
 
-func (n *leafNode) search(key interface{}, cmp compareFunc) int {
+func (n *leafNode[K]) count() int {
+	return n.len
+}
+
+func (n *leafNode[K]) nth(i int) K {
+	return n.keys[i]
+}
+
+func (n *leafNode[K]) rank(key K, cmp compareFunc[K]) int {
+	return n.searchFirst(key, cmp)
+}
+
+func (n *leafNode[K]) search(key K, cmp compareFunc[K]) int {
 	i := sort.Search(n.len, func(i int) bool {
 		return cmp(n.keys[i], key) >= 0
 	})
@@ -50,13 +62,62 @@ func (n *leafNode) search(key interface{}, cmp compareFunc) int {
 	}
 }
 
-func (n *leafNode) searchFirst(key interface{}, cmp compareFunc) int {
+func (n *leafNode[K]) searchFirst(key K, cmp compareFunc[K]) int {
 	return sort.Search(n.len, func(i int) bool {
 		return cmp(n.keys[i], key) >= 0
 	})
 }
 
-func (n *leafNode) searchEq(key interface{}, cmp compareFunc, eq eqFunc) (int, bool) {
+func (n *leafNode[K]) searchAfter(key K, cmp compareFunc[K]) int {
+	return sort.Search(n.len, func(i int) bool {
+		return cmp(n.keys[i], key) > 0
+	})
+}
+
+// searchCeiling returns the index of the first key >= key when
+// inclusive, or > key otherwise.
+func (n *leafNode[K]) searchCeiling(key K, cmp compareFunc[K], inclusive bool) int {
+	if inclusive {
+		return n.searchFirst(key, cmp)
+	}
+	return n.searchAfter(key, cmp)
+}
+
+func (n *leafNode[K]) first() (K, bool) {
+	if n.len == 0 {
+		var none K
+		return none, false
+	}
+	return n.keys[0], true
+}
+
+func (n *leafNode[K]) last() (K, bool) {
+	if n.len == 0 {
+		var none K
+		return none, false
+	}
+	return n.keys[n.len-1], true
+}
+
+func (n *leafNode[K]) ceiling(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	idx := n.searchCeiling(key, cmp, inclusive)
+	if idx >= n.len {
+		var none K
+		return none, false
+	}
+	return n.keys[idx], true
+}
+
+func (n *leafNode[K]) floor(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	idx := n.searchCeiling(key, cmp, !inclusive) - 1
+	if idx < 0 {
+		var none K
+		return none, false
+	}
+	return n.keys[idx], true
+}
+
+func (n *leafNode[K]) searchEq(key K, cmp compareFunc[K], eq eqFunc[K]) (int, bool) {
 	i := sort.Search(n.len, func(i int) bool {
 		return cmp(n.keys[i], key) >= 0
 	})
@@ -71,8 +132,8 @@ func (n *leafNode) searchEq(key interface{}, cmp compareFunc, eq eqFunc) (int, b
 	}
 }
 
-func (n *leafNode) find(key interface{}, cmp compareFunc) (interface{}, bool) {
-	var out interface{}
+func (n *leafNode[K]) find(key K, cmp compareFunc[K]) (K, bool) {
+	var out K
 	v := n.search(key, cmp)
 	if v >= 0 {
 		out = n.keys[v]
@@ -80,15 +141,15 @@ func (n *leafNode) find(key interface{}, cmp compareFunc) (interface{}, bool) {
 	return out, v >= 0
 }
 
-func (n *leafNode) add(
-	key interface{},
-	cmp compareFunc,
-	eq eqFunc,
+func (n *leafNode[K]) add(
+	key K,
+	cmp compareFunc[K],
+	eq eqFunc[K],
 	edit *atomic.Bool,
-) (out nodeReturn) {
+) (out nodeReturn[K]) {
 	idx, replace := n.searchEq(key, cmp, eq)
 	if idx >= 0 && !replace {
-		return nodeReturn{status: returnUnchanged}
+		return nodeReturn[K]{status: returnUnchanged}
 	}
 	ins := (-idx) - 1
 
@@ -107,83 +168,83 @@ func (n *leafNode) add(
 	return n.split(ins, key, edit)
 }
 
-func (n *leafNode) modifyInPlace(
-	ins int, key interface{}, edit *atomic.Bool, replace bool,
-) nodeReturn {
+func (n *leafNode[K]) modifyInPlace(
+	ins int, key K, edit *atomic.Bool, replace bool,
+) nodeReturn[K] {
 	if replace {
 		n.keys[ins] = key
-		return nodeReturn{status: returnReplaced, nodes: [3]node{n}}
+		return nodeReturn[K]{status: returnReplaced, nodes: [3]node[K]{n}}
 	} else if ins == n.len {
 		n.keys[n.len] = key
 		n.len++
-		return nodeReturn{status: returnOne, nodes: [3]node{n}}
+		return nodeReturn[K]{status: returnOne, nodes: [3]node[K]{n}}
 	} else {
 		copy(n.keys[ins+1:], n.keys[ins:n.len])
 		n.keys[ins] = key
 		n.len++
-		return nodeReturn{status: returnEarly}
+		return nodeReturn[K]{status: returnEarly}
 	}
 }
 
-func (n *leafNode) copyAndInsertNode(
-	ins int, key interface{}, edit *atomic.Bool,
-) nodeReturn {
-	nl := newLeaf(n.len+1, edit)
-	ks := keyStitcher{nl.keys, 0}
+func (n *leafNode[K]) copyAndInsertNode(
+	ins int, key K, edit *atomic.Bool,
+) nodeReturn[K] {
+	nl := newLeaf[K](n.len+1, edit)
+	ks := keyStitcher[K]{nl.keys, 0}
 	ks.copyAll(n.keys, 0, ins)
 	ks.copyOne(key)
 	ks.copyAll(n.keys, ins, n.len)
-	return nodeReturn{status: returnOne, nodes: [3]node{nl}}
+	return nodeReturn[K]{status: returnOne, nodes: [3]node[K]{nl}}
 }
 
-func (n *leafNode) copyAndReplaceNode(
-	ins int, key interface{}, edit *atomic.Bool,
-) nodeReturn {
-	nl := newLeaf(n.len, edit)
+func (n *leafNode[K]) copyAndReplaceNode(
+	ins int, key K, edit *atomic.Bool,
+) nodeReturn[K] {
+	nl := newLeaf[K](n.len, edit)
 	copy(nl.keys, n.keys)
 	nl.keys[ins] = key
-	return nodeReturn{status: returnReplaced, nodes: [3]node{nl}}
+	return nodeReturn[K]{status: returnReplaced, nodes: [3]node[K]{nl}}
 }
 
-func (n *leafNode) split(
-	ins int, key interface{}, edit *atomic.Bool,
-) nodeReturn {
+func (n *leafNode[K]) split(
+	ins int, key K, edit *atomic.Bool,
+) nodeReturn[K] {
 	firstHalf := (n.len + 1) >> 1
 	secondHalf := n.len + 1 - firstHalf
-	n1 := newLeaf(firstHalf, edit)
-	n2 := newLeaf(secondHalf, edit)
+	n1 := newLeaf[K](firstHalf, edit)
+	n2 := newLeaf[K](secondHalf, edit)
 
 	if ins < firstHalf {
-		ks := keyStitcher{n1.keys, 0}
+		ks := keyStitcher[K]{n1.keys, 0}
 		ks.copyAll(n.keys, 0, ins)
 		ks.copyOne(key)
 		ks.copyAll(n.keys, ins, firstHalf-1)
 		copy(n2.keys, n.keys[firstHalf-1:n.len])
-		return nodeReturn{status: returnTwo, nodes: [3]node{n1, n2}}
+		return nodeReturn[K]{status: returnTwo, nodes: [3]node[K]{n1, n2}}
 	}
 
 	copy(n1.keys, n.keys[0:firstHalf])
-	ks := keyStitcher{n2.keys, 0}
+	ks := keyStitcher[K]{n2.keys, 0}
 	ks.copyAll(n.keys, firstHalf, ins)
 	ks.copyOne(key)
 	ks.copyAll(n.keys, ins, n.len)
-	return nodeReturn{status: returnTwo, nodes: [3]node{n1, n2}}
+	return nodeReturn[K]{status: returnTwo, nodes: [3]node[K]{n1, n2}}
 }
 
-func (n *leafNode) remove(
-	key interface{},
-	leftNode, rightNode node,
-	cmp compareFunc,
+func (n *leafNode[K]) remove(
+	key K,
+	leftNode, rightNode node[K],
+	cmp compareFunc[K],
 	edit *atomic.Bool,
-) (out nodeReturn) {
+) (out nodeReturn[K]) {
 	idx := n.search(key, cmp)
 	if idx < 0 {
-		return nodeReturn{status: returnUnchanged}
+		return nodeReturn[K]{status: returnUnchanged}
 	}
 
 	newLen := n.len - 1
 
-	var left, right *leafNode
+	var left, right *leafNode[K]
 	if leftNode != nil {
 		left = leftNode.leafPart()
 	}
@@ -211,44 +272,44 @@ func (n *leafNode) remove(
 	}
 }
 
-func (n *leafNode) needsMerge(
+func (n *leafNode[K]) needsMerge(
 	newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 ) bool {
 	return newLen < minLen && (left != nil || right != nil)
 }
 
-func (n *leafNode) removeInPlace(
+func (n *leafNode[K]) removeInPlace(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	copy(n.keys[idx:], n.keys[idx+1:n.len])
 	n.len = newLen
 	if idx == newLen {
-		return nodeReturn{
+		return nodeReturn[K]{
 			status: returnThree,
-			nodes: [...]node{
+			nodes: [...]node[K]{
 				leafNodeToNode(left),
 				n,
 				leafNodeToNode(right),
 			},
 		}
 	}
-	return nodeReturn{status: returnEarly}
+	return nodeReturn[K]{status: returnEarly}
 }
 
-func (n *leafNode) copyAndRemoveIdx(
+func (n *leafNode[K]) copyAndRemoveIdx(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
-	center := newLeaf(newLen, edit)
+) nodeReturn[K] {
+	center := newLeaf[K](newLen, edit)
 	copy(center.keys, n.keys[0:idx])
 	copy(center.keys[idx:], n.keys[idx+1:])
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes: [...]node{
+		nodes: [...]node[K]{
 			leafNodeToNode(left),
 			center,
 			leafNodeToNode(right),
@@ -256,47 +317,47 @@ func (n *leafNode) copyAndRemoveIdx(
 	}
 }
 
-func (n *leafNode) joinLeft(
+func (n *leafNode[K]) joinLeft(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
-	join := newLeaf(left.len+newLen, edit)
-	ks := keyStitcher{join.keys, 0}
+) nodeReturn[K] {
+	join := newLeaf[K](left.len+newLen, edit)
+	ks := keyStitcher[K]{join.keys, 0}
 	ks.copyAll(left.keys, 0, left.len)
 	ks.copyAll(n.keys, 0, idx)
 	ks.copyAll(n.keys, idx+1, n.len)
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [...]node{nil, join, leafNodeToNode(right)},
+		nodes:  [...]node[K]{nil, join, leafNodeToNode(right)},
 	}
 }
 
-func (n *leafNode) joinRight(
+func (n *leafNode[K]) joinRight(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
-	join := newLeaf(right.len+newLen, edit)
-	ks := keyStitcher{join.keys, 0}
+) nodeReturn[K] {
+	join := newLeaf[K](right.len+newLen, edit)
+	ks := keyStitcher[K]{join.keys, 0}
 	ks.copyAll(n.keys, 0, idx)
 	ks.copyAll(n.keys, idx+1, n.len)
 	ks.copyAll(right.keys, 0, right.len)
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [...]node{leafNodeToNode(left), join, nil},
+		nodes:  [...]node[K]{leafNodeToNode(left), join, nil},
 	}
 }
 
-func (n *leafNode) canJoin(newLen int) bool {
+func (n *leafNode[K]) canJoin(newLen int) bool {
 	return n != nil && (n.len+newLen) < maxLen
 }
 
-func (n *leafNode) borrowLeft(
+func (n *leafNode[K]) borrowLeft(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	var (
 		totalLen     = left.len + newLen
 		newLeftLen   = totalLen >> 1
@@ -304,7 +365,7 @@ func (n *leafNode) borrowLeft(
 		leftTail     = left.len - newLeftLen
 	)
 
-	var newLeft, newCenter *leafNode
+	var newLeft, newCenter *leafNode[K]
 
 	// prepend to center
 	if n.isEditable() && newCenterLen <= len(n.keys) {
@@ -314,8 +375,8 @@ func (n *leafNode) borrowLeft(
 		copy(n.keys[0:], left.keys[newLeftLen:left.len])
 		n.len = newCenterLen
 	} else {
-		newCenter = newLeaf(newCenterLen, edit)
-		ks := keyStitcher{newCenter.keys, 0}
+		newCenter = newLeaf[K](newCenterLen, edit)
+		ks := keyStitcher[K]{newCenter.keys, 0}
 		ks.copyAll(left.keys, newLeftLen, left.len)
 		ks.copyAll(n.keys, 0, idx)
 		ks.copyAll(n.keys, idx+1, n.len)
@@ -326,21 +387,21 @@ func (n *leafNode) borrowLeft(
 		newLeft = left
 		left.len = newLeftLen
 	} else {
-		newLeft = newLeaf(newLeftLen, edit)
+		newLeft = newLeaf[K](newLeftLen, edit)
 		copy(newLeft.keys, left.keys[0:newLeftLen])
 	}
 
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [...]node{newLeft, newCenter, leafNodeToNode(right)},
+		nodes:  [...]node[K]{newLeft, newCenter, leafNodeToNode(right)},
 	}
 }
 
-func (n *leafNode) borrowRight(
+func (n *leafNode[K]) borrowRight(
 	idx, newLen int,
-	left, right *leafNode,
+	left, right *leafNode[K],
 	edit *atomic.Bool,
-) nodeReturn {
+) nodeReturn[K] {
 	var (
 		totalLen     = newLen + right.len
 		newCenterLen = totalLen >> 1
@@ -348,18 +409,18 @@ func (n *leafNode) borrowRight(
 		rightHead    = right.len - newRightLen
 	)
 
-	var newCenter, newRight *leafNode
+	var newCenter, newRight *leafNode[K]
 
 	// append to center
 	if n.isEditable() && newCenterLen <= len(n.keys) {
 		newCenter = n
-		ks := keyStitcher{n.keys, idx}
+		ks := keyStitcher[K]{n.keys, idx}
 		ks.copyAll(n.keys, idx+1, n.len)
 		ks.copyAll(right.keys, 0, rightHead)
 		n.len = newCenterLen
 	} else {
-		newCenter = newLeaf(newCenterLen, edit)
-		ks := keyStitcher{newCenter.keys, 0}
+		newCenter = newLeaf[K](newCenterLen, edit)
+		ks := keyStitcher[K]{newCenter.keys, 0}
 		ks.copyAll(n.keys, 0, idx)
 		ks.copyAll(n.keys, idx+1, n.len)
 		ks.copyAll(right.keys, 0, rightHead)
@@ -371,22 +432,22 @@ func (n *leafNode) borrowRight(
 		copy(right.keys, right.keys[rightHead:right.len])
 		right.len = newRightLen
 	} else {
-		newRight = newLeaf(newRightLen, edit)
+		newRight = newLeaf[K](newRightLen, edit)
 		copy(newRight.keys, right.keys[rightHead:right.len])
 	}
-	return nodeReturn{
+	return nodeReturn[K]{
 		status: returnThree,
-		nodes:  [...]node{leafNodeToNode(left), newCenter, newRight},
+		nodes:  [...]node[K]{leafNodeToNode(left), newCenter, newRight},
 	}
 }
 
-func (n *leafNode) String() string {
+func (n *leafNode[K]) String() string {
 	var b strings.Builder
 	n.string(&b, 0)
 	return b.String()
 }
 
-func (n *leafNode) string(b *strings.Builder, lvl int) {
+func (n *leafNode[K]) string(b *strings.Builder, lvl int) {
 	b.WriteRune('{')
 	for i := 0; i < n.len; i++ {
 		if i > 0 {
@@ -397,7 +458,7 @@ func (n *leafNode) string(b *strings.Builder, lvl int) {
 	b.WriteRune('}')
 }
 
-func leafNodeToNode(n *leafNode) node {
+func leafNodeToNode[K any](n *leafNode[K]) node[K] {
 	if n != nil {
 		return n
 	}
@@ -0,0 +1,237 @@
+package btree
+
+import (
+	"jsouthworth.net/go/immutable/internal/atomic"
+)
+
+// smallRatio is how many times larger one tree must be than the other
+// before merging by individual lookups is preferred over a linear
+// merge of both trees.
+const smallRatio = 16
+
+// FromSorted returns a tree with the same ordering as t that holds
+// keys. keys must be sorted by the tree's compare function and free
+// of duplicates. The tree is built bottom up in linear time.
+func (t *TreeOf[K]) FromSorted(keys []K) *TreeOf[K] {
+	if len(keys) == 0 {
+		return t.cleared()
+	}
+	edit := emptyEdit
+	nodes := make([]node[K], 0, chunks(len(keys)))
+	eachChunk(len(keys), func(start, end int) {
+		leaf := newLeaf[K](end-start, edit)
+		copy(leaf.keys, keys[start:end])
+		nodes = append(nodes, leaf)
+	})
+	for len(nodes) > 1 {
+		nodes = buildLevel(nodes, edit)
+	}
+	return &TreeOf[K]{
+		root:  nodes[0],
+		count: len(keys),
+		edit:  edit,
+		cmp:   t.cmp,
+		order: t.order,
+		eq:    t.eq,
+	}
+}
+
+// IsSorted reports whether keys are in strictly ascending order by
+// the tree's compare function, as FromSorted requires.
+func (t *TreeOf[K]) IsSorted(keys []K) bool {
+	for i := 1; i < len(keys); i++ {
+		if t.cmp(keys[i-1], keys[i]) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func buildLevel[K any](children []node[K], edit *atomic.Bool) []node[K] {
+	parents := make([]node[K], 0, chunks(len(children)))
+	eachChunk(len(children), func(start, end int) {
+		parent := newNode[K](end-start, edit)
+		for i, child := range children[start:end] {
+			parent.keys[i] = child.maxKey()
+			parent.children[i] = child
+		}
+		parent.recount()
+		parents = append(parents, parent)
+	})
+	return parents
+}
+
+func chunks(n int) int {
+	return (n + maxLen - 1) / maxLen
+}
+
+// eachChunk splits n items into as few chunks of at most maxLen items
+// as possible. The items are spread evenly so every chunk holds at
+// least minLen items when there is more than one.
+func eachChunk(n int, fn func(start, end int)) {
+	count := chunks(n)
+	size, extra := n/count, n%count
+	start := 0
+	for i := 0; i < count; i++ {
+		end := start + size
+		if i < extra {
+			end++
+		}
+		fn(start, end)
+		start = end
+	}
+}
+
+// SameOrder reports whether o was built from the same Compare option
+// as t, or like t from none, so their keys are known to be in the same
+// order.
+func (t *TreeOf[K]) SameOrder(o *TreeOf[K]) bool {
+	return t.order == o.order
+}
+
+// Union returns a tree holding the keys of both trees. Keys present
+// in both are taken from t.
+func (t *TreeOf[K]) Union(o *TreeOf[K]) *TreeOf[K] {
+	switch {
+	case o.count == 0:
+		return t
+	case t.count == 0:
+		return t.withRoot(o.root, o.count)
+	case o.count*smallRatio < t.count:
+		out := t.AsTransient()
+		iter := o.Iterator()
+		for iter.HasNext() {
+			key := iter.Next()
+			if !out.Contains(key) {
+				out.Add(key)
+			}
+		}
+		return out.AsPersistent()
+	}
+	return t.merge(o, true, true, true)
+}
+
+// Intersection returns a tree holding the keys of t that are also
+// in o.
+func (t *TreeOf[K]) Intersection(o *TreeOf[K]) *TreeOf[K] {
+	switch {
+	case t.count == 0:
+		return t
+	case o.count == 0:
+		return t.cleared()
+	case o.count*smallRatio < t.count:
+		var keys []K
+		iter := o.Iterator()
+		for iter.HasNext() {
+			if key, ok := t.Find(iter.Next()); ok {
+				keys = append(keys, key)
+			}
+		}
+		return t.fromMerged(keys)
+	case t.count*smallRatio < o.count:
+		var keys []K
+		iter := t.Iterator()
+		for iter.HasNext() {
+			key := iter.Next()
+			if o.Contains(key) {
+				keys = append(keys, key)
+			}
+		}
+		return t.fromMerged(keys)
+	}
+	return t.merge(o, false, true, false)
+}
+
+// Difference returns a tree holding the keys of t that are not in o.
+func (t *TreeOf[K]) Difference(o *TreeOf[K]) *TreeOf[K] {
+	switch {
+	case t.count == 0, o.count == 0:
+		return t
+	case o.count*smallRatio < t.count:
+		out := t.AsTransient()
+		iter := o.Iterator()
+		for iter.HasNext() {
+			out.Delete(iter.Next())
+		}
+		return out.AsPersistent()
+	case t.count*smallRatio < o.count:
+		var keys []K
+		iter := t.Iterator()
+		for iter.HasNext() {
+			key := iter.Next()
+			if !o.Contains(key) {
+				keys = append(keys, key)
+			}
+		}
+		return t.fromMerged(keys)
+	}
+	return t.merge(o, true, false, false)
+}
+
+// merge walks both trees in order keeping the keys only in t when
+// left is set, the keys in both when both is set and the keys only
+// in o when right is set.
+func (t *TreeOf[K]) merge(o *TreeOf[K], left, both, right bool) *TreeOf[K] {
+	keys := make([]K, 0, t.count+o.count)
+	ti, oi := t.Iterator(), o.Iterator()
+	var a, b K
+	hasA, hasB := ti.HasNext(), oi.HasNext()
+	if hasA {
+		a = ti.Next()
+	}
+	if hasB {
+		b = oi.Next()
+	}
+	for hasA && hasB {
+		c := t.cmp(a, b)
+		switch {
+		case c < 0 && left, c == 0 && both:
+			keys = append(keys, a)
+		case c > 0 && right:
+			keys = append(keys, b)
+		}
+		if c <= 0 {
+			if hasA = ti.HasNext(); hasA {
+				a = ti.Next()
+			}
+		}
+		if c >= 0 {
+			if hasB = oi.HasNext(); hasB {
+				b = oi.Next()
+			}
+		}
+	}
+	for hasA && left {
+		keys = append(keys, a)
+		if hasA = ti.HasNext(); hasA {
+			a = ti.Next()
+		}
+	}
+	for hasB && right {
+		keys = append(keys, b)
+		if hasB = oi.HasNext(); hasB {
+			b = oi.Next()
+		}
+	}
+	return t.fromMerged(keys)
+}
+
+// fromMerged builds the result of a set operation. When every key of
+// t survived the result is t itself.
+func (t *TreeOf[K]) fromMerged(keys []K) *TreeOf[K] {
+	if len(keys) == t.count {
+		return t
+	}
+	return t.FromSorted(keys)
+}
+
+func (t *TreeOf[K]) withRoot(root node[K], count int) *TreeOf[K] {
+	return &TreeOf[K]{
+		root:  root,
+		count: count,
+		edit:  t.edit,
+		cmp:   t.cmp,
+		order: t.order,
+		eq:    t.eq,
+	}
+}
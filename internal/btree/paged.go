@@ -0,0 +1,261 @@
+package btree
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"jsouthworth.net/go/immutable/internal/atomic"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/persist"
+)
+
+// Pager reads the leaves of paged trees from a store as they are
+// needed and keeps the most recently used of them in memory. A Pager
+// may be shared by any number of trees and is safe for concurrent
+// use.
+type Pager[K any] struct {
+	store    persist.Store
+	dec      func(*binenc.Decoder) (K, error)
+	capacity int
+
+	mu     sync.Mutex
+	leaves map[persist.Hash]*list.Element
+	lru    list.List
+}
+
+type pagerEntry[K any] struct {
+	hash persist.Hash
+	leaf *leafNode[K]
+}
+
+// NewPager returns a Pager that reads leaves written by Persist from
+// store, decoding keys with dec, and keeps up to capacity leaves in
+// memory.
+func NewPager[K any](store persist.Store, dec func(*binenc.Decoder) (K, error), capacity int) *Pager[K] {
+	return &Pager[K]{
+		store:    store,
+		dec:      dec,
+		capacity: max(capacity, 1),
+		leaves:   make(map[persist.Hash]*list.Element),
+	}
+}
+
+// Cached returns the number of leaves held in memory.
+func (p *Pager[K]) Cached() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+func (p *Pager[K]) leaf(h persist.Hash) (*leafNode[K], error) {
+	p.mu.Lock()
+	if e, ok := p.leaves[h]; ok {
+		p.lru.MoveToFront(e)
+		p.mu.Unlock()
+		return e.Value.(pagerEntry[K]).leaf, nil
+	}
+	p.mu.Unlock()
+
+	data, err := p.store.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeLeaf(data, p.dec)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.leaves[h]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(pagerEntry[K]).leaf, nil
+	}
+	p.leaves[h] = p.lru.PushFront(pagerEntry[K]{hash: h, leaf: n})
+	for p.lru.Len() > p.capacity {
+		e := p.lru.Back()
+		delete(p.leaves, e.Value.(pagerEntry[K]).hash)
+		p.lru.Remove(e)
+	}
+	return n, nil
+}
+
+// LoadPaged reads the tree whose root hash was returned by Persist
+// from the pager's store. Only the root is read immediately. Internal
+// nodes are read when they are first used and kept, but each leaf is
+// read when it is used and may be read again after the pager evicts
+// it, so a tree much larger than memory may be searched in O(log n)
+// reads. Changes to the tree keep the leaves they create in memory.
+// The tree has the same ordering as t, which must be the ordering it
+// was written with.
+//
+// Operations on the tree panic with a *persist.ReadError if a node can
+// not be read; persist.Recover turns the panic back into an error.
+func (t *TreeOf[K]) LoadPaged(p *Pager[K], h persist.Hash) (*TreeOf[K], error) {
+	data, err := p.store.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	count, h, err := decodeTreeRoot(data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = p.store.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	var root node[K]
+	kind, err := binenc.KindOf(data)
+	switch {
+	case err != nil:
+		return nil, err
+	case kind == binenc.TreeLeaf:
+		root, err = p.leaf(h)
+	default:
+		root, err = loadPagedInternal(p, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if root.count() != count {
+		return nil, errCorruptNode
+	}
+	return &TreeOf[K]{
+		root:  root,
+		count: count,
+		edit:  emptyEdit,
+		cmp:   t.cmp,
+		order: t.order,
+		eq:    t.eq,
+	}, nil
+}
+
+func loadPagedInternal[K any](p *Pager[K], data []byte) (node[K], error) {
+	return decodeInternal(data, p.dec, func(h persist.Hash, len int, max K) (node[K], error) {
+		return &pagedLeaf[K]{pager: p, hash: h, len: len, max: max}, nil
+	}, func(h persist.Hash, size int, max K) (node[K], error) {
+		return &lazyNode[K]{pager: p, hash: h, size: size, max: max}, nil
+	})
+}
+
+// internal reads the internal node stored under h.
+func (p *Pager[K]) internal(h persist.Hash) (node[K], error) {
+	data, err := p.store.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	return loadPagedInternal(p, data)
+}
+
+// pagedLeaf stands in for a leaf that has not been read. It knows
+// enough about the leaf for its parent to maintain counts and keys
+// and reads the leaf through the pager for everything else.
+type pagedLeaf[K any] struct {
+	pager *Pager[K]
+	hash  persist.Hash
+	len   int
+	max   K
+}
+
+func (n *pagedLeaf[K]) load() *leafNode[K] {
+	leaf, err := n.pager.leaf(n.hash)
+	if err != nil {
+		panic(&persist.ReadError{Hash: n.hash, Err: err})
+	}
+	return leaf
+}
+
+// resolve returns the node a pagedLeaf or lazyNode stands in for, or
+// n itself.
+func resolve[K any](n node[K]) node[K] {
+	switch n := n.(type) {
+	case *pagedLeaf[K]:
+		return n.load()
+	case *lazyNode[K]:
+		return n.load()
+	default:
+		return n
+	}
+}
+
+// sameNode reports whether a and b are the same node, in memory or as
+// the same node of a store that hasn't been read yet.
+func sameNode[K any](a, b node[K]) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *pagedLeaf[K]:
+		b, ok := b.(*pagedLeaf[K])
+		return ok && a.pager == b.pager && a.hash == b.hash
+	case *lazyNode[K]:
+		b, ok := b.(*lazyNode[K])
+		return ok && a.r == b.r && a.pager == b.pager && a.hash == b.hash
+	default:
+		return false
+	}
+}
+
+func (n *pagedLeaf[K]) search(key K, cmp compareFunc[K]) int {
+	return n.load().search(key, cmp)
+}
+
+func (n *pagedLeaf[K]) searchFirst(key K, cmp compareFunc[K]) int {
+	return n.load().searchFirst(key, cmp)
+}
+
+func (n *pagedLeaf[K]) find(key K, cmp compareFunc[K]) (K, bool) {
+	return n.load().find(key, cmp)
+}
+
+func (n *pagedLeaf[K]) first() (K, bool) {
+	return n.load().first()
+}
+
+func (n *pagedLeaf[K]) last() (K, bool) {
+	return n.max, n.len > 0
+}
+
+func (n *pagedLeaf[K]) ceiling(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	return n.load().ceiling(key, cmp, inclusive)
+}
+
+func (n *pagedLeaf[K]) floor(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	return n.load().floor(key, cmp, inclusive)
+}
+
+func (n *pagedLeaf[K]) count() int {
+	return n.len
+}
+
+func (n *pagedLeaf[K]) nth(i int) K {
+	return n.load().nth(i)
+}
+
+func (n *pagedLeaf[K]) rank(key K, cmp compareFunc[K]) int {
+	if cmp(key, n.max) > 0 {
+		return n.len
+	}
+	return n.load().rank(key, cmp)
+}
+
+func (n *pagedLeaf[K]) add(key K, cmp compareFunc[K], eq eqFunc[K], edit *atomic.Bool) nodeReturn[K] {
+	return n.load().add(key, cmp, eq, edit)
+}
+
+func (n *pagedLeaf[K]) remove(key K, left, right node[K], cmp compareFunc[K], edit *atomic.Bool) nodeReturn[K] {
+	return n.load().remove(key, left, right, cmp, edit)
+}
+
+func (n *pagedLeaf[K]) leafPart() *leafNode[K] {
+	return n.load()
+}
+
+func (n *pagedLeaf[K]) maxKey() K {
+	return n.max
+}
+
+func (n *pagedLeaf[K]) string(b *strings.Builder, lvl int) {
+	n.load().string(b, lvl)
+}
@@ -0,0 +1,382 @@
+package btree
+
+import (
+	"errors"
+	"strings"
+
+	"jsouthworth.net/go/immutable/internal/atomic"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/persist"
+)
+
+var errCorruptNode = errors.New("corrupt btree node")
+
+// Persist writes the tree to w and returns the hash of its root,
+// encoding each key with enc. Each node is written once, so the
+// nodes this tree shares with trees previously written by w are not
+// written again. Internal nodes record the size and largest key of
+// each child so that a paged tree can be searched without reading
+// its leaves.
+func (t *TreeOf[K]) Persist(w *persist.Writer, enc func(*binenc.Encoder, K) error) (persist.Hash, error) {
+	root, err := persistNode(w, t.root, enc)
+	if err != nil {
+		return persist.Hash{}, err
+	}
+	return w.Write(t, func() ([]byte, error) {
+		e := binenc.NewEncoder(binenc.TreeRoot, t.count)
+		e.WriteBytes(root[:])
+		return e.Bytes(), nil
+	})
+}
+
+// treeRoot is a decoded root. The tree built from it takes its order
+// from the tree Load is called on, so only the contents are shared
+// by a reader.
+type treeRoot[K any] struct {
+	root  node[K]
+	count int
+}
+
+// Load reads the tree whose root hash was returned by Persist,
+// decoding each key with dec. Only the root is read immediately; the
+// other nodes are read through r when they are first used and then
+// kept. Operations on the tree panic with a *persist.ReadError if a
+// node can not be read. The tree has the same ordering as t, which
+// must be the ordering it was written with.
+func (t *TreeOf[K]) Load(r *persist.Reader, h persist.Hash, dec func(*binenc.Decoder) (K, error)) (*TreeOf[K], error) {
+	tr, err := persist.Read(r, h, func(data []byte) (treeRoot[K], error) {
+		count, h, err := decodeTreeRoot(data)
+		if err != nil {
+			return treeRoot[K]{}, err
+		}
+		root, err := loadNode(r, h, dec)
+		if err != nil {
+			return treeRoot[K]{}, err
+		}
+		if root.count() != count {
+			return treeRoot[K]{}, errCorruptNode
+		}
+		return treeRoot[K]{root: root, count: count}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TreeOf[K]{
+		root:  tr.root,
+		count: tr.count,
+		edit:  emptyEdit,
+		cmp:   t.cmp,
+		order: t.order,
+		eq:    t.eq,
+	}, nil
+}
+
+func decodeTreeRoot(data []byte) (int, persist.Hash, error) {
+	d, count, err := binenc.NewDecoder(data, binenc.TreeRoot)
+	if err != nil {
+		return 0, persist.Hash{}, err
+	}
+	h, err := readHash(d)
+	if err != nil {
+		return 0, h, err
+	}
+	return count, h, d.Done()
+}
+
+func persistNode[K any](w *persist.Writer, n node[K], enc func(*binenc.Encoder, K) error) (persist.Hash, error) {
+	// A node that hasn't been read needn't be if it is written back
+	// to the store it came from.
+	switch n := n.(type) {
+	case *lazyNode[K]:
+		return w.WriteFrom(n, n.store(), n.hash, func() ([]byte, error) {
+			return encodeNode(w, n.load(), enc)
+		})
+	case *pagedLeaf[K]:
+		return w.WriteFrom(n, n.pager.store, n.hash, func() ([]byte, error) {
+			return encodeLeaf(n.load(), enc)
+		})
+	}
+	return w.Write(n, func() ([]byte, error) {
+		return encodeNode(w, n, enc)
+	})
+}
+
+func encodeNode[K any](w *persist.Writer, n node[K], enc func(*binenc.Encoder, K) error) ([]byte, error) {
+	switch n := n.(type) {
+	case *leafNode[K]:
+		return encodeLeaf(n, enc)
+	case *internalNode[K]:
+		return encodeInternal(w, n, enc)
+	default:
+		return nil, errCorruptNode
+	}
+}
+
+func encodeLeaf[K any](n *leafNode[K], enc func(*binenc.Encoder, K) error) ([]byte, error) {
+	e := binenc.NewEncoder(binenc.TreeLeaf, n.len)
+	for _, key := range n.keys[:n.len] {
+		if err := enc(e, key); err != nil {
+			return nil, err
+		}
+	}
+	return e.Bytes(), nil
+}
+
+// encodeInternal writes whether the children are leaves followed by
+// the hash, size and largest key of each child.
+func encodeInternal[K any](w *persist.Writer, n *internalNode[K], enc func(*binenc.Encoder, K) error) ([]byte, error) {
+	children := make([]persist.Hash, n.len)
+	for i, child := range n.children[:n.len] {
+		h, err := persistNode(w, child, enc)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = h
+	}
+	e := binenc.NewEncoder(binenc.TreeInternal, n.len)
+	if isLeaf(n.children[0]) {
+		e.WriteUvarint(1)
+	} else {
+		e.WriteUvarint(0)
+	}
+	for i, h := range children {
+		e.WriteBytes(h[:])
+		e.WriteUvarint(uint64(n.children[i].count()))
+		if err := enc(e, n.keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return e.Bytes(), nil
+}
+
+func loadNode[K any](r *persist.Reader, h persist.Hash, dec func(*binenc.Decoder) (K, error)) (node[K], error) {
+	return persist.Read(r, h, func(data []byte) (node[K], error) {
+		kind, err := binenc.KindOf(data)
+		if err != nil {
+			return nil, err
+		}
+		lazy := func(leaf bool) func(persist.Hash, int, K) (node[K], error) {
+			return func(h persist.Hash, size int, max K) (node[K], error) {
+				return &lazyNode[K]{
+					r:    r,
+					hash: h,
+					dec:  dec,
+					leaf: leaf,
+					size: size,
+					max:  max,
+				}, nil
+			}
+		}
+		switch kind {
+		case binenc.TreeLeaf:
+			return decodeLeaf(data, dec)
+		case binenc.TreeInternal:
+			return decodeInternal(data, dec, lazy(true), lazy(false))
+		default:
+			return nil, errCorruptNode
+		}
+	})
+}
+
+// isLeaf reports whether n is a leaf or stands in for one.
+func isLeaf[K any](n node[K]) bool {
+	switch n := n.(type) {
+	case *leafNode[K], *pagedLeaf[K]:
+		return true
+	case *lazyNode[K]:
+		return n.leaf
+	default:
+		return false
+	}
+}
+
+// lazyNode stands in for a node of a loaded tree that has not been
+// read. Like a pagedLeaf it knows the size and largest key of the
+// node for its parent; for anything else it reads the node the first
+// time it is needed and keeps it. The node is read through r, or for
+// an internal node of a paged tree through pager.
+type lazyNode[K any] struct {
+	r      *persist.Reader
+	pager  *Pager[K]
+	hash   persist.Hash
+	dec    func(*binenc.Decoder) (K, error)
+	leaf   bool
+	size   int
+	max    K
+	loaded atomic.Value[node[K]]
+}
+
+func (n *lazyNode[K]) load() node[K] {
+	if loaded, ok := n.loaded.Load(); ok {
+		return loaded
+	}
+	var loaded node[K]
+	var err error
+	if n.pager != nil {
+		loaded, err = n.pager.internal(n.hash)
+	} else {
+		loaded, err = loadNode(n.r, n.hash, n.dec)
+	}
+	if err == nil && (loaded.count() != n.size || isLeaf(loaded) != n.leaf) {
+		err = errCorruptNode
+	}
+	if err != nil {
+		panic(&persist.ReadError{Hash: n.hash, Err: err})
+	}
+	return n.loaded.Store(loaded)
+}
+
+// store returns the store the node is read from.
+func (n *lazyNode[K]) store() persist.Store {
+	if n.pager != nil {
+		return n.pager.store
+	}
+	return n.r.Store()
+}
+
+func (n *lazyNode[K]) search(key K, cmp compareFunc[K]) int {
+	return n.load().search(key, cmp)
+}
+
+func (n *lazyNode[K]) searchFirst(key K, cmp compareFunc[K]) int {
+	return n.load().searchFirst(key, cmp)
+}
+
+func (n *lazyNode[K]) find(key K, cmp compareFunc[K]) (K, bool) {
+	return n.load().find(key, cmp)
+}
+
+func (n *lazyNode[K]) first() (K, bool) {
+	return n.load().first()
+}
+
+func (n *lazyNode[K]) last() (K, bool) {
+	return n.max, n.size > 0
+}
+
+func (n *lazyNode[K]) ceiling(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	return n.load().ceiling(key, cmp, inclusive)
+}
+
+func (n *lazyNode[K]) floor(key K, cmp compareFunc[K], inclusive bool) (K, bool) {
+	return n.load().floor(key, cmp, inclusive)
+}
+
+func (n *lazyNode[K]) count() int {
+	return n.size
+}
+
+func (n *lazyNode[K]) nth(i int) K {
+	return n.load().nth(i)
+}
+
+func (n *lazyNode[K]) rank(key K, cmp compareFunc[K]) int {
+	if cmp(key, n.max) > 0 {
+		return n.size
+	}
+	return n.load().rank(key, cmp)
+}
+
+func (n *lazyNode[K]) add(key K, cmp compareFunc[K], eq eqFunc[K], edit *atomic.Bool) nodeReturn[K] {
+	return n.load().add(key, cmp, eq, edit)
+}
+
+func (n *lazyNode[K]) remove(key K, left, right node[K], cmp compareFunc[K], edit *atomic.Bool) nodeReturn[K] {
+	return n.load().remove(key, left, right, cmp, edit)
+}
+
+func (n *lazyNode[K]) leafPart() *leafNode[K] {
+	return n.load().leafPart()
+}
+
+func (n *lazyNode[K]) maxKey() K {
+	return n.max
+}
+
+func (n *lazyNode[K]) string(b *strings.Builder, lvl int) {
+	n.load().string(b, lvl)
+}
+
+func decodeLeaf[K any](data []byte, dec func(*binenc.Decoder) (K, error)) (*leafNode[K], error) {
+	d, count, err := binenc.NewDecoder(data, binenc.TreeLeaf)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxLen {
+		return nil, errCorruptNode
+	}
+	n := newLeaf[K](count, emptyEdit)
+	for i := range n.keys {
+		if n.keys[i], err = dec(d); err != nil {
+			return nil, err
+		}
+	}
+	return n, d.Done()
+}
+
+// decodeInternal decodes an internal node. Its children are produced
+// by leaf or by internal depending on their kind, given the size and
+// largest key the parent recorded for the child.
+func decodeInternal[K any](
+	data []byte,
+	dec func(*binenc.Decoder) (K, error),
+	leaf func(h persist.Hash, size int, max K) (node[K], error),
+	internal func(h persist.Hash, size int, max K) (node[K], error),
+) (node[K], error) {
+	d, count, err := binenc.NewDecoder(data, binenc.TreeInternal)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > maxLen {
+		return nil, errCorruptNode
+	}
+	leaves, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	n := newNode[K](count, emptyEdit)
+	for i := range n.children {
+		h, err := readHash(d)
+		if err != nil {
+			return nil, err
+		}
+		size, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n.keys[i], err = dec(d); err != nil {
+			return nil, err
+		}
+		var child node[K]
+		switch leaves {
+		case 0:
+			if size == 0 {
+				return nil, errCorruptNode
+			}
+			child, err = internal(h, int(size), n.keys[i])
+		case 1:
+			if size == 0 || size > maxLen {
+				return nil, errCorruptNode
+			}
+			child, err = leaf(h, int(size), n.keys[i])
+		default:
+			err = errCorruptNode
+		}
+		if err != nil {
+			return nil, err
+		}
+		if child.count() != int(size) {
+			return nil, errCorruptNode
+		}
+		n.children[i] = child
+	}
+	n.recount()
+	return n, d.Done()
+}
+
+func readHash(d *binenc.Decoder) (persist.Hash, error) {
+	var h persist.Hash
+	b, err := d.ReadBytes(len(h))
+	copy(h[:], b)
+	return h, err
+}
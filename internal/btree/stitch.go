@@ -1,35 +1,35 @@
 package btree
 
-type keyStitcher struct {
-	target []interface{}
+type keyStitcher[K any] struct {
+	target []K
 	offset int
 }
 
-func (s *keyStitcher) copyAll(source []interface{}, from, to int) {
+func (s *keyStitcher[K]) copyAll(source []K, from, to int) {
 	if to >= from {
 		copy(s.target[s.offset:s.offset+(to-from)], source[from:to])
 		s.offset += to - from
 	}
 }
 
-func (s *keyStitcher) copyOne(val interface{}) {
+func (s *keyStitcher[K]) copyOne(val K) {
 	s.target[s.offset] = val
 	s.offset++
 }
 
-type nodeStitcher struct {
-	target []node
+type nodeStitcher[K any] struct {
+	target []node[K]
 	offset int
 }
 
-func (s *nodeStitcher) copyAll(source []node, from, to int) {
+func (s *nodeStitcher[K]) copyAll(source []node[K], from, to int) {
 	if to >= from {
 		copy(s.target[s.offset:s.offset+(to-from)], source[from:to])
 		s.offset += to - from
 	}
 }
 
-func (s *nodeStitcher) copyOne(val node) {
+func (s *nodeStitcher[K]) copyOne(val node[K]) {
 	s.target[s.offset] = val
 	s.offset++
 }
@@ -0,0 +1,200 @@
+// Package jsonmap encodes the entries of the persistent maps as JSON.
+//
+// A map whose keys are all strings, or implement
+// encoding.TextMarshaler, is encoded as a JSON object. Any other map
+// is encoded as an array of [key, value] pairs so that keys of any
+// type survive the round trip. Both forms are accepted when decoding.
+package jsonmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+)
+
+var errPair = errors.New("expected a JSON object or an array of [key, value] pairs")
+
+type entry[K, V any] struct {
+	key   K
+	value V
+	name  string
+}
+
+// Marshal encodes the entries visited by rng. When sorted is set the
+// members of an object are ordered by key as encoding/json does for
+// native maps; otherwise they are written in the order visited.
+func Marshal[K, V any](rng func(func(K, V) bool), sorted bool) ([]byte, error) {
+	var entries []entry[K, V]
+	stringKeys := true
+	var err error
+	rng(func(k K, v V) bool {
+		e := entry[K, V]{key: k, value: v}
+		if stringKeys {
+			e.name, stringKeys, err = keyName(k)
+		}
+		entries = append(entries, e)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stringKeys {
+		if sorted {
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].name < entries[j].name
+			})
+		}
+		return marshalObject(entries)
+	}
+	return marshalPairs(entries)
+}
+
+// keyName returns the object member name for k and whether k may be
+// used as one.
+func keyName(k interface{}) (string, bool, error) {
+	if tm, ok := k.(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err == nil, err
+	}
+	rv := reflect.ValueOf(k)
+	if rv.Kind() == reflect.String {
+		return rv.String(), true, nil
+	}
+	return "", false, nil
+}
+
+func marshalObject[K, V any](entries []entry[K, V]) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(e.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func marshalPairs[K, V any](entries []entry[K, V]) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte('[')
+		buf.Write(key)
+		buf.WriteByte(',')
+		buf.Write(value)
+		buf.WriteByte(']')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a JSON object or array of [key, value] pairs
+// calling assoc with each entry. null is decoded as no entries.
+func Unmarshal[K, V any](data []byte, assoc func(K, V)) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errPair
+	}
+	switch data[0] {
+	case 'n':
+		return json.Unmarshal(data, new(struct{}))
+	case '{':
+		return unmarshalObject(data, assoc)
+	case '[':
+		return unmarshalPairs(data, assoc)
+	default:
+		return errPair
+	}
+}
+
+func unmarshalObject[K, V any](data []byte, assoc func(K, V)) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for name, raw := range members {
+		var k K
+		if err := parseKey(name, &k); err != nil {
+			return err
+		}
+		var v V
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		assoc(k, v)
+	}
+	return nil
+}
+
+// parseKey converts an object member name to a key. Strings are
+// used directly, encoding.TextUnmarshaler implementations are given
+// the name and any other type is decoded from the name as JSON, which
+// allows numeric keys.
+func parseKey[K any](name string, k *K) error {
+	if tu, ok := interface{}(k).(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(name))
+	}
+	rv := reflect.ValueOf(k).Elem()
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(name)
+		return nil
+	case rv.Kind() == reflect.Interface && rv.NumMethod() == 0:
+		rv.Set(reflect.ValueOf(name))
+		return nil
+	default:
+		return json.Unmarshal([]byte(name), k)
+	}
+}
+
+func unmarshalPairs[K, V any](data []byte, assoc func(K, V)) error {
+	var pairs []json.RawMessage
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+	for _, raw := range pairs {
+		var pair []json.RawMessage
+		if err := json.Unmarshal(raw, &pair); err != nil {
+			return err
+		}
+		if len(pair) != 2 {
+			return errPair
+		}
+		var k K
+		if err := json.Unmarshal(pair[0], &k); err != nil {
+			return err
+		}
+		var v V
+		if err := json.Unmarshal(pair[1], &v); err != nil {
+			return err
+		}
+		assoc(k, v)
+	}
+	return nil
+}
@@ -2,16 +2,19 @@
 package list // import "jsouthworth.net/go/immutable/list"
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
 	"jsouthworth.net/go/seq"
 )
 
 var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
 
-// List is a persistent linked list.
+// List is a persistent linked list. The empty list is nil, though the
+// zero List, such as one allocated by encoding/json, is also empty.
 type List struct {
 	first interface{}
 	next  *List
@@ -88,6 +91,9 @@ func Cons(elem interface{}, list *List) *List {
 
 // Cons constructs a new list from the element and another list.
 func (l *List) Cons(elem interface{}) *List {
+	if l.Length() == 0 {
+		l = nil
+	}
 	return &List{
 		first: elem,
 		next:  l,
@@ -169,7 +175,7 @@ func (l *List) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 	cont := true
-	for list := l; list != nil && cont; list = list.Next() {
+	for list := l; list.Length() != 0 && cont; list = list.Next() {
 		cont = f(list.First())
 	}
 }
@@ -196,6 +202,70 @@ func genRangeFunc(do interface{}) func(value interface{}) bool {
 	}
 }
 
+// MarshalJSON implements json.Marshaler encoding the list as a JSON
+// array.
+func (l *List) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, l.Length())
+	l.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array
+// into the list.
+func (l *List) UnmarshalJSON(data []byte) error {
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	if out := New(elems...); out != nil {
+		*l = *out
+	} else {
+		*l = List{}
+	}
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Elements are encoded with gob unless they implement
+// encoding.BinaryMarshaler, so their concrete types must be
+// registered with gob.Register.
+func (l *List) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.List, l.Length(),
+		func(fn func(interface{}) bool) {
+			l.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary.
+func (l *List) UnmarshalBinary(data []byte) error {
+	var elems []interface{}
+	err := binenc.UnmarshalSeq(data, binenc.List, func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	if err != nil {
+		return err
+	}
+	if out := New(elems...); out != nil {
+		*l = *out
+	} else {
+		*l = List{}
+	}
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (l *List) GobEncode() ([]byte, error) {
+	return l.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (l *List) GobDecode(data []byte) error {
+	return l.UnmarshalBinary(data)
+}
+
 // Seq returns a representation of the list as a sequence
 // corresponding to the elements of the list.
 func (l *List) Seq() seq.Sequence {
@@ -1,6 +1,9 @@
 package list
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
@@ -333,3 +336,58 @@ func ExampleSeqString() {
 	fmt.Println(New(1, 2, 3, 4, 5, 6).Seq())
 	// Output: (1 2 3 4 5 6)
 }
+
+func TestJSON(t *testing.T) {
+	l := New(1.0, "two", true)
+	data, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[1,"two",true]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got *List
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(l) {
+		t.Fatalf("expected %v, got %v", l, got)
+	}
+	var empty List
+	if err := json.Unmarshal([]byte(`[]`), &empty); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	empty.Range(func(interface{}) { count++ })
+	if empty.Length() != 0 || count != 0 {
+		t.Fatal("expected decoding an empty array to produce an empty list")
+	}
+	if got := empty.Cons(1); got.Length() != 1 || got.Next() != nil {
+		t.Fatalf("unexpected list built on the zero list %v", got)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *List
+	}
+	in := snapshot{Value: New(1, "two", nil, 4.5)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(List).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+}
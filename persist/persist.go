@@ -0,0 +1,248 @@
+// Package persist stores the nodes of persistent collections in a
+// content addressed store so that many versions of a collection share
+// the storage of the nodes they have in common.
+//
+// Each node is encoded on its own and stored under the SHA-256 hash
+// of its encoding, referring to its children by their hashes. Writing
+// a new version of a collection only stores the nodes that are not
+// already in the store, so a history of versions costs roughly the
+// size of the changes between them. The collections provide Persist
+// methods that write a version with a Writer and Load functions, or
+// methods for the ordered collections, that reconstruct a version
+// from its root hash with a Reader. Loading a version only reads its
+// root; the other nodes are read as they are first used, and a Reader
+// decodes each node once however many of the versions it loads share
+// it.
+//
+// A loaded collection has no way to report a node it can not read
+// from its methods, so they panic with a *ReadError instead. Recover
+// turns such a panic back into an error.
+package persist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Hash identifies a node by the SHA-256 hash of its encoding.
+type Hash [sha256.Size]byte
+
+// String returns the hash in hexadecimal.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ErrNotFound is returned by a Store that does not hold a hash.
+var ErrNotFound = errors.New("persist: hash not found in store")
+
+// Store holds encoded nodes by their hash.
+type Store interface {
+	// Put stores data, whose hash is h. Putting data that is already
+	// stored has no effect.
+	Put(h Hash, data []byte) error
+	// Get returns the data stored under h or ErrNotFound.
+	Get(h Hash) ([]byte, error)
+}
+
+// ReadError is the panic value of an operation on a loaded collection
+// that needed a node it could not read or decode.
+type ReadError struct {
+	Hash Hash
+	Err  error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("persist: reading node %v: %v", e.Hash, e.Err)
+}
+
+// Unwrap returns the error that stopped the node being read.
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Recover stops a panic with a *ReadError and stores the ReadError in
+// *err. Any other panic carries on. It must be deferred directly:
+//
+//	defer persist.Recover(&err)
+func Recover(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	re, ok := r.(*ReadError)
+	if !ok {
+		panic(r)
+	}
+	*err = re
+}
+
+// Writer writes the nodes of collections to a Store. It remembers the
+// nodes it has written so that writing successive versions of a
+// collection only encodes the nodes that changed. Use a single Writer
+// for a history of versions. A Writer is not safe for concurrent use.
+//
+// Remembering a node keeps it in memory, so a Writer made by NewWriter
+// keeps every version it has written from being collected. Use
+// NewWriterSize to bound the number of nodes it remembers instead.
+type Writer struct {
+	store Store
+	limit int
+	// seen holds the nodes most recently written or found, and old
+	// those before them. When seen fills up it replaces old, so
+	// nodes not used since are forgotten.
+	seen map[interface{}]Hash
+	old  map[interface{}]Hash
+}
+
+// NewWriter returns a Writer that writes to store and remembers every
+// node it writes.
+func NewWriter(store Store) *Writer {
+	return &Writer{
+		store: store,
+		seen:  make(map[interface{}]Hash),
+	}
+}
+
+// NewWriterSize returns a Writer that writes to store and remembers at
+// most size of the nodes it has written, forgetting those it has not
+// written or found for the longest. Writing a forgotten node encodes it
+// again, but as its encoding is already stored nothing new is stored.
+func NewWriterSize(store Store, size int) *Writer {
+	return &Writer{
+		store: store,
+		limit: max(size/2, 1),
+		seen:  make(map[interface{}]Hash),
+	}
+}
+
+// Write stores the encoding of node, produced by encode, and returns
+// its hash. node identifies the node in memory, usually by pointer;
+// encode is only called the first time it is written.
+func (w *Writer) Write(node interface{}, encode func() ([]byte, error)) (Hash, error) {
+	if h, ok := w.lookup(node); ok {
+		return h, nil
+	}
+	data, err := encode()
+	if err != nil {
+		return Hash{}, err
+	}
+	h := Hash(sha256.Sum256(data))
+	if err := w.store.Put(h, data); err != nil {
+		return Hash{}, err
+	}
+	w.remember(node, h)
+	return h, nil
+}
+
+// WriteFrom is Write for a node that was read from store, where it is
+// stored under h. If w writes to the same store h is returned without
+// encoding the node, so a loaded node that was never used need not be
+// read to be written.
+func (w *Writer) WriteFrom(node interface{}, store Store, h Hash, encode func() ([]byte, error)) (Hash, error) {
+	if !sameStore(w.store, store) {
+		return w.Write(node, encode)
+	}
+	if _, ok := w.lookup(node); !ok {
+		w.remember(node, h)
+	}
+	return h, nil
+}
+
+// sameStore reports whether a and b are the same store. Stores whose
+// dynamic types can't be compared are taken to differ.
+func sameStore(a, b Store) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+func (w *Writer) lookup(node interface{}) (Hash, bool) {
+	if h, ok := w.seen[node]; ok {
+		return h, true
+	}
+	h, ok := w.old[node]
+	if ok {
+		w.remember(node, h)
+	}
+	return h, ok
+}
+
+func (w *Writer) remember(node interface{}, h Hash) {
+	if w.limit > 0 && len(w.seen) >= w.limit {
+		w.old, w.seen = w.seen, make(map[interface{}]Hash, w.limit)
+	}
+	w.seen[node] = h
+}
+
+// Reader reads nodes from a Store. It remembers the nodes it has
+// decoded so versions loaded through the same Reader share the nodes
+// they have in common, in memory as they do in the store. The nodes
+// stay in memory for as long as the Reader does, so use a new Reader
+// to let the nodes of versions no longer used be collected. A Reader
+// is safe for concurrent use.
+type Reader struct {
+	store Store
+	mu    sync.Mutex
+	nodes map[readKey]interface{}
+}
+
+type readKey struct {
+	hash  Hash
+	typ   reflect.Type
+	scope interface{}
+}
+
+// NewReader returns a Reader that reads from store.
+func NewReader(store Store) *Reader {
+	return &Reader{
+		store: store,
+		nodes: make(map[readKey]interface{}),
+	}
+}
+
+// Store returns the store r reads from.
+func (r *Reader) Store() Store {
+	return r.store
+}
+
+// Read returns the node stored under h, calling decode with its
+// encoding unless a node of type N with that hash has already been
+// read.
+func Read[N any](r *Reader, h Hash, decode func([]byte) (N, error)) (N, error) {
+	return ReadIn(r, nil, h, decode)
+}
+
+// ReadIn is Read for nodes that depend on how they are loaded as well
+// as on their encoding, such as nodes holding the functions a
+// collection was loaded with. Nodes are only shared between reads
+// with equal scopes, which must be comparable.
+func ReadIn[N any](r *Reader, scope interface{}, h Hash, decode func([]byte) (N, error)) (N, error) {
+	key := readKey{hash: h, typ: reflect.TypeOf((*N)(nil)).Elem(), scope: scope}
+	r.mu.Lock()
+	n, ok := r.nodes[key]
+	r.mu.Unlock()
+	if ok {
+		return n.(N), nil
+	}
+	data, err := r.store.Get(h)
+	if err != nil {
+		var zero N
+		return zero, err
+	}
+	node, err := decode(data)
+	if err != nil {
+		return node, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Another reader may have decoded the same node meanwhile; keep
+	// the first so that all versions share it.
+	if n, ok := r.nodes[key]; ok {
+		return n.(N), nil
+	}
+	r.nodes[key] = node
+	return node, nil
+}
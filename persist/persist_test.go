@@ -0,0 +1,232 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) []Hash {
+	var hashes []Hash
+	for i := 0; i < 100; i++ {
+		data := []byte(strconv.Itoa(i))
+		h := Hash(sha256.Sum256(data))
+		if err := s.Put(h, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(h, data); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, h)
+	}
+	for i, h := range hashes {
+		got, err := s.Get(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != strconv.Itoa(i) {
+			t.Fatalf("got %q for %d", got, i)
+		}
+	}
+	if _, err := s.Get(Hash{}); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	return hashes
+}
+
+func TestMemStore(t *testing.T) {
+	s := NewMemStore()
+	testStore(t, s)
+	if s.Len() != 100 {
+		t.Fatalf("expected 100 nodes, got %d", s.Len())
+	}
+	if s.Size() != 190 {
+		t.Fatalf("expected 190 bytes, got %d", s.Size())
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := testStore(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(100*recordHeader + 190); info.Size() != want {
+		t.Fatalf("expected each node once, file is %d bytes not %d",
+			info.Size(), want)
+	}
+
+	// Simulate a write interrupted after the first few bytes.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(bytes.Repeat([]byte{1}, recordHeader+1))
+	f.Close()
+
+	s, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i, h := range hashes {
+		got, err := s.Get(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != strconv.Itoa(i) {
+			t.Fatalf("got %q for %d after reopening", got, i)
+		}
+	}
+	data := []byte("after")
+	h := Hash(sha256.Sum256(data))
+	if err := s.Put(h, data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(h); err != nil || string(got) != "after" {
+		t.Fatalf("got %q, %v after the partial record", got, err)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	s := NewMemStore()
+	w := NewWriter(s)
+	node := new(int)
+	calls := 0
+	encode := func() ([]byte, error) {
+		calls++
+		return []byte("node"), nil
+	}
+	h1, err := w.Write(node, encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := w.Write(node, encode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 || calls != 1 {
+		t.Fatalf("expected a single encoding, got %d", calls)
+	}
+	if h1 != Hash(sha256.Sum256([]byte("node"))) {
+		t.Fatalf("unexpected hash %v", h1)
+	}
+
+	r := NewReader(s)
+	decodes := 0
+	decode := func(data []byte) (*string, error) {
+		decodes++
+		str := string(data)
+		return &str, nil
+	}
+	a, err := Read(r, h1, decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Read(r, h1, decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || *a != "node" || decodes != 1 {
+		t.Fatalf("expected a shared node, decoded %d times", decodes)
+	}
+	// Nodes of a different type are decoded separately.
+	c, err := Read(r, h1, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+	if err != nil || string(c) != "node" {
+		t.Fatalf("got %q, %v", c, err)
+	}
+	if _, err := Read(r, Hash{}, decode); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWriterSize(t *testing.T) {
+	s := NewMemStore()
+	w := NewWriterSize(s, 4)
+	nodes := make([]*int, 10)
+	calls := 0
+	write := func(n *int) {
+		_, err := w.Write(n, func() ([]byte, error) {
+			calls++
+			return []byte(strconv.Itoa(*n)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range nodes {
+		nodes[i] = new(int)
+		*nodes[i] = i
+		write(nodes[i])
+		// The first node is found again each time, so it is kept.
+		write(nodes[0])
+	}
+	if len(w.seen)+len(w.old) > 4 || calls != 10 {
+		t.Fatalf("remembered %d nodes after %d encodings",
+			len(w.seen)+len(w.old), calls)
+	}
+	write(nodes[1])
+	if calls != 11 || s.Len() != 10 {
+		t.Fatalf("expected a forgotten node to be encoded again, got %d", calls)
+	}
+}
+
+func TestWriteFrom(t *testing.T) {
+	s := NewMemStore()
+	h, err := NewWriter(s).Write(new(int), func() ([]byte, error) {
+		return []byte("node"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := new(int)
+	encode := func() ([]byte, error) {
+		t.Fatal("encoded a node already in the store")
+		return nil, nil
+	}
+	w := NewWriter(s)
+	if got, err := w.WriteFrom(node, s, h, encode); err != nil || got != h {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if got, err := w.Write(node, encode); err != nil || got != h {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	other := NewMemStore()
+	got, err := NewWriter(other).WriteFrom(node, s, h, func() ([]byte, error) {
+		return []byte("node"), nil
+	})
+	if err != nil || got != h || other.Len() != 1 {
+		t.Fatalf("expected the node to be copied, got %v, %v", got, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	load := func(fail interface{}) (err error) {
+		defer Recover(&err)
+		panic(fail)
+	}
+	re := &ReadError{Err: ErrNotFound}
+	if err := load(re); err != re || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	defer func() {
+		if r := recover(); r != "other" {
+			t.Fatalf("expected other panics to carry on, got %v", r)
+		}
+	}()
+	load("other")
+}
@@ -0,0 +1,169 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// MemStore is a Store held in memory.
+type MemStore struct {
+	mu   sync.RWMutex
+	data map[Hash][]byte
+	size int
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{data: make(map[Hash][]byte)}
+}
+
+// Put implements Store.
+func (s *MemStore) Put(h Hash, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[h]; ok {
+		return nil
+	}
+	s.data[h] = append([]byte(nil), data...)
+	s.size += len(data)
+	return nil
+}
+
+// Get implements Store.
+func (s *MemStore) Get(h Hash) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.data[h]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Len returns the number of nodes in the store.
+func (s *MemStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Size returns the total size of the stored encodings in bytes.
+func (s *MemStore) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size
+}
+
+// recordHeader is the size of the hash and length that precede each
+// record of a FileStore.
+const recordHeader = len(Hash{}) + 4
+
+var errRecordSize = errors.New("persist: node too large for a file store")
+
+// FileStore is a Store kept in an append only file. Each record holds
+// a hash, the length of the data as a big endian uint32 and the data.
+// The index of the records is rebuilt when the file is opened.
+type FileStore struct {
+	mu    sync.RWMutex
+	f     *os.File
+	size  int64
+	index map[Hash]record
+}
+
+type record struct {
+	off int64
+	len int
+}
+
+// OpenFile opens or creates the FileStore at path. A record left
+// incomplete by an interrupted write is discarded.
+func OpenFile(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{f: f, index: make(map[Hash]record)}
+	if err := s.scan(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) scan() error {
+	r := bufio.NewReader(s.f)
+	var header [recordHeader]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return s.truncate(err)
+		}
+		var h Hash
+		copy(h[:], header[:])
+		n := int64(binary.BigEndian.Uint32(header[len(h):]))
+		if _, err := r.Discard(int(n)); err != nil {
+			return s.truncate(err)
+		}
+		s.index[h] = record{off: s.size + int64(recordHeader), len: int(n)}
+		s.size += int64(recordHeader) + n
+	}
+}
+
+// truncate ends the scan, dropping any partial record after the last
+// complete one.
+func (s *FileStore) truncate(err error) error {
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return s.f.Truncate(s.size)
+}
+
+// Put implements Store.
+func (s *FileStore) Put(h Hash, data []byte) error {
+	if uint64(len(data)) > 1<<32-1 {
+		return errRecordSize
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[h]; ok {
+		return nil
+	}
+	buf := make([]byte, recordHeader+len(data))
+	copy(buf, h[:])
+	binary.BigEndian.PutUint32(buf[len(h):], uint32(len(data)))
+	copy(buf[recordHeader:], data)
+	if _, err := s.f.WriteAt(buf, s.size); err != nil {
+		return err
+	}
+	s.index[h] = record{off: s.size + int64(recordHeader), len: len(data)}
+	s.size += int64(len(buf))
+	return nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(h Hash) ([]byte, error) {
+	s.mu.RLock()
+	rec, ok := s.index[h]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data := make([]byte, rec.len)
+	if _, err := s.f.ReadAt(data, rec.off); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Sync commits the file to stable storage.
+func (s *FileStore) Sync() error {
+	return s.f.Sync()
+}
+
+// Close closes the file.
+func (s *FileStore) Close() error {
+	return s.f.Close()
+}
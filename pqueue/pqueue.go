@@ -0,0 +1,549 @@
+// Package pqueue implements a persistent min-priority queue.
+//
+// The queue is a leftist heap: a binary tree in which each element's
+// priority is no greater than those below it and the right spine of
+// every subtree is no longer than its left. Push, Pop and Merge walk
+// only the right spines of the heaps involved, taking O(log n) time
+// in the worst case, so every version of a queue remains as fast as
+// the last.
+//
+// By default priorities are compared with the dyn library. Elements
+// of equal priority are popped in an unspecified order. The zero
+// PQueue is an empty queue using the default ordering.
+package pqueue // import "jsouthworth.net/go/immutable/pqueue"
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
+)
+
+var errRangeSig = errors.New("Range requires a function: func(elem eT, priority pT) bool or func(elem eT, priority pT)")
+var errReduceSig = errors.New("Reduce requires a function: func(init iT, elem eT, priority pT) oT")
+var errTafterP = errors.New("transient used after persistent call")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty queue")
+
+type cmpFunc func(p1, p2 interface{}) int
+
+func defaultCompare(a, b interface{}) int {
+	return dyn.Compare(a, b)
+}
+
+// PQueue is a persistent min-priority queue.
+type PQueue struct {
+	root  *node
+	count int
+	cmp   cmpFunc
+	order *order
+}
+
+// order identifies the compare function of a queue. Functions can't
+// be compared, so each Compare option makes its own order and queues
+// are known to share an ordering only when they were built from the
+// same option.
+type order struct {
+	_ byte // a zero sized order wouldn't have a unique address
+}
+
+var defaultOrder = new(order)
+
+var empty = PQueue{
+	cmp:   defaultCompare,
+	order: defaultOrder,
+}
+
+type queueOptions struct {
+	compare cmpFunc
+	order   *order
+}
+
+// Option is a type that allows changes to pluggable parts of the
+// PQueue implementation.
+type Option func(*queueOptions)
+
+// Compare is an option to the Empty function that will allow
+// one to specify a different comparison operator instead
+// of the default which is from the dyn library. This is used
+// for priorities. Queues built from the same Compare option are
+// merged in O(log n) time, see Merge.
+func Compare(cmp func(p1, p2 interface{}) int) Option {
+	ord := new(order)
+	return func(o *queueOptions) {
+		o.compare = cmp
+		o.order = ord
+	}
+}
+
+// Empty returns a new empty priority queue, one may supply options
+// for the queue by using one of the option generating functions and
+// providing that to Empty.
+func Empty(options ...Option) *PQueue {
+	if len(options) == 0 {
+		return &empty
+	}
+	opts := queueOptions{
+		compare: defaultCompare,
+		order:   defaultOrder,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return &PQueue{
+		cmp:   opts.compare,
+		order: opts.order,
+	}
+}
+
+// compare returns the compare function of q. The zero PQueue uses the
+// default ordering.
+func (q *PQueue) compare() cmpFunc {
+	if q.cmp == nil {
+		return defaultCompare
+	}
+	return q.cmp
+}
+
+// ordering returns the order of q.
+func (q *PQueue) ordering() *order {
+	if q.order == nil {
+		return defaultOrder
+	}
+	return q.order
+}
+
+// Push returns a queue with the element added at the given priority.
+func (q *PQueue) Push(elem, priority interface{}) *PQueue {
+	cmp := q.compare()
+	return &PQueue{
+		root:  merge(q.root, leaf(elem, priority), cmp),
+		count: q.count + 1,
+		cmp:   cmp,
+		order: q.ordering(),
+	}
+}
+
+// Peek returns the element with the lowest priority and its priority.
+// If the queue is empty, (nil, nil, false) is returned.
+func (q *PQueue) Peek() (elem, priority interface{}, ok bool) {
+	if q.root == nil {
+		return nil, nil, false
+	}
+	return q.root.elem, q.root.priority, true
+}
+
+// Pop returns a queue without the element returned by Peek.
+func (q *PQueue) Pop() *PQueue {
+	if q.count <= 1 {
+		return q.cleared()
+	}
+	cmp := q.compare()
+	return &PQueue{
+		root:  merge(q.root.left, q.root.right, cmp),
+		count: q.count - 1,
+		cmp:   cmp,
+		order: q.ordering(),
+	}
+}
+
+// Merge returns a queue holding the elements of both queues in the
+// ordering of q. Queues built from the same Compare option are merged
+// in O(log n) time. Otherwise the elements of other are reordered by
+// the compare function of q, taking time linear in their number.
+func (q *PQueue) Merge(other *PQueue) *PQueue {
+	same := q.ordering() == other.ordering()
+	switch {
+	case other.count == 0:
+		return q
+	case q.count == 0 && same:
+		return other
+	}
+	cmp, root := q.compare(), other.root
+	if !same {
+		root = heapify(leaves(root, nil), cmp)
+	}
+	return &PQueue{
+		root:  merge(q.root, root, cmp),
+		count: q.count + other.count,
+		cmp:   cmp,
+		order: q.ordering(),
+	}
+}
+
+// cleared returns an empty queue with the ordering of q.
+func (q *PQueue) cleared() *PQueue {
+	if q.ordering() == defaultOrder {
+		return Empty()
+	}
+	return &PQueue{
+		cmp:   q.cmp,
+		order: q.order,
+	}
+}
+
+// Length returns the number of elements in the queue.
+func (q *PQueue) Length() int {
+	return q.count
+}
+
+// AsTransient will return a mutable version of the queue for bulk
+// loading.
+func (q *PQueue) AsTransient() *TPQueue {
+	return &TPQueue{
+		root:  q.root,
+		count: q.count,
+		cmp:   q.compare(),
+		order: q.ordering(),
+	}
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent queue. It does this by making a transient
+// queue and calling each action on it, then converting it back
+// to a persistent queue.
+func (q *PQueue) Transform(actions ...func(*TPQueue) *TPQueue) *PQueue {
+	out := q.AsTransient()
+	for _, action := range actions {
+		out = action(out)
+	}
+	return out.AsPersistent()
+}
+
+// Range calls the passed in function on each element of the queue
+// and its priority, lowest priority first. The function passed in
+// may be of many types:
+//
+// func(elem, priority interface{}) bool:
+//    Takes empty interfaces and returns if the loop should continue.
+//    Useful to avoid reflection or for hetrogenous queues.
+// func(elem, priority interface{}):
+//    Takes empty interfaces.
+//    Useful to avoid reflection or for hetrogenous queues.
+// func(elem eT, priority pT) bool
+//    Takes an element of element type and a priority of priority type and returns if the loop should contiune.
+//    Is called with reflection and will panic if the eT and pT types are incorrect.
+// func(elem eT, priority pT)
+//    Takes an element of element type and a priority of priority type.
+//    Is called with reflection and will panic if the eT and pT types are incorrect.
+// Range will panic if passed anything not matching these signatures.
+func (q *PQueue) Range(do interface{}) {
+	// NOTE: Update other functions using the same pattern
+	//       when modifying the below.
+	//       This code is inlined to avoid heap allocation of
+	//       the closure.
+	var f func(elem, priority interface{}) bool
+	switch fn := do.(type) {
+	case func(elem, priority interface{}) bool:
+		f = fn
+	case func(elem, priority interface{}):
+		f = func(elem, priority interface{}) bool {
+			fn(elem, priority)
+			return true
+		}
+	default:
+		f = genRangeFunc(do)
+	}
+	rangeHeap(q.root, q.compare(), f)
+}
+
+func genRangeFunc(do interface{}) func(elem, priority interface{}) bool {
+	rv := reflect.ValueOf(do)
+	if rv.Kind() != reflect.Func {
+		panic(errRangeSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 2 || rt.NumOut() > 1 {
+		panic(errRangeSig)
+	}
+	if rt.NumOut() == 1 &&
+		rt.Out(0).Kind() != reflect.Bool {
+		panic(errRangeSig)
+	}
+	return func(elem, priority interface{}) bool {
+		out := dyn.Apply(do, elem, priority)
+		if out != nil {
+			return out.(bool)
+		}
+		return true
+	}
+}
+
+// Reduce is a fast mechanism for reducing a PQueue, lowest priority
+// first. Reduce can take the following types as the fn:
+//
+// func(init interface{}, elem interface{}, priority interface{}) interface{}
+// func(init iT, elem eT, priority pT) oT
+//
+// Reduce will panic if given any other function type.
+func (q *PQueue) Reduce(fn interface{}, init interface{}) interface{} {
+	return reduceHeap(q.root, q.compare(), fn, init)
+}
+
+func reduceHeap(root *node, cmp cmpFunc, fn interface{}, init interface{}) interface{} {
+	var rFn func(res, elem, priority interface{}) interface{}
+	switch f := fn.(type) {
+	case func(res, elem, priority interface{}) interface{}:
+		rFn = f
+	default:
+		rFn = genReduceFunc(fn)
+	}
+	res := init
+	rangeHeap(root, cmp, func(elem, priority interface{}) bool {
+		res = rFn(res, elem, priority)
+		return true
+	})
+	return res
+}
+
+func genReduceFunc(fn interface{}) func(res, elem, priority interface{}) interface{} {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		panic(errReduceSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 3 {
+		panic(errReduceSig)
+	}
+	if rt.NumOut() != 1 {
+		panic(errReduceSig)
+	}
+	return func(res, elem, priority interface{}) interface{} {
+		return dyn.Apply(fn, res, elem, priority)
+	}
+}
+
+// String returns a representation of the queue as a string, lowest
+// priority first.
+func (q *PQueue) String() string {
+	b := new(strings.Builder)
+	fmt.Fprint(b, "[ ")
+	q.Range(func(elem, priority interface{}) {
+		fmt.Fprintf(b, "%v:%v ", elem, priority)
+	})
+	fmt.Fprint(b, "]")
+	return b.String()
+}
+
+// MarshalJSON implements json.Marshaler encoding the queue as a JSON
+// array of [element, priority] pairs, lowest priority first.
+func (q *PQueue) MarshalJSON() ([]byte, error) {
+	pairs := make([][2]interface{}, 0, q.Length())
+	q.Range(func(elem, priority interface{}) {
+		pairs = append(pairs, [2]interface{}{elem, priority})
+	})
+	return json.Marshal(pairs)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array of
+// [element, priority] pairs into the queue. A queue created with a
+// Compare option keeps it; the zero PQueue uses the default ordering.
+// The queue returned by Empty without options is shared and may not
+// be decoded into.
+func (q *PQueue) UnmarshalJSON(data []byte) error {
+	if q == &empty {
+		return errUnmarshalEmpty
+	}
+	var pairs [][2]interface{}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+	out := q.cleared().AsTransient()
+	for _, pair := range pairs {
+		out.Push(pair[0], pair[1])
+	}
+	*q = *out.AsPersistent()
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format holding each element followed by its priority, lowest
+// priority first. Elements and priorities are encoded with gob
+// unless they implement encoding.BinaryMarshaler, so their concrete
+// types must be registered with gob.Register.
+func (q *PQueue) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalMap(binenc.PQueue, q.Length(),
+		func(fn func(elem, priority interface{}) bool) {
+			q.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. Like UnmarshalJSON, a queue
+// created with a Compare option keeps it and the queue returned by
+// Empty without options may not be decoded into.
+func (q *PQueue) UnmarshalBinary(data []byte) error {
+	if q == &empty {
+		return errUnmarshalEmpty
+	}
+	out := q.cleared().AsTransient()
+	err := binenc.UnmarshalMap(data, binenc.PQueue,
+		func(elem, priority interface{}) {
+			out.Push(elem, priority)
+		})
+	if err != nil {
+		return err
+	}
+	*q = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (q *PQueue) GobEncode() ([]byte, error) {
+	return q.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (q *PQueue) GobDecode(data []byte) error {
+	return q.UnmarshalBinary(data)
+}
+
+// node is a node of a leftist heap. rank is the length of the right
+// spine of the heap rooted at the node, which is never longer than
+// that of its left child.
+type node struct {
+	elem     interface{}
+	priority interface{}
+	rank     int
+	left     *node
+	right    *node
+}
+
+func leaf(elem, priority interface{}) *node {
+	return &node{
+		elem:     elem,
+		priority: priority,
+		rank:     1,
+	}
+}
+
+func (n *node) getRank() int {
+	if n == nil {
+		return 0
+	}
+	return n.rank
+}
+
+// merge returns a heap holding the elements of heaps a and b.
+func merge(a, b *node, cmp cmpFunc) *node {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case cmp(b.priority, a.priority) < 0:
+		a, b = b, a
+	}
+	left, right := a.left, merge(a.right, b, cmp)
+	if left.getRank() < right.getRank() {
+		left, right = right, left
+	}
+	return &node{
+		elem:     a.elem,
+		priority: a.priority,
+		rank:     right.getRank() + 1,
+		left:     left,
+		right:    right,
+	}
+}
+
+// leaves appends a single element heap to out for each element of the
+// heap rooted at n and returns out. The left spine of a heap may be as
+// long as the heap, so the nodes yet to visit are kept on a stack
+// rather than recursed into.
+func leaves(n *node, out []*node) []*node {
+	var stack []*node
+	if n != nil {
+		stack = append(stack, n)
+	}
+	for len(stack) > 0 {
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		out = append(out, leaf(n.elem, n.priority))
+		if n.left != nil {
+			stack = append(stack, n.left)
+		}
+		if n.right != nil {
+			stack = append(stack, n.right)
+		}
+	}
+	return out
+}
+
+// heapify returns a heap holding the elements of heaps by merging
+// them in pairs, taking O(len(heaps)) time for single element heaps.
+// heaps is overwritten.
+func heapify(heaps []*node, cmp cmpFunc) *node {
+	for len(heaps) > 1 {
+		n := 0
+		for i := 0; i+1 < len(heaps); i += 2 {
+			heaps[n] = merge(heaps[i], heaps[i+1], cmp)
+			n++
+		}
+		if len(heaps)%2 == 1 {
+			heaps[n] = heaps[len(heaps)-1]
+			n++
+		}
+		heaps = heaps[:n]
+	}
+	if len(heaps) == 0 {
+		return nil
+	}
+	return heaps[0]
+}
+
+// rangeHeap calls f with the elements of the heap rooted at root in
+// priority order until f returns false. The children of the visited
+// nodes are kept on a binary heap, so the walk takes O(n log n) time
+// without changing the queue.
+func rangeHeap(root *node, cmp cmpFunc, f func(elem, priority interface{}) bool) {
+	if root == nil {
+		return
+	}
+	fr := &frontier{nodes: []*node{root}, cmp: cmp}
+	for fr.Len() > 0 {
+		n := heap.Pop(fr).(*node)
+		if !f(n.elem, n.priority) {
+			return
+		}
+		if n.left != nil {
+			heap.Push(fr, n.left)
+		}
+		if n.right != nil {
+			heap.Push(fr, n.right)
+		}
+	}
+}
+
+// frontier implements heap.Interface over the nodes yet to be
+// visited by rangeHeap.
+type frontier struct {
+	nodes []*node
+	cmp   cmpFunc
+}
+
+func (f *frontier) Len() int {
+	return len(f.nodes)
+}
+
+func (f *frontier) Less(i, j int) bool {
+	return f.cmp(f.nodes[i].priority, f.nodes[j].priority) < 0
+}
+
+func (f *frontier) Swap(i, j int) {
+	f.nodes[i], f.nodes[j] = f.nodes[j], f.nodes[i]
+}
+
+func (f *frontier) Push(x interface{}) {
+	f.nodes = append(f.nodes, x.(*node))
+}
+
+func (f *frontier) Pop() interface{} {
+	n := f.nodes[len(f.nodes)-1]
+	f.nodes = f.nodes[:len(f.nodes)-1]
+	return n
+}
@@ -0,0 +1,347 @@
+package pqueue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/dyn"
+)
+
+// drain pops every element of q returning their priorities.
+func drain(q *PQueue) []int {
+	var out []int
+	for q.Length() > 0 {
+		_, p, _ := q.Peek()
+		out = append(out, p.(int))
+		q = q.Pop()
+	}
+	return out
+}
+
+func sorted(ps []int) []int {
+	out := append([]int(nil), ps...)
+	sort.Ints(out)
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHeap verifies that the tree rooted at n is a leftist heap
+// ordered by cmp and returns its size.
+func checkHeap(n *node, cmp cmpFunc) (int, bool) {
+	if n == nil {
+		return 0, true
+	}
+	if n.rank != n.right.getRank()+1 ||
+		n.left.getRank() < n.right.getRank() {
+		return 0, false
+	}
+	for _, c := range []*node{n.left, n.right} {
+		if c != nil && cmp(c.priority, n.priority) < 0 {
+			return 0, false
+		}
+	}
+	l, lok := checkHeap(n.left, cmp)
+	r, rok := checkHeap(n.right, cmp)
+	return l + r + 1, lok && rok
+}
+
+func TestPQueueModel(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Push and Pop match a sorted slice",
+		prop.ForAll(
+			func(ops []int) bool {
+				q := Empty()
+				var model []int
+				for _, op := range ops {
+					if op < 0 {
+						q = q.Pop()
+						if len(model) > 0 {
+							model = model[1:]
+						}
+						continue
+					}
+					q = q.Push(fmt.Sprint(op), op)
+					model = sorted(append(model, op))
+				}
+				n, ok := checkHeap(q.root, q.cmp)
+				if !ok || n != len(model) || q.Length() != n {
+					return false
+				}
+				return equalInts(drain(q), model)
+			},
+			gen.SliceOf(gen.IntRange(-20, 100)),
+		))
+	properties.Property("Merge holds the elements of both",
+		prop.ForAll(
+			func(a, b []int) bool {
+				qa, qb := Empty(), Empty()
+				for _, p := range a {
+					qa = qa.Push(p, p)
+				}
+				for _, p := range b {
+					qb = qb.Push(p, p)
+				}
+				q := qa.Merge(qb)
+				_, ok := checkHeap(q.root, q.cmp)
+				return ok &&
+					equalInts(drain(q), sorted(append(a, b...))) &&
+					equalInts(drain(qa), sorted(a)) &&
+					equalInts(drain(qb), sorted(b))
+			},
+			gen.SliceOf(gen.Int()),
+			gen.SliceOf(gen.Int()),
+		))
+	properties.TestingRun(t)
+}
+
+func TestPQueuePeek(t *testing.T) {
+	if _, _, ok := Empty().Peek(); ok {
+		t.Fatal("the empty queue should have nothing to peek")
+	}
+	q := Empty().Push("b", 2).Push("a", 1).Push("c", 3)
+	elem, priority, ok := q.Peek()
+	if !ok || elem != "a" || priority != 1 {
+		t.Fatal("didn't get expected element", elem, priority, ok)
+	}
+	if q.Pop().Pop().Pop() != Empty() {
+		t.Fatal("popping every element should return Empty")
+	}
+}
+
+func TestPQueueCompare(t *testing.T) {
+	maxFirst := Compare(func(a, b interface{}) int {
+		return b.(int) - a.(int)
+	})
+	q := Empty(maxFirst).Push("a", 1).Push("c", 3).Push("b", 2)
+	if elem, _, _ := q.Peek(); elem != "c" {
+		t.Fatal("didn't get expected element", elem)
+	}
+	if q.String() != "[ c:3 b:2 a:1 ]" {
+		t.Fatal("didn't get expected queue", q)
+	}
+	cleared := q.Pop().Pop().Pop()
+	if cleared.Length() != 0 || cleared == Empty() {
+		t.Fatal("popping every element should keep the ordering")
+	}
+	if elem, _, _ := cleared.Push("x", 1).Push("y", 5).Peek(); elem != "y" {
+		t.Fatal("the cleared queue lost its ordering", elem)
+	}
+	t.Run("Merge different orders", func(t *testing.T) {
+		order := func(dir int) Option {
+			return Compare(func(a, b interface{}) int {
+				return dir * (a.(int) - b.(int))
+			})
+		}
+		asc := Empty(order(1)).Push("a", 1).Push("c", 3)
+		desc := Empty(order(-1)).Push("b", 2).Push("d", 4)
+		for _, got := range []*PQueue{
+			asc.Merge(desc),
+			Empty(order(1)).Merge(desc).Merge(asc),
+			asc.AsTransient().Merge(desc).AsPersistent(),
+		} {
+			if got.String() != "[ a:1 b:2 c:3 d:4 ]" || got.Length() != 4 {
+				t.Fatal("didn't reorder the merged elements", got)
+			}
+			if _, ok := checkHeap(got.root, got.cmp); !ok {
+				t.Fatal("merge didn't keep the heap ordered", got)
+			}
+		}
+		if got := Empty(Compare(dyn.Compare)).Push("d", 4).Merge(
+			Empty().Push("a", 1)); got.String() != "[ a:1 d:4 ]" {
+			t.Fatal("didn't merge with the default ordering", got)
+		}
+		if got := desc.Merge(q); got.String() != "[ d:4 c:3 b:2 b:2 a:1 ]" {
+			t.Fatal("didn't keep the ordering of the receiver", got)
+		}
+	})
+}
+
+func TestMergeLongLeftSpine(t *testing.T) {
+	// Pushing descending priorities builds a heap whose left spine
+	// holds every element. Reordering it for a merge mustn't recurse
+	// down that spine.
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	const n = 100000
+	desc := Empty(Compare(func(a, b interface{}) int {
+		return b.(int) - a.(int)
+	}))
+	q := Empty()
+	for i := n; i > 0; i-- {
+		q = q.Push(i, i)
+	}
+	depth := 0
+	for n := q.root; n != nil; n = n.left {
+		depth++
+	}
+	if depth != n {
+		t.Fatal("expected a left spine of every element, got", depth)
+	}
+	for _, got := range []*PQueue{
+		desc.Merge(q),
+		desc.AsTransient().Merge(q).AsPersistent(),
+	} {
+		if got.Length() != n {
+			t.Fatal("expected every element, got", got.Length())
+		}
+		if elem, _, _ := got.Peek(); elem != n {
+			t.Fatal("expected the largest element first, got", elem)
+		}
+	}
+}
+
+func TestZeroPQueue(t *testing.T) {
+	var q PQueue
+	got := q.Push("b", 2).Push("a", 1).Push("c", 3)
+	if elem, _, _ := got.Peek(); elem != "a" || got.Length() != 3 {
+		t.Fatal("didn't get expected element", got)
+	}
+	if got.Pop().Pop().Pop() != Empty() {
+		t.Fatal("popping every element should return Empty")
+	}
+	if merged := q.Merge(got).Merge(&q); merged.String() != "[ a:1 b:2 c:3 ]" {
+		t.Fatal("didn't merge with the zero queue", merged)
+	}
+	if got := q.AsTransient().Push("x", 1).AsPersistent(); got.Length() != 1 {
+		t.Fatal("didn't push onto a transient of the zero queue", got)
+	}
+}
+
+func TestRange(t *testing.T) {
+	q := Empty().Push("b", 2).Push("a", 1).Push("c", 3)
+	var got []string
+	q.Range(func(elem string, priority int) {
+		got = append(got, fmt.Sprint(elem, priority))
+	})
+	if fmt.Sprint(got) != "[a1 b2 c3]" {
+		t.Fatal("didn't get expected elements", got)
+	}
+	got = nil
+	q.Range(func(elem, priority interface{}) bool {
+		got = append(got, elem.(string))
+		return len(got) < 2
+	})
+	if fmt.Sprint(got) != "[a b]" {
+		t.Fatal("Range didn't stop", got)
+	}
+	defer func() {
+		if r := recover(); r != errRangeSig {
+			t.Fatal("expected panic", r)
+		}
+	}()
+	q.Range(func(elem string) {})
+}
+
+func TestPQueueReduce(t *testing.T) {
+	q := Empty().Push("b", 2).Push("a", 1).Push("c", 3)
+	out := q.Reduce(func(res, elem string, priority int) string {
+		return res + elem
+	}, "")
+	if out != "abc" {
+		t.Fatal("didn't get expected value", out)
+	}
+	out = q.Reduce(func(res, elem, priority interface{}) interface{} {
+		return res.(int) + priority.(int)
+	}, 0)
+	if out != 6 {
+		t.Fatal("didn't get expected value", out)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	q := Empty().Push("b", 2.0).Push("a", 1.0)
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[["a",1],["b",2]]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got PQueue
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != q.String() {
+		t.Fatalf("expected %v, got %v", q, &got)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *PQueue
+	}
+	in := snapshot{Value: Empty().Push("two", 2).Push(nil, 4.5).Push(1, -1)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Value.String() != in.Value.String() {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(PQueue).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	maxFirst := Empty(Compare(func(a, b interface{}) int {
+		return b.(int) - a.(int)
+	}))
+	data, err = Empty().Push("a", 1).Push("b", 2).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := maxFirst.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if elem, _, _ := maxFirst.Peek(); elem != "b" {
+		t.Fatal("decoding didn't keep the ordering", maxFirst)
+	}
+}
+
+func ExamplePQueue_Pop() {
+	q := Empty().Push("write", 2).Push("read", 1).Push("close", 3)
+	for q.Length() > 0 {
+		elem, priority, _ := q.Peek()
+		fmt.Println(elem, priority)
+		q = q.Pop()
+	}
+	// Output:
+	// read 1
+	// write 2
+	// close 3
+}
+
+func ExamplePQueue_Merge() {
+	a := Empty().Push("a", 1).Push("c", 3)
+	b := Empty().Push("b", 2)
+	fmt.Println(a.Merge(b))
+	// Output: [ a:1 b:2 c:3 ]
+}
@@ -0,0 +1,151 @@
+package pqueue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TPQueue is a transient priority queue for loading many elements at
+// once. Elements pushed onto a transient are held until the queue is
+// next read and are then heapified together in time linear in their
+// number, rather than pushed one at a time. The changes become
+// immutable when AsPersistent is called.
+type TPQueue struct {
+	root    *node
+	count   int
+	cmp     cmpFunc
+	order   *order
+	pending []*node
+	done    bool
+}
+
+// Push adds the element to the queue at the given priority. q is
+// returned.
+func (q *TPQueue) Push(elem, priority interface{}) *TPQueue {
+	q.ensureEditable()
+	q.pending = append(q.pending, leaf(elem, priority))
+	q.count++
+	return q
+}
+
+// Peek returns the element with the lowest priority and its priority.
+// If the queue is empty, (nil, nil, false) is returned.
+func (q *TPQueue) Peek() (elem, priority interface{}, ok bool) {
+	q.flush()
+	if q.root == nil {
+		return nil, nil, false
+	}
+	return q.root.elem, q.root.priority, true
+}
+
+// Pop removes the element returned by Peek. q is returned.
+func (q *TPQueue) Pop() *TPQueue {
+	q.flush()
+	if q.root == nil {
+		return q
+	}
+	q.root = merge(q.root.left, q.root.right, q.cmp)
+	q.count--
+	return q
+}
+
+// Merge adds the elements of other to the queue. q is returned. Like
+// PQueue.Merge, the elements of a queue built from a different Compare
+// option are reordered by the compare function of q.
+func (q *TPQueue) Merge(other *PQueue) *TPQueue {
+	q.ensureEditable()
+	if q.order == other.ordering() {
+		q.root = merge(q.root, other.root, q.cmp)
+	} else {
+		q.pending = leaves(other.root, q.pending)
+	}
+	q.count += other.count
+	return q
+}
+
+// Length returns the number of elements in the queue.
+func (q *TPQueue) Length() int {
+	return q.count
+}
+
+// AsPersistent returns an immutable version of the queue. Any
+// transient operations performed after this will cause a panic.
+func (q *TPQueue) AsPersistent() *PQueue {
+	q.flush()
+	q.done = true
+	out := &PQueue{
+		root:  q.root,
+		count: q.count,
+		cmp:   q.cmp,
+		order: q.order,
+	}
+	if out.count == 0 {
+		return out.cleared()
+	}
+	return out
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (q *TPQueue) MakePersistent() interface{} {
+	return q.AsPersistent()
+}
+
+// Range calls the passed in function on each element of the queue
+// and its priority, lowest priority first. It accepts the same
+// functions as PQueue.Range.
+func (q *TPQueue) Range(do interface{}) {
+	// NOTE: Update other functions using the same pattern
+	//       when modifying the below.
+	//       This code is inlined to avoid heap allocation of
+	//       the closure.
+	q.flush()
+	var f func(elem, priority interface{}) bool
+	switch fn := do.(type) {
+	case func(elem, priority interface{}) bool:
+		f = fn
+	case func(elem, priority interface{}):
+		f = func(elem, priority interface{}) bool {
+			fn(elem, priority)
+			return true
+		}
+	default:
+		f = genRangeFunc(do)
+	}
+	rangeHeap(q.root, q.cmp, f)
+}
+
+// Reduce is a fast mechanism for reducing a TPQueue, lowest priority
+// first. It accepts the same functions as PQueue.Reduce.
+func (q *TPQueue) Reduce(fn interface{}, init interface{}) interface{} {
+	q.flush()
+	return reduceHeap(q.root, q.cmp, fn, init)
+}
+
+// String returns a representation of the queue as a string, lowest
+// priority first.
+func (q *TPQueue) String() string {
+	b := new(strings.Builder)
+	fmt.Fprint(b, "[ ")
+	q.Range(func(elem, priority interface{}) {
+		fmt.Fprintf(b, "%v:%v ", elem, priority)
+	})
+	fmt.Fprint(b, "]")
+	return b.String()
+}
+
+// flush merges the pending elements into the heap.
+func (q *TPQueue) flush() {
+	q.ensureEditable()
+	if len(q.pending) == 0 {
+		return
+	}
+	q.root = merge(q.root, heapify(q.pending, q.cmp), q.cmp)
+	clear(q.pending)
+	q.pending = q.pending[:0]
+}
+
+func (q *TPQueue) ensureEditable() {
+	if q.done {
+		panic(errTafterP)
+	}
+}
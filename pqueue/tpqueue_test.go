@@ -0,0 +1,84 @@
+package pqueue
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+)
+
+func TestTPQueue(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("bulk load matches pushes",
+		prop.ForAll(
+			func(base, ps []int) bool {
+				orig := Empty()
+				for _, p := range base {
+					orig = orig.Push(p, p)
+				}
+				pushed := orig
+				tq := orig.AsTransient()
+				for _, p := range ps {
+					pushed = pushed.Push(p, p)
+					tq.Push(p, p)
+				}
+				if tq.Length() != pushed.Length() {
+					return false
+				}
+				q := tq.AsPersistent()
+				n, ok := checkHeap(q.root, q.cmp)
+				return ok && n == q.Length() &&
+					equalInts(drain(q), drain(pushed)) &&
+					equalInts(drain(orig), sorted(base))
+			},
+			gen.SliceOf(gen.Int()),
+			gen.SliceOf(gen.Int()),
+		))
+	properties.Property("Pop and Merge",
+		prop.ForAll(
+			func(a, b []int) bool {
+				qb := Empty()
+				for _, p := range b {
+					qb = qb.Push(p, p)
+				}
+				q := Empty().Transform(func(tq *TPQueue) *TPQueue {
+					for _, p := range a {
+						tq.Push(p, p)
+					}
+					return tq.Pop().Merge(qb)
+				})
+				exp := sorted(a)
+				if len(exp) > 0 {
+					exp = exp[1:]
+				}
+				return equalInts(drain(q), sorted(append(exp, b...)))
+			},
+			gen.SliceOf(gen.Int()),
+			gen.SliceOf(gen.Int()),
+		))
+	properties.TestingRun(t)
+	t.Run("Peek", func(t *testing.T) {
+		tq := Empty().AsTransient().Push("b", 2).Push("a", 1)
+		if elem, priority, ok := tq.Peek(); !ok || elem != "a" || priority != 1 {
+			t.Fatal("didn't get expected element", elem, priority, ok)
+		}
+		if tq.String() != "[ a:1 b:2 ]" {
+			t.Fatal("didn't get expected queue", tq)
+		}
+		if tq.Pop().Pop().Pop().AsPersistent() != Empty() {
+			t.Fatal("an emptied transient should become Empty")
+		}
+	})
+	t.Run("after persistent", func(t *testing.T) {
+		tq := Empty().AsTransient()
+		tq.AsPersistent()
+		defer func() {
+			if r := recover(); r != errTafterP {
+				t.Fatal("expected panic", r)
+			}
+		}()
+		tq.Push(1, 1)
+	})
+}
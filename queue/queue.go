@@ -1,26 +1,42 @@
 // Package queue implements a persistent FIFO queue.
+//
+// A queue is a sequence of the elements at its front followed by a
+// vector of the elements pushed behind them. Elements are pushed onto
+// the vector and popped from the sequence; when the sequence runs out
+// a sequence over the vector becomes the new front. Nothing is copied,
+// so Push and Pop take O(1) time however many versions of a queue are
+// popped. The elements popped from a front that was a vector stay
+// referenced by the queue until the rest of that front is popped.
 package queue
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/list"
 	"jsouthworth.net/go/immutable/vector"
 	"jsouthworth.net/go/seq"
 )
 
 var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
+var errReduceSig = errors.New("Reduce requires a function: func(init iT, v vT) oT")
+var errTafterP = errors.New("transient used after persistent call")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty queue")
 
 // Queue represents a persistent immutable queue structure.
 type Queue struct {
-	bv *vector.Slice
+	count int
+	front seq.Sequence
+	rear  *vector.Vector
 }
 
 var empty = Queue{
-	bv: vector.Empty().Slice(0, 0),
+	rear: vector.Empty(),
 }
 
 // Empty returns an empty queue.
@@ -30,11 +46,11 @@ func Empty() *Queue {
 
 // New returns a queue populated with elems.
 func New(elems ...interface{}) *Queue {
-	q := Empty()
+	q := Empty().AsTransient()
 	for _, elem := range elems {
 		q = q.Push(elem)
 	}
-	return q
+	return q.AsPersistent()
 }
 
 // From returns a queue created from one of several go types:
@@ -93,8 +109,17 @@ func queueFromSequence(coll seq.Sequence) *Queue {
 
 // Push returns a Queue with the element added to the end.
 func (q *Queue) Push(elem interface{}) *Queue {
+	if q.Length() == 0 {
+		return &Queue{
+			count: 1,
+			front: list.New(elem).Seq(),
+			rear:  vector.Empty(),
+		}
+	}
 	return &Queue{
-		bv: q.bv.Append(elem),
+		count: q.count + 1,
+		front: q.front,
+		rear:  q.rear.Append(elem),
 	}
 }
 
@@ -106,19 +131,51 @@ func (q *Queue) Conj(elem interface{}) interface{} {
 
 // Pop returns a queue with the first element removed.
 func (q *Queue) Pop() *Queue {
-	new := q.bv.Slice(1, q.bv.Length())
-	if new.Length() == 0 {
+	if q.Length() <= 1 {
 		return Empty()
 	}
+	front := q.front.Next()
+	if front == nil {
+		return &Queue{
+			count: q.count - 1,
+			front: q.rear.Seq(),
+			rear:  vector.Empty(),
+		}
+	}
 	return &Queue{
-		bv: new,
+		count: q.count - 1,
+		front: front,
+		rear:  q.rear,
 	}
 }
 
 // First returns the first element of the queue.
 func (q *Queue) First() interface{} {
-	elem, _ := q.bv.Find(0)
-	return elem
+	if q.Length() == 0 {
+		return nil
+	}
+	return q.front.First()
+}
+
+// AsTransient returns a transient queue that pushes and pops in place.
+func (q *Queue) AsTransient() *TQueue {
+	return &TQueue{
+		count: q.count,
+		front: q.front,
+		rear:  q.rear.AsTransient(),
+	}
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent queue. It does this by making a transient
+// queue and calling each action on it, then converting it back
+// to a persistent queue.
+func (q *Queue) Transform(actions ...func(*TQueue) *TQueue) *Queue {
+	out := q.AsTransient()
+	for _, action := range actions {
+		out = action(out)
+	}
+	return out.AsPersistent()
 }
 
 // Range calls the passed in function on each element of the queue.
@@ -152,30 +209,43 @@ func (q *Queue) Range(do interface{}) {
 			return true
 		}
 	default:
-		rv := reflect.ValueOf(do)
-		if rv.Kind() != reflect.Func {
-			panic(errRangeSig)
-		}
-		rt := rv.Type()
-		if rt.NumIn() != 1 || rt.NumOut() > 1 {
-			panic(errRangeSig)
-		}
-		if rt.NumOut() == 1 &&
-			rt.Out(0).Kind() != reflect.Bool {
-			panic(errRangeSig)
-		}
-		f = func(value interface{}) bool {
-			out := dyn.Apply(do, value)
-			if out != nil {
-				return out.(bool)
-			}
-			return true
-		}
+		f = genRangeFunc(do)
 	}
+	rangeQueue(q.front, q.rear.Length(), q.rear.At, f)
+}
+
+// rangeQueue calls f with the elements of front and then of the rear
+// of a queue, which has n elements retrieved by at, until f returns
+// false.
+func rangeQueue(front seq.Sequence, n int, at func(int) interface{}, f func(value interface{}) bool) {
 	cont := true
-	for queue := q; queue != Empty() && cont; queue = queue.Pop() {
-		value := queue.First()
-		cont = f(value)
+	for s := front; s != nil && cont; s = s.Next() {
+		cont = f(s.First())
+	}
+	for i := 0; i < n && cont; i++ {
+		cont = f(at(i))
+	}
+}
+
+func genRangeFunc(do interface{}) func(value interface{}) bool {
+	rv := reflect.ValueOf(do)
+	if rv.Kind() != reflect.Func {
+		panic(errRangeSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 1 || rt.NumOut() > 1 {
+		panic(errRangeSig)
+	}
+	if rt.NumOut() == 1 &&
+		rt.Out(0).Kind() != reflect.Bool {
+		panic(errRangeSig)
+	}
+	return func(value interface{}) bool {
+		out := dyn.Apply(do, value)
+		if out != nil {
+			return out.(bool)
+		}
+		return true
 	}
 }
 
@@ -187,12 +257,42 @@ func (q *Queue) Range(do interface{}) {
 //
 // Reduce will panic if given any other function type.
 func (q *Queue) Reduce(fn interface{}, init interface{}) interface{} {
-	return q.bv.Reduce(fn, init)
+	var rFn func(r, v interface{}) interface{}
+	switch f := fn.(type) {
+	case func(res, val interface{}) interface{}:
+		rFn = f
+	default:
+		rFn = genReduceFunc(fn)
+	}
+	res := init
+	rangeQueue(q.front, q.rear.Length(), q.rear.At,
+		func(value interface{}) bool {
+			res = rFn(res, value)
+			return true
+		})
+	return res
+}
+
+func genReduceFunc(fn interface{}) func(r, v interface{}) interface{} {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		panic(errReduceSig)
+	}
+	rt := rv.Type()
+	if rt.NumIn() != 2 {
+		panic(errReduceSig)
+	}
+	if rt.NumOut() != 1 {
+		panic(errReduceSig)
+	}
+	return func(r, v interface{}) interface{} {
+		return dyn.Apply(fn, r, v)
+	}
 }
 
 // Seq returns the queue as a sequence.
 func (q *Queue) Seq() seq.Sequence {
-	if q.bv.Length() == 0 {
+	if q.Length() == 0 {
 		return nil
 	}
 	return &queueSeq{
@@ -211,17 +311,88 @@ func (q *Queue) String() string {
 	return b.String()
 }
 
+// MarshalJSON implements json.Marshaler encoding the queue as a JSON
+// array with the front of the queue first.
+func (q *Queue) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, q.Length())
+	q.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array,
+// front of the queue first, into the queue. The queue returned by
+// Empty is shared and may not be decoded into.
+func (q *Queue) UnmarshalJSON(data []byte) error {
+	if q == &empty {
+		return errUnmarshalEmpty
+	}
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*q = *New(elems...)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format with the front of the queue first. Elements are encoded with
+// gob unless they implement encoding.BinaryMarshaler, so their
+// concrete types must be registered with gob.Register.
+func (q *Queue) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.Queue, q.Length(),
+		func(fn func(interface{}) bool) {
+			q.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. The queue returned by Empty is
+// shared and may not be decoded into.
+func (q *Queue) UnmarshalBinary(data []byte) error {
+	if q == &empty {
+		return errUnmarshalEmpty
+	}
+	out := Empty().AsTransient()
+	err := binenc.UnmarshalSeq(data, binenc.Queue, func(elem interface{}) {
+		out.Push(elem)
+	})
+	if err != nil {
+		return err
+	}
+	*q = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (q *Queue) GobEncode() ([]byte, error) {
+	return q.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (q *Queue) GobDecode(data []byte) error {
+	return q.UnmarshalBinary(data)
+}
+
 // Length returns the number of elements currently in the queue.
 func (q *Queue) Length() int {
-	return q.bv.Length()
+	return q.count
 }
 
 // Equal returns whether the other value passed in is a queue and the
 // values of that queue are equal to its values.
 func (q *Queue) Equal(other interface{}) bool {
 	oq, isQueue := other.(*Queue)
-	return isQueue &&
-		q.bv.Equal(oq.bv)
+	if !isQueue || q.Length() != oq.Length() {
+		return false
+	}
+	for a, b := q.Seq(), oq.Seq(); a != nil; a, b = a.Next(), b.Next() {
+		if !dyn.Equal(a.First(), b.First()) {
+			return false
+		}
+	}
+	return true
 }
 
 type queueSeq struct {
@@ -234,7 +405,7 @@ func (q *queueSeq) First() interface{} {
 
 func (q *queueSeq) Next() seq.Sequence {
 	new := q.queue.Pop()
-	if new.bv.Length() == 0 {
+	if new.Length() == 0 {
 		return nil
 	}
 	return &queueSeq{
@@ -245,3 +416,117 @@ func (q *queueSeq) Next() seq.Sequence {
 func (q *queueSeq) String() string {
 	return seq.ConvertToString(q)
 }
+
+// TQueue is a transient queue. Pushing and popping change the
+// transient in place rather than returning new queues. The changes
+// become immutable when AsPersistent is called.
+type TQueue struct {
+	count int
+	front seq.Sequence
+	rear  *vector.TVector
+	done  bool
+}
+
+// Push adds the element to the end of the queue. q is returned.
+func (q *TQueue) Push(elem interface{}) *TQueue {
+	q.ensureEditable()
+	q.count++
+	if q.count == 1 {
+		q.front = list.New(elem).Seq()
+		return q
+	}
+	q.rear.Append(elem)
+	return q
+}
+
+// Conj adds the element to the end of the queue. Conj implements a
+// generic mechanism for building collections.
+func (q *TQueue) Conj(elem interface{}) interface{} {
+	return q.Push(elem)
+}
+
+// Pop removes the first element of the queue. q is returned.
+func (q *TQueue) Pop() *TQueue {
+	q.ensureEditable()
+	if q.Length() == 0 {
+		return q
+	}
+	q.count--
+	q.front = q.front.Next()
+	if q.front == nil {
+		q.front = q.rear.AsPersistent().Seq()
+		q.rear = vector.Empty().AsTransient()
+	}
+	return q
+}
+
+// First returns the first element of the queue.
+func (q *TQueue) First() interface{} {
+	q.ensureEditable()
+	if q.Length() == 0 {
+		return nil
+	}
+	return q.front.First()
+}
+
+// Length returns the number of elements currently in the queue.
+func (q *TQueue) Length() int {
+	return q.count
+}
+
+// AsPersistent returns an immutable version of the queue. Any
+// transient operations performed after this will cause a panic.
+func (q *TQueue) AsPersistent() *Queue {
+	q.ensureEditable()
+	q.done = true
+	rear := q.rear.AsPersistent()
+	if q.Length() == 0 {
+		return Empty()
+	}
+	return &Queue{
+		count: q.count,
+		front: q.front,
+		rear:  rear,
+	}
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (q *TQueue) MakePersistent() interface{} {
+	return q.AsPersistent()
+}
+
+// Range calls the passed in function on each element of the queue,
+// front first. It accepts the same functions as Queue.Range.
+func (q *TQueue) Range(do interface{}) {
+	q.ensureEditable()
+	var f func(value interface{}) bool
+	switch fn := do.(type) {
+	case func(value interface{}) bool:
+		f = fn
+	case func(value interface{}):
+		f = func(value interface{}) bool {
+			fn(value)
+			return true
+		}
+	default:
+		f = genRangeFunc(do)
+	}
+	rangeQueue(q.front, q.rear.Length(), q.rear.At, f)
+}
+
+// String returns a representation of the queue as a string.
+func (q *TQueue) String() string {
+	b := new(strings.Builder)
+	fmt.Fprint(b, "[ ")
+	q.Range(func(item interface{}) {
+		fmt.Fprintf(b, "%v ", item)
+	})
+	fmt.Fprint(b, "]")
+	return b.String()
+}
+
+func (q *TQueue) ensureEditable() {
+	if q.done {
+		panic(errTafterP)
+	}
+}
@@ -1,6 +1,9 @@
 package queue
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -132,6 +135,133 @@ func TestQueueEqual(t *testing.T) {
 
 }
 
+func TestQueueModel(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Push and Pop match a slice",
+		prop.ForAll(
+			func(ops []int) bool {
+				q := Empty()
+				var model []interface{}
+				for i, op := range ops {
+					if op%3 == 0 {
+						q = q.Pop()
+						if len(model) > 0 {
+							model = model[1:]
+						}
+					} else {
+						q = q.Push(i)
+						model = append(model, i)
+					}
+					if q.Length() != len(model) ||
+						!q.Equal(New(model...)) {
+						return false
+					}
+					// The front and rear hold the elements counted.
+					held := q.rear.Length()
+					for f := q.front; f != nil; f = f.Next() {
+						held++
+					}
+					if held != len(model) {
+						return false
+					}
+					if len(model) > 0 && q.First() != model[0] {
+						return false
+					}
+				}
+				return true
+			},
+			gen.SliceOf(gen.IntRange(0, 100)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestPopSharesRear(t *testing.T) {
+	q := Empty().AsTransient()
+	for i := 0; i < 100000; i++ {
+		q.Push(i)
+	}
+	full := q.AsPersistent()
+	// Popping the only element of the front makes the rear the front
+	// without copying it, however often the same version is popped.
+	allocs := testing.AllocsPerRun(100, func() {
+		if full.Pop().First() != 1 {
+			t.Fatal("expected 1 after the first pop")
+		}
+	})
+	if allocs > 4 {
+		t.Fatalf("Pop made %v allocations", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		if tq := full.AsTransient().Pop(); tq.First() != 1 {
+			t.Fatal("expected 1 after the first transient pop")
+		}
+	})
+	if allocs > 8 {
+		t.Fatalf("AsTransient and Pop made %v allocations", allocs)
+	}
+}
+
+func TestTQueue(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("transient matches persistent",
+		prop.ForAll(
+			func(ops []int) bool {
+				p := New(-1, -2)
+				tq := p.AsTransient()
+				for i, op := range ops {
+					if op%3 == 0 {
+						p = p.Pop()
+						tq = tq.Pop()
+					} else {
+						p = p.Push(i)
+						tq = tq.Push(i)
+					}
+					if tq.Length() != p.Length() ||
+						tq.First() != p.First() {
+						return false
+					}
+				}
+				return tq.String() == p.String() &&
+					tq.AsPersistent().Equal(p)
+			},
+			gen.SliceOf(gen.IntRange(0, 100)),
+		))
+	properties.TestingRun(t)
+	t.Run("original unchanged", func(t *testing.T) {
+		q := New(1, 2, 3)
+		tq := q.AsTransient().Pop().Push(4).Push(5)
+		if !q.Equal(New(1, 2, 3)) {
+			t.Fatal("transient changed the original queue", q)
+		}
+		if !tq.AsPersistent().Equal(New(2, 3, 4, 5)) {
+			t.Fatal("didn't get expected queue", tq)
+		}
+	})
+	t.Run("Transform", func(t *testing.T) {
+		q := Empty().Transform(func(tq *TQueue) *TQueue {
+			for i := 0; i < 10; i++ {
+				tq.Push(i)
+			}
+			return tq.Pop()
+		})
+		if q.Length() != 9 || q.First() != 1 {
+			t.Fatal("didn't get expected queue", q)
+		}
+	})
+	t.Run("after persistent", func(t *testing.T) {
+		tq := Empty().AsTransient()
+		tq.AsPersistent()
+		defer func() {
+			if r := recover(); r != errTafterP {
+				t.Fatal("expected panic", r)
+			}
+		}()
+		tq.Push(1)
+	})
+}
+
 func TestRange(t *testing.T) {
 	parameters := gopter.DefaultTestParameters()
 	properties := gopter.NewProperties(parameters)
@@ -374,3 +504,52 @@ func TestQueueReduce(t *testing.T) {
 		t.Fatal("didn't get expected value", out)
 	}
 }
+
+func TestJSON(t *testing.T) {
+	q := New(1.0, 2.0, 3.0).Pop()
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[2,3]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Queue
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(q) || got.First() != 2.0 {
+		t.Fatalf("expected %v, got %v", q, &got)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Queue
+	}
+	in := snapshot{Value: New(1, "two", nil, 4.5)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Queue).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	if out.Value.First() != 1 {
+		t.Fatalf("expected the front to survive, got %v", out.Value.First())
+	}
+}
@@ -2,18 +2,21 @@
 package stack // import "jsouthworth.net/go/immutable/stack"
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
 	"jsouthworth.net/go/immutable/vector"
 	"jsouthworth.net/go/seq"
 )
 
 var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
 var errReduceSig = errors.New("Reduce requires a function: func(init iT, v vT) oT")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty stack")
 
 // Stack is a persistent stack.
 type Stack struct {
@@ -268,6 +271,78 @@ func (s *Stack) String() string {
 	return b.String()
 }
 
+// MarshalJSON implements json.Marshaler encoding the stack as a JSON
+// array with the top of the stack first.
+func (s *Stack) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, s.Length())
+	s.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array,
+// top of the stack first, into the stack. The stack returned by Empty
+// is shared and may not be decoded into.
+func (s *Stack) UnmarshalJSON(data []byte) error {
+	if s == &empty {
+		return errUnmarshalEmpty
+	}
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	out := Empty().AsTransient()
+	for i := len(elems) - 1; i >= 0; i-- {
+		out = out.Push(elems[i])
+	}
+	*s = *out.AsPersistent()
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format with the top of the stack first. Elements are encoded with
+// gob unless they implement encoding.BinaryMarshaler, so their
+// concrete types must be registered with gob.Register.
+func (s *Stack) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.Stack, s.Length(),
+		func(fn func(interface{}) bool) {
+			s.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. The stack returned by Empty is
+// shared and may not be decoded into.
+func (s *Stack) UnmarshalBinary(data []byte) error {
+	if s == &empty {
+		return errUnmarshalEmpty
+	}
+	var elems []interface{}
+	err := binenc.UnmarshalSeq(data, binenc.Stack, func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	if err != nil {
+		return err
+	}
+	out := Empty().AsTransient()
+	for i := len(elems) - 1; i >= 0; i-- {
+		out = out.Push(elems[i])
+	}
+	*s = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (s *Stack) GobEncode() ([]byte, error) {
+	return s.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (s *Stack) GobDecode(data []byte) error {
+	return s.UnmarshalBinary(data)
+}
+
 // Transform takes a set of actions and performs them
 // on the persistent stack. It does this by making a transient
 // stack and calling each action on it, then converting it back
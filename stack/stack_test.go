@@ -1,6 +1,9 @@
 package stack
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
@@ -539,3 +542,52 @@ func TestReduce(t *testing.T) {
 		}
 	})
 }
+
+func TestJSON(t *testing.T) {
+	s := New(1.0, 2.0, 3.0)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[3,2,1]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Stack
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(s) || got.Top() != 3.0 {
+		t.Fatalf("expected %v, got %v", s, &got)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Stack
+	}
+	in := snapshot{Value: New(1, "two", nil, 4.5)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Stack).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	if out.Value.Top() != 4.5 {
+		t.Fatalf("expected the top to survive, got %v", out.Value.Top())
+	}
+}
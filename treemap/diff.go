@@ -0,0 +1,76 @@
+package treemap
+
+// ChangeKind describes how the entry for a key differs between two
+// versions of a map.
+type ChangeKind uint8
+
+const (
+	// Added marks a key only in the new map.
+	Added ChangeKind = iota
+	// Removed marks a key only in the old map.
+	Removed
+	// Changed marks a key in both maps with different values.
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	case Changed:
+		return "Changed"
+	default:
+		return "ChangeKind(?)"
+	}
+}
+
+// ChangeOf is a difference between two versions of a typed map. Old
+// is the zero value for added keys and New is the zero value for
+// removed keys.
+type ChangeOf[K, V any] struct {
+	Kind ChangeKind
+	Key  K
+	Old  V
+	New  V
+}
+
+// Change is a difference between two versions of a Map.
+type Change = ChangeOf[interface{}, interface{}]
+
+// DiffOf calls fn, in ascending key order, for each key that was
+// added, removed or changed between old and new. Subtrees the two
+// maps share are skipped, so comparing two versions of a large map
+// costs time proportional to the number of changes. Values are
+// compared with the equality function of new. The walk stops when
+// fn returns false. Both maps must be ordered by the same compare
+// function.
+func DiffOf[K, V any](old, new *MapOf[K, V], fn func(ChangeOf[K, V]) bool) {
+	old.root.Diff(new.root, func(a, b entryOf[K, V], inOld, inNew bool) bool {
+		switch {
+		case !inNew:
+			return fn(ChangeOf[K, V]{Kind: Removed, Key: a.key, Old: a.value})
+		case !inOld:
+			return fn(ChangeOf[K, V]{Kind: Added, Key: b.key, New: b.value})
+		case new.eq(a.value, b.value):
+			return true
+		default:
+			return fn(ChangeOf[K, V]{
+				Kind: Changed,
+				Key:  b.key,
+				Old:  a.value,
+				New:  b.value,
+			})
+		}
+	})
+}
+
+// Diff calls fn, in ascending key order, for each key that was added,
+// removed or changed between old and new. Subtrees the two maps share
+// are skipped, so comparing two versions of a large map costs time
+// proportional to the number of changes. The walk stops when fn
+// returns false. Both maps must be ordered by the same Compare option.
+func Diff(old, new *Map, fn func(Change) bool) {
+	DiffOf(old.typed(), new.typed(), fn)
+}
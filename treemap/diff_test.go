@@ -0,0 +1,59 @@
+package treemap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := Empty().Transform(func(m *TMap) {
+		for i := 0; i < 10000; i++ {
+			m.Assoc(i, i)
+		}
+	})
+	new := old.Assoc(-1, -1).Assoc(5000, 0).Delete(7).Assoc(3, 3)
+	var got []string
+	Diff(old, new, func(c Change) bool {
+		got = append(got, fmt.Sprint(c.Kind, c.Key, c.Old, c.New))
+		return true
+	})
+	exp := []string{
+		"Added -1 <nil> -1",
+		"Removed 7 7 <nil>",
+		"Changed 5000 5000 0",
+	}
+	if strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	count := 0
+	Diff(old, new, func(c Change) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Fatalf("expected Diff to stop early, got %d calls", count)
+	}
+	Diff(new, new, func(c Change) bool {
+		t.Fatalf("unexpected change %v", c)
+		return true
+	})
+}
+
+func TestDiffOf(t *testing.T) {
+	old := EmptyOf[string, int]().Assoc("a", 1).Assoc("b", 2)
+	new := old.Delete("a").Assoc("b", 3).Assoc("c", 4)
+	var got []ChangeOf[string, int]
+	DiffOf(old, new, func(c ChangeOf[string, int]) bool {
+		got = append(got, c)
+		return true
+	})
+	exp := []ChangeOf[string, int]{
+		{Kind: Removed, Key: "a", Old: 1},
+		{Kind: Changed, Key: "b", Old: 2, New: 3},
+		{Kind: Added, Key: "c", New: 4},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
@@ -6,4 +6,9 @@
 // Otherwise '==' will be used with all its restrictions. Additionally,
 // Key's must be comparable. One may implement Compare(other interface{}) int
 // to override the default comparable restrcitions.
+//
+// MapOf provides a typed variant of Map whose keys and values are
+// stored without boxing and whose keys are ordered by a func(K, K) int.
+// EmptyOf uses cmp.Compare for ordered key types and EmptyOfFunc
+// accepts any comparison function.
 package treemap
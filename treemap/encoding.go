@@ -0,0 +1,176 @@
+package treemap
+
+import (
+	"errors"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/internal/btree"
+	"jsouthworth.net/go/immutable/internal/jsonmap"
+	"jsouthworth.net/go/immutable/persist"
+)
+
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty map")
+
+// MarshalJSON implements json.Marshaler. A map whose keys are all
+// strings, or implement encoding.TextMarshaler, is encoded as a JSON
+// object with its members in key order. Any other map is encoded as
+// an array of [key, value] pairs in key order.
+func (m *MapOf[K, V]) MarshalJSON() ([]byte, error) {
+	return jsonmap.Marshal(m.Range, false)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either of the
+// forms produced by MarshalJSON and builds the map with a transient.
+// A map that already has an order, such as one returned by
+// EmptyOfFunc, keeps it; the zero MapOf is ordered by dyn.Compare.
+// Object member names are converted to K directly for string keys,
+// with UnmarshalText for encoding.TextUnmarshaler keys and are
+// otherwise decoded as JSON, which allows numeric keys. The map
+// returned by Empty is shared and may not be decoded into.
+func (m *MapOf[K, V]) UnmarshalJSON(data []byte) error {
+	if interface{}(m) == interface{}(empty.typed()) {
+		return errUnmarshalEmpty
+	}
+	out := m.cleared().AsTransient()
+	err := jsonmap.Unmarshal(data, func(k K, v V) {
+		out.Assoc(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	*m = *out.AsPersistent()
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format with the entries in key order. Keys and values whose types
+// implement encoding.BinaryMarshaler encode themselves, others are
+// encoded with gob so the concrete types held in interface{} keys or
+// values must be registered with gob.Register.
+func (m *MapOf[K, V]) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalMap(binenc.TreeMap, m.Length(), m.Range)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. Like UnmarshalJSON, a map that
+// already has an order keeps it and the map returned by Empty may not
+// be decoded into.
+func (m *MapOf[K, V]) UnmarshalBinary(data []byte) error {
+	if interface{}(m) == interface{}(empty.typed()) {
+		return errUnmarshalEmpty
+	}
+	out := m.cleared().AsTransient()
+	err := binenc.UnmarshalMap(data, binenc.TreeMap, func(k K, v V) {
+		out.Assoc(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	*m = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (m *MapOf[K, V]) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (m *MapOf[K, V]) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
+
+// Persist writes the map to w and returns the hash of its root. Each
+// node is written once, so the nodes this map shares with versions
+// previously written by w are not written again. Keys and values are
+// encoded as by MarshalBinary.
+func (m *MapOf[K, V]) Persist(w *persist.Writer) (persist.Hash, error) {
+	return m.root.Persist(w, encodeEntry[K, V])
+}
+
+// Load reads the map whose root hash was returned by Persist. The map
+// has the order and value equality of m, which must have the order
+// the map was written with. Nodes are read as they are first used and
+// nodes already read by r are shared with the maps it returned before.
+func (m *MapOf[K, V]) Load(r *persist.Reader, h persist.Hash) (*MapOf[K, V], error) {
+	c := m.cleared()
+	root, err := c.root.Load(r, h, decodeEntry[K, V])
+	if err != nil {
+		return nil, err
+	}
+	return &MapOf[K, V]{root: root, eq: c.eq}, nil
+}
+
+// PagerOf reads the leaves of paged maps from a persist.Store, such
+// as a persist.FileStore, as they are needed and keeps the most
+// recently used of them in memory. A PagerOf may be shared by any
+// number of maps and is safe for concurrent use.
+type PagerOf[K, V any] struct {
+	impl *btree.Pager[entryOf[K, V]]
+}
+
+// NewPagerOf returns a pager that reads from store and keeps up to
+// capacity leaves, each holding up to 64 entries, in memory.
+func NewPagerOf[K, V any](store persist.Store, capacity int) *PagerOf[K, V] {
+	return &PagerOf[K, V]{
+		impl: btree.NewPager(store, decodeEntry[K, V], capacity),
+	}
+}
+
+// Cached returns the number of leaves the pager holds in memory.
+func (p *PagerOf[K, V]) Cached() int {
+	return p.impl.Cached()
+}
+
+// LoadPaged reads the map whose root hash was returned by Persist
+// from the pager's store. The internal nodes of the map are read
+// immediately but its leaves are only read when they are used and
+// may be evicted and read again later, so a map much larger than
+// memory can be searched with O(log n) reads. The map may be changed
+// like any other; new versions keep the leaves they change in memory
+// and may be written with Persist. The map has the order and value
+// equality of m, which must have the order the map was written with.
+//
+// Operations on the map panic if a leaf can not be read from the
+// store.
+func (m *MapOf[K, V]) LoadPaged(p *PagerOf[K, V], h persist.Hash) (*MapOf[K, V], error) {
+	c := m.cleared()
+	root, err := c.root.LoadPaged(p.impl, h)
+	if err != nil {
+		return nil, err
+	}
+	return &MapOf[K, V]{root: root, eq: c.eq}, nil
+}
+
+func encodeEntry[K, V any](e *binenc.Encoder, ent entryOf[K, V]) error {
+	if err := binenc.Encode(e, ent.key); err != nil {
+		return err
+	}
+	return binenc.Encode(e, ent.value)
+}
+
+func decodeEntry[K, V any](d *binenc.Decoder) (entryOf[K, V], error) {
+	var ent entryOf[K, V]
+	var err error
+	if ent.key, err = binenc.Decode[K](d); err != nil {
+		return ent, err
+	}
+	ent.value, err = binenc.Decode[V](d)
+	return ent, err
+}
+
+// cleared returns an empty map with the same order and value
+// equality as m.
+func (m *MapOf[K, V]) cleared() *MapOf[K, V] {
+	if m.root == nil {
+		return emptyOf(
+			func(k1, k2 K) int { return dyn.Compare(k1, k2) },
+			func(v1, v2 V) bool { return dyn.Equal(v1, v2) },
+		)
+	}
+	return &MapOf[K, V]{
+		root: m.root.FromSorted(nil),
+		eq:   m.eq,
+	}
+}
@@ -2,18 +2,17 @@ package treemap // import "jsouthworth.net/go/immutable/treemap"
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
-	"strings"
 
 	"jsouthworth.net/go/dyn"
-	"jsouthworth.net/go/immutable/internal/btree"
+	"jsouthworth.net/go/immutable/persist"
 	"jsouthworth.net/go/seq"
 )
 
 var errOddElements = errors.New("must supply an even number elements")
 var errRangeSig = errors.New("Range requires a function: func(k kT, v vT) bool or func(k kT, v vT)")
 var errReduceSig = errors.New("Reduce requires a function: func(init iT, k kT, v vT) oT or func(init iT, e Entry) oT")
+var errUnsorted = errors.New("FromSorted requires keys in strictly ascending order")
 
 // Entry is a map entry. Each entry consists of a key and value.
 type Entry interface {
@@ -26,59 +25,19 @@ func EntryNew(key, value interface{}) Entry {
 	return entry{key, value}
 }
 
-type entry struct {
-	key   interface{}
-	value interface{}
-}
-
-func (e entry) Key() interface{} {
-	return e.key
-}
-
-func (e entry) Value() interface{} {
-	return e.value
-}
-
-func (e entry) String() string {
-	return fmt.Sprintf("[%v %v]", e.key, e.value)
-}
+type entry = entryOf[interface{}, interface{}]
 
-// Map is a persistent immutable map based on Red/Black
-// trees. Operations on map returns a new map that shares much of the
-// structure with the original map.
-type Map struct {
-	root *btree.BTree
-	eq   eqFunc
-}
+// Map is a persistent immutable map based on B+ trees. Operations on
+// map returns a new map that shares much of the structure with the
+// original map. Map is a MapOf[interface{}, interface{}] and may be
+// used to store heterogeneous keys and values.
+type Map MapOf[interface{}, interface{}]
 
-type cmpFunc func(k1, k2 interface{}) int
-type eqFunc func(k1, k2 interface{}) bool
-
-func defaultCompare(a, b interface{}) int {
-	ae := a.(entry)
-	be := b.(entry)
-	return dyn.Compare(ae.key, be.key)
-}
-
-func defaultEqual(a, b interface{}) bool {
-	ae, aok := a.(entry)
-	be, bok := b.(entry)
-	return aok && bok &&
-		dyn.Compare(ae.key, be.key) == 0 &&
-		dyn.Equal(ae.value, be.value)
-}
-
-var empty = Map{
-	root: btree.Empty(
-		btree.Compare(defaultCompare),
-		btree.Equal(defaultEqual),
-	),
-	eq: dyn.Equal,
-}
+var empty = (*Map)(emptyOf[interface{}, interface{}](dyn.Compare, dyn.Equal))
 
 type mapOptions struct {
-	compare cmpFunc
-	equal   eqFunc
+	compare func(k1, k2 interface{}) int
+	equal   func(v1, v2 interface{}) bool
 }
 
 // Option is a type that allows changes to pluggable parts of the
@@ -110,7 +69,7 @@ func Equal(eq func(v1, v2 interface{}) bool) Option {
 // providing that to Empty.
 func Empty(options ...Option) *Map {
 	if len(options) == 0 {
-		return &empty
+		return empty
 	}
 
 	opts := mapOptions{
@@ -121,26 +80,7 @@ func Empty(options ...Option) *Map {
 		opt(&opts)
 	}
 
-	cmp := func(a, b interface{}) int {
-		ae := a.(entry)
-		be := b.(entry)
-		return opts.compare(ae.key, be.key)
-	}
-	eq := func(a, b interface{}) bool {
-		ae, aok := a.(entry)
-		be, bok := b.(entry)
-		return aok && bok &&
-			opts.compare(ae.key, be.key) == 0 &&
-			opts.equal(ae.value, be.value)
-	}
-
-	return &Map{
-		root: btree.Empty(
-			btree.Compare(cmp),
-			btree.Equal(eq),
-		),
-		eq: opts.equal,
-	}
+	return (*Map)(emptyOf(opts.compare, opts.equal))
 }
 
 // New converts a list of elements to a persistent map
@@ -204,6 +144,23 @@ func From(value interface{}, options ...Option) *Map {
 	}
 }
 
+// FromSorted returns a map holding entries, which must be in strictly
+// ascending order of their keys by the map's Compare option. The map
+// is built bottom up in O(n) time rather than by associating each
+// entry in turn. FromSorted panics if the keys are out of order or
+// repeated.
+func FromSorted(entries []Entry, options ...Option) *Map {
+	out := Empty(options...)
+	if len(entries) == 0 {
+		return out
+	}
+	es := make([]entry, len(entries))
+	for i, e := range entries {
+		es[i] = entry{e.Key(), e.Value()}
+	}
+	return (*Map)(out.typed().fromSorted(es))
+}
+
 func mapFromReflection(value interface{}, options ...Option) *Map {
 	v := reflect.ValueOf(value)
 	switch v.Kind() {
@@ -229,12 +186,7 @@ func mapFromReflection(value interface{}, options ...Option) *Map {
 // At returns the value associated with the key.
 // If one is not found, nil is returned.
 func (m *Map) At(key interface{}) interface{} {
-	v, ok := m.root.Find(entry{key: key})
-	if !ok {
-		return nil
-	}
-	ent := v.(entry)
-	return ent.value
+	return m.typed().At(key)
 }
 
 // EntryAt returns the entry (key, value pair) of the key.
@@ -244,25 +196,19 @@ func (m *Map) EntryAt(key interface{}) Entry {
 	if !ok {
 		return nil
 	}
-	ent := v.(entry)
-	return ent
+	return v
 }
 
 // Contains will test if the key exists in the map.
 func (m *Map) Contains(key interface{}) bool {
-	return m.root.Contains(entry{key: key})
+	return m.typed().Contains(key)
 }
 
 // Find will return the value for a key if it exists in the map and
 // whether the key exists in the map. For non-nil values, exists will
 // always be true.
 func (m *Map) Find(key interface{}) (value interface{}, exists bool) {
-	v, ok := m.root.Find(entry{key: key})
-	if !ok {
-		return nil, ok
-	}
-	ent := v.(entry)
-	return ent.value, ok
+	return m.typed().Find(key)
 }
 
 // Assoc associates a value with a key in the map.
@@ -270,16 +216,7 @@ func (m *Map) Find(key interface{}) (value interface{}, exists bool) {
 // are different from one already in the map, if the entry
 // is already in the map the original map is returned.
 func (m *Map) Assoc(key, value interface{}) *Map {
-	root := m.root.Add(entry{key: key, value: value})
-	switch {
-	case root == m.root:
-		return m
-	default:
-		return &Map{
-			root: root,
-			eq:   m.eq,
-		}
-	}
+	return (*Map)(m.typed().Assoc(key, value))
 }
 
 // Conj associates a value with a key in the map.
@@ -290,14 +227,59 @@ func (m *Map) Conj(elem interface{}) interface{} {
 
 // Delete removes a key and associated value from the map.
 func (m *Map) Delete(key interface{}) *Map {
-	root := m.root.Delete(entry{key: key})
-	if root == m.root {
-		return m
-	}
-	return &Map{
-		root: root,
-		eq:   m.eq,
-	}
+	return (*Map)(m.typed().Delete(key))
+}
+
+// First returns the entry with the smallest key in the map. The boolean is false when
+// no such entry exists.
+func (m *Map) First() (Entry, bool) {
+	return m.typed().First()
+}
+
+// Last returns the entry with the largest key in the map. The boolean is false when
+// no such entry exists.
+func (m *Map) Last() (Entry, bool) {
+	return m.typed().Last()
+}
+
+// Floor returns the entry with the greatest key less than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *Map) Floor(key interface{}) (Entry, bool) {
+	return m.typed().Floor(key)
+}
+
+// Ceiling returns the entry with the least key greater than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *Map) Ceiling(key interface{}) (Entry, bool) {
+	return m.typed().Ceiling(key)
+}
+
+// Lower returns the entry with the greatest key strictly less
+// than key. The boolean is false when
+// no such entry exists.
+func (m *Map) Lower(key interface{}) (Entry, bool) {
+	return m.typed().Lower(key)
+}
+
+// Higher returns the entry with the least key strictly greater
+// than key. The boolean is false when
+// no such entry exists.
+func (m *Map) Higher(key interface{}) (Entry, bool) {
+	return m.typed().Higher(key)
+}
+
+// Nth returns the entry at index i in key order. The boolean is
+// false when i is out of range.
+func (m *Map) Nth(i int) (Entry, bool) {
+	return m.typed().Nth(i)
+}
+
+// Rank returns the number of keys in the map strictly less than key.
+// When key is in the map this is its index.
+func (m *Map) Rank(key interface{}) int {
+	return m.typed().Rank(key)
 }
 
 // Length returns the number of entries in the map.
@@ -354,11 +336,10 @@ func (m *Map) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 
-	iter := m.Iterator()
+	iter := m.root.Iterator()
 	var cont = true
 	for iter.HasNext() && cont {
-		entry := iter.NextEntry()
-		cont = f(entry)
+		cont = f(iter.Next())
 	}
 }
 
@@ -413,10 +394,9 @@ func (m *Map) Reduce(fn interface{}, init interface{}) interface{} {
 		rFn = genReduceFunc(fn)
 	}
 	res := init
-	iter := m.Iterator()
+	iter := m.root.Iterator()
 	for iter.HasNext() {
-		entry := iter.NextEntry()
-		res = rFn(res, entry)
+		res = rFn(res, iter.Next())
 	}
 	return res
 }
@@ -449,32 +429,72 @@ func genReduceFunc(fn interface{}) func(interface{}, Entry) interface{} {
 // are not safe for concurrent access so they may not be shared
 // by reference between goroutines.
 func (m *Map) Iterator() Iterator {
-	return Iterator{
-		impl: m.root.Iterator(),
-	}
+	return Iterator(m.typed().Iterator())
 }
 
 // Seq returns a seralized sequence of Entry
 // corresponding to the maps entries.
 func (m *Map) Seq() seq.Sequence {
-	iter := m.root.Iterator()
-	if !iter.HasNext() {
-		return nil
-	}
-	return sequenceNew(iter)
+	return m.typed().Seq()
+}
+
+// IteratorFrom returns an iterator over the entries whose keys are
+// greater than or equal to key in ascending order.
+func (m *Map) IteratorFrom(key interface{}) Iterator {
+	return Iterator(m.typed().IteratorFrom(key))
+}
+
+// Subrange returns an iterator over the entries whose keys are in
+// [lo, hi) in ascending order.
+func (m *Map) Subrange(lo, hi interface{}) Iterator {
+	return Iterator(m.typed().Subrange(lo, hi))
+}
+
+// SliceByIndex returns an iterator over the entries with indexes in
+// [i, j) in key order. It panics if the indexes are out of range.
+func (m *Map) SliceByIndex(i, j int) Iterator {
+	return Iterator(m.typed().SliceByIndex(i, j))
+}
+
+// ReverseIterator returns an iterator over the entries in descending
+// key order.
+func (m *Map) ReverseIterator() Iterator {
+	return Iterator(m.typed().ReverseIterator())
+}
+
+// IteratorBefore returns an iterator over the entries whose keys are
+// strictly less than key in descending order.
+func (m *Map) IteratorBefore(key interface{}) Iterator {
+	return Iterator(m.typed().IteratorBefore(key))
+}
+
+// SeqFrom returns a sequence of the entries whose keys are greater
+// than or equal to key in ascending order.
+func (m *Map) SeqFrom(key interface{}) seq.Sequence {
+	return m.typed().SeqFrom(key)
+}
+
+// SubrangeSeq returns a sequence of the entries whose keys are in
+// [lo, hi) in ascending order.
+func (m *Map) SubrangeSeq(lo, hi interface{}) seq.Sequence {
+	return m.typed().SubrangeSeq(lo, hi)
+}
+
+// ReverseSeq returns a sequence of the entries in descending key
+// order.
+func (m *Map) ReverseSeq() seq.Sequence {
+	return m.typed().ReverseSeq()
+}
+
+// SeqBefore returns a sequence of the entries whose keys are strictly
+// less than key in descending order.
+func (m *Map) SeqBefore(key interface{}) seq.Sequence {
+	return m.typed().SeqBefore(key)
 }
 
 // String returns a string representation of the map.
 func (m *Map) String() string {
-	var b strings.Builder
-	fmt.Fprint(&b, "{ ")
-	iter := m.Iterator()
-	for iter.HasNext() {
-		entry := iter.NextEntry()
-		fmt.Fprintf(&b, "%s ", entry)
-	}
-	fmt.Fprint(&b, "}")
-	return b.String()
+	return m.typed().String()
 }
 
 // AsNative returns the map converted to a go native map type.
@@ -496,17 +516,7 @@ func (m *Map) Equal(o interface{}) bool {
 	if !ok {
 		return ok
 	}
-	if m.Length() != other.Length() {
-		return false
-	}
-	iter := m.Iterator()
-	for iter.HasNext() {
-		key, value := iter.Next()
-		if !m.eq(other.At(key), value) {
-			return false
-		}
-	}
-	return true
+	return m.typed().Equal(other.typed())
 }
 
 // Apply takes an arbitrary number of arguments and returns the
@@ -520,22 +530,16 @@ func (m *Map) Apply(args ...interface{}) interface{} {
 // Iterator is a mutable iterator for a map. It has a fixed size
 // stack, the size of which is computed from the maximum number of
 // nested nodes possible based on the branching factor.
-type Iterator struct {
-	impl btree.Iterator
-}
+type Iterator IteratorOf[interface{}, interface{}]
 
 // Next provides the next key value pair and increments the cursor.
 func (i *Iterator) Next() (interface{}, interface{}) {
-	out := i.impl.Next()
-	ent := out.(entry)
-	return ent.key, ent.value
+	return i.typed().Next()
 }
 
 // NextEntry provides the next entry and increments the cursor.
 func (i *Iterator) NextEntry() Entry {
-	out := i.impl.Next()
-	ent := out.(entry)
-	return ent
+	return i.impl.Next()
 }
 
 // HasNext is true when there are more elements to be iterated over.
@@ -543,14 +547,14 @@ func (i *Iterator) HasNext() bool {
 	return i.impl.HasNext()
 }
 
+func (i *Iterator) typed() *IteratorOf[interface{}, interface{}] {
+	return (*IteratorOf[interface{}, interface{}])(i)
+}
+
 // AsTransient will return a transient map that shares
 // structure with the persistent map.
 func (m *Map) AsTransient() *TMap {
-	return &TMap{
-		root: m.root.AsTransient(),
-		eq:   m.eq,
-		orig: m,
-	}
+	return (*TMap)(m.typed().AsTransient())
 }
 
 // MakeTransient is a generic version of AsTransient.
@@ -569,3 +573,89 @@ func (m *Map) Transform(actions ...func(*TMap)) *Map {
 	}
 	return out.AsPersistent()
 }
+
+// MarshalJSON implements json.Marshaler. A map whose keys are all
+// strings, or implement encoding.TextMarshaler, is encoded as a JSON
+// object with its members in key order. Any other map is encoded as
+// an array of [key, value] pairs in key order.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return m.typed().MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either of the
+// forms produced by MarshalJSON. A map created with Compare or Equal
+// options keeps them. Keys decoded from an object are strings; keys
+// decoded from pairs take the types encoding/json uses for
+// interface{} values.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	return m.typed().UnmarshalJSON(data)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Keys and values are encoded with gob unless they implement
+// encoding.BinaryMarshaler, so their concrete types must be
+// registered with gob.Register.
+func (m *Map) MarshalBinary() ([]byte, error) {
+	return m.typed().MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. A map created with Compare or
+// Equal options keeps them.
+func (m *Map) UnmarshalBinary(data []byte) error {
+	return m.typed().UnmarshalBinary(data)
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (m *Map) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (m *Map) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
+
+// Persist writes the map to w and returns the hash of its root. Nodes
+// shared with versions previously written by w are not written
+// again. Keys and values are encoded as by MarshalBinary.
+func (m *Map) Persist(w *persist.Writer) (persist.Hash, error) {
+	return m.typed().Persist(w)
+}
+
+// Load reads the map whose root hash was returned by Persist. The map
+// is ordered like m, which must have the order the map was written
+// with. Nodes already read by r are shared with the maps it returned
+// before.
+func (m *Map) Load(r *persist.Reader, h persist.Hash) (*Map, error) {
+	out, err := m.typed().Load(r, h)
+	return (*Map)(out), err
+}
+
+// Pager reads the leaves of paged maps from a persist.Store as they
+// are needed and keeps the most recently used of them in memory.
+type Pager PagerOf[interface{}, interface{}]
+
+// NewPager returns a pager that reads from store and keeps up to
+// capacity leaves, each holding up to 64 entries, in memory.
+func NewPager(store persist.Store, capacity int) *Pager {
+	return (*Pager)(NewPagerOf[interface{}, interface{}](store, capacity))
+}
+
+// Cached returns the number of leaves the pager holds in memory.
+func (p *Pager) Cached() int {
+	return p.impl.Cached()
+}
+
+// LoadPaged reads the map whose root hash was returned by Persist,
+// reading its leaves from the pager's store as they are used. The map
+// is ordered like m, which must have the order the map was written
+// with. Operations on the map panic if a leaf can not be read.
+func (m *Map) LoadPaged(p *Pager, h persist.Hash) (*Map, error) {
+	out, err := m.typed().LoadPaged((*PagerOf[interface{}, interface{}])(p), h)
+	return (*Map)(out), err
+}
+
+func (m *Map) typed() *MapOf[interface{}, interface{}] {
+	return (*MapOf[interface{}, interface{}])(m)
+}
@@ -1,6 +1,9 @@
 package treemap
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -10,6 +13,7 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/seq"
 )
 
 func assert(t *testing.T, b bool, msg string) {
@@ -252,6 +256,49 @@ func TestFrom(t *testing.T) {
 	properties.TestingRun(t)
 }
 
+func TestFromSorted(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("FromSorted matches Assoc", prop.ForAll(
+		func(n int) bool {
+			entries := make([]Entry, n)
+			exp := Empty().AsTransient()
+			for i := range entries {
+				entries[i] = EntryNew(i*3, strconv.Itoa(i))
+				exp.Assoc(i*3, strconv.Itoa(i))
+			}
+			m := FromSorted(entries)
+			return m.Length() == n && m.Equal(exp.AsPersistent()) &&
+				m.Assoc(1, "x").At(1) == "x"
+		},
+		gen.IntRange(0, 20000),
+	))
+	properties.TestingRun(t)
+	if FromSorted(nil) != Empty() {
+		t.Fatal("expected Empty for no entries")
+	}
+	desc := Compare(func(k1, k2 interface{}) int {
+		return k2.(int) - k1.(int)
+	})
+	m := FromSorted([]Entry{EntryNew(2, "b"), EntryNew(1, "a")}, desc)
+	if m.String() != "{ [2 b] [1 a] }" {
+		t.Fatal("didn't keep the Compare option", m)
+	}
+	for _, entries := range [][]Entry{
+		{EntryNew(1, "a"), EntryNew(2, "b")},
+		{EntryNew(2, "a"), EntryNew(2, "b")},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != errUnsorted {
+					t.Fatal("expected panic", r)
+				}
+			}()
+			FromSorted(entries, desc)
+		}()
+	}
+}
+
 func TestAt(t *testing.T) {
 	parameters := gopter.DefaultTestParameters()
 	properties := gopter.NewProperties(parameters)
@@ -1115,3 +1162,229 @@ func TestTransientString(t *testing.T) {
 	))
 	properties.TestingRun(t)
 }
+
+func TestRangeIterators(t *testing.T) {
+	m := Empty().Transform(func(t *TMap) {
+		for i := 0; i < 1000; i++ {
+			t.Assoc(i, strconv.Itoa(i))
+		}
+	})
+	collect := func(iter Iterator) []interface{} {
+		var out []interface{}
+		for iter.HasNext() {
+			k, v := iter.Next()
+			if v != strconv.Itoa(k.(int)) {
+				t.Fatalf("unexpected value %v for key %v", v, k)
+			}
+			out = append(out, k)
+		}
+		return out
+	}
+	check := func(name string, got []interface{}, from, to, step int) {
+		want := []interface{}{}
+		for i := from; i != to; i += step {
+			want = append(want, i)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d keys expected %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %v at %d expected %v", name, got[i], i, want[i])
+			}
+		}
+	}
+	check("Subrange", collect(m.Subrange(100, 250)), 100, 250, 1)
+	check("Subrange empty", collect(m.Subrange(250, 100)), 0, 0, 1)
+	check("IteratorFrom", collect(m.IteratorFrom(990)), 990, 1000, 1)
+	check("ReverseIterator", collect(m.ReverseIterator()), 999, -1, -1)
+	check("IteratorBefore", collect(m.IteratorBefore(10)), 9, -1, -1)
+	check("IteratorBefore past end", collect(m.IteratorBefore(5000)), 999, -1, -1)
+
+	if got := seq.First(m.ReverseSeq()).(Entry).Key(); got != 999 {
+		t.Fatalf("ReverseSeq started at %v", got)
+	}
+	if got := seq.First(m.SeqFrom(500)).(Entry).Key(); got != 500 {
+		t.Fatalf("SeqFrom started at %v", got)
+	}
+	if got := seq.First(m.SeqBefore(500)).(Entry).Key(); got != 499 {
+		t.Fatalf("SeqBefore started at %v", got)
+	}
+	count := seq.Reduce(func(res int, _ interface{}) int {
+		return res + 1
+	}, 0, m.SubrangeSeq(10, 20)).(int)
+	if count != 10 {
+		t.Fatalf("SubrangeSeq produced %d entries", count)
+	}
+	if m.SubrangeSeq(20, 10) != nil {
+		t.Fatal("empty SubrangeSeq should be nil")
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	m := Empty()
+	if _, ok := m.First(); ok {
+		t.Fatal("First on empty map found an entry")
+	}
+	m = m.Transform(func(t *TMap) {
+		for i := 0; i < 1000; i += 10 {
+			t.Assoc(i, strconv.Itoa(i))
+		}
+	})
+	expect := func(name string, got Entry, ok bool, want interface{}) {
+		if want == nil {
+			if ok || got != nil {
+				t.Fatalf("%s: got %v expected no entry", name, got)
+			}
+			return
+		}
+		if !ok || got.Key() != want ||
+			got.Value() != strconv.Itoa(want.(int)) {
+			t.Fatalf("%s: got %v, %v expected key %v", name, got, ok, want)
+		}
+	}
+	got, ok := m.First()
+	expect("First", got, ok, 0)
+	got, ok = m.Last()
+	expect("Last", got, ok, 990)
+	got, ok = m.Floor(55)
+	expect("Floor", got, ok, 50)
+	got, ok = m.Floor(50)
+	expect("Floor equal", got, ok, 50)
+	got, ok = m.Ceiling(55)
+	expect("Ceiling", got, ok, 60)
+	got, ok = m.Ceiling(2000)
+	expect("Ceiling above", got, ok, nil)
+	got, ok = m.Lower(0)
+	expect("Lower below", got, ok, nil)
+	got, ok = m.Lower(55)
+	expect("Lower", got, ok, 50)
+	got, ok = m.Higher(50)
+	expect("Higher", got, ok, 60)
+
+	tm := m.AsTransient()
+	got, ok = tm.Ceiling(50)
+	expect("TMap Ceiling", got, ok, 50)
+	got, ok = tm.Lower(50)
+	expect("TMap Lower", got, ok, 40)
+	got, ok = tm.First()
+	expect("TMap First", got, ok, 0)
+}
+
+func TestOrderStatistics(t *testing.T) {
+	m := Empty().Transform(func(t *TMap) {
+		for i := 0; i < 1000; i++ {
+			t.Assoc(i*2, strconv.Itoa(i))
+		}
+	})
+	for i := 0; i < 1000; i++ {
+		e, ok := m.Nth(i)
+		if !ok || e.Key() != i*2 || e.Value() != strconv.Itoa(i) {
+			t.Fatalf("Nth(%d) = %v, %v", i, e, ok)
+		}
+		if got := m.Rank(i*2 + 1); got != i+1 {
+			t.Fatalf("Rank(%d) = %d expected %d", i*2+1, got, i+1)
+		}
+	}
+	if e, ok := m.Nth(-1); ok || e != nil {
+		t.Fatalf("Nth(-1) returned %v, %v", e, ok)
+	}
+	iter := m.SliceByIndex(990, 1000)
+	count := 0
+	for iter.HasNext() {
+		k, _ := iter.Next()
+		if k != (990+count)*2 {
+			t.Fatalf("SliceByIndex got key %v at %d", k, count)
+		}
+		count++
+	}
+	if count != 10 {
+		t.Fatalf("SliceByIndex produced %d entries", count)
+	}
+	tm := m.AsTransient().Delete(0)
+	if e, _ := tm.Nth(0); e.Key() != 2 {
+		t.Fatalf("TMap Nth(0) = %v", e)
+	}
+	if got := tm.Rank(2); got != 0 {
+		t.Fatalf("TMap Rank(2) = %d", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := New("b", 2.0, "a", 1.0, "c", 3.0)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":1,"b":2,"c":3}` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Map
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(m) {
+		t.Fatalf("expected %v, got %v", m, &got)
+	}
+
+	numbers := New(2.0, "two", 1.0, "one")
+	data, err = json.Marshal(numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[[1,"one"],[2,"two"]]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	reversed := Empty(Compare(func(a, b interface{}) int {
+		return dyn.Compare(b, a)
+	}))
+	if err := json.Unmarshal(data, reversed); err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := reversed.First(); first.Key() != 2.0 {
+		t.Fatalf("expected decoded map to keep its order, got %v", reversed)
+	}
+
+	var typed MapOf[int, string]
+	if err := json.Unmarshal([]byte(`{"2":"two","1":"one"}`), &typed); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(&typed); string(data) != `[[1,"one"],[2,"two"]]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Map
+	}
+	in := snapshot{Value: New(1, "one", 2, "two", 3, nil)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Map).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	var typed MapOf[int, string]
+	if err := typed.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error decoding interface{} keys as int")
+	}
+	if err := Empty().UnmarshalBinary(data); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package treemap
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/btree"
+	"jsouthworth.net/go/seq"
+)
+
+// EntryOf is a typed map entry. Each entry consists of a key and value.
+type EntryOf[K, V any] interface {
+	Key() K
+	Value() V
+}
+
+// EntryOfNew returns an EntryOf[K, V]
+func EntryOfNew[K, V any](key K, value V) EntryOf[K, V] {
+	return entryOf[K, V]{key, value}
+}
+
+type entryOf[K, V any] struct {
+	key   K
+	value V
+}
+
+func (e entryOf[K, V]) Key() K {
+	return e.key
+}
+
+func (e entryOf[K, V]) Value() V {
+	return e.value
+}
+
+func (e entryOf[K, V]) String() string {
+	return fmt.Sprintf("[%v %v]", e.key, e.value)
+}
+
+// MapOf is a persistent immutable map with keys of type K and values
+// of type V ordered by a comparison function. Operations on the map
+// return a new map that shares much of the structure with the
+// original map. Keys and values are stored in the tree without
+// boxing.
+type MapOf[K, V any] struct {
+	root *btree.TreeOf[entryOf[K, V]]
+	eq   func(v1, v2 V) bool
+}
+
+// EmptyOf returns a new empty persistent map whose keys are ordered
+// by cmp.Compare.
+func EmptyOf[K cmp.Ordered, V any]() *MapOf[K, V] {
+	return EmptyOfFunc[K, V](cmp.Compare[K])
+}
+
+// EmptyOfFunc returns a new empty persistent map whose keys are
+// ordered by compare. compare must return a negative number when
+// k1 < k2, zero when k1 == k2 and a positive number when k1 > k2.
+func EmptyOfFunc[K, V any](compare func(k1, k2 K) int) *MapOf[K, V] {
+	return emptyOf(compare, func(v1, v2 V) bool {
+		return dyn.Equal(v1, v2)
+	})
+}
+
+func emptyOf[K, V any](
+	compare func(k1, k2 K) int,
+	equal func(v1, v2 V) bool,
+) *MapOf[K, V] {
+	entryCompare := func(a, b entryOf[K, V]) int {
+		return compare(a.key, b.key)
+	}
+	entryEqual := func(a, b entryOf[K, V]) bool {
+		return compare(a.key, b.key) == 0 &&
+			equal(a.value, b.value)
+	}
+	return &MapOf[K, V]{
+		root: btree.EmptyOf(entryCompare, entryEqual),
+		eq:   equal,
+	}
+}
+
+// At returns the value associated with the key.
+// If one is not found, the zero value of V is returned.
+func (m *MapOf[K, V]) At(key K) V {
+	v, _ := m.root.Find(entryOf[K, V]{key: key})
+	return v.value
+}
+
+// EntryAt returns the entry (key, value pair) of the key.
+// If one is not found, nil is returned.
+func (m *MapOf[K, V]) EntryAt(key K) EntryOf[K, V] {
+	v, ok := m.root.Find(entryOf[K, V]{key: key})
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Contains will test if the key exists in the map.
+func (m *MapOf[K, V]) Contains(key K) bool {
+	return m.root.Contains(entryOf[K, V]{key: key})
+}
+
+// Find will return the value for a key if it exists in the map and
+// whether the key exists in the map.
+func (m *MapOf[K, V]) Find(key K) (value V, exists bool) {
+	v, ok := m.root.Find(entryOf[K, V]{key: key})
+	return v.value, ok
+}
+
+// Assoc associates a value with a key in the map.
+// A new persistent map is returned if the key and value
+// are different from one already in the map, if the entry
+// is already in the map the original map is returned.
+func (m *MapOf[K, V]) Assoc(key K, value V) *MapOf[K, V] {
+	root := m.root.Add(entryOf[K, V]{key: key, value: value})
+	if root == m.root {
+		return m
+	}
+	return &MapOf[K, V]{
+		root: root,
+		eq:   m.eq,
+	}
+}
+
+// Conj takes a value that must be an EntryOf[K, V]. Conj implements
+// a generic mechanism for building collections.
+func (m *MapOf[K, V]) Conj(elem interface{}) interface{} {
+	entry := elem.(EntryOf[K, V])
+	return m.Assoc(entry.Key(), entry.Value())
+}
+
+// FromSorted returns a map with the ordering and value equality of m
+// holding entries, which must be in strictly ascending order of their
+// keys. The map is built bottom up in O(n) time. FromSorted panics if
+// the keys are out of order or repeated.
+func (m *MapOf[K, V]) FromSorted(entries []EntryOf[K, V]) *MapOf[K, V] {
+	es := make([]entryOf[K, V], len(entries))
+	for i, e := range entries {
+		es[i] = entryOf[K, V]{e.Key(), e.Value()}
+	}
+	return m.fromSorted(es)
+}
+
+func (m *MapOf[K, V]) fromSorted(entries []entryOf[K, V]) *MapOf[K, V] {
+	if !m.root.IsSorted(entries) {
+		panic(errUnsorted)
+	}
+	return &MapOf[K, V]{
+		root: m.root.FromSorted(entries),
+		eq:   m.eq,
+	}
+}
+
+// Delete removes a key and associated value from the map.
+func (m *MapOf[K, V]) Delete(key K) *MapOf[K, V] {
+	root := m.root.Delete(entryOf[K, V]{key: key})
+	if root == m.root {
+		return m
+	}
+	return &MapOf[K, V]{
+		root: root,
+		eq:   m.eq,
+	}
+}
+
+// First returns the entry with the smallest key in the map. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) First() (EntryOf[K, V], bool) {
+	return navResult(m.root.First())
+}
+
+// Last returns the entry with the largest key in the map. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) Last() (EntryOf[K, V], bool) {
+	return navResult(m.root.Last())
+}
+
+// Floor returns the entry with the greatest key less than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) Floor(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Floor(entryOf[K, V]{key: key}))
+}
+
+// Ceiling returns the entry with the least key greater than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) Ceiling(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Ceiling(entryOf[K, V]{key: key}))
+}
+
+// Lower returns the entry with the greatest key strictly less
+// than key. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) Lower(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Lower(entryOf[K, V]{key: key}))
+}
+
+// Higher returns the entry with the least key strictly greater
+// than key. The boolean is false when
+// no such entry exists.
+func (m *MapOf[K, V]) Higher(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Higher(entryOf[K, V]{key: key}))
+}
+
+// Nth returns the entry at index i in key order. The boolean is
+// false when i is out of range.
+func (m *MapOf[K, V]) Nth(i int) (EntryOf[K, V], bool) {
+	return navResult(m.root.Nth(i))
+}
+
+// Rank returns the number of keys in the map strictly less than key.
+// When key is in the map this is its index.
+func (m *MapOf[K, V]) Rank(key K) int {
+	return m.root.Rank(entryOf[K, V]{key: key})
+}
+
+// Length returns the number of entries in the map.
+func (m *MapOf[K, V]) Length() int {
+	return m.root.Length()
+}
+
+// Range calls do on each entry of the map in key order until do
+// returns false.
+func (m *MapOf[K, V]) Range(do func(key K, value V) bool) {
+	iter := m.root.Iterator()
+	for iter.HasNext() {
+		e := iter.Next()
+		if !do(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Reduce is a fast mechanism for reducing a typed map. fn is called
+// with the accumulated result and each entry of the map in key order.
+func Reduce[K, V, R any](
+	m *MapOf[K, V],
+	fn func(res R, key K, value V) R,
+	init R,
+) R {
+	res := init
+	m.Range(func(key K, value V) bool {
+		res = fn(res, key, value)
+		return true
+	})
+	return res
+}
+
+// Iterator provides a mutable iterator over the map. This allows
+// efficient, heap allocation-less access to the contents. Iterators
+// are not safe for concurrent access so they may not be shared
+// by reference between goroutines.
+func (m *MapOf[K, V]) Iterator() IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.Iterator(),
+	}
+}
+
+// Seq returns a seralized sequence of EntryOf[K, V]
+// corresponding to the maps entries.
+func (m *MapOf[K, V]) Seq() seq.Sequence {
+	return iteratorSeq(m.root.Iterator())
+}
+
+// IteratorFrom returns an iterator over the entries whose keys are
+// greater than or equal to key in ascending order.
+func (m *MapOf[K, V]) IteratorFrom(key K) IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.IteratorFrom(entryOf[K, V]{key: key}),
+	}
+}
+
+// Subrange returns an iterator over the entries whose keys are in
+// [lo, hi) in ascending order.
+func (m *MapOf[K, V]) Subrange(lo, hi K) IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.IteratorRange(
+			entryOf[K, V]{key: lo}, entryOf[K, V]{key: hi}),
+	}
+}
+
+// SliceByIndex returns an iterator over the entries with indexes in
+// [i, j) in key order. It panics if the indexes are out of range.
+func (m *MapOf[K, V]) SliceByIndex(i, j int) IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.IteratorSlice(i, j),
+	}
+}
+
+// ReverseIterator returns an iterator over the entries in descending
+// key order.
+func (m *MapOf[K, V]) ReverseIterator() IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.ReverseIterator(),
+	}
+}
+
+// IteratorBefore returns an iterator over the entries whose keys are
+// strictly less than key in descending order.
+func (m *MapOf[K, V]) IteratorBefore(key K) IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.IteratorBefore(entryOf[K, V]{key: key}),
+	}
+}
+
+// SeqFrom returns a sequence of the entries whose keys are greater
+// than or equal to key in ascending order.
+func (m *MapOf[K, V]) SeqFrom(key K) seq.Sequence {
+	return iteratorSeq(m.root.IteratorFrom(entryOf[K, V]{key: key}))
+}
+
+// SubrangeSeq returns a sequence of the entries whose keys are in
+// [lo, hi) in ascending order.
+func (m *MapOf[K, V]) SubrangeSeq(lo, hi K) seq.Sequence {
+	return iteratorSeq(m.root.IteratorRange(
+		entryOf[K, V]{key: lo}, entryOf[K, V]{key: hi}))
+}
+
+// ReverseSeq returns a sequence of the entries in descending key
+// order.
+func (m *MapOf[K, V]) ReverseSeq() seq.Sequence {
+	return iteratorSeq(m.root.ReverseIterator())
+}
+
+// SeqBefore returns a sequence of the entries whose keys are strictly
+// less than key in descending order.
+func (m *MapOf[K, V]) SeqBefore(key K) seq.Sequence {
+	return iteratorSeq(m.root.IteratorBefore(entryOf[K, V]{key: key}))
+}
+
+// String returns a string representation of the map.
+func (m *MapOf[K, V]) String() string {
+	return mapString(m.Iterator())
+}
+
+// Equal tests if two maps are Equal by comparing the entries of each.
+// Equal implements the Equaler which allows for deep
+// comparisons when there are maps of maps
+func (m *MapOf[K, V]) Equal(o interface{}) bool {
+	other, ok := o.(*MapOf[K, V])
+	if !ok {
+		return ok
+	}
+	if m.Length() != other.Length() {
+		return false
+	}
+	iter := m.Iterator()
+	for iter.HasNext() {
+		key, value := iter.Next()
+		if !m.eq(other.At(key), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows map to be called
+// as a function by the 'dyn' library.
+func (m *MapOf[K, V]) Apply(args ...interface{}) interface{} {
+	k, _ := args[0].(K)
+	return m.At(k)
+}
+
+// AsTransient will return a transient map that shares
+// structure with the persistent map.
+func (m *MapOf[K, V]) AsTransient() *TMapOf[K, V] {
+	return &TMapOf[K, V]{
+		root: m.root.AsTransient(),
+		eq:   m.eq,
+		orig: m,
+	}
+}
+
+// MakeTransient is a generic version of AsTransient.
+func (m *MapOf[K, V]) MakeTransient() interface{} {
+	return m.AsTransient()
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent map. It does this by making a transient
+// map and calling each action on it, then converting it back
+// to a persistent map.
+func (m *MapOf[K, V]) Transform(actions ...func(*TMapOf[K, V])) *MapOf[K, V] {
+	out := m.AsTransient()
+	for _, action := range actions {
+		action(out)
+	}
+	return out.AsPersistent()
+}
+
+// IteratorOf is a mutable iterator for a typed map. It has a fixed
+// size stack, the size of which is computed from the maximum number
+// of nested nodes possible based on the branching factor.
+type IteratorOf[K, V any] struct {
+	impl btree.IteratorOf[entryOf[K, V]]
+}
+
+// Next provides the next key value pair and increments the cursor.
+func (i *IteratorOf[K, V]) Next() (K, V) {
+	ent := i.impl.Next()
+	return ent.key, ent.value
+}
+
+// NextEntry provides the next entry and increments the cursor.
+func (i *IteratorOf[K, V]) NextEntry() EntryOf[K, V] {
+	return i.impl.Next()
+}
+
+// HasNext is true when there are more elements to be iterated over.
+func (i *IteratorOf[K, V]) HasNext() bool {
+	return i.impl.HasNext()
+}
+
+func navResult[K, V any](e entryOf[K, V], ok bool) (EntryOf[K, V], bool) {
+	if !ok {
+		return nil, false
+	}
+	return e, true
+}
+
+func mapString[K, V any](iter IteratorOf[K, V]) string {
+	var b strings.Builder
+	fmt.Fprint(&b, "{ ")
+	for iter.HasNext() {
+		entry := iter.impl.Next()
+		fmt.Fprintf(&b, "%s ", entry)
+	}
+	fmt.Fprint(&b, "}")
+	return b.String()
+}
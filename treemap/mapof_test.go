@@ -0,0 +1,344 @@
+package treemap
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/immutable/persist"
+)
+
+func BenchmarkMapOfAssoc(b *testing.B) {
+	b.ReportAllocs()
+	m := EmptyOf[int, int]()
+	for i := 0; i < b.N; i++ {
+		m = m.Assoc(i, i)
+	}
+}
+
+func BenchmarkTMapOfAssoc(b *testing.B) {
+	b.ReportAllocs()
+	m := EmptyOf[int, int]().AsTransient()
+	for i := 0; i < b.N; i++ {
+		m.Assoc(i, i)
+	}
+	m.AsPersistent()
+}
+
+func TestMapOf(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Assoc then At returns value", prop.ForAll(
+		func(native map[string]int, k string, v int) bool {
+			m := EmptyOf[string, int]()
+			for key, val := range native {
+				m = m.Assoc(key, val)
+			}
+			m = m.Assoc(k, v)
+			got, ok := m.Find(k)
+			return ok && got == v && m.At(k) == v && m.Contains(k)
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+		gen.AlphaString(),
+		gen.Int(),
+	))
+	properties.Property("Range visits keys in order", prop.ForAll(
+		func(native map[int]int) bool {
+			m := EmptyOf[int, int]()
+			for key, val := range native {
+				m = m.Assoc(key, val)
+			}
+			keys := make([]int, 0, len(native))
+			for key := range native {
+				keys = append(keys, key)
+			}
+			sort.Ints(keys)
+			i := 0
+			ok := true
+			m.Range(func(k, v int) bool {
+				ok = ok && keys[i] == k && native[k] == v
+				i++
+				return true
+			})
+			return ok && i == len(keys) && m.Length() == len(keys)
+		},
+		gen.MapOf(gen.Int(), gen.Int()),
+	))
+	properties.Property("Delete removes key", prop.ForAll(
+		func(native map[int]int) bool {
+			m := EmptyOf[int, int]()
+			for key, val := range native {
+				m = m.Assoc(key, val)
+			}
+			for key := range native {
+				m = m.Delete(key)
+				if m.Contains(key) {
+					return false
+				}
+			}
+			return m.Length() == 0
+		},
+		gen.MapOf(gen.Int(), gen.Int()),
+	))
+	properties.Property("transient and persistent agree", prop.ForAll(
+		func(native map[string]int) bool {
+			p := EmptyOf[string, int]()
+			tr := EmptyOf[string, int]().AsTransient()
+			for k, v := range native {
+				p = p.Assoc(k, v)
+				tr = tr.Assoc(k, v)
+			}
+			return p.Equal(tr.AsPersistent())
+		},
+		gen.MapOf(gen.AlphaString(), gen.Int()),
+	))
+	properties.Property("Reduce sums values", prop.ForAll(
+		func(native map[int]int) bool {
+			m := EmptyOf[int, int]()
+			exp := 0
+			for k, v := range native {
+				m = m.Assoc(k, v)
+				exp += v
+			}
+			got := Reduce(m, func(res, _, v int) int {
+				return res + v
+			}, 0)
+			return got == exp
+		},
+		gen.MapOf(gen.Int(), gen.IntRange(-1000, 1000)),
+	))
+	properties.TestingRun(t)
+}
+
+func TestMapOfCompareFunc(t *testing.T) {
+	m := EmptyOfFunc[string, int](func(k1, k2 string) int {
+		return strings.Compare(strings.ToLower(k1), strings.ToLower(k2))
+	})
+	m = m.Assoc("b", 1).Assoc("A", 2).Assoc("a", 3)
+	if m.Length() != 2 {
+		t.Fatalf("expected keys to fold case, got %s", m)
+	}
+	if m.String() != "{ [a 3] [b 1] }" {
+		t.Fatalf("unexpected map %s", m)
+	}
+	if m.At("B") != 1 {
+		t.Fatal("expected case insensitive lookup")
+	}
+}
+
+func TestMapOfFromSorted(t *testing.T) {
+	entries := make([]EntryOf[string, int], 1000)
+	for i := range entries {
+		entries[i] = EntryOfNew(fmt.Sprintf("%04d", i), i)
+	}
+	m := EmptyOf[string, int]().FromSorted(entries)
+	if m.Length() != len(entries) || m.At("0500") != 500 {
+		t.Fatalf("unexpected map %s", m)
+	}
+	folded := EmptyOfFunc[string, int](func(k1, k2 string) int {
+		return strings.Compare(strings.ToLower(k1), strings.ToLower(k2))
+	})
+	m = folded.FromSorted([]EntryOf[string, int]{
+		EntryOfNew("a", 1), EntryOfNew("B", 2),
+	})
+	if m.At("b") != 2 {
+		t.Fatal("expected the ordering of the receiver")
+	}
+	defer func() {
+		if r := recover(); r != errUnsorted {
+			t.Fatal("expected panic", r)
+		}
+	}()
+	folded.FromSorted([]EntryOf[string, int]{
+		EntryOfNew("a", 1), EntryOfNew("A", 2),
+	})
+}
+
+func TestMapOfIterator(t *testing.T) {
+	m := EmptyOf[int, string]().Assoc(2, "b").Assoc(1, "a")
+	iter := m.Iterator()
+	k, v := iter.Next()
+	if k != 1 || v != "a" {
+		t.Fatalf("expected first entry [1 a], got [%v %v]", k, v)
+	}
+	e := iter.NextEntry()
+	if e.Key() != 2 || e.Value() != "b" {
+		t.Fatalf("expected second entry [2 b], got %v", e)
+	}
+	if iter.HasNext() {
+		t.Fatal("expected iterator to be exhausted")
+	}
+}
+
+func TestMapOfNavigation(t *testing.T) {
+	properties := gopter.NewProperties(gopter.DefaultTestParameters())
+	properties.Property("Floor and Higher agree with a linear scan", prop.ForAll(
+		func(native map[int]int, k int) bool {
+			m := EmptyOf[int, int]()
+			for key, val := range native {
+				m = m.Assoc(key, val)
+			}
+			floor, hasFloor := 0, false
+			higher, hasHigher := 0, false
+			for key := range native {
+				if key <= k && (!hasFloor || key > floor) {
+					floor, hasFloor = key, true
+				}
+				if key > k && (!hasHigher || key < higher) {
+					higher, hasHigher = key, true
+				}
+			}
+			fe, fok := m.Floor(k)
+			he, hok := m.Higher(k)
+			return fok == hasFloor && hok == hasHigher &&
+				(!fok || (fe.Key() == floor && fe.Value() == native[floor])) &&
+				(!hok || (he.Key() == higher && he.Value() == native[higher]))
+		},
+		gen.MapOf(gen.IntRange(-500, 500), gen.Int()),
+		gen.IntRange(-600, 600),
+	))
+	properties.TestingRun(t)
+}
+
+func TestMapOfOrderStatistics(t *testing.T) {
+	properties := gopter.NewProperties(gopter.DefaultTestParameters())
+	properties.Property("Nth and Rank agree with sorted keys", prop.ForAll(
+		func(native map[int]int) bool {
+			m := EmptyOf[int, int]()
+			keys := make([]int, 0, len(native))
+			for key, val := range native {
+				m = m.Assoc(key, val)
+				keys = append(keys, key)
+			}
+			sort.Ints(keys)
+			for i, key := range keys {
+				e, ok := m.Nth(i)
+				if !ok || e.Key() != key || m.Rank(key) != i {
+					return false
+				}
+			}
+			_, ok := m.Nth(len(keys))
+			return !ok
+		},
+		gen.MapOf(gen.Int(), gen.Int()),
+	))
+	properties.TestingRun(t)
+}
+
+func TestMapOfPersist(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	r := persist.NewReader(store)
+	fold := EmptyOfFunc[string, int](func(k1, k2 string) int {
+		return strings.Compare(strings.ToLower(k1), strings.ToLower(k2))
+	})
+	m := fold.Transform(func(t *TMapOf[string, int]) {
+		for i := 0; i < 1000; i++ {
+			t.Assoc(strconv.Itoa(i)+"x", i)
+		}
+	})
+	versions := []*MapOf[string, int]{m}
+	for i := 0; i < 10; i++ {
+		m = m.Assoc(strconv.Itoa(i*37)+"X", -i)
+		versions = append(versions, m)
+	}
+	for i, v := range versions {
+		h, err := v.Persist(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fold.Load(r, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(v) {
+			t.Fatalf("version %d did not round trip", i)
+		}
+		if got.At("7X") != 7 {
+			t.Fatal("expected the loaded map to fold case")
+		}
+	}
+
+	untyped := New("a", 1, "b", 2)
+	h, err := untyped.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Empty().Load(r, h)
+	if err != nil || !got.Equal(untyped) {
+		t.Fatalf("got %v, %v expected %v", got, err, untyped)
+	}
+}
+
+func TestMapOfLoadPaged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	store, err := persist.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := EmptyOf[int, string]().Transform(func(t *TMapOf[int, string]) {
+		for i := 0; i < 50000; i++ {
+			t.Assoc(i, strconv.Itoa(i))
+		}
+	})
+	h, err := m.Persist(persist.NewWriter(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = persist.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	pager := NewPagerOf[int, string](store, 16)
+	paged, err := EmptyOf[int, string]().LoadPaged(pager, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paged.Length() != m.Length() || pager.Cached() != 0 {
+		t.Fatalf("expected %d entries without reading leaves, got %d with %d leaves",
+			m.Length(), paged.Length(), pager.Cached())
+	}
+	for i := 0; i < 50000; i += 997 {
+		if got := paged.At(i); got != strconv.Itoa(i) {
+			t.Fatalf("At(%d) = %q", i, got)
+		}
+	}
+	if !paged.Equal(m) {
+		t.Fatal("expected the paged map to equal the original")
+	}
+	if pager.Cached() > 16 {
+		t.Fatalf("pager holds %d leaves", pager.Cached())
+	}
+
+	next := paged.Assoc(-1, "new").Delete(25000)
+	h, err = next.Persist(persist.NewWriter(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EmptyOf[int, string]().LoadPaged(pager, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.At(-1) != "new" || got.Contains(25000) || got.Length() != 50000 {
+		t.Fatalf("unexpected reloaded map of %d entries", got.Length())
+	}
+
+	untyped := New(1, "one", 2, "two")
+	h, err = untyped.Persist(persist.NewWriter(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Empty().LoadPaged(NewPager(store, 1), h)
+	if err != nil || !loaded.Equal(untyped) {
+		t.Fatalf("got %v, %v expected %v", loaded, err, untyped)
+	}
+}
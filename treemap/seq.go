@@ -5,21 +5,28 @@ import (
 	"jsouthworth.net/go/seq"
 )
 
-type sequence struct {
-	iter btree.Iterator
+type sequence[E any] struct {
+	iter btree.IteratorOf[E]
 }
 
-func sequenceNew(iter btree.Iterator) *sequence {
-	return &sequence{
+func sequenceNew[E any](iter btree.IteratorOf[E]) *sequence[E] {
+	return &sequence[E]{
 		iter: iter,
 	}
 }
 
-func (s *sequence) First() interface{} {
+func iteratorSeq[E any](iter btree.IteratorOf[E]) seq.Sequence {
+	if !iter.HasNext() {
+		return nil
+	}
+	return sequenceNew(iter)
+}
+
+func (s *sequence[E]) First() interface{} {
 	return s.iter.Next()
 }
 
-func (s *sequence) Next() seq.Sequence {
+func (s *sequence[E]) Next() seq.Sequence {
 	new := &(*s)
 	hasNext := new.iter.HasNext()
 	if !hasNext {
@@ -28,6 +35,6 @@ func (s *sequence) Next() seq.Sequence {
 	return new
 }
 
-func (s *sequence) String() string {
+func (s *sequence[E]) String() string {
 	return seq.ConvertToString(s)
 }
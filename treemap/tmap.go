@@ -1,12 +1,5 @@
 package treemap
 
-import (
-	"fmt"
-	"strings"
-
-	"jsouthworth.net/go/immutable/internal/btree"
-)
-
 // TMap is a transient version of a map. Changes made to a transient
 // map will not effect the original persistent structure. Changes to a
 // transient map occur as mutations. These mutations are then made
@@ -14,22 +7,12 @@ import (
 // structure. These are useful when appling multiple transforms to a
 // persistent map where the intermediate results will not be seen or
 // stored anywhere.
-type TMap struct {
-	root *btree.TBTree
-	eq   eqFunc
-
-	orig *Map
-}
+type TMap TMapOf[interface{}, interface{}]
 
 // At returns the value associated with the key.
 // If one is not found, nil is returned.
 func (m *TMap) At(key interface{}) interface{} {
-	v, ok := m.root.Find(entry{key: key})
-	if !ok {
-		return nil
-	}
-	ent := v.(entry)
-	return ent.value
+	return m.typed().At(key)
 }
 
 // EntryAt returns the entry (key, value pair) of the key.
@@ -39,14 +22,13 @@ func (m *TMap) EntryAt(key interface{}) Entry {
 	if !ok {
 		return nil
 	}
-	ent := v.(entry)
-	return ent
+	return v
 }
 
 // Assoc associates a value with a key in the map.
 // The transient map is modified and then returned.
 func (m *TMap) Assoc(key, value interface{}) *TMap {
-	m.root = m.root.Add(entry{key: key, value: value})
+	m.typed().Assoc(key, value)
 	return m
 }
 
@@ -60,14 +42,7 @@ func (m *TMap) Conj(value interface{}) interface{} {
 // AsPersistent will transform this transient map into a persistent map.
 // Once this occurs any additional actions on the transient map will fail.
 func (m *TMap) AsPersistent() *Map {
-	newRoot := m.root.AsPersistent()
-	if newRoot == m.orig.root {
-		return m.orig
-	}
-	return &Map{
-		root: newRoot,
-		eq:   m.eq,
-	}
+	return (*Map)(m.typed().AsPersistent())
 }
 
 // MakePersistent is a generic version of AsPersistent.
@@ -77,24 +52,19 @@ func (m *TMap) MakePersistent() interface{} {
 
 // Contains will test if the key exists in the map.
 func (m *TMap) Contains(key interface{}) bool {
-	return m.root.Contains(entry{key: key})
+	return m.typed().Contains(key)
 }
 
 // Find will return the value for a key if it exists in the map and
 // whether the key exists in the map. For non-nil values, exists will
 // always be true.
 func (m *TMap) Find(key interface{}) (value interface{}, exists bool) {
-	v, ok := m.root.Find(entry{key: key})
-	if !ok {
-		return nil, ok
-	}
-	ent := v.(entry)
-	return ent.value, ok
+	return m.typed().Find(key)
 }
 
 // Delete removes a key and associated value from the map.
 func (m *TMap) Delete(key interface{}) *TMap {
-	m.root = m.root.Delete(entry{key: key})
+	m.typed().Delete(key)
 	return m
 }
 
@@ -106,17 +76,59 @@ func (m *TMap) Equal(o interface{}) bool {
 	if !ok {
 		return ok
 	}
-	if m.Length() != other.Length() {
-		return false
-	}
-	iter := m.Iterator()
-	for iter.HasNext() {
-		key, value := iter.Next()
-		if !m.eq(other.At(key), value) {
-			return false
-		}
-	}
-	return true
+	return m.typed().Equal(other.typed())
+}
+
+// First returns the entry with the smallest key in the map. The boolean is false when
+// no such entry exists.
+func (m *TMap) First() (Entry, bool) {
+	return m.typed().First()
+}
+
+// Last returns the entry with the largest key in the map. The boolean is false when
+// no such entry exists.
+func (m *TMap) Last() (Entry, bool) {
+	return m.typed().Last()
+}
+
+// Floor returns the entry with the greatest key less than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *TMap) Floor(key interface{}) (Entry, bool) {
+	return m.typed().Floor(key)
+}
+
+// Ceiling returns the entry with the least key greater than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *TMap) Ceiling(key interface{}) (Entry, bool) {
+	return m.typed().Ceiling(key)
+}
+
+// Lower returns the entry with the greatest key strictly less
+// than key. The boolean is false when
+// no such entry exists.
+func (m *TMap) Lower(key interface{}) (Entry, bool) {
+	return m.typed().Lower(key)
+}
+
+// Higher returns the entry with the least key strictly greater
+// than key. The boolean is false when
+// no such entry exists.
+func (m *TMap) Higher(key interface{}) (Entry, bool) {
+	return m.typed().Higher(key)
+}
+
+// Nth returns the entry at index i in key order. The boolean is
+// false when i is out of range.
+func (m *TMap) Nth(i int) (Entry, bool) {
+	return m.typed().Nth(i)
+}
+
+// Rank returns the number of keys in the map strictly less than key.
+// When key is in the map this is its index.
+func (m *TMap) Rank(key interface{}) int {
+	return m.typed().Rank(key)
 }
 
 // Length returns the number of entries in the map.
@@ -181,11 +193,10 @@ func (m *TMap) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 
-	iter := m.Iterator()
+	iter := m.root.Iterator()
 	cont := true
 	for iter.HasNext() && cont {
-		entry := iter.NextEntry().(entry)
-		cont = f(entry)
+		cont = f(iter.Next())
 	}
 }
 
@@ -218,25 +229,16 @@ func (m *TMap) Reduce(fn interface{}, init interface{}) interface{} {
 		rFn = genReduceFunc(fn)
 	}
 	res := init
-	iter := m.Iterator()
+	iter := m.root.Iterator()
 	for iter.HasNext() {
-		entry := iter.NextEntry()
-		res = rFn(res, entry)
+		res = rFn(res, iter.Next())
 	}
 	return res
 }
 
 // String returns a string representation of the map.
 func (m *TMap) String() string {
-	var b strings.Builder
-	fmt.Fprint(&b, "{ ")
-	iter := m.Iterator()
-	for iter.HasNext() {
-		entry := iter.NextEntry()
-		fmt.Fprintf(&b, "%s ", entry)
-	}
-	fmt.Fprint(&b, "}")
-	return b.String()
+	return m.typed().String()
 }
 
 // Iterator provides a mutable iterator over the map. This allows
@@ -244,7 +246,9 @@ func (m *TMap) String() string {
 // are not safe for concurrent access so they may not be shared
 // by reference between goroutines.
 func (m *TMap) Iterator() Iterator {
-	return Iterator{
-		impl: m.root.Iterator(),
-	}
+	return Iterator(m.typed().Iterator())
+}
+
+func (m *TMap) typed() *TMapOf[interface{}, interface{}] {
+	return (*TMapOf[interface{}, interface{}])(m)
 }
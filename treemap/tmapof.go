@@ -0,0 +1,197 @@
+package treemap
+
+import (
+	"jsouthworth.net/go/immutable/internal/btree"
+)
+
+// TMapOf is a transient version of a typed map. Changes made to a
+// transient map will not effect the original persistent
+// structure. Changes to a transient map occur as mutations. These
+// mutations are then made persistent when the transient is
+// transformed into a persistent structure.
+type TMapOf[K, V any] struct {
+	root *btree.TTreeOf[entryOf[K, V]]
+	eq   func(v1, v2 V) bool
+
+	orig *MapOf[K, V]
+}
+
+// At returns the value associated with the key.
+// If one is not found, the zero value of V is returned.
+func (m *TMapOf[K, V]) At(key K) V {
+	v, _ := m.root.Find(entryOf[K, V]{key: key})
+	return v.value
+}
+
+// EntryAt returns the entry (key, value pair) of the key.
+// If one is not found, nil is returned.
+func (m *TMapOf[K, V]) EntryAt(key K) EntryOf[K, V] {
+	v, ok := m.root.Find(entryOf[K, V]{key: key})
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Assoc associates a value with a key in the map.
+// The transient map is modified and then returned.
+func (m *TMapOf[K, V]) Assoc(key K, value V) *TMapOf[K, V] {
+	m.root = m.root.Add(entryOf[K, V]{key: key, value: value})
+	return m
+}
+
+// Conj takes a value that must be an EntryOf[K, V]. Conj implements
+// a generic mechanism for building collections.
+func (m *TMapOf[K, V]) Conj(value interface{}) interface{} {
+	entry := value.(EntryOf[K, V])
+	return m.Assoc(entry.Key(), entry.Value())
+}
+
+// AsPersistent will transform this transient map into a persistent map.
+// Once this occurs any additional actions on the transient map will fail.
+func (m *TMapOf[K, V]) AsPersistent() *MapOf[K, V] {
+	newRoot := m.root.AsPersistent()
+	if newRoot == m.orig.root {
+		return m.orig
+	}
+	return &MapOf[K, V]{
+		root: newRoot,
+		eq:   m.eq,
+	}
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (m *TMapOf[K, V]) MakePersistent() interface{} {
+	return m.AsPersistent()
+}
+
+// Contains will test if the key exists in the map.
+func (m *TMapOf[K, V]) Contains(key K) bool {
+	return m.root.Contains(entryOf[K, V]{key: key})
+}
+
+// Find will return the value for a key if it exists in the map and
+// whether the key exists in the map.
+func (m *TMapOf[K, V]) Find(key K) (value V, exists bool) {
+	v, ok := m.root.Find(entryOf[K, V]{key: key})
+	return v.value, ok
+}
+
+// Delete removes a key and associated value from the map.
+func (m *TMapOf[K, V]) Delete(key K) *TMapOf[K, V] {
+	m.root = m.root.Delete(entryOf[K, V]{key: key})
+	return m
+}
+
+// Equal tests if two maps are Equal by comparing the entries of each.
+// Equal implements the Equaler which allows for deep
+// comparisons when there are maps of maps
+func (m *TMapOf[K, V]) Equal(o interface{}) bool {
+	other, ok := o.(*TMapOf[K, V])
+	if !ok {
+		return ok
+	}
+	if m.Length() != other.Length() {
+		return false
+	}
+	iter := m.Iterator()
+	for iter.HasNext() {
+		key, value := iter.Next()
+		if !m.eq(other.At(key), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// First returns the entry with the smallest key in the map. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) First() (EntryOf[K, V], bool) {
+	return navResult(m.root.First())
+}
+
+// Last returns the entry with the largest key in the map. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) Last() (EntryOf[K, V], bool) {
+	return navResult(m.root.Last())
+}
+
+// Floor returns the entry with the greatest key less than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) Floor(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Floor(entryOf[K, V]{key: key}))
+}
+
+// Ceiling returns the entry with the least key greater than or
+// equal to key. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) Ceiling(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Ceiling(entryOf[K, V]{key: key}))
+}
+
+// Lower returns the entry with the greatest key strictly less
+// than key. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) Lower(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Lower(entryOf[K, V]{key: key}))
+}
+
+// Higher returns the entry with the least key strictly greater
+// than key. The boolean is false when
+// no such entry exists.
+func (m *TMapOf[K, V]) Higher(key K) (EntryOf[K, V], bool) {
+	return navResult(m.root.Higher(entryOf[K, V]{key: key}))
+}
+
+// Nth returns the entry at index i in key order. The boolean is
+// false when i is out of range.
+func (m *TMapOf[K, V]) Nth(i int) (EntryOf[K, V], bool) {
+	return navResult(m.root.Nth(i))
+}
+
+// Rank returns the number of keys in the map strictly less than key.
+// When key is in the map this is its index.
+func (m *TMapOf[K, V]) Rank(key K) int {
+	return m.root.Rank(entryOf[K, V]{key: key})
+}
+
+// Length returns the number of entries in the map.
+func (m *TMapOf[K, V]) Length() int {
+	return m.root.Length()
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows map to be called
+// as a function by the 'dyn' library.
+func (m *TMapOf[K, V]) Apply(args ...interface{}) interface{} {
+	k, _ := args[0].(K)
+	return m.At(k)
+}
+
+// Range calls do on each entry of the map in key order until do
+// returns false.
+func (m *TMapOf[K, V]) Range(do func(key K, value V) bool) {
+	iter := m.root.Iterator()
+	for iter.HasNext() {
+		e := iter.Next()
+		if !do(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// String returns a string representation of the map.
+func (m *TMapOf[K, V]) String() string {
+	return mapString(m.Iterator())
+}
+
+// Iterator provides a mutable iterator over the map. This allows
+// efficient, heap allocation-less access to the contents. Iterators
+// are not safe for concurrent access so they may not be shared
+// by reference between goroutines.
+func (m *TMapOf[K, V]) Iterator() IteratorOf[K, V] {
+	return IteratorOf[K, V]{
+		impl: m.root.Iterator(),
+	}
+}
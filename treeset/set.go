@@ -6,17 +6,23 @@
 package treeset // import "jsouthworth.net/go/immutable/treeset"
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
 	"jsouthworth.net/go/immutable/internal/btree"
+	"jsouthworth.net/go/immutable/persist"
 	"jsouthworth.net/go/seq"
 )
 
 var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
+var errCompareMismatch = errors.New("set operation on sets with different Compare options")
+var errUnsorted = errors.New("FromSorted requires elements in strictly ascending order")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty set")
 
 // Set is a persistent ordered set implementation.
 type Set struct {
@@ -35,9 +41,12 @@ func defaultEqual(a, b interface{}) bool {
 	return dyn.Compare(a, b) == 0
 }
 
+// defaultOrder orders the sets made without a Compare option.
+var defaultOrder = btree.Compare(defaultCompare)
+
 var empty = Set{
 	root: btree.Empty(
-		btree.Compare(defaultCompare),
+		defaultOrder,
 		btree.Equal(defaultEqual),
 	),
 	eq: defaultEqual,
@@ -45,6 +54,7 @@ var empty = Set{
 
 type setOptions struct {
 	compare cmpFunc
+	order   btree.Option
 }
 
 // Option is a type that allows changes to pluggable parts of the
@@ -54,10 +64,14 @@ type Option func(*setOptions)
 // Compare is an option to the Empty function that will allow
 // one to specify a different comparison operator instead
 // of the default which is from the dyn library. This is used
-// for keys.
+// for keys. Union, Intersection and Difference only combine sets
+// built from the same Compare option, so keep the option around and
+// reuse it for sets that are to be combined.
 func Compare(cmp func(k1, k2 interface{}) int) Option {
+	order := btree.Compare(cmp)
 	return func(o *setOptions) {
 		o.compare = cmp
+		o.order = order
 	}
 }
 
@@ -71,6 +85,7 @@ func Empty(options ...Option) *Set {
 
 	opts := setOptions{
 		compare: defaultCompare,
+		order:   defaultOrder,
 	}
 	for _, opt := range options {
 		opt(&opts)
@@ -82,7 +97,7 @@ func Empty(options ...Option) *Set {
 
 	return &Set{
 		root: btree.Empty(
-			btree.Compare(opts.compare),
+			opts.order,
 			btree.Equal(eq),
 		),
 		eq: eq,
@@ -149,6 +164,24 @@ func From(value interface{}, options ...Option) *Set {
 	}
 }
 
+// FromSorted returns a set holding elems, which must be in strictly
+// ascending order by the set's Compare option. The set is built
+// bottom up in O(n) time rather than by adding each element in turn.
+// FromSorted panics if the elements are out of order or repeated.
+func FromSorted(elems []interface{}, options ...Option) *Set {
+	out := Empty(options...)
+	if len(elems) == 0 {
+		return out
+	}
+	if !out.root.IsSorted(elems) {
+		panic(errUnsorted)
+	}
+	return &Set{
+		root: out.root.FromSorted(elems),
+		eq:   out.eq,
+	}
+}
+
 func setFromSequence(coll seq.Sequence, options ...Option) *Set {
 	if coll == nil {
 		return Empty(options...)
@@ -220,6 +253,44 @@ func (s *Set) Find(elem interface{}) (interface{}, bool) {
 	return s.root.Find(elem)
 }
 
+// First returns the smallest element in the set. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) First() (interface{}, bool) {
+	return s.root.First()
+}
+
+// Last returns the largest element in the set. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) Last() (interface{}, bool) {
+	return s.root.Last()
+}
+
+// Floor returns the greatest element less than or equal to
+// elem. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) Floor(elem interface{}) (interface{}, bool) {
+	return s.root.Floor(elem)
+}
+
+// Ceiling returns the least element greater than or equal to
+// elem. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) Ceiling(elem interface{}) (interface{}, bool) {
+	return s.root.Ceiling(elem)
+}
+
+// Lower returns the greatest element strictly less than elem. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) Lower(elem interface{}) (interface{}, bool) {
+	return s.root.Lower(elem)
+}
+
+// Higher returns the least element strictly greater than elem. If there is no such element,
+// (nil, false) is returned.
+func (s *Set) Higher(elem interface{}) (interface{}, bool) {
+	return s.root.Higher(elem)
+}
+
 // Delete removes an element from the set returning a new Set without
 // the element.
 func (s *Set) Delete(elem interface{}) *Set {
@@ -233,6 +304,45 @@ func (s *Set) Delete(elem interface{}) *Set {
 	}
 }
 
+// Union returns a set containing the elements of both sets. Elements
+// found in both are taken from s. The sets are merged in sorted order
+// and the result keeps the ordering of s. Union panics if the sets
+// weren't built from the same Compare option.
+func (s *Set) Union(other *Set) *Set {
+	return s.withRoot(s.checkOrder(other).Union(other.root))
+}
+
+// Intersection returns a set containing the elements of s that are
+// also in other. Intersection panics if the sets weren't built
+// from the same Compare option.
+func (s *Set) Intersection(other *Set) *Set {
+	return s.withRoot(s.checkOrder(other).Intersection(other.root))
+}
+
+// Difference returns a set containing the elements of s that are not
+// in other. Difference panics if the sets weren't built from the
+// same Compare option.
+func (s *Set) Difference(other *Set) *Set {
+	return s.withRoot(s.checkOrder(other).Difference(other.root))
+}
+
+func (s *Set) checkOrder(other *Set) *btree.BTree {
+	if !s.root.SameOrder(other.root) {
+		panic(errCompareMismatch)
+	}
+	return s.root
+}
+
+func (s *Set) withRoot(root *btree.BTree) *Set {
+	if root == s.root {
+		return s
+	}
+	return &Set{
+		root: root,
+		eq:   s.eq,
+	}
+}
+
 // Range calls the passed in function on each element of the set.
 // The function passed in may be of many types:
 //
@@ -293,6 +403,116 @@ func (s *Set) Range(do interface{}) {
 	}
 }
 
+// Nth returns the element at index i in ascending order. If i is out
+// of range, (nil, false) is returned.
+func (s *Set) Nth(i int) (interface{}, bool) {
+	return s.root.Nth(i)
+}
+
+// Rank returns the number of elements in the set strictly less than
+// elem. When elem is in the set this is its index.
+func (s *Set) Rank(elem interface{}) int {
+	return s.root.Rank(elem)
+}
+
+// MarshalJSON implements json.Marshaler encoding the set as a JSON
+// array in ascending order.
+func (s *Set) MarshalJSON() ([]byte, error) {
+	elems := make([]interface{}, 0, s.Length())
+	s.Range(func(elem interface{}) {
+		elems = append(elems, elem)
+	})
+	return json.Marshal(elems)
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array
+// into the set. A set created with a Compare option keeps it; the
+// zero Set uses the default ordering. The set returned by Empty
+// without options is shared and may not be decoded into.
+func (s *Set) UnmarshalJSON(data []byte) error {
+	if s == &empty {
+		return errUnmarshalEmpty
+	}
+	var elems []interface{}
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*s = *s.cleared().Transform(func(t *TSet) {
+		for _, elem := range elems {
+			t.Add(elem)
+		}
+	})
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format in ascending order. Elements are encoded with gob unless
+// they implement encoding.BinaryMarshaler, so their concrete types
+// must be registered with gob.Register.
+func (s *Set) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.TreeSet, s.Length(),
+		func(fn func(interface{}) bool) {
+			s.Range(fn)
+		})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. Like UnmarshalJSON, a set created
+// with a Compare option keeps it and the set returned by Empty
+// without options may not be decoded into.
+func (s *Set) UnmarshalBinary(data []byte) error {
+	if s == &empty {
+		return errUnmarshalEmpty
+	}
+	out := s.cleared().AsTransient()
+	err := binenc.UnmarshalSeq(data, binenc.TreeSet, func(elem interface{}) {
+		out.Add(elem)
+	})
+	if err != nil {
+		return err
+	}
+	*s = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (s *Set) GobEncode() ([]byte, error) {
+	return s.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (s *Set) GobDecode(data []byte) error {
+	return s.UnmarshalBinary(data)
+}
+
+// Persist writes the set to w and returns the hash of its root. Nodes
+// shared with versions previously written by w are not written
+// again. Elements are encoded as by MarshalBinary.
+func (s *Set) Persist(w *persist.Writer) (persist.Hash, error) {
+	return s.root.Persist(w, binenc.Encode[interface{}])
+}
+
+// Load reads the set whose root hash was returned by Persist. The set
+// is ordered like s, which must have the order the set was written
+// with. Nodes are read as they are first used and nodes already read
+// by r are shared with the sets it returned before.
+func (s *Set) Load(r *persist.Reader, h persist.Hash) (*Set, error) {
+	c := s.cleared()
+	root, err := c.root.Load(r, h, binenc.Decode[interface{}])
+	if err != nil {
+		return nil, err
+	}
+	return &Set{root: root, eq: c.eq}, nil
+}
+
+// cleared returns an empty set with the same order as s.
+func (s *Set) cleared() *Set {
+	if s.root == nil {
+		return Empty()
+	}
+	return &Set{root: s.root.FromSorted(nil), eq: s.eq}
+}
+
 // Length returns the elements in the set.
 func (s *Set) Length() int {
 	return s.root.Length()
@@ -322,11 +542,30 @@ func (s *Set) Apply(args ...interface{}) interface{} {
 // Seq returns a seralized sequence of interface{}
 // corresponding to the sets entries.
 func (s *Set) Seq() seq.Sequence {
-	iter := s.root.Iterator()
-	if !iter.HasNext() {
-		return nil
-	}
-	return sequenceNew(iter)
+	return iteratorSeq(s.root.Iterator())
+}
+
+// SeqFrom returns a sequence of the elements greater than or equal
+// to elem in ascending order.
+func (s *Set) SeqFrom(elem interface{}) seq.Sequence {
+	return iteratorSeq(s.root.IteratorFrom(elem))
+}
+
+// SubrangeSeq returns a sequence of the elements in [lo, hi) in
+// ascending order.
+func (s *Set) SubrangeSeq(lo, hi interface{}) seq.Sequence {
+	return iteratorSeq(s.root.IteratorRange(lo, hi))
+}
+
+// ReverseSeq returns a sequence of the elements in descending order.
+func (s *Set) ReverseSeq() seq.Sequence {
+	return iteratorSeq(s.root.ReverseIterator())
+}
+
+// SeqBefore returns a sequence of the elements strictly less than
+// elem in descending order.
+func (s *Set) SeqBefore(elem interface{}) seq.Sequence {
+	return iteratorSeq(s.root.IteratorBefore(elem))
 }
 
 // Equal tests if two sets are Equal by comparing the entries of each.
@@ -360,6 +599,47 @@ func (s *Set) Iterator() Iterator {
 	}
 }
 
+// IteratorFrom returns an iterator over the elements greater than or
+// equal to elem in ascending order.
+func (s *Set) IteratorFrom(elem interface{}) Iterator {
+	return Iterator{
+		impl: s.root.IteratorFrom(elem),
+	}
+}
+
+// Subrange returns an iterator over the elements in [lo, hi) in
+// ascending order.
+func (s *Set) Subrange(lo, hi interface{}) Iterator {
+	return Iterator{
+		impl: s.root.IteratorRange(lo, hi),
+	}
+}
+
+// SliceByIndex returns an iterator over the elements with indexes in
+// [i, j) in ascending order. It panics if the indexes are out of
+// range.
+func (s *Set) SliceByIndex(i, j int) Iterator {
+	return Iterator{
+		impl: s.root.IteratorSlice(i, j),
+	}
+}
+
+// ReverseIterator returns an iterator over the elements in
+// descending order.
+func (s *Set) ReverseIterator() Iterator {
+	return Iterator{
+		impl: s.root.ReverseIterator(),
+	}
+}
+
+// IteratorBefore returns an iterator over the elements strictly less
+// than elem in descending order.
+func (s *Set) IteratorBefore(elem interface{}) Iterator {
+	return Iterator{
+		impl: s.root.IteratorBefore(elem),
+	}
+}
+
 // AsTransient will return a transient map that shares
 // structure with the persistent set.
 func (s *Set) AsTransient() *TSet {
@@ -414,6 +694,13 @@ func sequenceNew(iter btree.Iterator) *sequence {
 	}
 }
 
+func iteratorSeq(iter btree.Iterator) seq.Sequence {
+	if !iter.HasNext() {
+		return nil
+	}
+	return sequenceNew(iter)
+}
+
 func (s *sequence) First() interface{} {
 	return s.iter.Next()
 }
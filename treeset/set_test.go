@@ -1,6 +1,9 @@
 package treeset
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
@@ -9,6 +12,7 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/persist"
 	"jsouthworth.net/go/immutable/vector"
 	"jsouthworth.net/go/seq"
 )
@@ -431,6 +435,37 @@ func TestFrom(t *testing.T) {
 	properties.TestingRun(t)
 }
 
+func TestFromSorted(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("FromSorted matches Add",
+		prop.ForAll(
+			func(n int) bool {
+				elems := make([]interface{}, n)
+				for i := range elems {
+					elems[i] = i * 2
+				}
+				s := FromSorted(elems)
+				return s.Length() == n && s.Equal(From(elems)) &&
+					!s.Contains(1) && s.Add(1).Contains(1)
+			},
+			gen.IntRange(0, 20000),
+		))
+	properties.TestingRun(t)
+	desc := Compare(func(k1, k2 interface{}) int {
+		return k2.(int) - k1.(int)
+	})
+	if s := FromSorted([]interface{}{3, 2, 1}, desc); s.String() != "{ 3 2 1 }" {
+		t.Fatal("didn't keep the Compare option", s)
+	}
+	defer func() {
+		if r := recover(); r != errUnsorted {
+			t.Fatal("expected panic", r)
+		}
+	}()
+	FromSorted([]interface{}{1, 3, 2})
+}
+
 func TestApply(t *testing.T) {
 	parameters := gopter.DefaultTestParameters()
 	properties := gopter.NewProperties(parameters)
@@ -556,3 +591,373 @@ func TestCustomComparator(t *testing.T) {
 		t.Fatal("Sets should not have been equal")
 	}
 }
+
+func TestRangeIterators(t *testing.T) {
+	s := Empty().Transform(func(t *TSet) {
+		for i := 0; i < 1000; i++ {
+			t.Add(i)
+		}
+	})
+	collect := func(iter Iterator) []interface{} {
+		var out []interface{}
+		for iter.HasNext() {
+			out = append(out, iter.Next())
+		}
+		return out
+	}
+	check := func(name string, got []interface{}, from, to, step int) {
+		want := []interface{}{}
+		for i := from; i != to; i += step {
+			want = append(want, i)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d elements expected %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %v at %d expected %v", name, got[i], i, want[i])
+			}
+		}
+	}
+	check("Subrange", collect(s.Subrange(100, 250)), 100, 250, 1)
+	check("IteratorFrom", collect(s.IteratorFrom(990)), 990, 1000, 1)
+	check("ReverseIterator", collect(s.ReverseIterator()), 999, -1, -1)
+	check("IteratorBefore", collect(s.IteratorBefore(10)), 9, -1, -1)
+
+	if got := seq.First(s.ReverseSeq()); got != 999 {
+		t.Fatalf("ReverseSeq started at %v", got)
+	}
+	if got := seq.First(s.SeqFrom(500)); got != 500 {
+		t.Fatalf("SeqFrom started at %v", got)
+	}
+	if got := seq.First(s.SeqBefore(500)); got != 499 {
+		t.Fatalf("SeqBefore started at %v", got)
+	}
+	if got := seq.First(s.SubrangeSeq(10, 20)); got != 10 {
+		t.Fatalf("SubrangeSeq started at %v", got)
+	}
+	if s.SubrangeSeq(20, 10) != nil {
+		t.Fatal("empty SubrangeSeq should be nil")
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	s := Empty()
+	if _, ok := s.First(); ok {
+		t.Fatal("First on empty set found an element")
+	}
+	if _, ok := s.Last(); ok {
+		t.Fatal("Last on empty set found an element")
+	}
+	s = s.Transform(func(t *TSet) {
+		for i := 0; i < 1000; i += 10 {
+			t.Add(i)
+		}
+	})
+	expect := func(name string, got interface{}, ok bool, want interface{}) {
+		if want == nil {
+			if ok {
+				t.Fatalf("%s: got %v expected no element", name, got)
+			}
+			return
+		}
+		if !ok || got != want {
+			t.Fatalf("%s: got %v, %v expected %v", name, got, ok, want)
+		}
+	}
+	got, ok := s.First()
+	expect("First", got, ok, 0)
+	got, ok = s.Last()
+	expect("Last", got, ok, 990)
+	got, ok = s.Floor(55)
+	expect("Floor", got, ok, 50)
+	got, ok = s.Floor(-1)
+	expect("Floor below", got, ok, nil)
+	got, ok = s.Ceiling(55)
+	expect("Ceiling", got, ok, 60)
+	got, ok = s.Ceiling(991)
+	expect("Ceiling above", got, ok, nil)
+	got, ok = s.Lower(50)
+	expect("Lower", got, ok, 40)
+	got, ok = s.Higher(50)
+	expect("Higher", got, ok, 60)
+
+	tr := s.AsTransient()
+	got, ok = tr.Floor(50)
+	expect("TSet Floor", got, ok, 50)
+	got, ok = tr.Higher(990)
+	expect("TSet Higher", got, ok, nil)
+	got, ok = tr.Last()
+	expect("TSet Last", got, ok, 990)
+}
+
+func TestOrderStatistics(t *testing.T) {
+	s := Empty().Transform(func(t *TSet) {
+		for i := 999; i >= 0; i-- {
+			t.Add(i * 2)
+		}
+	})
+	for i := 0; i < 1000; i++ {
+		if got, ok := s.Nth(i); !ok || got != i*2 {
+			t.Fatalf("Nth(%d) = %v, %v", i, got, ok)
+		}
+		if got := s.Rank(i * 2); got != i {
+			t.Fatalf("Rank(%d) = %d expected %d", i*2, got, i)
+		}
+		if got := s.Rank(i*2 + 1); got != i+1 {
+			t.Fatalf("Rank(%d) = %d expected %d", i*2+1, got, i+1)
+		}
+	}
+	if got, ok := s.Nth(1000); ok || got != nil {
+		t.Fatalf("Nth past the end returned %v, %v", got, ok)
+	}
+	page := s.SliceByIndex(20, 30)
+	for i := 20; i < 30; i++ {
+		if !page.HasNext() {
+			t.Fatalf("SliceByIndex ended early at %d", i)
+		}
+		if got := page.Next(); got != i*2 {
+			t.Fatalf("SliceByIndex got %v expected %v", got, i*2)
+		}
+	}
+	if page.HasNext() {
+		t.Fatal("SliceByIndex produced too many elements")
+	}
+
+	tr := s.AsTransient().Delete(0)
+	if got, ok := tr.Nth(0); !ok || got != 2 {
+		t.Fatalf("TSet Nth(0) = %v, %v", got, ok)
+	}
+	if got := tr.Rank(10); got != 4 {
+		t.Fatalf("TSet Rank(10) = %d", got)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	evens := Empty().Transform(func(t *TSet) {
+		for i := 0; i < 1000; i += 2 {
+			t.Add(i)
+		}
+	})
+	threes := Empty().Transform(func(t *TSet) {
+		for i := 0; i < 1000; i += 3 {
+			t.Add(i)
+		}
+	})
+	check := func(name string, got *Set, pred func(int) bool) {
+		count := 0
+		for i := 0; i < 1000; i++ {
+			if pred(i) {
+				count++
+				if !got.Contains(i) {
+					t.Fatalf("%s is missing %d", name, i)
+				}
+			}
+		}
+		if got.Length() != count {
+			t.Fatalf("%s has length %d expected %d",
+				name, got.Length(), count)
+		}
+	}
+	check("Union", evens.Union(threes), func(i int) bool {
+		return i%2 == 0 || i%3 == 0
+	})
+	check("Intersection", evens.Intersection(threes), func(i int) bool {
+		return i%6 == 0
+	})
+	check("Difference", evens.Difference(threes), func(i int) bool {
+		return i%2 == 0 && i%3 != 0
+	})
+	if evens.Union(Empty()) != evens || evens.Intersection(evens) != evens {
+		t.Fatal("expected unchanged results to return the receiver")
+	}
+}
+
+func TestSetAlgebraLeavesReceiver(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 50
+	properties := gopter.NewProperties(parameters)
+	properties.Property("s.Union(small) and s.Difference(small) leave s unchanged",
+		prop.ForAll(
+			func(adds []int) bool {
+				s := Empty()
+				for i, v := range adds {
+					s = s.Add(v)
+					if i%3 == 0 {
+						s = s.Delete(adds[i/2])
+					}
+				}
+				last, ok := s.Last()
+				if !ok {
+					return true
+				}
+				top := last.(int) + 100
+				want, length := s.String(), s.Length()
+				s.Union(New(-3, -2, -1, top))
+				s.Difference(New(adds[0], adds[len(adds)/2], top))
+				return s.String() == want &&
+					s.Length() == length &&
+					!s.Contains(top)
+			},
+			gen.SliceOfN(3000, gen.IntRange(0, 100000)),
+		))
+	properties.TestingRun(t)
+}
+
+func reverseInts(a, b interface{}) int {
+	return b.(int) - a.(int)
+}
+
+func TestSetAlgebraKeepsCompare(t *testing.T) {
+	reversed := Compare(reverseInts)
+	a := Empty(reversed).Add(1).Add(3).Add(5)
+	b := Empty(reversed).Add(2).Add(3).Add(4)
+	union := a.Union(b)
+	if first, _ := union.First(); first != 5 {
+		t.Fatalf("expected union to keep the reversed order, got %v", first)
+	}
+	if got := union.Add(6); got.Length() != 6 {
+		t.Fatalf("expected union to remain usable, got %v", got)
+	}
+	if last, _ := a.Difference(b).Last(); last != 1 {
+		t.Fatalf("expected difference to keep the reversed order, got %v", last)
+	}
+	defer func() {
+		if r := recover(); r != errCompareMismatch {
+			t.Fatalf("expected compare mismatch panic, got %v", r)
+		}
+	}()
+	a.Union(New(1, 2, 3))
+}
+
+func TestJSON(t *testing.T) {
+	s := New(3.0, 1.0, 2.0)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[1,2,3]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Set
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(s) {
+		t.Fatalf("expected %v, got %v", s, &got)
+	}
+	reversed := Empty(Compare(func(a, b interface{}) int {
+		return dyn.Compare(b, a)
+	}))
+	if err := json.Unmarshal(data, reversed); err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := reversed.First(); first != 3.0 {
+		t.Fatalf("expected decoded set to keep its order, got %v", reversed)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Set
+	}
+	in := snapshot{Value: New(1, 2, 3, 4)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Set).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	reversed := Empty(Compare(func(a, b interface{}) int {
+		return dyn.Compare(b, a)
+	}))
+	if err := reversed.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := reversed.First(); first != 4 {
+		t.Fatalf("expected decoded set to keep its order, got %v", reversed)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	r := persist.NewReader(store)
+	s := Empty(Compare(reverseInts)).Transform(func(t *TSet) {
+		for i := 0; i < 1000; i++ {
+			t.Add(i)
+		}
+	})
+	h, err := s.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Empty(Compare(reverseInts)).Load(r, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(s) {
+		t.Fatalf("expected %v, got %v", s, got)
+	}
+	if first, _ := got.Add(1000).First(); first != 1000 {
+		t.Fatalf("expected the loaded set to keep the reversed order, got %v",
+			first)
+	}
+	if _, err := Empty().Load(r, persist.Hash{}); err != persist.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSetAlgebraComparesOptions(t *testing.T) {
+	order := func(dir int) Option {
+		return Compare(func(a, b interface{}) int {
+			return dir * (a.(int) - b.(int))
+		})
+	}
+	for _, op := range []func(a, b *Set) *Set{
+		(*Set).Union, (*Set).Intersection, (*Set).Difference,
+	} {
+		func() {
+			asc := Empty(order(1)).Add(1).Add(3).Add(5)
+			desc := Empty(order(-1)).Add(2).Add(4).Add(6)
+			defer func() {
+				if r := recover(); r != errCompareMismatch {
+					t.Fatalf("expected compare mismatch panic, got %v", r)
+				}
+			}()
+			op(asc, desc)
+		}()
+	}
+	for _, s := range []*Set{
+		Empty(Compare(defaultCompare)),
+		Empty(order(1)),
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != errCompareMismatch {
+					t.Fatalf("expected compare mismatch panic, got %v", r)
+				}
+			}()
+			New(1, 2).Union(s.Add(3))
+		}()
+	}
+	if got := New(1, 3).Union(Empty().Add(2)); got.Length() != 3 ||
+		!got.Contains(2) {
+		t.Fatalf("expected the default order to be shared, got %v", got)
+	}
+}
@@ -48,6 +48,44 @@ func (s *TSet) Find(elem interface{}) (interface{}, bool) {
 	return s.root.Find(elem)
 }
 
+// First returns the smallest element in the set. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) First() (interface{}, bool) {
+	return s.root.First()
+}
+
+// Last returns the largest element in the set. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) Last() (interface{}, bool) {
+	return s.root.Last()
+}
+
+// Floor returns the greatest element less than or equal to
+// elem. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) Floor(elem interface{}) (interface{}, bool) {
+	return s.root.Floor(elem)
+}
+
+// Ceiling returns the least element greater than or equal to
+// elem. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) Ceiling(elem interface{}) (interface{}, bool) {
+	return s.root.Ceiling(elem)
+}
+
+// Lower returns the greatest element strictly less than elem. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) Lower(elem interface{}) (interface{}, bool) {
+	return s.root.Lower(elem)
+}
+
+// Higher returns the least element strictly greater than elem. If there is no such element,
+// (nil, false) is returned.
+func (s *TSet) Higher(elem interface{}) (interface{}, bool) {
+	return s.root.Higher(elem)
+}
+
 // Delete removes an element from the set returning a new Set without
 // the element.
 func (s *TSet) Delete(elem interface{}) *TSet {
@@ -55,6 +93,18 @@ func (s *TSet) Delete(elem interface{}) *TSet {
 	return s
 }
 
+// Nth returns the element at index i in ascending order. If i is out
+// of range, (nil, false) is returned.
+func (s *TSet) Nth(i int) (interface{}, bool) {
+	return s.root.Nth(i)
+}
+
+// Rank returns the number of elements in the set strictly less than
+// elem. When elem is in the set this is its index.
+func (s *TSet) Rank(elem interface{}) int {
+	return s.root.Rank(elem)
+}
+
 // Length returns the elements in the set.
 func (s *TSet) Length() int {
 	return s.root.Length()
@@ -0,0 +1,233 @@
+package vector
+
+import (
+	"errors"
+	mathbits "math/bits"
+
+	"jsouthworth.net/go/immutable/internal/atomic"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/immutable/persist"
+)
+
+var errCorruptNode = errors.New("corrupt vector node")
+
+// Persist writes the vector to w and returns the hash of its root.
+// Each node is written once, so the nodes this vector shares with
+// versions previously written by w are not written again. Elements
+// are encoded as by MarshalBinary.
+func (v *VectorOf[T]) Persist(w *persist.Writer) (persist.Hash, error) {
+	root, err := persistNode(w, v.root)
+	if err != nil {
+		return persist.Hash{}, err
+	}
+	return w.Write(v, func() ([]byte, error) {
+		e := binenc.NewEncoder(binenc.VectorRoot, v.count)
+		e.WriteUvarint(uint64(v.shift))
+		e.WriteBytes(root[:])
+		e.WriteUvarint(uint64(len(v.tail)))
+		for _, elem := range v.tail {
+			if err := binenc.Encode(e, elem); err != nil {
+				return nil, err
+			}
+		}
+		return e.Bytes(), nil
+	})
+}
+
+// LoadOf reads the vector whose root hash was returned by Persist.
+// Only the root is read immediately; the other nodes are read through
+// r when they are first used and nodes already read by r are shared
+// with the vectors it returned before. Operations on the vector panic
+// with a *persist.ReadError if a node can not be read.
+func LoadOf[T any](r *persist.Reader, h persist.Hash) (*VectorOf[T], error) {
+	return persist.Read(r, h, func(data []byte) (*VectorOf[T], error) {
+		d, count, err := binenc.NewDecoder(data, binenc.VectorRoot)
+		if err != nil {
+			return nil, err
+		}
+		shift, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		var root persist.Hash
+		b, err := d.ReadBytes(len(root))
+		if err != nil {
+			return nil, err
+		}
+		copy(root[:], b)
+		tailLen, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if shift%bits != 0 || shift > 64 || tailLen > width ||
+			int(tailLen) > count || (tailLen == 0 && count > 0) {
+			return nil, errCorruptNode
+		}
+		tail := make([]T, tailLen)
+		for i := range tail {
+			if tail[i], err = binenc.Decode[T](d); err != nil {
+				return nil, err
+			}
+		}
+		if err := d.Done(); err != nil {
+			return nil, err
+		}
+		n, err := loadNode[T](r, root, atomicZero())
+		if err != nil {
+			return nil, err
+		}
+		return &VectorOf[T]{
+			count: count,
+			shift: uint(shift),
+			root:  n,
+			tail:  tail,
+		}, nil
+	})
+}
+
+func persistNode[T any](w *persist.Writer, n *vnode[T]) (persist.Hash, error) {
+	if n.lazy != nil {
+		// A node that hasn't been read needn't be if it is
+		// written back to the store it came from.
+		return w.WriteFrom(n, n.lazy.r.Store(), n.lazy.hash, func() ([]byte, error) {
+			return encodeNode(w, n.resolve())
+		})
+	}
+	return w.Write(n, func() ([]byte, error) {
+		return encodeNode(w, n)
+	})
+}
+
+func encodeNode[T any](w *persist.Writer, n *vnode[T]) ([]byte, error) {
+	// A leaf is written as a node without children followed by
+	// its elements.
+	if n.array != nil {
+		e := binenc.NewEncoder(binenc.VectorNode, width)
+		e.WriteUvarint(0)
+		for _, elem := range n.array {
+			if err := binenc.Encode(e, elem); err != nil {
+				return nil, err
+			}
+		}
+		return e.Bytes(), nil
+	}
+	var present uint32
+	var children []persist.Hash
+	for i, child := range n.nodes {
+		if child == nil {
+			continue
+		}
+		h, err := persistNode(w, child)
+		if err != nil {
+			return nil, err
+		}
+		present |= 1 << uint(i)
+		children = append(children, h)
+	}
+	// A relaxed node is followed by its size table.
+	kind := binenc.VectorNode
+	if n.sizes != nil {
+		kind = binenc.VectorRelaxedNode
+	}
+	e := binenc.NewEncoder(kind, len(children))
+	e.WriteUvarint(uint64(present))
+	for _, h := range children {
+		e.WriteBytes(h[:])
+	}
+	if n.sizes != nil {
+		for _, size := range n.sizes[:len(children)] {
+			e.WriteUvarint(uint64(size))
+		}
+	}
+	return e.Bytes(), nil
+}
+
+// loadNode reads a node. Nodes are given the persistent edit so that
+// transients copy them before changing them.
+func loadNode[T any](r *persist.Reader, h persist.Hash, edit *int32) (*vnode[T], error) {
+	return persist.Read(r, h, func(data []byte) (*vnode[T], error) {
+		kind, err := binenc.KindOf(data)
+		if err != nil {
+			return nil, err
+		}
+		relaxed := kind == binenc.VectorRelaxedNode
+		if !relaxed {
+			kind = binenc.VectorNode
+		}
+		d, count, err := binenc.NewDecoder(data, kind)
+		if err != nil {
+			return nil, err
+		}
+		present, err := d.ReadUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if !relaxed && present == 0 && count == width {
+			n := vnodeNewFromArray(edit, new([width]T))
+			for i := range n.array {
+				if n.array[i], err = binenc.Decode[T](d); err != nil {
+					return nil, err
+				}
+			}
+			return n, d.Done()
+		}
+		if present > 1<<width-1 || mathbits.OnesCount64(present) != count ||
+			(relaxed && (count == 0 || present != 1<<count-1)) {
+			return nil, errCorruptNode
+		}
+		n := vnodeNew[T](edit)
+		for i := range n.nodes {
+			if present&(1<<uint(i)) == 0 {
+				continue
+			}
+			var child persist.Hash
+			b, err := d.ReadBytes(len(child))
+			if err != nil {
+				return nil, err
+			}
+			copy(child[:], b)
+			n.nodes[i] = &vnode[T]{lazy: &lazyNode[T]{
+				r:    r,
+				hash: child,
+				edit: edit,
+			}}
+		}
+		if relaxed {
+			n.sizes = new([width]int)
+			prev := 0
+			for i := range n.sizes[:count] {
+				size, err := d.ReadUvarint()
+				if err != nil {
+					return nil, err
+				}
+				if size <= uint64(prev) || size > 1<<62 {
+					return nil, errCorruptNode
+				}
+				n.sizes[i] = int(size)
+				prev = n.sizes[i]
+			}
+		}
+		return n, d.Done()
+	})
+}
+
+// lazyNode is the source of a node of a loaded vector that has not
+// been read. The node is read through the Reader the first time it is
+// needed and kept.
+type lazyNode[T any] struct {
+	r      *persist.Reader
+	hash   persist.Hash
+	edit   *int32
+	loaded atomic.Value[*vnode[T]]
+}
+
+func (l *lazyNode[T]) load() *vnode[T] {
+	if loaded, ok := l.loaded.Load(); ok {
+		return loaded
+	}
+	loaded, err := loadNode[T](l.r, l.hash, l.edit)
+	if err != nil {
+		panic(&persist.ReadError{Hash: l.hash, Err: err})
+	}
+	return l.loaded.Store(loaded)
+}
@@ -0,0 +1,421 @@
+package vector
+
+// The trie is relaxed radix balanced. A node at shift holds children
+// that each hold up to 1<<shift elements. A regular node is indexed by
+// radix alone as every child but its last is full. Concatenating and
+// splitting vectors produces relaxed nodes whose children may hold
+// fewer elements; a relaxed node records the cumulative sizes of its
+// children, which are searched to find the child holding an index.
+//
+// Leaves do not record how many elements they hold. The number of
+// elements below a node is known to its parent, so the functions here
+// are given the size of the node they start at and derive the sizes
+// of the nodes below it on the way down.
+
+// A concatenation leaves at most extras more nodes at each level than
+// the fewest that could hold their children, bounding the extra steps
+// of a search through a relaxed node.
+const extras = 2
+
+// span is a node and the number of elements below it.
+type span[T any] struct {
+	node *vnode[T]
+	size int
+}
+
+func (s span[T]) child(shift uint, i int) span[T] {
+	n := s.node.resolve()
+	return span[T]{
+		node: n.nodes[i],
+		size: n.childSize(shift, s.size, i),
+	}
+}
+
+func (s span[T]) children(shift uint) []span[T] {
+	out := make([]span[T], s.node.resolve().children(shift, s.size))
+	for i := range out {
+		out[i] = s.child(shift, i)
+	}
+	return out
+}
+
+// slots returns the number of children of the node, or the number of
+// elements of a leaf.
+func (s span[T]) slots(shift uint) int {
+	if shift == 0 {
+		return s.size
+	}
+	return s.node.resolve().children(shift, s.size)
+}
+
+// children returns the number of children of n, which holds size
+// elements.
+func (n *vnode[T]) children(shift uint, size int) int {
+	if n.sizes == nil {
+		return (size + 1<<shift - 1) >> shift
+	}
+	k := 0
+	for k < width && n.nodes[k] != nil {
+		k++
+	}
+	return k
+}
+
+// childSize returns the number of elements held by child i of n, which
+// holds size elements.
+func (n *vnode[T]) childSize(shift uint, size, i int) int {
+	switch {
+	case n.sizes == nil:
+		return min(size-i<<shift, 1<<shift)
+	case i == 0:
+		return n.sizes[0]
+	default:
+		return n.sizes[i] - n.sizes[i-1]
+	}
+}
+
+// childFor returns the index of the child of n holding element i and
+// the index of the element within that child.
+func (n *vnode[T]) childFor(shift uint, i int) (int, int) {
+	idx := i >> shift
+	if n.sizes == nil {
+		return idx, i - idx<<shift
+	}
+	// No child holds more than 1<<shift elements so the child holding
+	// i is at or after its radix index.
+	for n.sizes[idx] <= i {
+		idx++
+	}
+	if idx > 0 {
+		i -= n.sizes[idx-1]
+	}
+	return idx, i
+}
+
+// relax gives n, which has count children, the size table sizes
+// unless the sizes are those of a regular node.
+func (n *vnode[T]) relax(shift uint, sizes *[width]int, count int) {
+	n.sizes = nil
+	for i := 0; i < count-1; i++ {
+		if sizes[i] != (i+1)<<shift {
+			n.sizes = sizes
+			return
+		}
+	}
+}
+
+func (n *vnode[T]) sizeTable(shift uint, size int) *[width]int {
+	sizes := new([width]int)
+	sum := 0
+	for i := 0; i < n.children(shift, size); i++ {
+		sum += n.childSize(shift, size, i)
+		sizes[i] = sum
+	}
+	return sizes
+}
+
+func (n *vnode[T]) leafFor(shift uint, i int) (*vnode[T], int) {
+	for ; shift > 0; shift -= bits {
+		var idx int
+		idx, i = n.childFor(shift, i)
+		n = n.child(idx)
+	}
+	return n, i
+}
+
+// leafSlice returns the elements of the leaf holding element i of n,
+// which holds size elements, from i to the end of the leaf.
+func (n *vnode[T]) leafSlice(shift uint, size, i int) []T {
+	for ; shift > 0; shift -= bits {
+		idx, j := n.childFor(shift, i)
+		size = n.childSize(shift, size, idx)
+		n, i = n.child(idx), j
+	}
+	return n.array[i:size]
+}
+
+func (n *vnode[T]) assoc(edit *int32, shift uint, i int, value T) *vnode[T] {
+	ret := n.editableBy(edit)
+	if shift == 0 {
+		ret.array[i] = value
+		return ret
+	}
+	idx, j := n.childFor(shift, i)
+	ret.nodes[idx] = n.child(idx).assoc(edit, shift-bits, j, value)
+	return ret
+}
+
+// pushLeaf returns n, which holds size elements, with leaf holding
+// count elements added after its last element, or nil if n is full.
+func (n *vnode[T]) pushLeaf(edit *int32, shift uint, size int, leaf *vnode[T], count int) *vnode[T] {
+	k := n.children(shift, size)
+	if shift > bits && k > 0 {
+		last := n.childSize(shift, size, k-1)
+		child := n.child(k-1).pushLeaf(edit, shift-bits, last, leaf, count)
+		if child != nil {
+			ret := n.editableBy(edit)
+			ret.nodes[k-1] = child
+			if ret.sizes != nil {
+				ret.sizes[k-1] += count
+			}
+			return ret
+		}
+	}
+	if k == width {
+		return nil
+	}
+	ret := n.editableBy(edit)
+	ret.nodes[k] = newPath(edit, shift-bits, leaf)
+	if ret.sizes == nil && size != k<<shift {
+		// The last child is not full so it may no longer be last.
+		ret.sizes = n.sizeTable(shift, size)
+	}
+	if ret.sizes != nil {
+		ret.sizes[k] = size + count
+	}
+	return ret
+}
+
+// popLeaf returns n, which holds size elements, without its last leaf,
+// or nil if that was its only leaf, along with the leaf and the number
+// of elements it holds.
+func (n *vnode[T]) popLeaf(edit *int32, shift uint, size int) (*vnode[T], *vnode[T], int) {
+	k := n.children(shift, size)
+	var child *vnode[T]
+	leaf, count := n.child(k-1), n.childSize(shift, size, k-1)
+	if shift > bits {
+		child, leaf, count = leaf.popLeaf(edit, shift-bits, count)
+	}
+	if child == nil && k == 1 {
+		return nil, leaf, count
+	}
+	ret := n.editableBy(edit)
+	ret.nodes[k-1] = child
+	switch {
+	case ret.sizes == nil:
+	case child == nil:
+		ret.sizes[k-1] = 0
+	default:
+		ret.sizes[k-1] -= count
+	}
+	return ret, leaf, count
+}
+
+// take returns n, which holds size elements, with only its first i.
+func (n *vnode[T]) take(shift uint, size, i int) *vnode[T] {
+	if i == size {
+		return n
+	}
+	if shift == 0 {
+		leaf := vnodeNewFromArray(nil, new([width]T))
+		copy(leaf.array[:], n.array[:i])
+		return leaf
+	}
+	idx, j := n.childFor(shift, i-1)
+	ret := vnodeNew[T](nil)
+	copy(ret.nodes[:idx], n.nodes[:idx])
+	ret.nodes[idx] = n.child(idx).take(shift-bits,
+		n.childSize(shift, size, idx), j+1)
+	if n.sizes != nil {
+		sizes := new([width]int)
+		copy(sizes[:idx], n.sizes[:idx])
+		sizes[idx] = i
+		ret.relax(shift, sizes, idx+1)
+	}
+	return ret
+}
+
+// drop returns n, which holds size elements, without its first i.
+func (n *vnode[T]) drop(shift uint, size, i int) *vnode[T] {
+	if i == 0 {
+		return n
+	}
+	if shift == 0 {
+		leaf := vnodeNewFromArray(nil, new([width]T))
+		copy(leaf.array[:], n.array[i:size])
+		return leaf
+	}
+	idx, j := n.childFor(shift, i)
+	k := n.children(shift, size)
+	ret := vnodeNew[T](nil)
+	ret.nodes[0] = n.child(idx).drop(shift-bits,
+		n.childSize(shift, size, idx), j)
+	copy(ret.nodes[1:], n.nodes[idx+1:k])
+	sizes := new([width]int)
+	for c := idx; c < k; c++ {
+		if n.sizes != nil {
+			sizes[c-idx] = n.sizes[c] - i
+		} else {
+			sizes[c-idx] = min((c+1)<<shift, size) - i
+		}
+	}
+	ret.relax(shift, sizes, k-idx)
+	return ret
+}
+
+// pushTail returns the root and shift of the tree rooted at root, which
+// holds size elements, with leaf holding count elements appended.
+func pushTail[T any](edit *int32, root *vnode[T], shift uint, size int, leaf *vnode[T], count int) (*vnode[T], uint) {
+	if ret := root.pushLeaf(edit, shift, size, leaf, count); ret != nil {
+		return ret, shift
+	}
+	ret := vnodeNew[T](edit)
+	ret.nodes[0] = root
+	ret.nodes[1] = newPath(edit, shift, leaf)
+	if size != 1<<(shift+bits) {
+		ret.sizes = &[width]int{size, size + count}
+	}
+	return ret, shift + bits
+}
+
+// popTail returns the root and shift of the tree rooted at root, which
+// holds size elements, without its last leaf, along with the leaf and
+// the number of elements it holds.
+func popTail[T any](edit *int32, root *vnode[T], shift uint, size int) (*vnode[T], uint, *vnode[T], int) {
+	root, leaf, count := root.popLeaf(edit, shift, size)
+	if root == nil {
+		return vnodeNew[T](edit), bits, leaf, count
+	}
+	root, shift = trim(root, shift, size-count)
+	return root, shift, leaf, count
+}
+
+// trim removes the levels at the top of the tree that have one child.
+func trim[T any](root *vnode[T], shift uint, size int) (*vnode[T], uint) {
+	for shift > bits && root.children(shift, size) == 1 {
+		root, shift = root.child(0), shift-bits
+	}
+	return root, shift
+}
+
+// concatTrees returns the root and shift of a tree holding the elements
+// of the non-empty tree a followed by those of the non-empty tree b.
+func concatTrees[T any](a span[T], ashift uint, b span[T], bshift uint) (*vnode[T], uint) {
+	top := concatNodes(a, ashift, b, bshift)
+	return trim(top.node, max(ashift, bshift)+bits, top.size)
+}
+
+// concatNodes joins a and b along the right edge of a and the left
+// edge of b, returning a node a level above the higher of them that
+// has one or two children.
+func concatNodes[T any](a span[T], ashift uint, b span[T], bshift uint) span[T] {
+	switch {
+	case ashift > bshift:
+		left := a.children(ashift)
+		mid := concatNodes(left[len(left)-1], ashift-bits, b, bshift)
+		return rebalance(ashift-bits,
+			left[:len(left)-1], mid.children(ashift), nil)
+	case ashift < bshift:
+		right := b.children(bshift)
+		mid := concatNodes(a, ashift, right[0], bshift-bits)
+		return rebalance(bshift-bits,
+			nil, mid.children(bshift), right[1:])
+	case ashift == 0:
+		return nodeOf(bits, []span[T]{a, b})
+	default:
+		left, right := a.children(ashift), b.children(bshift)
+		mid := concatNodes(left[len(left)-1], ashift-bits,
+			right[0], bshift-bits)
+		return rebalance(ashift-bits,
+			left[:len(left)-1], mid.children(ashift), right[1:])
+	}
+}
+
+// rebalance joins the nodes at shift in left, center and right,
+// redistributing their children so that few of them are not full, and
+// returns a node two levels above them that has one or two children.
+func rebalance[T any](shift uint, left, center, right []span[T]) span[T] {
+	all := make([]span[T], 0, len(left)+len(center)+len(right))
+	all = append(append(append(all, left...), center...), right...)
+	nodes := redistribute(shift, all)
+	if len(nodes) <= width {
+		return nodeOf(shift+2*bits, []span[T]{
+			nodeOf(shift+bits, nodes),
+		})
+	}
+	return nodeOf(shift+2*bits, []span[T]{
+		nodeOf(shift+bits, nodes[:width]),
+		nodeOf(shift+bits, nodes[width:]),
+	})
+}
+
+// redistribute moves the children of the nodes at shift in all, or
+// the elements if they are leaves, into as many nodes as concatPlan
+// allows. Nodes that would be unchanged are kept.
+func redistribute[T any](shift uint, all []span[T]) []span[T] {
+	counts := make([]int, len(all))
+	total := 0
+	for i, s := range all {
+		counts[i] = s.slots(shift)
+		total += counts[i]
+	}
+	plan := concatPlan(counts, total)
+	out := make([]span[T], 0, len(plan))
+	i, offset := 0, 0
+	for _, want := range plan {
+		if offset == 0 && counts[i] == want {
+			out = append(out, all[i])
+			i++
+			continue
+		}
+		if shift == 0 {
+			leaf := vnodeNewFromArray(nil, new([width]T))
+			for got := 0; got < want; {
+				n := copy(leaf.array[got:want],
+					all[i].node.resolve().array[offset:counts[i]])
+				got += n
+				offset += n
+				if offset == counts[i] {
+					i, offset = i+1, 0
+				}
+			}
+			out = append(out, span[T]{node: leaf, size: want})
+			continue
+		}
+		children := make([]span[T], 0, want)
+		for len(children) < want {
+			children = append(children, all[i].child(shift, offset))
+			offset++
+			if offset == counts[i] {
+				i, offset = i+1, 0
+			}
+		}
+		out = append(out, nodeOf(shift, children))
+	}
+	return out
+}
+
+// concatPlan returns the number of slots each of the nodes with counts
+// slots should have so that there are at most extras more of them than
+// the fewest that could hold total slots. Slots move from the first
+// node that is not full into the nodes after it.
+func concatPlan(counts []int, total int) []int {
+	plan := append([]int(nil), counts...)
+	optimal := (total + width - 1) / width
+	for i := 0; len(plan) > optimal+extras; i-- {
+		for plan[i] == width {
+			i++
+		}
+		for r := plan[i]; r > 0; i++ {
+			n := min(r+plan[i+1], width)
+			r += plan[i+1] - n
+			plan[i] = n
+		}
+		plan = append(plan[:i], plan[i+1:]...)
+	}
+	return plan
+}
+
+// nodeOf returns a node at shift holding children.
+func nodeOf[T any](shift uint, children []span[T]) span[T] {
+	n := vnodeNew[T](nil)
+	sizes := new([width]int)
+	size := 0
+	for i, c := range children {
+		n.nodes[i] = c.node
+		size += c.size
+		sizes[i] = size
+	}
+	n.relax(shift, sizes, len(children))
+	return span[T]{node: n, size: size}
+}
@@ -1,14 +1,13 @@
-// Package vector implements a Radix Balanced trie based vector.
+// Package vector implements a Relaxed Radix Balanced trie based vector.
 package vector // import "jsouthworth.net/go/immutable/vector"
 
 import (
-	"bytes"
 	"errors"
-	"fmt"
 	"reflect"
 	"sync/atomic"
 
 	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/persist"
 	"jsouthworth.net/go/seq"
 )
 
@@ -16,6 +15,7 @@ var errOutOfBounds = errors.New("out of bounds")
 var errEmptyVector = errors.New("empty vector")
 var errTafterP = errors.New("transient used after persistent call")
 var errRangeSig = errors.New("Range requires a function: func(v vT) bool or func(v vT)")
+var errUnmarshalEmpty = errors.New("cannot decode into the shared empty vector")
 var errReduceSig = errors.New("Reduce requires a function: func(init iT, v vT) oT")
 
 const (
@@ -28,34 +28,24 @@ const (
 // Operations on this structure will return
 // modified copies of the original vector sharing
 // much of the structure with the original.
-type Vector struct {
-	count int
-	shift uint
-	root  *vnode
-	tail  slice
-}
-
-var emptyNode = vnodeNew(atomicZero())
-
-var empty = Vector{
-	count: 0,
-	shift: bits,
-	root:  emptyNode,
-	tail:  make(slice, 0),
-}
+// Vector is a VectorOf[interface{}] and may be used to
+// store heterogeneous elements.
+type Vector VectorOf[interface{}]
 
 // Empty returns the empty vector
 func Empty() *Vector {
-	return &empty
+	return (*Vector)(&empty)
 }
 
 // New converts as list of elements to a persistent vector.
 func New(elems ...interface{}) *Vector {
-	v := Empty().AsTransient()
-	for _, elem := range elems {
-		v = v.Append(elem)
-	}
-	return v.AsPersistent()
+	return (*Vector)(NewOf(elems...))
+}
+
+// FromSlice returns a vector holding a copy of elems. The elements
+// are copied straight into the leaves of the vector in O(n) time.
+func FromSlice(elems []interface{}) *Vector {
+	return (*Vector)(FromSliceOf(elems))
 }
 
 // From will convert many go types to an immutable vector.
@@ -104,11 +94,11 @@ func vectorFromReflection(value interface{}) *Vector {
 	v := reflect.ValueOf(value)
 	switch v.Kind() {
 	case reflect.Slice:
-		out := Empty().AsTransient()
-		for i := 0; i < v.Len(); i++ {
-			out = out.Append(v.Index(i).Interface())
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = v.Index(i).Interface()
 		}
-		return out.AsPersistent()
+		return FromSlice(elems)
 	default:
 		return Empty()
 	}
@@ -116,89 +106,27 @@ func vectorFromReflection(value interface{}) *Vector {
 
 // At returns the element at the supplied index. It will panic if out of bounds.
 func (v *Vector) At(i int) interface{} {
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		return v.tail.at(i & mask)
-	default:
-		n := v.root
-		for level := v.shift; level > 0; level -= bits {
-			n = n.array[(i>>level)&mask].(*vnode)
-		}
-		return n.array.at(i & mask)
-	}
+	return v.typed().At(i)
 }
 
 // Find returns the value at the supplied index and if that index was
 // in bounds for the vector. Out of bounds access does not panic but
 // returns (nil, false). idx must be an int.
 func (v *Vector) Find(idx interface{}) (interface{}, bool) {
-	i := idx.(int)
-	if i < 0 || i >= v.Length() {
-		return nil, false
-	}
-	return v.At(i), true
+	return v.typed().Find(idx.(int))
 }
 
 // Assoc associates the value with the index in an immutable copy of the vector
 // sharing structure with the original vector.
 func (v *Vector) Assoc(i int, value interface{}) *Vector {
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		return &Vector{
-			count: v.count,
-			shift: v.shift,
-			root:  v.root,
-			tail:  v.tail.copy().assoc(i&mask, value),
-		}
-	default:
-		return &Vector{
-			count: v.count,
-			shift: v.shift,
-			root:  v.doAssoc(v.shift, v.root, i, value),
-			tail:  v.tail,
-		}
-	}
+	return (*Vector)(v.typed().Assoc(i, value))
 }
 
 // Append will extend the vector and associates the value with new last
 // element. This will return a new copy of the immutable vector sharing
 // structure with the original vector.
 func (v *Vector) Append(value interface{}) *Vector {
-	if v == nil {
-		return Empty().Append(value)
-	}
-	switch {
-	case v.roomInTail():
-		return &Vector{
-			count: v.count + 1,
-			shift: v.shift,
-			root:  v.root,
-			tail:  v.tail.appendExact(value),
-		}
-	case v.overflowsRoot():
-		root := vnodeNew(v.root.edit)
-		root.array[0] = v.root
-		root.array[1] = newPath(v.root.edit, v.shift,
-			vnodeNewFromSlice(v.root.edit, v.tail))
-		return &Vector{
-			count: v.count + 1,
-			shift: v.shift + bits,
-			root:  root,
-			tail:  make(slice, 1).assoc(0, value),
-		}
-	default:
-		return &Vector{
-			count: v.count + 1,
-			shift: v.shift,
-			root: v.pushTail(v.shift, v.root,
-				vnodeNewFromSlice(v.root.edit, v.tail)),
-			tail: make(slice, 1).assoc(0, value),
-		}
-	}
+	return (*Vector)(v.typed().Append(value))
 }
 
 // Conj will extend the vector and associates the value with new last
@@ -208,20 +136,39 @@ func (v *Vector) Conj(elem interface{}) interface{} {
 }
 
 // Delete removes the element at the current index, shifting the others
-// down and yeilding a vector with one fewer elements.
+// down and yeilding a vector with one fewer elements. Delete takes
+// O(log n) time.
 func (v *Vector) Delete(idx int) *Vector {
-	return v.Transform(func(t *TVector) *TVector {
-		return t.Delete(idx)
-	})
+	return (*Vector)(v.typed().Delete(idx))
 }
 
 // Insert adds the value to the vector at the provided index shifting the
 // other values down. This yeilds a vector with an additional value at the
-// provided index.
+// provided index. Insert takes O(log n) time.
 func (v *Vector) Insert(idx int, val interface{}) *Vector {
-	return v.Transform(func(t *TVector) *TVector {
-		return t.Insert(idx, val)
-	})
+	return (*Vector)(v.typed().Insert(idx, val))
+}
+
+// Concat returns a vector holding the elements of v followed by the
+// elements of o. Concat takes O(log n) time and the result shares most
+// of its structure with v and o.
+func (v *Vector) Concat(o *Vector) *Vector {
+	return (*Vector)(v.typed().Concat(o.typed()))
+}
+
+// SplitAt returns a vector of the first i elements of v and a vector of
+// the remaining elements. SplitAt takes O(log n) time. It will panic if
+// i is out of bounds.
+func (v *Vector) SplitAt(i int) (*Vector, *Vector) {
+	l, r := v.typed().SplitAt(i)
+	return (*Vector)(l), (*Vector)(r)
+}
+
+// SubVector returns a vector of the elements of v from start up to but
+// not including end. Unlike a Slice the result does not refer to the
+// elements of v outside of it.
+func (v *Vector) SubVector(start, end int) *Vector {
+	return (*Vector)(v.typed().SubVector(start, end))
 }
 
 // Equal compares each value of the vector to determine if the vector is
@@ -231,16 +178,7 @@ func (v *Vector) Equal(o interface{}) bool {
 	if !ok {
 		return false
 	}
-	if v.Length() != other.Length() {
-		return false
-	}
-	for i := 0; i < v.Length(); i++ {
-		val := v.At(i)
-		if !dyn.Equal(other.At(i), val) {
-			return false
-		}
-	}
-	return true
+	return v.typed().Equal(other.typed())
 }
 
 // Pop removes the last element of the vector,
@@ -248,64 +186,19 @@ func (v *Vector) Equal(o interface{}) bool {
 // with one less element, sharing structure with
 // the original vector.
 func (v *Vector) Pop() *Vector {
-	switch {
-	case v.count == 0:
-		panic(errEmptyVector)
-	case v.count == 1:
-		return Empty()
-	case v.count-v.tailOffset() > 1:
-		newtail := sliceNewFromSlice(
-			v.tail[:(v.count-v.tailOffset())-1])
-		return &Vector{
-			count: v.count - 1,
-			shift: v.shift,
-			root:  v.root,
-			tail:  newtail,
-		}
-	default:
-		newTail := v.arrayFor(v.count - 2).toSlice()
-		newRoot := v.popTail(v.shift, v.root)
-		if newRoot == nil {
-			newRoot = emptyNode
-		}
-		if v.shift > bits && newRoot.array[1] == nil {
-			root := emptyNode
-			if newRoot.array[0] != nil {
-				root = newRoot.array[0].(*vnode)
-			}
-			return &Vector{
-				count: v.count - 1,
-				shift: v.shift - bits,
-				root:  root,
-				tail:  newTail,
-			}
-		}
-		return &Vector{
-			count: v.count - 1,
-			shift: v.shift,
-			root:  newRoot,
-			tail:  newTail,
-		}
-	}
+	return (*Vector)(v.typed().Pop())
 }
 
 // Length returns the number of elements in the vector.
 func (v *Vector) Length() int {
-	if v == nil {
-		return 0
-	}
-	return v.count
+	return v.typed().Length()
 }
 
 // AsTransient will return a mutable version of the
 // vector that may be used to perform mutations in
 // a controlled way.
 func (v *Vector) AsTransient() *TVector {
-	return &TVector{
-		count: v.count,
-		shift: v.shift,
-		orig:  v,
-	}
+	return (*TVector)(v.typed().AsTransient())
 }
 
 // MakeTransient is a generic version of AsTransient.
@@ -316,40 +209,75 @@ func (v *Vector) MakeTransient() interface{} {
 // AsNative will traverse the vector and return a
 // go native representation of the values contained within.
 func (v *Vector) AsNative() []interface{} {
-	out := make([]interface{}, v.Length())
-	for i := 0; i < v.Length(); i++ {
-		val := v.At(i)
-		out[i] = val
-	}
-	return out
+	return v.typed().AsNative()
+}
+
+// MarshalJSON implements json.Marshaler encoding the vector as a JSON
+// array.
+func (v *Vector) MarshalJSON() ([]byte, error) {
+	return v.typed().MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array
+// into the vector. The vector returned by Empty is shared and may not
+// be decoded into.
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	return v.typed().UnmarshalJSON(data)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Elements are encoded with gob unless they implement
+// encoding.BinaryMarshaler, so their concrete types must be
+// registered with gob.Register.
+func (v *Vector) MarshalBinary() ([]byte, error) {
+	return v.typed().MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary.
+func (v *Vector) UnmarshalBinary(data []byte) error {
+	return v.typed().UnmarshalBinary(data)
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (v *Vector) GobEncode() ([]byte, error) {
+	return v.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (v *Vector) GobDecode(data []byte) error {
+	return v.UnmarshalBinary(data)
+}
+
+// Persist writes the vector to w and returns the hash of its root.
+// Nodes shared with versions previously written by w are not written
+// again. Elements are encoded as by MarshalBinary.
+func (v *Vector) Persist(w *persist.Writer) (persist.Hash, error) {
+	return v.typed().Persist(w)
+}
+
+// Load reads the vector whose root hash was returned by Persist. Nodes
+// are read as they are first used and nodes already read by r are
+// shared with the vectors it returned before.
+func Load(r *persist.Reader, h persist.Hash) (*Vector, error) {
+	v, err := LoadOf[interface{}](r, h)
+	return (*Vector)(v), err
 }
 
 // String coverts the vector to a string representation.
 func (v *Vector) String() string {
-	return vectorString(v)
+	return v.typed().String()
 }
 
 // Seq returns a seq.Sequence that will traverse the vector.
 func (v *Vector) Seq() seq.Sequence {
-	if v.Length() == 0 {
-		return nil
-	}
-	return &vectorSequence{
-		vec: v,
-	}
+	return v.typed().Seq()
 }
 
 // Slice returns a Slice structure that has the semantics of go slices
 // over the immutable vector.
 func (v *Vector) Slice(start, end int) *Slice {
-	if start < 0 || end > v.Length() {
-		panic(errOutOfBounds)
-	}
-	return &Slice{
-		vector: v,
-		start:  start,
-		end:    end,
-	}
+	return (*Slice)(v.typed().Slice(start, end))
 }
 
 // Range calls the passed in function on each element of the vector.
@@ -390,11 +318,7 @@ func (v *Vector) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 
-	cont := true
-	for i := 0; i < v.Length() && cont; i++ {
-		value := v.At(i)
-		cont = f(i, value)
-	}
+	v.typed().Range(f)
 }
 
 func genRangeFunc(do interface{}) func(int, interface{}) bool {
@@ -483,101 +407,8 @@ func (v *Vector) Transform(actions ...func(*TVector) *TVector) *Vector {
 	return out.AsPersistent()
 }
 
-func (v *Vector) tailOffset() int {
-	if v.count < width {
-		return 0
-	}
-	return ((v.count - 1) >> bits) << bits
-}
-
-func (v *Vector) arrayFor(i int) arrayI {
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		return v.tail
-	default:
-		n := v.root
-		for level := v.shift; level > 0; level -= bits {
-			n = n.array[(i>>level)&mask].(*vnode)
-		}
-		return n.array
-	}
-}
-
-func (v *Vector) roomInTail() bool {
-	return (v.count - v.tailOffset()) < width
-}
-
-func (v *Vector) overflowsRoot() bool {
-	return (v.count >> bits) > (1 << v.shift)
-}
-
-func (v *Vector) pushTail(
-	level uint,
-	parent *vnode,
-	tailnode *vnode,
-) *vnode {
-	subidx := ((v.count - 1) >> level) & mask
-	ret := parent.clone()
-	if isLeaf(level) {
-		//leaf of trie, insert the node passed in
-		ret.array[subidx] = tailnode
-	} else {
-		child := parent.array[subidx]
-		if child != nil {
-			//maps to existing trie, keep walking
-			ret.array[subidx] =
-				v.pushTail(level-bits, child.(*vnode), tailnode)
-		} else {
-			//no child found, allocate a new path
-			ret.array[subidx] =
-				newPath(v.root.edit, level-bits, tailnode)
-		}
-	}
-	return ret
-}
-
-func (v *Vector) popTail(level uint, n *vnode) *vnode {
-	subidx := ((v.count - 2) >> level) & mask
-	switch {
-	case level > bits:
-		newChild := v.popTail(level-bits, n.array[subidx].(*vnode))
-		if newChild == nil && subidx == 0 {
-			return nil
-		}
-		ret := vnodeNewFromArray(v.root.edit, n.array.copy())
-		if newChild == nil {
-			ret.array[subidx] = nil
-		} else {
-			ret.array[subidx] = newChild
-		}
-		return ret
-	case subidx == 0:
-		return nil
-	default:
-		ret := vnodeNewFromArray(v.root.edit, n.array.copy())
-		ret.array[subidx] = nil
-		return ret
-	}
-}
-
-func (v *Vector) doAssoc(
-	level uint,
-	n *vnode,
-	i int,
-	value interface{},
-) *vnode {
-	ret := n.clone()
-	if level == 0 {
-		ret.array[i&mask] = value
-	} else {
-		subidx := (i >> level) & mask
-		ret.array[subidx] =
-			v.doAssoc(level-bits,
-				n.array[subidx].(*vnode), i, value)
-	}
-	return ret
+func (v *Vector) typed() *VectorOf[interface{}] {
+	return (*VectorOf[interface{}])(v)
 }
 
 // TVector is a transient version of a Vector. Changes made to a
@@ -586,78 +417,32 @@ func (v *Vector) doAssoc(
 // made will become immutable when AsPersistent is called. This structure
 // is useful when making mulitple modifications to a persistent vector
 // where the intermediate results will not be seen or stored anywhere.
-type TVector struct {
-	count int
-	shift uint
-	root  *vnode
-	tail  *array
-
-	modified bool
-	orig     *Vector
-}
+type TVector TVectorOf[interface{}]
 
 // At returns the element at the supplied index.
 // It will panic if out of bounds or called after AsPersistent.
 func (v *TVector) At(i int) interface{} {
-	v.ensureEditable()
-	if !v.modified {
-		return v.orig.At(i)
-	}
-	node := v.arrayFor(i)
-	return node.at(i & mask)
+	return v.typed().At(i)
 }
 
 // Find returns the value at the supplied index and if that index was
 // in bounds for the vector. Out of bounds access does not panic but
 // returns (nil, false). idx must be an int.
 func (v *TVector) Find(idx interface{}) (interface{}, bool) {
-	i := idx.(int)
-	if i < 0 || i >= v.Length() {
-		return nil, false
-	}
-	return v.At(i), true
+	return v.typed().Find(idx.(int))
 }
 
 // Assoc associates the value with the index.
 // It will panic if called after AsPersistent.
 func (v *TVector) Assoc(i int, value interface{}) *TVector {
-	v.ensureEditable()
-	v.makeModifiable()
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		v.tail[i&mask] = value
-		return v
-	default:
-		v.root = v.doAssoc(v.shift, v.root, i, value)
-		return v
-	}
+	v.typed().Assoc(i, value)
+	return v
 }
 
 // Append will extend the vector and associates the value with new last
 // element. It will panic if called after AsPersistent.
 func (v *TVector) Append(value interface{}) *TVector {
-	v.ensureEditable()
-	v.makeModifiable()
-	switch {
-	case v.roomInTail():
-		v.tail.assoc(v.count&mask, value)
-	case v.overflowsRoot():
-		newroot := vnodeNew(v.root.edit)
-		newroot.array[0] = v.root
-		newroot.array[1] = newPath(v.root.edit, v.shift,
-			vnodeNewFromArray(v.root.edit, v.tail))
-		v.root = newroot
-		v.shift = v.shift + bits
-		v.tail = new(array).assoc(0, value)
-	default:
-		v.root = v.pushTail(v.shift, v.root,
-			vnodeNewFromArray(v.root.edit, v.tail))
-		v.tail = new(array).assoc(0, value)
-	}
-
-	v.count = v.count + 1
+	v.typed().Append(value)
 	return v
 }
 
@@ -670,39 +455,8 @@ func (v *TVector) Conj(elem interface{}) interface{} {
 // Pop removes the last element of the vector.
 // It will panic if called after AsPersistent.
 func (v *TVector) Pop() *TVector {
-	v.ensureEditable()
-	v.makeModifiable()
-	switch {
-	case v.count == 0:
-		panic(errEmptyVector)
-	case v.count == 1:
-		v.count--
-		return v
-	case ((v.count - 1) & mask) > 0:
-		v.count--
-		return v
-	default:
-		newTail := v.editableArrayFor(v.count - 2)
-		newRoot := v.popTail(v.shift, v.root)
-		newShift := v.shift
-		if newRoot == nil {
-			newRoot = vnodeNew(v.root.edit)
-		}
-		if v.shift > bits && newRoot.array[1] == nil {
-			if newRoot.array[0] != nil {
-				newRoot = v.ensureEditableNode(
-					newRoot.array[0].(*vnode))
-			} else {
-				newRoot = vnodeNew(v.root.edit)
-			}
-			newShift = newShift - bits
-		}
-		v.root = newRoot
-		v.shift = newShift
-		v.count = v.count - 1
-		v.tail = newTail
-		return v
-	}
+	v.typed().Pop()
+	return v
 }
 
 // Length returns the number of elements in the vector.
@@ -713,25 +467,7 @@ func (v *TVector) Length() int {
 // AsPersistent will transform this transient vector into a persistent vector.
 // Once this occurs any additional actions on the transient vector will panic.
 func (v *TVector) AsPersistent() *Vector {
-	v.ensureEditable()
-	if !v.modified {
-		return v.orig
-	}
-	atomic.StoreInt32(v.root.edit, 0)
-	if v.count == 0 {
-		return Empty()
-	}
-	root := v.root
-	if v.tailOffset() == 0 {
-		root = emptyNode
-	}
-	trimmedTail := sliceNewFromSlice(v.tail[:v.count-v.tailOffset()])
-	return &Vector{
-		count: v.count,
-		shift: v.shift,
-		root:  root,
-		tail:  trimmedTail,
-	}
+	return (*Vector)(v.typed().AsPersistent())
 }
 
 // MakePersistent is a generic version of AsPersistent.
@@ -741,7 +477,7 @@ func (v *TVector) MakePersistent() interface{} {
 
 // String coverts the vector to a string representation.
 func (v *TVector) String() string {
-	return vectorString(v)
+	return v.typed().String()
 }
 
 // Range calls the passed in function on each element of the vector.
@@ -782,11 +518,7 @@ func (v *TVector) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 
-	cont := true
-	for i := 0; i < v.Length() && cont; i++ {
-		value := v.At(i)
-		cont = f(i, value)
-	}
+	v.typed().Range(f)
 }
 
 // Reduce is a fast mechanism for reducing a Vector. Reduce can take
@@ -827,369 +559,48 @@ func (v *TVector) Apply(args ...interface{}) interface{} {
 // Delete removes the element at the current index, shifting the others
 // down and yeilding a vector with one fewer elements.
 func (v *TVector) Delete(idx int) *TVector {
-	v.ensureEditable()
-	v.makeModifiable()
-	if idx < 0 || idx >= v.count {
-		panic(errOutOfBounds)
-	}
-
-	for i := idx; i < v.Length()-1; i++ {
-		v = v.Assoc(i, v.At(i+1))
-	}
-	return v.Pop()
-
+	v.typed().Delete(idx)
+	return v
 }
 
 // Insert adds the value to the vector at the provided index shifting the
 // other values down. This yeilds a vector with an additional value at the
 // provided index.
 func (v *TVector) Insert(idx int, val interface{}) *TVector {
-	v.ensureEditable()
-	v.makeModifiable()
-	if idx < 0 || idx >= v.count {
-		panic(errOutOfBounds)
-	}
-	v = v.Append(nil)
-	for i := v.Length() - 1; i > idx; i-- {
-		v = v.Assoc(i, v.At(i-1))
-	}
-	return v.Assoc(idx, val)
-}
-
-func (v *TVector) roomInTail() bool {
-	return (v.count - v.tailOffset()) < width
-}
-
-func (v *TVector) overflowsRoot() bool {
-	return (v.count >> bits) > (1 << v.shift)
-}
-
-func (v *TVector) pushTail(
-	level uint,
-	parent *vnode,
-	tailnode *vnode,
-) *vnode {
-	subidx := ((v.count - 1) >> level) & mask
-	ret := v.ensureEditableNode(parent)
-	var nodeToInsert *vnode
-	if isLeaf(level) {
-		nodeToInsert = tailnode
-	} else {
-		child := parent.array[subidx]
-		if child != nil {
-			nodeToInsert =
-				v.pushTail(level-bits, child.(*vnode), tailnode)
-		} else {
-			nodeToInsert =
-				newPath(v.root.edit, level-bits, tailnode)
-		}
-	}
-	ret.array[subidx] = nodeToInsert
-	return ret
-}
-
-func (v *TVector) popTail(level uint, n *vnode) *vnode {
-	n = v.ensureEditableNode(n)
-	subidx := ((v.count - 2) >> level) & mask
-	switch {
-	case level > bits:
-		newChild := v.popTail(level-bits, n.array[subidx].(*vnode))
-		if newChild == nil && subidx == 0 {
-			return nil
-		}
-		if newChild == nil {
-			n.array[subidx] = nil
-		} else {
-			n.array[subidx] = newChild
-		}
-		return n
-	case subidx == 0:
-		return nil
-	default:
-		n.array[subidx] = nil
-		return n
-	}
-}
-
-func (v *TVector) arrayFor(i int) *array {
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		return v.tail
-	default:
-		n := v.root
-		for level := v.shift; level > 0; level -= bits {
-			n = n.array[(i>>level)&mask].(*vnode)
-		}
-		return n.array
-	}
-}
-
-func (v *TVector) editableArrayFor(i int) *array {
-	switch {
-	case i < 0 || i >= v.count:
-		panic(errOutOfBounds)
-	case i >= v.tailOffset():
-		return v.tail
-	default:
-		n := v.root
-		for level := v.shift; level > 0; level -= bits {
-			n = v.ensureEditableNode(
-				n.array[(i>>level)&mask].(*vnode))
-		}
-		return n.array
-	}
-}
-
-func (v *TVector) tailOffset() int {
-	if v.count < width {
-		return 0
-	}
-	return ((v.count - 1) >> bits) << bits
-}
-
-func (v *TVector) ensureEditable() {
-	if !v.modified {
-		return
-	}
-	if atomic.LoadInt32(v.root.edit) == 0 {
-		panic(errTafterP)
-	}
-}
-
-func (v *TVector) makeModifiable() {
-	if v.modified {
-		return
-	}
-	tail := new(array)
-	copy(tail[:], v.orig.tail)
-	v.tail = tail
-	v.root = v.orig.root.editable()
-	v.modified = true
-}
-
-func (v *TVector) ensureEditableNode(node *vnode) *vnode {
-	if node.edit == v.root.edit {
-		return node
-	}
-	return node.editable()
-}
-
-func (v *TVector) doAssoc(
-	level uint,
-	n *vnode,
-	i int,
-	value interface{},
-) *vnode {
-	ret := v.ensureEditableNode(n)
-	if level == 0 {
-		ret.array[i&mask] = value
-	} else {
-		subidx := (i >> level) & mask
-		ret.array[subidx] =
-			v.doAssoc(level-bits,
-				n.array[subidx].(*vnode), i, value)
-	}
-	return ret
-}
-
-type vnode struct {
-	array *array
-	edit  *int32
-}
-
-func (n *vnode) clone() *vnode {
-	return &vnode{
-		edit:  n.edit,
-		array: n.array.copy(),
-	}
-}
-
-func (n *vnode) editable() *vnode {
-	tmp := n.clone()
-	tmp.edit = atomicOne()
-	return tmp
-}
-
-func vnodeNew(edit *int32) *vnode {
-	return &vnode{edit: edit, array: new(array)}
-}
-
-func vnodeNewFromArray(edit *int32, a *array) *vnode {
-	n := &vnode{edit: edit, array: a}
-	return n
-}
-
-func vnodeNewFromSlice(edit *int32, s slice) *vnode {
-	return vnodeNewFromArray(edit, arrayNewFromSlice(s))
-}
-
-type arrayI interface {
-	at(idx int) interface{}
-	toSlice() slice
-}
-type array [width]interface{}
-
-func (a *array) copy() *array {
-	var tmp array
-	copy(tmp[:], a[:])
-	return &tmp
-}
-
-func (a *array) assoc(i int, v interface{}) *array {
-	a[i] = v
-	return a
-}
-
-func (a *array) toSlice() slice {
-	return a[:]
-}
-
-func (a *array) at(idx int) interface{} {
-	return a[idx]
-}
-
-type slice []interface{}
-
-func sliceNewFromSlice(in slice) slice {
-	return in.copy()
-}
-
-func (a slice) copy() slice {
-	tmp := make(slice, len(a))
-	copy(tmp, a)
-	return tmp
-}
-
-func (a slice) assoc(i int, v interface{}) slice {
-	a[i] = v
-	return a
-}
-
-func (a slice) append(vs ...interface{}) slice {
-	return append(a, vs...)
-}
-
-func (a slice) appendExact(vs ...interface{}) slice {
-	tmp := make(slice, len(a)+len(vs))
-	copy(tmp, a)
-	copy(tmp[len(a):], vs)
-	return tmp
-}
-
-func (a slice) toSlice() slice {
-	return a
-}
-
-func (a slice) at(idx int) interface{} {
-	return a[idx]
-}
-
-func arrayNewFromSlice(in []interface{}) *array {
-	var out array
-	copy(out[:], in)
-	return &out
-}
-
-func isLeaf(level uint) bool {
-	return level == 5
-}
-
-func newPath(edit *int32, level uint, node *vnode) *vnode {
-	if level == 0 {
-		return node
-	}
-	ret := vnodeNew(edit)
-	ret.array[0] = newPath(edit, level-bits, node)
-	return ret
-}
-
-func atomicInt(i int32) *int32 {
-	var atom = new(int32)
-	atomic.StoreInt32(atom, i)
-	return atom
-}
-
-func atomicZero() *int32 {
-	return atomicInt(0)
-}
-
-func atomicOne() *int32 {
-	return atomicInt(1)
-}
-
-type vectorSequence struct {
-	vec interface {
-		At(int) interface{}
-		Length() int
-	}
-	idx int
-}
-
-func (seq *vectorSequence) First() interface{} {
-	return seq.vec.At(seq.idx)
-}
-
-func (seq *vectorSequence) Next() seq.Sequence {
-	if seq.idx+1 == seq.vec.Length() {
-		return nil
-	}
-	return &vectorSequence{
-		vec: seq.vec,
-		idx: seq.idx + 1,
-	}
+	v.typed().Insert(idx, val)
+	return v
 }
 
-func (s *vectorSequence) String() string {
-	return seq.ConvertToString(s)
+func (v *TVector) typed() *TVectorOf[interface{}] {
+	return (*TVectorOf[interface{}])(v)
 }
 
 // Slice is a view of an underlying persistent vector.
 // For the most part a Slice shares semantics with a go slice,
 // except that changes do not modify the underlying vector;
 // instead returning a view of a new persistent vector that
-// shares structure with the original vector.
-type Slice struct {
-	vector     *Vector
-	start, end int
-}
+// shares structure with the original vector. Like a SliceOf, a Slice
+// narrowed far enough from the front is compacted so that it no longer
+// keeps the elements before it alive.
+type Slice SliceOf[interface{}]
 
 // At returns the element at the supplied index. It will panic if out of bounds.
 func (s *Slice) At(i int) interface{} {
-	if (s.start+i >= s.end) || (i < 0) {
-		panic(errOutOfBounds)
-	}
-	return s.vector.At(s.start + i)
+	return s.typed().At(i)
 }
 
 // Find returns the value at the supplied index and if that index was
 // in bounds for the vector. Out of bounds access does not panic but
 // returns (nil, false). idx must be an int.
 func (s *Slice) Find(idx interface{}) (interface{}, bool) {
-	i := idx.(int)
-	if i < 0 || i >= s.Length() {
-		return nil, false
-	}
-	return s.At(i), true
+	return s.typed().Find(idx.(int))
 }
 
 // Append will extend the vector and associates the value with new last
 // element. This will return a new copy of the immutable vector sharing
 // structure with the original vector.
 func (s *Slice) Append(v interface{}) *Slice {
-	if s.end == s.vector.Length() {
-		return &Slice{
-			vector: s.vector.Append(v),
-			start:  s.start,
-			end:    s.end + 1,
-		}
-	}
-	return &Slice{
-		vector: s.vector.Assoc(s.end, v),
-		start:  s.start,
-		end:    s.end + 1,
-	}
+	return (*Slice)(s.typed().Append(v))
 }
 
 // Conj will extend the vector and associates the value with new last
@@ -1201,14 +612,7 @@ func (s *Slice) Conj(elem interface{}) interface{} {
 // Assoc associates the value with the index in an immutable copy of the vector
 // sharing structure with the original vector.
 func (s *Slice) Assoc(i int, v interface{}) *Slice {
-	if (s.start+i >= s.end) || (i < 0) {
-		panic(errOutOfBounds)
-	}
-	return &Slice{
-		vector: s.vector.Assoc(s.start+i, v),
-		start:  s.start,
-		end:    s.end,
-	}
+	return (*Slice)(s.typed().Assoc(i, v))
 }
 
 // Length returns the number of elements in the vector.
@@ -1218,25 +622,18 @@ func (s *Slice) Length() int {
 
 // Slice will further limit the view of this slice.
 func (s *Slice) Slice(start, end int) *Slice {
-	newEnd := s.start + start + (end - start)
-	if start < 0 || newEnd > s.end {
-		panic(errOutOfBounds)
-	}
-	return &Slice{
-		vector: s.vector,
-		start:  s.start + start,
-		end:    newEnd,
-	}
+	return (*Slice)(s.typed().Slice(start, end))
+}
+
+// Materialize returns a vector of the elements of the slice that does
+// not keep the rest of the slice's vector alive.
+func (s *Slice) Materialize() *Vector {
+	return (*Vector)(s.typed().Materialize())
 }
 
 // Seq returns a seq.Sequence that will traverse the vector.
 func (s *Slice) Seq() seq.Sequence {
-	if s.Length() == 0 {
-		return nil
-	}
-	return &vectorSequence{
-		vec: s,
-	}
+	return s.typed().Seq()
 }
 
 // Equal compares each value of the slice to determine if the slice is
@@ -1246,21 +643,12 @@ func (s *Slice) Equal(o interface{}) bool {
 	if !ok {
 		return false
 	}
-	if s.Length() != other.Length() {
-		return false
-	}
-	for i := 0; i < s.Length(); i++ {
-		val := s.At(i)
-		if !dyn.Equal(other.At(i), val) {
-			return false
-		}
-	}
-	return true
+	return s.typed().Equal(other.typed())
 }
 
 // String coverts the vector to a string representation.
 func (s *Slice) String() string {
-	return vectorString(s)
+	return s.typed().String()
 }
 
 // Range calls the passed in function on each element of the slice.
@@ -1301,11 +689,7 @@ func (s *Slice) Range(do interface{}) {
 		f = genRangeFunc(do)
 	}
 
-	cont := true
-	for i := 0; i < s.Length() && cont; i++ {
-		value := s.At(i)
-		cont = f(i, value)
-	}
+	s.typed().Range(f)
 }
 
 // Reduce is a fast mechanism for reducing a Vector. Reduce can take
@@ -1343,18 +727,20 @@ func (s *Slice) Apply(args ...interface{}) interface{} {
 	return s.At(idx)
 }
 
-func vectorString(v interface {
-	At(int) interface{}
-	Length() int
-}) string {
-	buf := new(bytes.Buffer)
-	fmt.Fprint(buf, "[")
-	if v.Length() != 0 {
-		fmt.Fprint(buf, v.At(0))
-	}
-	for i := 1; i < v.Length(); i++ {
-		fmt.Fprintf(buf, " %v", v.At(i))
-	}
-	fmt.Fprint(buf, "]")
-	return buf.String()
+func (s *Slice) typed() *SliceOf[interface{}] {
+	return (*SliceOf[interface{}])(s)
+}
+
+func atomicInt(i int32) *int32 {
+	var atom = new(int32)
+	atomic.StoreInt32(atom, i)
+	return atom
+}
+
+func atomicZero() *int32 {
+	return atomicInt(0)
+}
+
+func atomicOne() *int32 {
+	return atomicInt(1)
 }
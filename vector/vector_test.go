@@ -1,6 +1,9 @@
 package vector
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -1256,3 +1259,70 @@ func TestReduce(t *testing.T) {
 		}
 	})
 }
+
+func TestJSON(t *testing.T) {
+	v := New(1.0, "two", true, nil)
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[1,"two",true,null]` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+	var got Vector
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(v) {
+		t.Fatalf("expected %v, got %v", v, &got)
+	}
+	var typed *VectorOf[int]
+	if err := json.Unmarshal([]byte(`[1,2,3]`), &typed); err != nil {
+		t.Fatal(err)
+	}
+	if !typed.Equal(NewOf(1, 2, 3)) {
+		t.Fatalf("unexpected typed vector %v", typed)
+	}
+	if data, _ := json.Marshal(EmptyOf[int]()); string(data) != "[]" {
+		t.Fatalf("unexpected encoding of empty vector %s", data)
+	}
+	if err := json.Unmarshal(data, Empty()); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type snapshot struct {
+		Value *Vector
+	}
+	in := snapshot{Value: New(1, "two", nil, 4.5)}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out snapshot
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Value.Equal(in.Value) {
+		t.Fatalf("expected %v, got %v", in.Value, out.Value)
+	}
+	data, err := in.Value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Vector).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated encoding")
+	}
+	typed, err := NewOf(1, 2, 3).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got VectorOf[int]
+	if err := got.UnmarshalBinary(typed); err != nil || !got.Equal(NewOf(1, 2, 3)) {
+		t.Fatalf("unexpected typed vector %v, %v", &got, err)
+	}
+	if err := Empty().UnmarshalBinary(data); err != errUnmarshalEmpty {
+		t.Fatalf("expected error decoding into Empty, got %v", err)
+	}
+}
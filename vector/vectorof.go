@@ -0,0 +1,1106 @@
+package vector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"jsouthworth.net/go/dyn"
+	"jsouthworth.net/go/immutable/internal/binenc"
+	"jsouthworth.net/go/seq"
+)
+
+// VectorOf is a persistent immutable vector of elements of type T.
+// Operations on this structure will return modified copies of the
+// original vector sharing much of the structure with the original.
+// The leaves of the trie hold the elements directly so no boxing
+// occurs when storing values that are not interfaces.
+type VectorOf[T any] struct {
+	count int
+	shift uint
+	root  *vnode[T]
+	tail  []T
+}
+
+var emptyNode = vnodeNew[interface{}](atomicZero())
+
+var empty = VectorOf[interface{}]{
+	count: 0,
+	shift: bits,
+	root:  emptyNode,
+	tail:  make([]interface{}, 0),
+}
+
+// EmptyOf returns the empty vector of T.
+func EmptyOf[T any]() *VectorOf[T] {
+	if e, ok := interface{}(&empty).(*VectorOf[T]); ok {
+		return e
+	}
+	return &VectorOf[T]{
+		count: 0,
+		shift: bits,
+		root:  vnodeNew[T](atomicZero()),
+		tail:  make([]T, 0),
+	}
+}
+
+// NewOf converts a list of elements to a persistent vector.
+func NewOf[T any](elems ...T) *VectorOf[T] {
+	return FromSliceOf(elems)
+}
+
+// FromSliceOf returns a vector holding a copy of elems. The elements
+// are copied straight into full leaves and the levels above them are
+// built bottom up, taking O(n) time.
+func FromSliceOf[T any](elems []T) *VectorOf[T] {
+	if len(elems) == 0 {
+		return EmptyOf[T]()
+	}
+	// The tail holds the last 1 to width elements.
+	tailOff := (len(elems) - 1) &^ (width - 1)
+	out := &VectorOf[T]{
+		count: len(elems),
+		shift: bits,
+		root:  EmptyOf[T]().root,
+		tail:  copySlice(elems[tailOff:]),
+	}
+	if tailOff == 0 {
+		return out
+	}
+	nodes := make([]*vnode[T], 0, tailOff/width)
+	for i := 0; i < tailOff; i += width {
+		nodes = append(nodes, vnodeNewFromSlice[T](nil, elems[i:i+width]))
+	}
+	for {
+		parents := make([]*vnode[T], 0, (len(nodes)+width-1)/width)
+		for i := 0; i < len(nodes); i += width {
+			parent := vnodeNew[T](nil)
+			copy(parent.nodes[:], nodes[i:min(i+width, len(nodes))])
+			parents = append(parents, parent)
+		}
+		if len(parents) == 1 {
+			out.root = parents[0]
+			return out
+		}
+		nodes = parents
+		out.shift += bits
+	}
+}
+
+// At returns the element at the supplied index. It will panic if out of bounds.
+func (v *VectorOf[T]) At(i int) T {
+	switch {
+	case i < 0 || i >= v.count:
+		panic(errOutOfBounds)
+	case i >= v.tailOffset():
+		return v.tail[i-v.tailOffset()]
+	default:
+		n, j := v.root.leafFor(v.shift, i)
+		return n.array[j]
+	}
+}
+
+// Find returns the value at the supplied index and if that index was
+// in bounds for the vector. Out of bounds access does not panic but
+// returns the zero value of T and false.
+func (v *VectorOf[T]) Find(i int) (T, bool) {
+	if i < 0 || i >= v.Length() {
+		var none T
+		return none, false
+	}
+	return v.At(i), true
+}
+
+// Assoc associates the value with the index in an immutable copy of the vector
+// sharing structure with the original vector.
+func (v *VectorOf[T]) Assoc(i int, value T) *VectorOf[T] {
+	switch {
+	case i < 0 || i >= v.count:
+		panic(errOutOfBounds)
+	case i >= v.tailOffset():
+		tail := copySlice(v.tail)
+		tail[i-v.tailOffset()] = value
+		return &VectorOf[T]{
+			count: v.count,
+			shift: v.shift,
+			root:  v.root,
+			tail:  tail,
+		}
+	default:
+		return &VectorOf[T]{
+			count: v.count,
+			shift: v.shift,
+			root:  v.root.assoc(nil, v.shift, i, value),
+			tail:  v.tail,
+		}
+	}
+}
+
+// Append will extend the vector and associates the value with new last
+// element. This will return a new copy of the immutable vector sharing
+// structure with the original vector.
+func (v *VectorOf[T]) Append(value T) *VectorOf[T] {
+	if v == nil {
+		return EmptyOf[T]().Append(value)
+	}
+	switch {
+	case v.roomInTail():
+		return &VectorOf[T]{
+			count: v.count + 1,
+			shift: v.shift,
+			root:  v.root,
+			tail:  appendExact(v.tail, value),
+		}
+	default:
+		root, shift := pushTail(nil, v.root, v.shift, v.tailOffset(),
+			vnodeNewFromSlice(nil, v.tail), len(v.tail))
+		return &VectorOf[T]{
+			count: v.count + 1,
+			shift: shift,
+			root:  root,
+			tail:  []T{value},
+		}
+	}
+}
+
+// Conj will extend the vector and associates the value with new last
+// element. Conj implements a generic mechanism for building collections.
+// elem must be of type T.
+func (v *VectorOf[T]) Conj(elem interface{}) interface{} {
+	return v.Append(elem.(T))
+}
+
+// Delete removes the element at the current index, shifting the others
+// down and yeilding a vector with one fewer elements. The vector is
+// split around the element and joined again so Delete takes O(log n)
+// time.
+func (v *VectorOf[T]) Delete(idx int) *VectorOf[T] {
+	switch {
+	case idx < 0 || idx >= v.count:
+		panic(errOutOfBounds)
+	case idx == v.count-1:
+		return v.Pop()
+	default:
+		return v.take(idx).Concat(v.drop(idx + 1))
+	}
+}
+
+// Insert adds the value to the vector at the provided index shifting the
+// other values down. This yeilds a vector with an additional value at the
+// provided index. The vector is split at the index and joined again so
+// Insert takes O(log n) time.
+func (v *VectorOf[T]) Insert(idx int, val T) *VectorOf[T] {
+	if idx < 0 || idx >= v.count {
+		panic(errOutOfBounds)
+	}
+	return v.take(idx).Append(val).Concat(v.drop(idx))
+}
+
+// Concat returns a vector holding the elements of v followed by the
+// elements of o. The trees of the two vectors are joined, rebalancing
+// only the nodes along the join, so Concat takes O(log n) time and the
+// result shares most of its structure with v and o.
+func (v *VectorOf[T]) Concat(o *VectorOf[T]) *VectorOf[T] {
+	switch {
+	case o.Length() == 0:
+		return v
+	case v.Length() == 0:
+		return o
+	case o.tailOffset() == 0:
+		out := v.AsTransient()
+		for _, elem := range o.tail {
+			out.Append(elem)
+		}
+		return out.AsPersistent()
+	}
+	root, shift := pushTail(nil, v.root, v.shift, v.tailOffset(),
+		vnodeNewFromSlice(nil, v.tail), len(v.tail))
+	root, shift = concatTrees(
+		span[T]{node: root, size: v.count}, shift,
+		span[T]{node: o.root, size: o.tailOffset()}, o.shift)
+	return &VectorOf[T]{
+		count: v.count + o.count,
+		shift: shift,
+		root:  root,
+		tail:  o.tail,
+	}
+}
+
+// SplitAt returns a vector of the first i elements of v and a vector of
+// the remaining elements. Both share structure with v and SplitAt takes
+// O(log n) time. It will panic if i is out of bounds.
+func (v *VectorOf[T]) SplitAt(i int) (*VectorOf[T], *VectorOf[T]) {
+	if i < 0 || i > v.Length() {
+		panic(errOutOfBounds)
+	}
+	return v.take(i), v.drop(i)
+}
+
+// SubVector returns a vector of the elements of v from start up to but
+// not including end. Unlike a SliceOf the result is a vector in its own
+// right that does not refer to the elements of v outside of it. It
+// will panic if start or end are out of bounds.
+func (v *VectorOf[T]) SubVector(start, end int) *VectorOf[T] {
+	if start < 0 || end > v.Length() || start > end {
+		panic(errOutOfBounds)
+	}
+	return v.drop(start).take(end - start)
+}
+
+// Equal compares each value of the vector to determine if the vector is
+// equal to the one passed in.
+func (v *VectorOf[T]) Equal(o interface{}) bool {
+	other, ok := o.(*VectorOf[T])
+	if !ok {
+		return false
+	}
+	if v.Length() != other.Length() {
+		return false
+	}
+	for i := 0; i < v.Length(); i++ {
+		val := v.At(i)
+		if !dyn.Equal(other.At(i), val) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pop removes the last element of the vector,
+// returning an immutable copy of the vector
+// with one less element, sharing structure with
+// the original vector.
+func (v *VectorOf[T]) Pop() *VectorOf[T] {
+	switch {
+	case v.count == 0:
+		panic(errEmptyVector)
+	case v.count == 1:
+		return EmptyOf[T]()
+	case len(v.tail) > 1:
+		return &VectorOf[T]{
+			count: v.count - 1,
+			shift: v.shift,
+			root:  v.root,
+			tail:  copySlice(v.tail[:len(v.tail)-1]),
+		}
+	default:
+		root, shift, leaf, n := popTail(nil, v.root, v.shift,
+			v.tailOffset())
+		return &VectorOf[T]{
+			count: v.count - 1,
+			shift: shift,
+			root:  root,
+			tail:  leaf.array[:n],
+		}
+	}
+}
+
+// Length returns the number of elements in the vector.
+func (v *VectorOf[T]) Length() int {
+	if v == nil {
+		return 0
+	}
+	return v.count
+}
+
+// AsTransient will return a mutable version of the
+// vector that may be used to perform mutations in
+// a controlled way.
+func (v *VectorOf[T]) AsTransient() *TVectorOf[T] {
+	return &TVectorOf[T]{
+		count: v.count,
+		shift: v.shift,
+		orig:  v,
+	}
+}
+
+// MakeTransient is a generic version of AsTransient.
+func (v *VectorOf[T]) MakeTransient() interface{} {
+	return v.AsTransient()
+}
+
+// AsNative will traverse the vector and return a
+// go native representation of the values contained within.
+func (v *VectorOf[T]) AsNative() []T {
+	out := make([]T, 0, v.Length())
+	v.Range(func(_ int, val T) bool {
+		out = append(out, val)
+		return true
+	})
+	return out
+}
+
+// MarshalJSON implements json.Marshaler encoding the vector as a JSON
+// array.
+func (v *VectorOf[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.AsNative())
+}
+
+// UnmarshalJSON implements json.Unmarshaler decoding a JSON array
+// into the vector. The vector is built with a transient. The vector
+// returned by Empty is shared and may not be decoded into.
+func (v *VectorOf[T]) UnmarshalJSON(data []byte) error {
+	if interface{}(v) == interface{}(&empty) {
+		return errUnmarshalEmpty
+	}
+	var elems []T
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*v = *NewOf(elems...)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using a versioned
+// format. Elements whose type implements encoding.BinaryMarshaler
+// encode themselves, others are encoded with gob so the concrete
+// types held in interface{} elements must be registered with
+// gob.Register.
+func (v *VectorOf[T]) MarshalBinary() ([]byte, error) {
+	return binenc.MarshalSeq(binenc.Vector, v.count, func(fn func(T) bool) {
+		v.Range(func(_ int, elem T) bool {
+			return fn(elem)
+		})
+	})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler decoding the
+// format produced by MarshalBinary. The vector is built with a
+// transient. The vector returned by Empty is shared and may not be
+// decoded into.
+func (v *VectorOf[T]) UnmarshalBinary(data []byte) error {
+	if interface{}(v) == interface{}(&empty) {
+		return errUnmarshalEmpty
+	}
+	out := EmptyOf[T]().AsTransient()
+	err := binenc.UnmarshalSeq(data, binenc.Vector, func(elem T) {
+		out.Append(elem)
+	})
+	if err != nil {
+		return err
+	}
+	*v = *out.AsPersistent()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder using MarshalBinary.
+func (v *VectorOf[T]) GobEncode() ([]byte, error) {
+	return v.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder using UnmarshalBinary.
+func (v *VectorOf[T]) GobDecode(data []byte) error {
+	return v.UnmarshalBinary(data)
+}
+
+// String coverts the vector to a string representation.
+func (v *VectorOf[T]) String() string {
+	return vectorString[T](v)
+}
+
+// Seq returns a seq.Sequence that will traverse the vector.
+func (v *VectorOf[T]) Seq() seq.Sequence {
+	if v.Length() == 0 {
+		return nil
+	}
+	return &vectorSequence[T]{
+		vec: v,
+	}
+}
+
+// Slice returns a SliceOf structure that has the semantics of go slices
+// over the immutable vector. The slice is a view that keeps v alive
+// unless start is at least compactAt; SubVector returns a compact
+// vector instead.
+func (v *VectorOf[T]) Slice(start, end int) *SliceOf[T] {
+	if start < 0 || end > v.Length() {
+		panic(errOutOfBounds)
+	}
+	return sliceOf(v, start, end)
+}
+
+// Range calls do on each element of the vector, in order, until do
+// returns false.
+func (v *VectorOf[T]) Range(do func(idx int, value T) bool) {
+	for i := 0; i < v.Length(); {
+		arr := v.arrayFor(i)
+		for j := range arr {
+			if !do(i+j, arr[j]) {
+				return
+			}
+		}
+		i += len(arr)
+	}
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows vector to be called
+// as a function by the 'dyn' library.
+func (v *VectorOf[T]) Apply(args ...interface{}) interface{} {
+	idx := args[0].(int)
+	return v.At(idx)
+}
+
+// Transform takes a set of actions and performs them
+// on the persistent vector. It does this by making a transient
+// vector and calling each action on it, then converting it back
+// to a persistent vector.
+func (v *VectorOf[T]) Transform(actions ...func(*TVectorOf[T]) *TVectorOf[T]) *VectorOf[T] {
+	out := v.AsTransient()
+	for _, action := range actions {
+		out = action(out)
+	}
+	return out.AsPersistent()
+}
+
+func (v *VectorOf[T]) tailOffset() int {
+	return v.count - len(v.tail)
+}
+
+// arrayFor returns the elements from i to the end of the leaf, or the
+// tail, that holds i.
+func (v *VectorOf[T]) arrayFor(i int) []T {
+	switch {
+	case i < 0 || i >= v.count:
+		panic(errOutOfBounds)
+	case i >= v.tailOffset():
+		return v.tail[i-v.tailOffset():]
+	default:
+		return v.root.leafSlice(v.shift, v.tailOffset(), i)
+	}
+}
+
+func (v *VectorOf[T]) roomInTail() bool {
+	return len(v.tail) < width
+}
+
+// take returns a vector of the first i elements of v.
+func (v *VectorOf[T]) take(i int) *VectorOf[T] {
+	switch {
+	case i == 0:
+		return EmptyOf[T]()
+	case i == v.count:
+		return v
+	case i > v.tailOffset():
+		return &VectorOf[T]{
+			count: i,
+			shift: v.shift,
+			root:  v.root,
+			tail:  copySlice(v.tail[:i-v.tailOffset()]),
+		}
+	}
+	root, shift, leaf, n := popTail(nil,
+		v.root.take(v.shift, v.tailOffset(), i), v.shift, i)
+	return &VectorOf[T]{
+		count: i,
+		shift: shift,
+		root:  root,
+		tail:  leaf.array[:n],
+	}
+}
+
+// drop returns a vector of v without its first i elements.
+func (v *VectorOf[T]) drop(i int) *VectorOf[T] {
+	switch {
+	case i == 0:
+		return v
+	case i == v.count:
+		return EmptyOf[T]()
+	case i >= v.tailOffset():
+		return &VectorOf[T]{
+			count: v.count - i,
+			shift: bits,
+			root:  EmptyOf[T]().root,
+			tail:  copySlice(v.tail[i-v.tailOffset():]),
+		}
+	}
+	size := v.tailOffset() - i
+	root, shift := trim(v.root.drop(v.shift, v.tailOffset(), i),
+		v.shift, size)
+	return &VectorOf[T]{
+		count: v.count - i,
+		shift: shift,
+		root:  root,
+		tail:  v.tail,
+	}
+}
+
+// TVectorOf is a transient version of a VectorOf. Changes made to a
+// transient vector will not effect the original persistent
+// structure. Changes occur as mutation of the transient. The changes
+// made will become immutable when AsPersistent is called.
+type TVectorOf[T any] struct {
+	count   int
+	shift   uint
+	root    *vnode[T]
+	tail    *[width]T
+	tailLen int
+	edit    *int32
+
+	modified bool
+	orig     *VectorOf[T]
+}
+
+// At returns the element at the supplied index.
+// It will panic if out of bounds or called after AsPersistent.
+func (v *TVectorOf[T]) At(i int) T {
+	v.ensureEditable()
+	if !v.modified {
+		return v.orig.At(i)
+	}
+	return v.arrayFor(i)[0]
+}
+
+// Find returns the value at the supplied index and if that index was
+// in bounds for the vector. Out of bounds access does not panic but
+// returns the zero value of T and false.
+func (v *TVectorOf[T]) Find(i int) (T, bool) {
+	if i < 0 || i >= v.Length() {
+		var none T
+		return none, false
+	}
+	return v.At(i), true
+}
+
+// Assoc associates the value with the index.
+// It will panic if called after AsPersistent.
+func (v *TVectorOf[T]) Assoc(i int, value T) *TVectorOf[T] {
+	v.ensureEditable()
+	v.makeModifiable()
+	switch {
+	case i < 0 || i >= v.count:
+		panic(errOutOfBounds)
+	case i >= v.tailOffset():
+		v.tail[i-v.tailOffset()] = value
+		return v
+	default:
+		v.root = v.root.assoc(v.edit, v.shift, i, value)
+		return v
+	}
+}
+
+// Append will extend the vector and associates the value with new last
+// element. It will panic if called after AsPersistent.
+func (v *TVectorOf[T]) Append(value T) *TVectorOf[T] {
+	v.ensureEditable()
+	v.makeModifiable()
+	if !v.roomInTail() {
+		v.root, v.shift = pushTail(v.edit, v.root, v.shift, v.tailOffset(),
+			vnodeNewFromArray(v.edit, v.tail), v.tailLen)
+		v.tail = new([width]T)
+		v.tailLen = 0
+	}
+	v.tail[v.tailLen] = value
+	v.tailLen++
+	v.count++
+	return v
+}
+
+// Conj will extend the vector and associates the value with new last
+// element. Conj implements a generic mechanism for building collections.
+// elem must be of type T.
+func (v *TVectorOf[T]) Conj(elem interface{}) interface{} {
+	return v.Append(elem.(T))
+}
+
+// Pop removes the last element of the vector.
+// It will panic if called after AsPersistent.
+func (v *TVectorOf[T]) Pop() *TVectorOf[T] {
+	v.ensureEditable()
+	v.makeModifiable()
+	switch {
+	case v.count == 0:
+		panic(errEmptyVector)
+	case v.count == 1 || v.tailLen > 1:
+		v.count--
+		v.tailLen--
+		return v
+	default:
+		root, shift, leaf, n := popTail(v.edit, v.root, v.shift,
+			v.tailOffset())
+		v.root = root
+		v.shift = shift
+		v.count--
+		v.tail = leaf.array
+		if leaf.edit != v.edit {
+			v.tail = copyArray(leaf.array)
+		}
+		v.tailLen = n
+		return v
+	}
+}
+
+// Length returns the number of elements in the vector.
+func (v *TVectorOf[T]) Length() int {
+	return v.count
+}
+
+// AsPersistent will transform this transient vector into a persistent vector.
+// Once this occurs any additional actions on the transient vector will panic.
+func (v *TVectorOf[T]) AsPersistent() *VectorOf[T] {
+	v.ensureEditable()
+	if !v.modified {
+		return v.orig
+	}
+	atomic.StoreInt32(v.edit, 0)
+	if v.count == 0 {
+		return EmptyOf[T]()
+	}
+	root, shift := v.root, v.shift
+	if v.tailOffset() == 0 {
+		root, shift = EmptyOf[T]().root, bits
+	}
+	return &VectorOf[T]{
+		count: v.count,
+		shift: shift,
+		root:  root,
+		tail:  copySlice(v.tail[:v.tailLen]),
+	}
+}
+
+// MakePersistent is a generic version of AsPersistent.
+func (v *TVectorOf[T]) MakePersistent() interface{} {
+	return v.AsPersistent()
+}
+
+// String coverts the vector to a string representation.
+func (v *TVectorOf[T]) String() string {
+	return vectorString[T](v)
+}
+
+// Range calls do on each element of the vector, in order, until do
+// returns false.
+func (v *TVectorOf[T]) Range(do func(idx int, value T) bool) {
+	v.ensureEditable()
+	if !v.modified {
+		v.orig.Range(do)
+		return
+	}
+	for i := 0; i < v.Length(); {
+		arr := v.arrayFor(i)
+		for j := range arr {
+			if !do(i+j, arr[j]) {
+				return
+			}
+		}
+		i += len(arr)
+	}
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows vector to be called
+// as a function by the 'dyn' library.
+func (v *TVectorOf[T]) Apply(args ...interface{}) interface{} {
+	idx := args[0].(int)
+	return v.At(idx)
+}
+
+// Delete removes the element at the current index, shifting the others
+// down and yeilding a vector with one fewer elements. Like the
+// persistent Delete it takes O(log n) time.
+func (v *TVectorOf[T]) Delete(idx int) *TVectorOf[T] {
+	v.ensureEditable()
+	v.makeModifiable()
+	v.replace(v.snapshot().Delete(idx))
+	return v
+}
+
+// Insert adds the value to the vector at the provided index shifting the
+// other values down. This yeilds a vector with an additional value at the
+// provided index. Like the persistent Insert it takes O(log n) time.
+func (v *TVectorOf[T]) Insert(idx int, val T) *TVectorOf[T] {
+	v.ensureEditable()
+	v.makeModifiable()
+	v.replace(v.snapshot().Insert(idx, val))
+	return v
+}
+
+// snapshot returns a persistent vector of the current contents of v.
+// Persistent operations copy the nodes they change so operating on the
+// snapshot does not disturb v.
+func (v *TVectorOf[T]) snapshot() *VectorOf[T] {
+	return &VectorOf[T]{
+		count: v.count,
+		shift: v.shift,
+		root:  v.root,
+		tail:  v.tail[:v.tailLen],
+	}
+}
+
+// replace makes o the contents of v. The nodes of o that v owned
+// before remain v's to change.
+func (v *TVectorOf[T]) replace(o *VectorOf[T]) {
+	v.count = o.count
+	v.shift = o.shift
+	v.root = o.root
+	v.tail = new([width]T)
+	v.tailLen = copy(v.tail[:], o.tail)
+}
+
+func (v *TVectorOf[T]) roomInTail() bool {
+	return v.tailLen < width
+}
+
+// arrayFor returns the elements from i to the end of the leaf, or the
+// tail, that holds i.
+func (v *TVectorOf[T]) arrayFor(i int) []T {
+	switch {
+	case i < 0 || i >= v.count:
+		panic(errOutOfBounds)
+	case i >= v.tailOffset():
+		return v.tail[i-v.tailOffset() : v.tailLen]
+	default:
+		return v.root.leafSlice(v.shift, v.tailOffset(), i)
+	}
+}
+
+func (v *TVectorOf[T]) tailOffset() int {
+	return v.count - v.tailLen
+}
+
+func (v *TVectorOf[T]) ensureEditable() {
+	if !v.modified {
+		return
+	}
+	if atomic.LoadInt32(v.edit) == 0 {
+		panic(errTafterP)
+	}
+}
+
+func (v *TVectorOf[T]) makeModifiable() {
+	if v.modified {
+		return
+	}
+	v.tail = new([width]T)
+	v.tailLen = copy(v.tail[:], v.orig.tail)
+	v.root = v.orig.root
+	v.edit = atomicOne()
+	v.modified = true
+}
+
+// SliceOf is a view of an underlying persistent vector.
+// For the most part a SliceOf shares semantics with a go slice,
+// except that changes do not modify the underlying vector;
+// instead returning a view of a new persistent vector that
+// shares structure with the original vector.
+//
+// A slice that would start compactAt or more elements into its
+// vector is instead made a view of a vector of just its elements, so
+// that narrowing a slice from the front, as a queue does, releases the
+// elements it no longer covers.
+type SliceOf[T any] struct {
+	vector     *VectorOf[T]
+	start, end int
+}
+
+// compactAt is the number of leading elements of its vector a slice
+// may hide before it is compacted. Compacting takes O(log n) time, so
+// a slice narrowed one element at a time is compacted once every
+// compactAt steps.
+const compactAt = 32 * width
+
+func sliceOf[T any](v *VectorOf[T], start, end int) *SliceOf[T] {
+	if start >= compactAt {
+		return &SliceOf[T]{
+			vector: v.SubVector(start, end),
+			start:  0,
+			end:    end - start,
+		}
+	}
+	return &SliceOf[T]{
+		vector: v,
+		start:  start,
+		end:    end,
+	}
+}
+
+// At returns the element at the supplied index. It will panic if out of bounds.
+func (s *SliceOf[T]) At(i int) T {
+	if (s.start+i >= s.end) || (i < 0) {
+		panic(errOutOfBounds)
+	}
+	return s.vector.At(s.start + i)
+}
+
+// Find returns the value at the supplied index and if that index was
+// in bounds for the slice. Out of bounds access does not panic but
+// returns the zero value of T and false.
+func (s *SliceOf[T]) Find(i int) (T, bool) {
+	if i < 0 || i >= s.Length() {
+		var none T
+		return none, false
+	}
+	return s.At(i), true
+}
+
+// Append will extend the slice and associates the value with new last
+// element. This will return a new view over an immutable vector sharing
+// structure with the original vector.
+func (s *SliceOf[T]) Append(v T) *SliceOf[T] {
+	if s.end == s.vector.Length() {
+		return &SliceOf[T]{
+			vector: s.vector.Append(v),
+			start:  s.start,
+			end:    s.end + 1,
+		}
+	}
+	return &SliceOf[T]{
+		vector: s.vector.Assoc(s.end, v),
+		start:  s.start,
+		end:    s.end + 1,
+	}
+}
+
+// Conj will extend the slice and associates the value with new last
+// element. Conj implements a generic mechanism for building collections.
+// elem must be of type T.
+func (s *SliceOf[T]) Conj(elem interface{}) interface{} {
+	return s.Append(elem.(T))
+}
+
+// Assoc associates the value with the index in an immutable copy of the vector
+// sharing structure with the original vector.
+func (s *SliceOf[T]) Assoc(i int, v T) *SliceOf[T] {
+	if (s.start+i >= s.end) || (i < 0) {
+		panic(errOutOfBounds)
+	}
+	return &SliceOf[T]{
+		vector: s.vector.Assoc(s.start+i, v),
+		start:  s.start,
+		end:    s.end,
+	}
+}
+
+// Length returns the number of elements in the slice.
+func (s *SliceOf[T]) Length() int {
+	return s.end - s.start
+}
+
+// Slice will further limit the view of this slice.
+func (s *SliceOf[T]) Slice(start, end int) *SliceOf[T] {
+	newEnd := s.start + start + (end - start)
+	if start < 0 || newEnd > s.end {
+		panic(errOutOfBounds)
+	}
+	return sliceOf(s.vector, s.start+start, newEnd)
+}
+
+// Materialize returns a vector of the elements of the slice. The
+// vector shares the nodes of the slice's vector that hold those
+// elements and does not keep the others alive.
+func (s *SliceOf[T]) Materialize() *VectorOf[T] {
+	return s.vector.SubVector(s.start, s.end)
+}
+
+// Seq returns a seq.Sequence that will traverse the slice.
+func (s *SliceOf[T]) Seq() seq.Sequence {
+	if s.Length() == 0 {
+		return nil
+	}
+	return &vectorSequence[T]{
+		vec: s,
+	}
+}
+
+// Equal compares each value of the slice to determine if the slice is
+// equal to the one passed in.
+func (s *SliceOf[T]) Equal(o interface{}) bool {
+	other, ok := o.(*SliceOf[T])
+	if !ok {
+		return false
+	}
+	if s.Length() != other.Length() {
+		return false
+	}
+	for i := 0; i < s.Length(); i++ {
+		val := s.At(i)
+		if !dyn.Equal(other.At(i), val) {
+			return false
+		}
+	}
+	return true
+}
+
+// String coverts the slice to a string representation.
+func (s *SliceOf[T]) String() string {
+	return vectorString[T](s)
+}
+
+// Range calls do on each element of the slice, in order, until do
+// returns false. The index passed to do is relative to the start of
+// the slice.
+func (s *SliceOf[T]) Range(do func(idx int, value T) bool) {
+	for i := s.start; i < s.end; {
+		arr := s.vector.arrayFor(i)
+		for j := 0; j < len(arr) && i < s.end; j++ {
+			if !do(i-s.start, arr[j]) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// Apply takes an arbitrary number of arguments and returns the
+// value At the first argument.  Apply allows a slice to be called
+// as a function by the 'dyn' library.
+func (s *SliceOf[T]) Apply(args ...interface{}) interface{} {
+	idx := args[0].(int)
+	return s.At(idx)
+}
+
+// Reduce is a fast mechanism for reducing a typed vector, transient
+// vector, or slice. fn is called with the accumulated result and
+// each element in turn.
+func Reduce[T any, R any](
+	v interface{ Range(func(int, T) bool) },
+	fn func(res R, value T) R,
+	init R,
+) R {
+	res := init
+	v.Range(func(_ int, e T) bool {
+		res = fn(res, e)
+		return true
+	})
+	return res
+}
+
+// vnode is a node of the trie. Leaves hold elements in array and
+// internal nodes hold children in nodes; relaxed internal nodes also
+// hold the cumulative sizes of their children. A node may be changed
+// in place by the transient whose edit it has. Nodes made by
+// persistent operations have a nil edit. A node of a loaded vector
+// that has not been read holds only lazy; children are read through
+// child so that it is never used in place of the node it stands for.
+type vnode[T any] struct {
+	nodes *[width]*vnode[T]
+	array *[width]T
+	sizes *[width]int
+	edit  *int32
+	lazy  *lazyNode[T]
+}
+
+// child returns child i of n, reading it if it has not been.
+func (n *vnode[T]) child(i int) *vnode[T] {
+	return n.nodes[i].resolve()
+}
+
+// resolve returns the node n stands in for, or n itself.
+func (n *vnode[T]) resolve() *vnode[T] {
+	if n.lazy == nil {
+		return n
+	}
+	return n.lazy.load()
+}
+
+func (n *vnode[T]) clone() *vnode[T] {
+	out := &vnode[T]{edit: n.edit}
+	if n.nodes != nil {
+		out.nodes = copyArray(n.nodes)
+	}
+	if n.array != nil {
+		out.array = copyArray(n.array)
+	}
+	if n.sizes != nil {
+		out.sizes = copyArray(n.sizes)
+	}
+	return out
+}
+
+// editableBy returns n if the transient with edit may change it and a
+// copy that it may change otherwise. Persistent operations pass a nil
+// edit and always copy.
+func (n *vnode[T]) editableBy(edit *int32) *vnode[T] {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	out := n.clone()
+	if edit != nil {
+		out.edit = edit
+	}
+	return out
+}
+
+func vnodeNew[T any](edit *int32) *vnode[T] {
+	return &vnode[T]{edit: edit, nodes: new([width]*vnode[T])}
+}
+
+func vnodeNewFromArray[T any](edit *int32, a *[width]T) *vnode[T] {
+	return &vnode[T]{edit: edit, array: a}
+}
+
+func vnodeNewFromSlice[T any](edit *int32, s []T) *vnode[T] {
+	var a [width]T
+	copy(a[:], s)
+	return vnodeNewFromArray(edit, &a)
+}
+
+func newPath[T any](edit *int32, level uint, node *vnode[T]) *vnode[T] {
+	if level == 0 {
+		return node
+	}
+	ret := vnodeNew[T](edit)
+	ret.nodes[0] = newPath(edit, level-bits, node)
+	return ret
+}
+
+func copyArray[E any](a *[width]E) *[width]E {
+	tmp := *a
+	return &tmp
+}
+
+func copySlice[E any](a []E) []E {
+	tmp := make([]E, len(a))
+	copy(tmp, a)
+	return tmp
+}
+
+func appendExact[E any](a []E, vs ...E) []E {
+	tmp := make([]E, len(a)+len(vs))
+	copy(tmp, a)
+	copy(tmp[len(a):], vs)
+	return tmp
+}
+
+type vectorSequence[T any] struct {
+	vec interface {
+		At(int) T
+		Length() int
+	}
+	idx int
+}
+
+func (seq *vectorSequence[T]) First() interface{} {
+	return seq.vec.At(seq.idx)
+}
+
+func (seq *vectorSequence[T]) Next() seq.Sequence {
+	if seq.idx+1 == seq.vec.Length() {
+		return nil
+	}
+	return &vectorSequence[T]{
+		vec: seq.vec,
+		idx: seq.idx + 1,
+	}
+}
+
+func (s *vectorSequence[T]) String() string {
+	return seq.ConvertToString(s)
+}
+
+func vectorString[T any](v interface {
+	At(int) T
+	Length() int
+}) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprint(buf, "[")
+	if v.Length() != 0 {
+		fmt.Fprint(buf, v.At(0))
+	}
+	for i := 1; i < v.Length(); i++ {
+		fmt.Fprintf(buf, " %v", v.At(i))
+	}
+	fmt.Fprint(buf, "]")
+	return buf.String()
+}
@@ -0,0 +1,654 @@
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"jsouthworth.net/go/immutable/persist"
+)
+
+func BenchmarkVectorOfAppend(b *testing.B) {
+	b.ReportAllocs()
+	v := EmptyOf[int]()
+	for i := 0; i < b.N; i++ {
+		v = v.Append(i)
+	}
+}
+
+func BenchmarkTVectorOfAppend(b *testing.B) {
+	b.ReportAllocs()
+	v := EmptyOf[int]().AsTransient()
+	for i := 0; i < b.N; i++ {
+		v = v.Append(i)
+	}
+}
+
+func BenchmarkVectorOfRange(b *testing.B) {
+	v := EmptyOf[int]().AsTransient()
+	for i := 0; i < 100000; i++ {
+		v = v.Append(i)
+	}
+	pv := v.AsPersistent()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pv.Range(func(_ int, _ int) bool {
+			return true
+		})
+	}
+}
+
+func TestVectorOfNewMatchesInput(t *testing.T) {
+	f := func(elems []int) bool {
+		v := NewOf(elems...)
+		if v.Length() != len(elems) {
+			return false
+		}
+		for i, elem := range elems {
+			if v.At(i) != elem {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfAppendMatchesTransient(t *testing.T) {
+	f := func(elems []int) bool {
+		p := EmptyOf[int]()
+		tr := EmptyOf[int]().AsTransient()
+		for _, elem := range elems {
+			p = p.Append(elem)
+			tr = tr.Append(elem)
+		}
+		return p.Equal(tr.AsPersistent())
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfAssocPreservesOriginal(t *testing.T) {
+	f := func(elems []int, val int) bool {
+		if len(elems) == 0 {
+			return true
+		}
+		v := NewOf(elems...)
+		idx := len(elems) / 2
+		nv := v.Assoc(idx, val)
+		return v.At(idx) == elems[idx] && nv.At(idx) == val
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfPopShrinks(t *testing.T) {
+	f := func(elems []int) bool {
+		v := NewOf(elems...)
+		for i := len(elems) - 1; i >= 0; i-- {
+			if v.At(i) != elems[i] {
+				return false
+			}
+			v = v.Pop()
+		}
+		return v.Length() == 0
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfRange(t *testing.T) {
+	f := func(elems []int) bool {
+		got := make([]int, 0, len(elems))
+		NewOf(elems...).Range(func(i int, v int) bool {
+			if i != len(got) {
+				return false
+			}
+			got = append(got, v)
+			return true
+		})
+		if len(got) != len(elems) {
+			return false
+		}
+		for i := range elems {
+			if got[i] != elems[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfRangeStops(t *testing.T) {
+	v := EmptyOf[int]()
+	for i := 0; i < 100; i++ {
+		v = v.Append(i)
+	}
+	count := 0
+	v.Range(func(i int, _ int) bool {
+		count++
+		return i < 40
+	})
+	if count != 41 {
+		t.Fatalf("expected Range to stop after 41 calls, got %d", count)
+	}
+}
+
+func TestTVectorOfRange(t *testing.T) {
+	f := func(elems []int) bool {
+		tv := EmptyOf[int]().AsTransient()
+		for _, elem := range elems {
+			tv = tv.Append(elem)
+		}
+		got := 0
+		ok := true
+		tv.Range(func(i int, v int) bool {
+			ok = ok && elems[i] == v
+			got++
+			return true
+		})
+		return ok && got == len(elems)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSliceOfRange(t *testing.T) {
+	f := func(elems []int, a, b uint8) bool {
+		start, end := int(a), int(b)
+		if start > end {
+			start, end = end, start
+		}
+		if end > len(elems) {
+			return true
+		}
+		s := NewOf(elems...).Slice(start, end)
+		got := 0
+		ok := true
+		s.Range(func(i int, v int) bool {
+			ok = ok && elems[start+i] == v && s.At(i) == v
+			got++
+			return true
+		})
+		return ok && got == end-start
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfReduce(t *testing.T) {
+	f := func(elems []int) bool {
+		exp := 0
+		for _, elem := range elems {
+			exp += elem
+		}
+		sum := func(res, v int) int { return res + v }
+		return Reduce(NewOf(elems...), sum, 0) == exp
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfInsertDelete(t *testing.T) {
+	f := func(elems []int, val int) bool {
+		if len(elems) == 0 {
+			return true
+		}
+		v := NewOf(elems...)
+		idx := len(elems) / 2
+		iv := v.Insert(idx, val)
+		if iv.Length() != len(elems)+1 || iv.At(idx) != val {
+			return false
+		}
+		return iv.Delete(idx).Equal(v)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfFind(t *testing.T) {
+	v := NewOf("a", "b", "c")
+	if val, ok := v.Find(1); !ok || val != "b" {
+		t.Fatal("expected to find b at 1")
+	}
+	if val, ok := v.Find(3); ok || val != "" {
+		t.Fatal("expected out of bounds find to return zero value")
+	}
+}
+
+func TestVectorOfPersistRoundTrip(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	r := persist.NewReader(store)
+	f := func(elems []int) bool {
+		v := NewOf(elems...)
+		h, err := v.Persist(w)
+		if err != nil {
+			return false
+		}
+		got, err := LoadOf[int](r, h)
+		if err != nil || !got.Equal(v) {
+			return false
+		}
+		return got.Append(1).Equal(v.Append(1)) &&
+			got.AsTransient().Append(1).AsPersistent().Equal(v.Append(1))
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfPersistHistory(t *testing.T) {
+	store := persist.NewMemStore()
+	w := persist.NewWriter(store)
+	v := EmptyOf[int]().AsTransient()
+	for i := 0; i < 100000; i++ {
+		v.Append(i)
+	}
+	versions := []*VectorOf[int]{v.AsPersistent()}
+	hashes := make([]persist.Hash, 0, 1001)
+	h, err := versions[0].Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes = append(hashes, h)
+	full := store.Size()
+	for i := 1; i <= 1000; i++ {
+		prev := versions[len(versions)-1]
+		next := prev.Assoc(i*97, -i)
+		if i%10 == 0 {
+			next = next.Append(i)
+		}
+		h, err := next.Persist(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, next)
+		hashes = append(hashes, h)
+	}
+	// Each version only adds the nodes on the path to its change,
+	// a small fraction of the whole.
+	if perVersion := (store.Size() - full) / 1000; perVersion > full/100 {
+		t.Fatalf("each version added %d bytes to a %d byte vector",
+			perVersion, full)
+	}
+	r := persist.NewReader(store)
+	for i, h := range hashes {
+		got, err := LoadOf[int](r, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(versions[i]) {
+			t.Fatalf("version %d did not round trip", i)
+		}
+	}
+	untyped := New(1, "two", 3.0)
+	h, err = untyped.Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(r, h)
+	if err != nil || !got.Equal(untyped) {
+		t.Fatalf("got %v, %v expected %v", got, err, untyped)
+	}
+}
+
+// countingStore counts the reads made from a store and fails them
+// with err once it is set.
+type countingStore struct {
+	persist.Store
+	gets int
+	err  error
+}
+
+func (s *countingStore) Get(h persist.Hash) ([]byte, error) {
+	s.gets++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.Get(h)
+}
+
+func TestVectorOfLoadLazily(t *testing.T) {
+	const n = 100000
+	store := &countingStore{Store: persist.NewMemStore()}
+	w := persist.NewWriter(store)
+	v := EmptyOf[int]().AsTransient()
+	for i := 0; i < n; i++ {
+		v.Append(i)
+	}
+	h, err := v.AsPersistent().Persist(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.gets = 0
+	got, err := LoadOf[int](persist.NewReader(store), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.gets != 2 || got.Length() != n {
+		t.Fatalf("loading read %d nodes", store.gets)
+	}
+	if e := got.At(12345); e != 12345 {
+		t.Fatalf("At(12345) = %d", e)
+	}
+	if store.gets > 5 {
+		t.Fatalf("a lookup read %d nodes", store.gets-2)
+	}
+
+	// Writing an edit back to the store only writes the changed path.
+	before := store.gets
+	edited := got.Assoc(54321, -1).Append(n)
+	if _, err := edited.Persist(w); err != nil {
+		t.Fatal(err)
+	}
+	if reads := store.gets - before; reads > 8 {
+		t.Fatalf("persisting an edit read %d nodes", reads)
+	}
+
+	// The loaded nodes behave like any others.
+	a, b := got.SplitAt(n / 3)
+	joined := b.Concat(a)
+	if err := checkTree(joined); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i += 997 {
+		if e := joined.At(i); e != (i+n/3)%n {
+			t.Fatalf("At(%d) = %d", i, e)
+		}
+	}
+
+	// A node that can't be read panics with a ReadError.
+	fresh, err := LoadOf[int](persist.NewReader(store), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.err = errors.New("store unavailable")
+	err = func() (err error) {
+		defer persist.Recover(&err)
+		fresh.At(12345)
+		return nil
+	}()
+	var re *persist.ReadError
+	if !errors.As(err, &re) || !errors.Is(err, store.err) {
+		t.Fatalf("expected a ReadError, got %v", err)
+	}
+}
+
+// checkTree verifies the structure of v: the sizes of relaxed nodes
+// match their children, regular nodes have full children but for the
+// last and the tail is not empty.
+func checkTree[T any](v *VectorOf[T]) error {
+	if v.count > 0 && len(v.tail) == 0 {
+		return fmt.Errorf("empty tail")
+	}
+	if v.tailOffset() == 0 {
+		return nil
+	}
+	if v.shift > bits && v.root.children(v.shift, v.tailOffset()) < 2 {
+		return fmt.Errorf("root at shift %d has one child", v.shift)
+	}
+	return checkNode(v.root, v.shift, v.tailOffset())
+}
+
+func checkNode[T any](n *vnode[T], shift uint, size int) error {
+	if shift == 0 {
+		if n.array == nil || size < 1 || size > width {
+			return fmt.Errorf("bad leaf of %d elements", size)
+		}
+		return nil
+	}
+	k := n.children(shift, size)
+	if k < 1 || k > width || size > width<<shift {
+		return fmt.Errorf("node at shift %d with %d children holds %d",
+			shift, k, size)
+	}
+	for i, child := range n.nodes {
+		if (i < k) != (child != nil) {
+			return fmt.Errorf("node at shift %d has %d children but slot %d is %v",
+				shift, k, i, child)
+		}
+	}
+	if n.sizes != nil && n.sizes[k-1] != size {
+		return fmt.Errorf("relaxed node holds %d, expected %d",
+			n.sizes[k-1], size)
+	}
+	for i := 0; i < k; i++ {
+		cs := n.childSize(shift, size, i)
+		if cs < 1 || cs > 1<<shift {
+			return fmt.Errorf("child %d at shift %d holds %d", i, shift, cs)
+		}
+		if err := checkNode(n.child(i), shift-bits, cs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFromSliceOf(t *testing.T) {
+	f := func(a []int, n uint16) bool {
+		for i := 0; i < int(n); i++ {
+			a = append(a, i)
+		}
+		got := FromSliceOf(a)
+		exp := EmptyOf[int]().AsTransient()
+		for _, elem := range a {
+			exp.Append(elem)
+		}
+		if err := checkTree(got); err != nil {
+			t.Log(err)
+			return false
+		}
+		if len(a) > 0 {
+			// The vector does not share the slice.
+			a[0]++
+		}
+		return got.Equal(exp.AsPersistent()) &&
+			got.Append(-1).At(got.Length()) == -1
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+	if FromSliceOf([]interface{}(nil)) != EmptyOf[interface{}]() {
+		t.Fatal("expected the empty vector")
+	}
+}
+
+func TestVectorOfConcat(t *testing.T) {
+	f := func(a, b []int, n, m uint16) bool {
+		// Pad the inputs so that trees of different heights are
+		// joined.
+		for i := 0; i < int(n); i++ {
+			a = append(a, i)
+		}
+		for i := 0; i < int(m%2048); i++ {
+			b = append(b, -i)
+		}
+		got := NewOf(a...).Concat(NewOf(b...))
+		exp := append(append([]int(nil), a...), b...)
+		if err := checkTree(got); err != nil {
+			t.Log(err)
+			return false
+		}
+		return got.Equal(NewOf(exp...)) &&
+			got.Append(1).Equal(NewOf(append(exp, 1)...))
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfSplitAt(t *testing.T) {
+	f := func(elems []int, n uint16, at uint16) bool {
+		for i := 0; i < int(n); i++ {
+			elems = append(elems, i)
+		}
+		i := int(at) % (len(elems) + 1)
+		l, r := NewOf(elems...).SplitAt(i)
+		if err := checkTree(l); err != nil {
+			t.Log(err)
+			return false
+		}
+		if err := checkTree(r); err != nil {
+			t.Log(err)
+			return false
+		}
+		return l.Equal(NewOf(elems[:i]...)) && r.Equal(NewOf(elems[i:]...)) &&
+			l.Concat(r).Equal(NewOf(elems...))
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorOfSubVector(t *testing.T) {
+	f := func(elems []int, a, b uint8) bool {
+		start, end := int(a), int(b)
+		if start > end {
+			start, end = end, start
+		}
+		if end > len(elems) {
+			return true
+		}
+		sub := NewOf(elems...).SubVector(start, end)
+		return checkTree(sub) == nil &&
+			sub.Equal(NewOf(elems[start:end]...))
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSliceOfMaterialize(t *testing.T) {
+	f := func(elems []int, a, b uint8) bool {
+		start, end := int(a), int(b)
+		if start > end {
+			start, end = end, start
+		}
+		if end > len(elems) {
+			return true
+		}
+		v := NewOf(elems...).Slice(start, end).Materialize()
+		return checkTree(v) == nil && v.Equal(NewOf(elems[start:end]...))
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSliceOfCompacts(t *testing.T) {
+	v := EmptyOf[int]().AsTransient()
+	for i := 0; i < 100000; i++ {
+		v.Append(i)
+	}
+	s := v.AsPersistent().Slice(0, 100000)
+	for i := 0; s.Length() > 0; i++ {
+		if s.At(0) != i {
+			t.Fatalf("got %d at the front, expected %d", s.At(0), i)
+		}
+		if s.start >= compactAt {
+			t.Fatalf("slice [%d:%d] was not compacted", s.start, s.end)
+		}
+		if s.start == 0 && i > 0 && s.vector.Length() != s.end {
+			t.Fatalf("compacted slice [%d:%d] kept %d elements",
+				s.start, s.end, s.vector.Length())
+		}
+		s = s.Slice(1, s.Length())
+		if i%1000 == 0 {
+			s = s.Append(-i).Slice(0, s.Length()-1)
+		}
+	}
+}
+
+// TestVectorOfRelaxedOps applies random edits to a vector and a slice
+// and compares them. Inserting, deleting and joining leave relaxed
+// nodes throughout the tree that the other operations must handle.
+func TestVectorOfRelaxedOps(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	v := EmptyOf[int]()
+	var exp []int
+	for step := 0; step < 2000; step++ {
+		n := len(exp)
+		switch op := rng.Intn(8); {
+		case op == 0 && n > 0:
+			i := rng.Intn(n)
+			v = v.Delete(i)
+			exp = append(exp[:i:i], exp[i+1:]...)
+		case op == 1 && n > 0:
+			i := rng.Intn(n)
+			v = v.Insert(i, step)
+			exp = append(exp[:i:i], append([]int{step}, exp[i:]...)...)
+		case op == 2:
+			m := rng.Intn(1000)
+			o := EmptyOf[int]().AsTransient()
+			for j := 0; j < m; j++ {
+				o.Append(-j)
+				exp = append(exp, -j)
+			}
+			v = v.Concat(o.AsPersistent())
+		case op == 3 && n > 0:
+			i := rng.Intn(n + 1)
+			l, r := v.SplitAt(i)
+			v = r.Concat(l)
+			exp = append(append([]int(nil), exp[i:]...), exp[:i]...)
+		case op == 4 && n > 0:
+			v = v.Pop()
+			exp = exp[:n-1]
+		case op == 5 && n > 0:
+			i := rng.Intn(n)
+			v = v.Assoc(i, step)
+			exp[i] = step
+		case op == 6 && n > 0:
+			i, j := rng.Intn(n), rng.Intn(n)
+			tv := v.AsTransient().Insert(i, step).Delete(j)
+			exp = append(exp[:i:i], append([]int{step}, exp[i:]...)...)
+			exp = append(exp[:j:j], exp[j+1:]...)
+			for k := 0; k < 40; k++ {
+				tv.Append(k)
+				exp = append(exp, k)
+			}
+			for k := 0; k < 50 && tv.Length() > 0; k++ {
+				tv.Pop()
+				exp = exp[:len(exp)-1]
+			}
+			if tv.Length() > 0 {
+				tv.Assoc(0, step)
+				exp[0] = step
+			}
+			v = tv.AsPersistent()
+		default:
+			v = v.Append(step)
+			exp = append(exp, step)
+		}
+		if err := checkTree(v); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		if v.Length() != len(exp) {
+			t.Fatalf("step %d: length %d, expected %d",
+				step, v.Length(), len(exp))
+		}
+		if step%50 == 0 {
+			for i, x := range v.AsNative() {
+				if exp[i] != x || v.At(i) != x {
+					t.Fatalf("step %d: element %d is %d, expected %d",
+						step, i, x, exp[i])
+				}
+			}
+		}
+	}
+}